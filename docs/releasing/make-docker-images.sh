@@ -30,18 +30,43 @@ while IFS= read -d $'\0' -r dir; do
     # build image
     svcname="$(basename "${dir}")"
     builddir="${dir}"
+    dockerfile="Dockerfile"
     #PR 516 moved cartservice build artifacts one level down to src
     if [ $svcname == "cartservice" ]
     then
         builddir="${dir}/src"
     fi
+    # Go services using the shared money module are built from src/.
+    if [ -f "${dir}/go.mod" ] && grep -q '=> ../money' "${dir}/go.mod"
+    then
+        builddir="${dir}/.."
+        dockerfile="${svcname}/Dockerfile"
+    fi
+    # Shared libraries (e.g. src/money) have no image.
+    if [ ! -f "${builddir}/${dockerfile}" ]
+    then
+        continue
+    fi
     image="${REPO_PREFIX}/$svcname:$TAG"
     image_with_sample_public_image_tag="${REPO_PREFIX}/$svcname:sample-public-image-$TAG"
     (
         cd "${builddir}"
         log "Building (and pushing) image on Google Cloud Build: ${image}"
         log "Submitting Cloud Build job..."
-        build_id=$(gcloud builds submit --project=${PROJECT_ID} --tag=${image} --async --format="value(id)")
+        if [ "${dockerfile}" == "Dockerfile" ]
+        then
+            build_id=$(gcloud builds submit --project=${PROJECT_ID} --tag=${image} --async --format="value(id)")
+        else
+            build_config="$(mktemp)"
+            cat > "${build_config}" <<EOF
+steps:
+- name: gcr.io/cloud-builders/docker
+  args: ["build", "-t", "${image}", "-f", "${dockerfile}", "."]
+images: ["${image}"]
+EOF
+            build_id=$(gcloud builds submit --project=${PROJECT_ID} --config="${build_config}" --async --format="value(id)")
+            rm -f "${build_config}"
+        fi
         log "Build submitted with ID: ${build_id}. Waiting for completion..."
         while true; do
             status=$(gcloud builds describe ${build_id} --project=${PROJECT_ID} --format="value(status)")
@@ -0,0 +1,378 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backendtest serves in-memory fakes of the hipstershop backend
+// services over an in-process connection, for tests of the Go services.
+//
+// The fakes have no generated code of their own. They serve the services that
+// the genproto package registers, and read and build its messages through
+// protobuf reflection. Handle and
+// Calls are typed with the caller's messages:
+//
+//	srv := backendtest.NewServer(t)
+//	srv.SetProducts(&pb.Product{Id: "mug", PriceUsd: price})
+//	backendtest.Handle(srv, "PaymentService/Charge",
+//		func(ctx context.Context, req *pb.ChargeRequest) (*pb.ChargeResponse, error) {
+//			return nil, status.Error(codes.InvalidArgument, "card declined")
+//		})
+//	client := pb.NewCartServiceClient(srv.Conn())
+//
+// Methods are named "Service/Method". Latency and errors can be injected for
+// a method or for every method of a service.
+//
+// The fakes can also stand in for the services outside tests, by passing
+// NewServer a TB that is not a test and serving them on a listener with Serve.
+package backendtest
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/cart"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/exchange"
+)
+
+// protoFile is the file the services are declared in, as registered by the
+// genproto package.
+const protoFile = "demo.proto"
+
+// handler serves a unary method.
+type handler func(ctx context.Context, req proto.Message) (proto.Message, error)
+
+// method is a method of a registered service.
+type method struct {
+	desc    protoreflect.MethodDescriptor
+	in, out protoreflect.MessageType
+}
+
+// fault is the latency and errors injected into a method or service.
+type fault struct {
+	latency time.Duration
+	err     error   // returned by every call
+	next    []error // returned by the next calls, before err
+}
+
+// TB is the part of testing.TB the server uses.
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// Server serves fakes of the backend services. Its methods are safe for
+// concurrent use.
+type Server struct {
+	// Cart holds the carts of the CartService fake.
+	Cart *cart.Store
+	// Currency converts amounts for the CurrencyService fake.
+	Currency *exchange.Converter
+
+	tb      TB
+	srv     *grpc.Server
+	conn    *grpc.ClientConn
+	methods map[string]method
+
+	mu       sync.Mutex
+	handlers map[string]handler
+	faults   map[string]*fault
+	calls    map[string][]proto.Message
+	catalog  catalog
+	stock    inventory
+	counter  int
+}
+
+// NewServer starts a server with every service registered in the caller's
+// demo.proto. CartService, CurrencyService, PaymentService, EmailService,
+// RecommendationService, AdService, ShippingService, ProductCatalogService
+// and InventoryService are faked; methods of other services fail with
+// UNIMPLEMENTED until they are given a handler. The server is stopped when
+// the test ends.
+func NewServer(tb TB) *Server {
+	tb.Helper()
+	fd, err := protoregistry.GlobalFiles.FindFileByPath(protoFile)
+	if err != nil {
+		tb.Fatalf("backendtest: %s is not registered, import the genproto package: %v", protoFile, err)
+	}
+	s := &Server{
+		Cart:     cart.NewStore(),
+		Currency: exchange.NewConverter(exchange.DefaultRates(), 0),
+		tb:       tb,
+		methods:  make(map[string]method),
+		handlers: make(map[string]handler),
+		faults:   make(map[string]*fault),
+		calls:    make(map[string][]proto.Message),
+		catalog:  newCatalog(),
+		stock:    newInventory(),
+	}
+
+	s.srv = grpc.NewServer()
+	services := fd.Services()
+	for i := 0; i < services.Len(); i++ {
+		s.srv.RegisterService(s.serviceDesc(services.Get(i)), nil)
+	}
+	s.registerFakes()
+
+	lis := bufconn.Listen(1 << 20)
+	go s.srv.Serve(lis)
+	tb.Cleanup(s.srv.Stop)
+
+	s.conn, err = grpc.NewClient("passthrough:///backendtest",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		tb.Fatalf("backendtest: failed to connect: %v", err)
+	}
+	tb.Cleanup(func() { s.conn.Close() })
+	return s
+}
+
+// Conn returns a connection to the server, on which every service is served.
+func (s *Server) Conn() *grpc.ClientConn { return s.conn }
+
+// Serve also serves the fakes on lis, until the server is stopped.
+func (s *Server) Serve(lis net.Listener) error { return s.srv.Serve(lis) }
+
+// serviceDesc describes sd to gRPC, dispatching every method to s.
+func (s *Server) serviceDesc(sd protoreflect.ServiceDescriptor) *grpc.ServiceDesc {
+	desc := &grpc.ServiceDesc{
+		ServiceName: string(sd.FullName()),
+		HandlerType: (*interface{})(nil),
+		Metadata:    protoFile,
+	}
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		name := string(sd.Name()) + "/" + string(md.Name())
+		m := method{desc: md, in: s.messageType(md.Input()), out: s.messageType(md.Output())}
+		s.methods[name] = m
+		switch {
+		case md.IsStreamingClient():
+			// No hipstershop service has client streams.
+			continue
+		case md.IsStreamingServer():
+			desc.Streams = append(desc.Streams, grpc.StreamDesc{
+				StreamName:    string(md.Name()),
+				ServerStreams: true,
+				Handler: func(_ interface{}, stream grpc.ServerStream) error {
+					req := m.in.New().Interface()
+					if err := stream.RecvMsg(req); err != nil {
+						return err
+					}
+					if err := s.begin(stream.Context(), name, req); err != nil {
+						return err
+					}
+					return s.serveStream(name, req, stream)
+				},
+			})
+		default:
+			desc.Methods = append(desc.Methods, grpc.MethodDesc{
+				MethodName: string(md.Name()),
+				Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+					req := m.in.New().Interface()
+					if err := dec(req); err != nil {
+						return nil, err
+					}
+					return s.call(ctx, name, req)
+				},
+			})
+		}
+	}
+	return desc
+}
+
+func (s *Server) messageType(md protoreflect.MessageDescriptor) protoreflect.MessageType {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(md.FullName())
+	if err != nil {
+		s.tb.Fatalf("backendtest: message %s is not registered: %v", md.FullName(), err)
+	}
+	return mt
+}
+
+// call serves a unary method.
+func (s *Server) call(ctx context.Context, name string, req proto.Message) (proto.Message, error) {
+	if err := s.begin(ctx, name, req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	h := s.handlers[name]
+	s.mu.Unlock()
+	if h == nil {
+		return nil, status.Errorf(codes.Unimplemented, "backendtest: %s has no handler", name)
+	}
+	return h(ctx, req)
+}
+
+// begin records a call and applies the faults injected into it.
+func (s *Server) begin(ctx context.Context, name string, req proto.Message) error {
+	s.mu.Lock()
+	s.calls[name] = append(s.calls[name], req)
+	latency, err := s.faultLocked(name)
+	s.mu.Unlock()
+
+	if latency > 0 {
+		t := time.NewTimer(latency)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	return err
+}
+
+// faultLocked returns the latency and error of the next call of a method.
+// Faults of the method take precedence over those of its service. s.mu must
+// be held.
+func (s *Server) faultLocked(name string) (time.Duration, error) {
+	service, _, _ := strings.Cut(name, "/")
+	var latency time.Duration
+	var err error
+	for _, f := range []*fault{s.faults[service], s.faults[name]} {
+		if f == nil {
+			continue
+		}
+		if f.latency > 0 {
+			latency = f.latency
+		}
+		if f.err != nil {
+			err = f.err
+		}
+	}
+	for _, f := range []*fault{s.faults[name], s.faults[service]} {
+		if f != nil && len(f.next) > 0 {
+			err, f.next = f.next[0], f.next[1:]
+			break
+		}
+	}
+	return latency, err
+}
+
+// faultFor returns the faults of a method or service, which must exist.
+// s.mu must be held.
+func (s *Server) faultFor(name string) *fault {
+	if _, ok := s.methods[name]; !ok && !s.isService(name) {
+		s.tb.Fatalf("backendtest: no method or service %q", name)
+	}
+	f := s.faults[name]
+	if f == nil {
+		f = &fault{}
+		s.faults[name] = f
+	}
+	return f
+}
+
+func (s *Server) isService(name string) bool {
+	for m := range s.methods {
+		if strings.HasPrefix(m, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// SetLatency delays every call of a method, or of every method of a service,
+// by d. Calls whose deadline passes first fail with DEADLINE_EXCEEDED.
+func (s *Server) SetLatency(name string, d time.Duration) {
+	s.tb.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faultFor(name).latency = d
+}
+
+// SetError makes every call of a method, or of every method of a service,
+// fail with err, which should be a gRPC status error. A nil err clears it.
+func (s *Server) SetError(name string, err error) {
+	s.tb.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faultFor(name).err = err
+}
+
+// FailNext makes the next call of a method, or of any method of a service,
+// fail with err. Failures queue up, so calling FailNext twice fails the next
+// two calls.
+func (s *Server) FailNext(name string, err error) {
+	s.tb.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.faultFor(name)
+	f.next = append(f.next, err)
+}
+
+// Handle serves a unary method with h instead of its fake. Req and Resp are
+// the caller's generated messages for the method.
+func Handle[Req, Resp proto.Message](s *Server, name string, h func(context.Context, Req) (Resp, error)) {
+	s.tb.Helper()
+	m := s.checkMethod(name, *new(Req))
+	if m.desc.IsStreamingServer() {
+		s.tb.Fatalf("backendtest: Handle does not support the streaming method %s", name)
+	}
+	if want, got := m.out.Descriptor().FullName(), (*new(Resp)).ProtoReflect().Descriptor().FullName(); got != want {
+		s.tb.Fatalf("backendtest: %s returns %s, not %s", name, want, got)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[name] = func(ctx context.Context, req proto.Message) (proto.Message, error) {
+		resp, err := h(ctx, req.(Req))
+		if err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// Calls returns the requests the server received for a method, in order,
+// including those that failed.
+func Calls[Req proto.Message](s *Server, name string) []Req {
+	s.tb.Helper()
+	s.checkMethod(name, *new(Req))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Req, len(s.calls[name]))
+	for i, req := range s.calls[name] {
+		out[i] = req.(Req)
+	}
+	return out
+}
+
+// checkMethod returns the named method and checks that req is its request
+// message.
+func (s *Server) checkMethod(name string, req proto.Message) method {
+	s.tb.Helper()
+	m, ok := s.methods[name]
+	if !ok {
+		s.tb.Fatalf("backendtest: no method %q", name)
+	}
+	if want, got := m.in.Descriptor().FullName(), req.ProtoReflect().Descriptor().FullName(); got != want {
+		s.tb.Fatalf("backendtest: %s takes %s, not %s", name, want, got)
+	}
+	if want := m.in.Zero().Interface(); reflect.TypeOf(want) != reflect.TypeOf(req) {
+		s.tb.Fatalf("backendtest: %s takes %T, not %T", name, want, req)
+	}
+	return m
+}
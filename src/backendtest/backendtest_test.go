@@ -0,0 +1,207 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backendtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+)
+
+func usd(units int64, nanos int32) *pb.Money {
+	return &pb.Money{CurrencyCode: "USD", Units: units, Nanos: nanos}
+}
+
+func TestFakes(t *testing.T) {
+	s := NewServer(t)
+	s.SetProducts(
+		&pb.Product{Id: "mug", Name: "Mug", Description: "For coffee", PriceUsd: usd(8, 990000000)},
+		&pb.Product{Id: "shirt", Name: "Shirt", PriceUsd: usd(20, 0), Variants: []*pb.ProductVariant{{Sku: "shirt-s"}, {Sku: "shirt-l"}}},
+	)
+	s.SetStock("mug", 1)
+	ctx := context.Background()
+	conn := s.Conn()
+
+	cartClient := pb.NewCartServiceClient(conn)
+	if _, err := cartClient.AddItem(ctx, &pb.AddItemRequest{UserId: "u", Item: &pb.CartItem{ProductId: "shirt", VariantSku: "shirt-s", Quantity: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	cart, err := cartClient.GetCart(ctx, &pb.GetCartRequest{UserId: "u"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&pb.Cart{UserId: "u", Items: []*pb.CartItem{{ProductId: "shirt", VariantSku: "shirt-s", Quantity: 2}}}); !proto.Equal(cart, want) {
+		t.Errorf("GetCart() = %v, want %v", cart, want)
+	}
+	if _, err := cartClient.UpdateItemQuantity(ctx, &pb.UpdateItemQuantityRequest{UserId: "u", ProductId: "mug", Quantity: 1}); status.Code(err) != codes.NotFound {
+		t.Errorf("UpdateItemQuantity of a missing item: %v, want NotFound", err)
+	}
+
+	eur, err := pb.NewCurrencyServiceClient(conn).Convert(ctx, &pb.CurrencyConversionRequest{From: usd(10, 0), ToCode: "EUR"})
+	if err != nil || eur.GetCurrencyCode() != "EUR" || eur.GetUnits() == 0 {
+		t.Errorf("Convert() = %v, %v", eur, err)
+	}
+	if _, err := pb.NewCurrencyServiceClient(conn).Convert(ctx, &pb.CurrencyConversionRequest{From: usd(10, 0), ToCode: "XYZ"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Convert() to XYZ: %v, want InvalidArgument", err)
+	}
+
+	catalogClient := pb.NewProductCatalogServiceClient(conn)
+	if p, err := catalogClient.GetProduct(ctx, &pb.GetProductRequest{Id: "mug"}); err != nil || p.GetName() != "Mug" {
+		t.Errorf("GetProduct(mug) = %v, %v", p, err)
+	}
+	if _, err := catalogClient.GetProduct(ctx, &pb.GetProductRequest{Id: "hat"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetProduct(hat): %v, want NotFound", err)
+	}
+	if res, _ := catalogClient.SearchProducts(ctx, &pb.SearchProductsRequest{Query: "COFFEE"}); len(res.GetResults()) != 1 {
+		t.Errorf("SearchProducts(COFFEE) = %v", res)
+	}
+	if recs, _ := pb.NewRecommendationServiceClient(conn).ListRecommendations(ctx, &pb.ListRecommendationsRequest{ProductIds: []string{"mug"}}); len(recs.GetProductIds()) != 1 || recs.GetProductIds()[0] != "shirt" {
+		t.Errorf("ListRecommendations() = %v", recs)
+	}
+
+	quote, err := pb.NewShippingServiceClient(conn).GetQuote(ctx, &pb.GetQuoteRequest{Items: cart.GetItems()})
+	if err != nil || !proto.Equal(quote.GetCostUsd(), usd(8, 990000000)) {
+		t.Errorf("GetQuote() = %v, %v", quote, err)
+	}
+}
+
+func TestInventory(t *testing.T) {
+	s := NewServer(t)
+	s.SetStock("mug", 2)
+	inventory := pb.NewInventoryServiceClient(s.Conn())
+	ctx := context.Background()
+
+	reserve := func(quantity int32) (*pb.ReserveStockResponse, error) {
+		return inventory.ReserveStock(ctx, &pb.ReserveStockRequest{Items: []*pb.CartItem{
+			{ProductId: "mug", Quantity: quantity},
+			{ProductId: "shirt", Quantity: 100}, // untracked
+		}})
+	}
+	if _, err := reserve(3); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("reserving more than the stock: %v, want FailedPrecondition", err)
+	}
+	r, err := reserve(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.Stock("mug"); n != 0 {
+		t.Errorf("stock after reserving = %d, want 0", n)
+	}
+	inventory.ReleaseReservation(ctx, &pb.ReleaseReservationRequest{ReservationId: r.GetReservationId()})
+	if n, _ := s.Stock("mug"); n != 2 {
+		t.Errorf("stock after releasing = %d, want 2", n)
+	}
+	if _, err := inventory.CommitReservation(ctx, &pb.CommitReservationRequest{ReservationId: r.GetReservationId()}); status.Code(err) != codes.NotFound {
+		t.Errorf("committing a released reservation: %v, want NotFound", err)
+	}
+
+	levels, err := inventory.GetStock(ctx, &pb.GetStockRequest{Skus: []string{"mug", "shirt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &pb.GetStockResponse{Levels: []*pb.StockLevel{{Sku: "mug", Available: 2, Tracked: true}, {Sku: "shirt"}}}
+	if !proto.Equal(levels, want) {
+		t.Errorf("GetStock() = %v, want %v", levels, want)
+	}
+}
+
+func TestHandleAndCalls(t *testing.T) {
+	s := NewServer(t)
+	Handle(s, "PaymentService/Charge", func(ctx context.Context, req *pb.ChargeRequest) (*pb.ChargeResponse, error) {
+		if req.GetCreditCard().GetCreditCardNumber() == "4000000000000002" {
+			return nil, status.Error(codes.InvalidArgument, "card declined")
+		}
+		return &pb.ChargeResponse{TransactionId: "t1"}, nil
+	})
+	payment := pb.NewPaymentServiceClient(s.Conn())
+	ctx := context.Background()
+
+	if resp, err := payment.Charge(ctx, &pb.ChargeRequest{Amount: usd(1, 0), CreditCard: &pb.CreditCardInfo{}}); err != nil || resp.GetTransactionId() != "t1" {
+		t.Errorf("Charge() = %v, %v", resp, err)
+	}
+	_, err := payment.Charge(ctx, &pb.ChargeRequest{Amount: usd(2, 0), CreditCard: &pb.CreditCardInfo{CreditCardNumber: "4000000000000002"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Charge() with a declined card: %v", err)
+	}
+	calls := Calls[*pb.ChargeRequest](s, "PaymentService/Charge")
+	if len(calls) != 2 || calls[1].GetAmount().GetUnits() != 2 {
+		t.Errorf("Calls() = %v", calls)
+	}
+
+	if _, err := pb.NewCheckoutServiceClient(s.Conn()).PlaceOrder(ctx, &pb.PlaceOrderRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("PlaceOrder without a handler: %v, want Unimplemented", err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	s := NewServer(t)
+	email := pb.NewEmailServiceClient(s.Conn())
+	send := func(ctx context.Context) error {
+		_, err := email.SendOrderConfirmation(ctx, &pb.SendOrderConfirmationRequest{Email: "a@example.com"})
+		return err
+	}
+	ctx := context.Background()
+
+	s.FailNext("EmailService/SendOrderConfirmation", status.Error(codes.Unavailable, "try again"))
+	s.FailNext("EmailService", status.Error(codes.Internal, "oops"))
+	for _, want := range []codes.Code{codes.Unavailable, codes.Internal, codes.OK} {
+		if err := send(ctx); status.Code(err) != want {
+			t.Errorf("send() = %v, want %v", err, want)
+		}
+	}
+
+	s.SetError("EmailService", status.Error(codes.PermissionDenied, "no"))
+	if err := send(ctx); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("send() with a service error = %v", err)
+	}
+	s.SetError("EmailService", nil)
+
+	s.SetLatency("EmailService/SendOrderConfirmation", time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := send(ctx); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("send() with latency = %v, want DeadlineExceeded", err)
+	}
+	if n := len(Calls[*pb.SendOrderConfirmationRequest](s, "EmailService/SendOrderConfirmation")); n != 5 {
+		t.Errorf("%d calls recorded, want 5", n)
+	}
+}
+
+func TestWatchCatalog(t *testing.T) {
+	s := NewServer(t)
+	s.SetProducts(&pb.Product{Id: "mug"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := pb.NewProductCatalogServiceClient(s.Conn()).WatchCatalog(ctx, &pb.WatchCatalogRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := stream.Recv()
+	if err != nil || change.GetVersion() != 1 || !change.GetSnapshot() || len(change.GetAdded()) != 1 {
+		t.Fatalf("first change = %v, %v", change, err)
+	}
+	s.SetProducts(&pb.Product{Id: "mug"}, &pb.Product{Id: "hat"})
+	change, err = stream.Recv()
+	if err != nil || change.GetVersion() != 2 || len(change.GetAdded()) != 2 {
+		t.Fatalf("second change = %v, %v", change, err)
+	}
+}
@@ -0,0 +1,462 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backendtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	moneypb "google.golang.org/genproto/googleapis/type/money"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/cart"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/exchange"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
+)
+
+const (
+	// shippingRate is what the ShippingService fake quotes for any non-empty
+	// order, like the shipping service.
+	shippingRate = "8.99"
+	// maxRecommendations is how many products the RecommendationService fake
+	// recommends at most.
+	maxRecommendations = 5
+)
+
+// catalog is the state of the ProductCatalogService fake.
+type catalog struct {
+	products []proto.Message
+	version  int64
+	changed  chan struct{} // closed when the products change
+}
+
+func newCatalog() catalog {
+	return catalog{changed: make(chan struct{})}
+}
+
+// inventory is the state of the InventoryService fake.
+type inventory struct {
+	available    map[string]int32            // tracked SKUs only
+	reservations map[string]map[string]int32 // SKU quantities by reservation ID
+}
+
+func newInventory() inventory {
+	return inventory{available: make(map[string]int32), reservations: make(map[string]map[string]int32)}
+}
+
+// SetProducts replaces the products of the ProductCatalogService fake, and
+// sends them to catalog watchers. Products are the caller's Product messages.
+func (s *Server) SetProducts(products ...proto.Message) {
+	s.tb.Helper()
+	for _, p := range products {
+		if name := p.ProtoReflect().Descriptor().FullName(); name.Name() != "Product" {
+			s.tb.Fatalf("backendtest: SetProducts got a %s, not a Product", name)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.catalog.products = make([]proto.Message, len(products))
+	for i, p := range products {
+		s.catalog.products[i] = proto.Clone(p)
+	}
+	s.catalog.version++
+	close(s.catalog.changed)
+	s.catalog.changed = make(chan struct{})
+}
+
+// SetStock sets the stock of a SKU in the InventoryService fake. SKUs are
+// untracked, and never run out, until their stock is set.
+func (s *Server) SetStock(sku string, available int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stock.available[sku] = available
+}
+
+// Stock returns the stock of a SKU that is not held by reservations, and
+// whether the SKU is tracked.
+func (s *Server) Stock(sku string) (available int32, tracked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	available, tracked = s.stock.available[sku]
+	return available, tracked
+}
+
+// nextIDLocked returns a new ID for transactions, shipments and
+// reservations. s.mu must be held.
+func (s *Server) nextIDLocked(prefix string) string {
+	s.counter++
+	return fmt.Sprintf("%s-%d", prefix, s.counter)
+}
+
+// fake fills in resp, the response to req.
+type fake func(req, resp protoreflect.Message) error
+
+// registerFakes serves the faked methods. Methods missing from the caller's
+// demo.proto, which may be older, are skipped.
+func (s *Server) registerFakes() {
+	fakes := map[string]fake{
+		"CartService/AddItem":                       s.addItem,
+		"CartService/GetCart":                       s.getCart,
+		"CartService/EmptyCart":                     s.emptyCart,
+		"CartService/UpdateItemQuantity":            s.updateItemQuantity,
+		"CartService/RemoveItem":                    s.removeItem,
+		"CurrencyService/GetSupportedCurrencies":    s.getSupportedCurrencies,
+		"CurrencyService/Convert":                   s.convert,
+		"PaymentService/Charge":                     s.charge,
+		"EmailService/SendOrderConfirmation":        func(req, resp protoreflect.Message) error { return nil },
+		"RecommendationService/ListRecommendations": s.listRecommendations,
+		"AdService/GetAds":                          func(req, resp protoreflect.Message) error { return nil },
+		"ShippingService/GetQuote":                  s.getQuote,
+		"ShippingService/ShipOrder":                 s.shipOrder,
+		"ProductCatalogService/ListProducts":        s.listProducts,
+		"ProductCatalogService/GetProduct":          s.getProduct,
+		"ProductCatalogService/SearchProducts":      s.searchProducts,
+		"ProductCatalogService/GetProductVariants":  s.getProductVariants,
+		"InventoryService/GetStock":                 s.getStock,
+		"InventoryService/ReserveStock":             s.reserveStock,
+		"InventoryService/CommitReservation":        s.commitReservation,
+		"InventoryService/ReleaseReservation":       s.releaseReservation,
+	}
+	for name, f := range fakes {
+		m, ok := s.methods[name]
+		if !ok {
+			continue
+		}
+		f := f
+		s.handlers[name] = func(_ context.Context, req proto.Message) (proto.Message, error) {
+			resp := m.out.New()
+			if err := f(req.ProtoReflect(), resp); err != nil {
+				return nil, err
+			}
+			return resp.Interface(), nil
+		}
+	}
+}
+
+// serveStream serves a server-streaming method.
+func (s *Server) serveStream(name string, req proto.Message, stream grpc.ServerStream) error {
+	if name != "ProductCatalogService/WatchCatalog" {
+		return status.Errorf(codes.Unimplemented, "backendtest: %s has no handler", name)
+	}
+	return s.watchCatalog(s.methods[name], req.ProtoReflect(), stream)
+}
+
+func cartError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, cart.ErrInvalidQuantity):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, cart.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (s *Server) addItem(req, resp protoreflect.Message) error {
+	item := getMessage(req, "item")
+	return cartError(s.Cart.Add(getString(req, "user_id"), cart.Item{
+		ProductID:  getString(item, "product_id"),
+		VariantSKU: getString(item, "variant_sku"),
+		Quantity:   int32(getInt(item, "quantity")),
+	}))
+}
+
+func (s *Server) getCart(req, resp protoreflect.Message) error {
+	userID := getString(req, "user_id")
+	set(resp, "user_id", userID)
+	for _, item := range s.Cart.Get(userID) {
+		out := appendMessage(resp, "items")
+		set(out, "product_id", item.ProductID)
+		set(out, "variant_sku", item.VariantSKU)
+		set(out, "quantity", item.Quantity)
+	}
+	return nil
+}
+
+func (s *Server) emptyCart(req, resp protoreflect.Message) error {
+	s.Cart.Empty(getString(req, "user_id"))
+	return nil
+}
+
+func (s *Server) updateItemQuantity(req, resp protoreflect.Message) error {
+	return cartError(s.Cart.UpdateQuantity(getString(req, "user_id"),
+		getString(req, "product_id"), getString(req, "variant_sku"), int32(getInt(req, "quantity"))))
+}
+
+func (s *Server) removeItem(req, resp protoreflect.Message) error {
+	s.Cart.Remove(getString(req, "user_id"), getString(req, "product_id"), getString(req, "variant_sku"))
+	return nil
+}
+
+func (s *Server) getSupportedCurrencies(req, resp protoreflect.Message) error {
+	for _, code := range s.Currency.Rates().Currencies() {
+		appendValue(resp, "currency_codes", code)
+	}
+	return nil
+}
+
+func (s *Server) convert(req, resp protoreflect.Message) error {
+	v, err := exchange.Convert(s.Currency, getMoney(getMessage(req, "from")), getString(req, "to_code"))
+	switch {
+	case err == nil:
+		setMoney(resp, v)
+		return nil
+	case errors.Is(err, exchange.ErrUnsupportedCurrency), errors.Is(err, money.ErrInvalidValue):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, exchange.ErrStaleRates):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, money.ErrOverflow):
+		return status.Error(codes.OutOfRange, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (s *Server) charge(req, resp protoreflect.Message) error {
+	if amount := getMoney(getMessage(req, "amount")); !money.IsValid(amount) || money.IsNegative(amount) {
+		return status.Errorf(codes.InvalidArgument, "invalid amount %s", money.String(amount))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	set(resp, "transaction_id", s.nextIDLocked("transaction"))
+	return nil
+}
+
+// listRecommendations recommends the first products of the catalog that
+// are not in the request.
+func (s *Server) listRecommendations(req, resp protoreflect.Message) error {
+	exclude := make(map[string]bool)
+	for _, id := range stringList(req, "product_ids") {
+		exclude[id] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, p := range s.catalog.products {
+		id := getString(p.ProtoReflect(), "id")
+		if exclude[id] || n == maxRecommendations {
+			continue
+		}
+		appendValue(resp, "product_ids", id)
+		n++
+	}
+	return nil
+}
+
+func (s *Server) getQuote(req, resp protoreflect.Message) error {
+	cost := money.New[moneypb.Money]("USD", 0, 0)
+	var count int64
+	for _, item := range messageList(req, "items") {
+		count += getInt(item, "quantity")
+	}
+	if count > 0 {
+		cost = money.Must(money.ParseDecimal[moneypb.Money](shippingRate, "USD"))
+	}
+	setMoney(mutable(resp, "cost_usd"), cost)
+	return nil
+}
+
+func (s *Server) shipOrder(req, resp protoreflect.Message) error {
+	if !getMessage(req, "address").IsValid() {
+		return status.Error(codes.InvalidArgument, "no shipping address")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	set(resp, "tracking_id", s.nextIDLocked("tracking"))
+	return nil
+}
+
+// productLocked returns the product with an ID. s.mu must be held.
+func (s *Server) productLocked(id string) (proto.Message, error) {
+	for _, p := range s.catalog.products {
+		if getString(p.ProtoReflect(), "id") == id {
+			return p, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "no product with ID %s", id)
+}
+
+func (s *Server) listProducts(req, resp protoreflect.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.catalog.products {
+		appendValue(resp, "products", p.ProtoReflect())
+	}
+	return nil
+}
+
+func (s *Server) getProduct(req, resp protoreflect.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.productLocked(getString(req, "id"))
+	if err != nil {
+		return err
+	}
+	proto.Merge(resp.Interface(), p)
+	return nil
+}
+
+// searchProducts matches the query against product names and descriptions,
+// ignoring case, like the product catalog service.
+func (s *Server) searchProducts(req, resp protoreflect.Message) error {
+	query := strings.ToLower(getString(req, "query"))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.catalog.products {
+		m := p.ProtoReflect()
+		if strings.Contains(strings.ToLower(getString(m, "name")), query) ||
+			strings.Contains(strings.ToLower(getString(m, "description")), query) {
+			appendValue(resp, "results", m)
+		}
+	}
+	return nil
+}
+
+func (s *Server) getProductVariants(req, resp protoreflect.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.productLocked(getString(req, "product_id"))
+	if err != nil {
+		return err
+	}
+	for _, v := range messageList(p.ProtoReflect(), "variants") {
+		appendValue(resp, "variants", v)
+	}
+	return nil
+}
+
+// watchCatalog sends a snapshot of the catalog whenever it changes, starting
+// with the current one unless the watcher already has it.
+func (s *Server) watchCatalog(m method, req protoreflect.Message, stream grpc.ServerStream) error {
+	sent := getInt(req, "since_version")
+	for {
+		s.mu.Lock()
+		version, products, changed := s.catalog.version, s.catalog.products, s.catalog.changed
+		s.mu.Unlock()
+
+		if version != sent {
+			change := m.out.New()
+			set(change, "version", version)
+			set(change, "snapshot", true)
+			for _, p := range products {
+				appendValue(change, "added", p.ProtoReflect())
+			}
+			if err := stream.SendMsg(change.Interface()); err != nil {
+				return err
+			}
+			sent = version
+		}
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-changed:
+		}
+	}
+}
+
+// stockKey returns the SKU stock is tracked under for a cart item.
+func stockKey(item protoreflect.Message) string {
+	if sku := getString(item, "variant_sku"); sku != "" {
+		return sku
+	}
+	return getString(item, "product_id")
+}
+
+func (s *Server) getStock(req, resp protoreflect.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sku := range stringList(req, "skus") {
+		available, tracked := s.stock.available[sku]
+		level := appendMessage(resp, "levels")
+		set(level, "sku", sku)
+		set(level, "available", available)
+		set(level, "tracked", tracked)
+	}
+	return nil
+}
+
+// reserveStock holds the stock of tracked SKUs until the reservation is
+// committed or released. Reservations do not expire.
+func (s *Server) reserveStock(req, resp protoreflect.Message) error {
+	items := messageList(req, "items")
+	if len(items) == 0 {
+		return status.Error(codes.InvalidArgument, "no items to reserve")
+	}
+	wanted := make(map[string]int32)
+	for _, item := range items {
+		n := int32(getInt(item, "quantity"))
+		if n <= 0 {
+			return status.Errorf(codes.InvalidArgument, "invalid quantity %d for %s", n, stockKey(item))
+		}
+		wanted[stockKey(item)] += n
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var short []string
+	held := make(map[string]int32)
+	for sku, n := range wanted {
+		available, tracked := s.stock.available[sku]
+		if !tracked {
+			continue
+		}
+		if available < n {
+			short = append(short, sku)
+		}
+		held[sku] = n
+	}
+	if len(short) > 0 {
+		sort.Strings(short)
+		return status.Errorf(codes.FailedPrecondition, "insufficient stock for %s", strings.Join(short, ", "))
+	}
+	for sku, n := range held {
+		s.stock.available[sku] -= n
+	}
+	id := s.nextIDLocked("reservation")
+	s.stock.reservations[id] = held
+	set(resp, "reservation_id", id)
+	return nil
+}
+
+func (s *Server) commitReservation(req, resp protoreflect.Message) error {
+	id := getString(req, "reservation_id")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.stock.reservations[id]; !ok {
+		return status.Errorf(codes.NotFound, "no reservation with ID %s", id)
+	}
+	delete(s.stock.reservations, id)
+	return nil
+}
+
+// releaseReservation returns the held stock. Releasing an unknown
+// reservation succeeds, like in the inventory service.
+func (s *Server) releaseReservation(req, resp protoreflect.Message) error {
+	id := getString(req, "reservation_id")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sku, n := range s.stock.reservations[id] {
+		s.stock.available[sku] += n
+	}
+	delete(s.stock.reservations, id)
+	return nil
+}
@@ -0,0 +1,31 @@
+module github.com/GoogleCloudPlatform/microservices-demo/src/backendtest
+
+go 1.25.0
+
+toolchain go1.26.5
+
+require (
+	github.com/GoogleCloudPlatform/microservices-demo/src/cart v0.0.0
+	github.com/GoogleCloudPlatform/microservices-demo/src/exchange v0.0.0
+	github.com/GoogleCloudPlatform/microservices-demo/src/genproto v0.0.0
+	github.com/GoogleCloudPlatform/microservices-demo/src/money v0.0.0
+	google.golang.org/genproto v0.0.0-20260319201613-d00831a3d3e7
+	google.golang.org/grpc v1.83.0
+	google.golang.org/protobuf v1.36.11
+)
+
+require (
+	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/net v0.55.0 // indirect
+	golang.org/x/sys v0.45.0 // indirect
+	golang.org/x/text v0.37.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260526163538-3dc84a4a5aaa // indirect
+)
+
+replace github.com/GoogleCloudPlatform/microservices-demo/src/cart => ../cart
+
+replace github.com/GoogleCloudPlatform/microservices-demo/src/exchange => ../exchange
+
+replace github.com/GoogleCloudPlatform/microservices-demo/src/genproto => ../genproto
+
+replace github.com/GoogleCloudPlatform/microservices-demo/src/money => ../money
@@ -0,0 +1,105 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backendtest
+
+import (
+	"fmt"
+
+	moneypb "google.golang.org/genproto/googleapis/type/money"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
+)
+
+// The fakes access fields by their names in demo.proto. A missing field is a
+// bug in the fakes, so it panics.
+
+func field(m protoreflect.Message, name string) protoreflect.FieldDescriptor {
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if fd == nil {
+		panic(fmt.Sprintf("backendtest: %s has no field %s", m.Descriptor().FullName(), name))
+	}
+	return fd
+}
+
+func getString(m protoreflect.Message, name string) string {
+	return m.Get(field(m, name)).String()
+}
+
+func getInt(m protoreflect.Message, name string) int64 {
+	return m.Get(field(m, name)).Int()
+}
+
+func getMessage(m protoreflect.Message, name string) protoreflect.Message {
+	return m.Get(field(m, name)).Message()
+}
+
+func getList(m protoreflect.Message, name string) protoreflect.List {
+	return m.Get(field(m, name)).List()
+}
+
+func set(m protoreflect.Message, name string, v interface{}) {
+	m.Set(field(m, name), protoreflect.ValueOf(v))
+}
+
+// mutable returns the message in a message field of m, to be filled in.
+func mutable(m protoreflect.Message, name string) protoreflect.Message {
+	return m.Mutable(field(m, name)).Message()
+}
+
+// appendMessage appends a new message to a repeated field of m and returns
+// it, to be filled in.
+func appendMessage(m protoreflect.Message, name string) protoreflect.Message {
+	l := m.Mutable(field(m, name)).List()
+	e := l.NewElement()
+	l.Append(e)
+	return e.Message()
+}
+
+func appendValue(m protoreflect.Message, name string, v interface{}) {
+	m.Mutable(field(m, name)).List().Append(protoreflect.ValueOf(v))
+}
+
+// stringList returns the elements of a repeated string field of m.
+func stringList(m protoreflect.Message, name string) []string {
+	l := getList(m, name)
+	out := make([]string, l.Len())
+	for i := range out {
+		out[i] = l.Get(i).String()
+	}
+	return out
+}
+
+// messageList returns the elements of a repeated message field of m.
+func messageList(m protoreflect.Message, name string) []protoreflect.Message {
+	l := getList(m, name)
+	out := make([]protoreflect.Message, l.Len())
+	for i := range out {
+		out[i] = l.Get(i).Message()
+	}
+	return out
+}
+
+// getMoney reads a hipstershop Money message.
+func getMoney(m protoreflect.Message) *moneypb.Money {
+	return money.New[moneypb.Money](getString(m, "currency_code"), getInt(m, "units"), int32(getInt(m, "nanos")))
+}
+
+// setMoney fills in a hipstershop Money message.
+func setMoney(m protoreflect.Message, v money.Money) {
+	set(m, "currency_code", v.GetCurrencyCode())
+	set(m, "units", v.GetUnits())
+	set(m, "nanos", v.GetNanos())
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cart keeps shopping carts in memory. It is the reference
+// behaviour of the CartService API, used by cmd/cartserver and by tests.
+package cart
+
+import (
+	"errors"
+	"math"
+	"sync"
+)
+
+var (
+	// ErrNotFound is returned when updating an item that is not in the cart.
+	ErrNotFound = errors.New("cart: item not in cart")
+	// ErrInvalidQuantity is returned for quantities that are not positive,
+	// or negative for updates, or that would overflow.
+	ErrInvalidQuantity = errors.New("cart: invalid quantity")
+)
+
+// Item is a line of a cart. Lines are identified by product ID and variant
+// SKU, which is empty for products without variants.
+type Item struct {
+	ProductID  string
+	VariantSKU string
+	Quantity   int32
+}
+
+func (i Item) sameLine(productID, variantSKU string) bool {
+	return i.ProductID == productID && i.VariantSKU == variantSKU
+}
+
+// Store holds the carts of every user. It is safe for concurrent use.
+type Store struct {
+	mu    sync.Mutex
+	carts map[string][]Item
+}
+
+// NewStore returns an empty store.
+func NewStore() *Store {
+	return &Store{carts: make(map[string][]Item)}
+}
+
+// Add adds item to the user's cart, adding to the quantity of the line if
+// the cart already has it.
+func (s *Store) Add(userID string, item Item) error {
+	if item.Quantity <= 0 {
+		return ErrInvalidQuantity
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cart := s.carts[userID]
+	for i := range cart {
+		if cart[i].sameLine(item.ProductID, item.VariantSKU) {
+			if cart[i].Quantity > math.MaxInt32-item.Quantity {
+				return ErrInvalidQuantity
+			}
+			cart[i].Quantity += item.Quantity
+			return nil
+		}
+	}
+	s.carts[userID] = append(cart, item)
+	return nil
+}
+
+// Get returns the items in the user's cart, in the order they were added.
+func (s *Store) Get(userID string) []Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Item(nil), s.carts[userID]...)
+}
+
+// Empty removes every item from the user's cart.
+func (s *Store) Empty(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.carts, userID)
+}
+
+// UpdateQuantity sets the quantity of a line already in the user's cart. A
+// quantity of zero removes the line.
+func (s *Store) UpdateQuantity(userID, productID, variantSKU string, quantity int32) error {
+	if quantity < 0 {
+		return ErrInvalidQuantity
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cart := s.carts[userID]
+	for i := range cart {
+		if cart[i].sameLine(productID, variantSKU) {
+			if quantity == 0 {
+				s.remove(userID, i)
+			} else {
+				cart[i].Quantity = quantity
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Remove removes a line from the user's cart, if it is there.
+func (s *Store) Remove(userID, productID, variantSKU string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, item := range s.carts[userID] {
+		if item.sameLine(productID, variantSKU) {
+			s.remove(userID, i)
+			return
+		}
+	}
+}
+
+// remove removes the i-th line of the user's cart. s.mu must be held.
+func (s *Store) remove(userID string, i int) {
+	cart := s.carts[userID]
+	cart = append(cart[:i:i], cart[i+1:]...)
+	if len(cart) == 0 {
+		delete(s.carts, userID)
+		return
+	}
+	s.carts[userID] = cart
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cart
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore()
+	mustAdd := func(item Item) {
+		t.Helper()
+		if err := s.Add("u", item); err != nil {
+			t.Fatalf("Add(%v) = %v", item, err)
+		}
+	}
+	mustAdd(Item{ProductID: "mug", Quantity: 1})
+	mustAdd(Item{ProductID: "shirt", VariantSKU: "shirt-s", Quantity: 2})
+	mustAdd(Item{ProductID: "shirt", VariantSKU: "shirt-l", Quantity: 1})
+	mustAdd(Item{ProductID: "mug", Quantity: 3})
+
+	want := []Item{{"mug", "", 4}, {"shirt", "shirt-s", 2}, {"shirt", "shirt-l", 1}}
+	if got := s.Get("u"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Get() = %v, want %v", got, want)
+	}
+	if got := s.Get("other"); len(got) != 0 {
+		t.Errorf("Get(other) = %v, carts should be per user", got)
+	}
+
+	if err := s.UpdateQuantity("u", "shirt", "shirt-s", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateQuantity("u", "mug", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	s.Remove("u", "shirt", "shirt-l")
+	s.Remove("u", "shirt", "shirt-xl") // not in the cart
+	want = []Item{{"shirt", "shirt-s", 5}}
+	if got := s.Get("u"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after updates: Get() = %v, want %v", got, want)
+	}
+
+	s.Empty("u")
+	if got := s.Get("u"); len(got) != 0 {
+		t.Errorf("after Empty: Get() = %v", got)
+	}
+}
+
+func TestStoreErrors(t *testing.T) {
+	s := NewStore()
+	s.Add("u", Item{ProductID: "mug", Quantity: math.MaxInt32})
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"add zero", s.Add("u", Item{ProductID: "mug"}), ErrInvalidQuantity},
+		{"add overflow", s.Add("u", Item{ProductID: "mug", Quantity: 1}), ErrInvalidQuantity},
+		{"update negative", s.UpdateQuantity("u", "mug", "", -1), ErrInvalidQuantity},
+		{"update missing", s.UpdateQuantity("u", "mug", "mug-xl", 1), ErrNotFound},
+		{"update other user", s.UpdateQuantity("other", "mug", "", 1), ErrNotFound},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, tt.err, tt.want)
+		}
+	}
+}
+
+func TestStoreGetReturnsCopy(t *testing.T) {
+	s := NewStore()
+	s.Add("u", Item{ProductID: "mug", Quantity: 1})
+	s.Get("u")[0].Quantity = 10
+	if got := s.Get("u")[0].Quantity; got != 1 {
+		t.Errorf("modifying the result of Get changed the cart: quantity = %d", got)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command cartserver is a drop-in replacement for the cart service for local
+// testing. It serves the same gRPC API, including UpdateItemQuantity and
+// RemoveItem, from carts kept in memory, which are lost when it stops.
+//
+// Configuration, all optional:
+//
+//	PORT  port to listen on (default 7070)
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/cart"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	defaultPort = "7070"
+)
+
+var log *logrus.Logger
+
+func init() {
+	log = logrus.New()
+	log.Level = logrus.DebugLevel
+	log.Formatter = &logrus.JSONFormatter{
+		FieldMap: logrus.FieldMap{
+			logrus.FieldKeyTime:  "timestamp",
+			logrus.FieldKeyLevel: "severity",
+			logrus.FieldKeyMsg:   "message",
+		},
+		TimestampFormat: time.RFC3339Nano,
+	}
+	log.Out = os.Stdout
+}
+
+func main() {
+	port := defaultPort
+	if value, ok := os.LookupEnv("PORT"); ok {
+		port = value
+	}
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterCartServiceServer(srv, &server{store: cart.NewStore()})
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	reflection.Register(srv)
+
+	log.Infof("Cart Service listening on port %s", port)
+	if err := srv.Serve(lis); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// server implements the CartService API with a cart.Store.
+type server struct {
+	pb.UnimplementedCartServiceServer
+	store *cart.Store
+}
+
+func (s *server) AddItem(ctx context.Context, req *pb.AddItemRequest) (*pb.Empty, error) {
+	item := req.GetItem()
+	err := s.store.Add(req.GetUserId(), cart.Item{
+		ProductID:  item.GetProductId(),
+		VariantSKU: item.GetVariantSku(),
+		Quantity:   item.GetQuantity(),
+	})
+	return &pb.Empty{}, grpcError(err)
+}
+
+func (s *server) GetCart(ctx context.Context, req *pb.GetCartRequest) (*pb.Cart, error) {
+	items := s.store.Get(req.GetUserId())
+	out := &pb.Cart{UserId: req.GetUserId(), Items: make([]*pb.CartItem, len(items))}
+	for i, item := range items {
+		out.Items[i] = &pb.CartItem{
+			ProductId:  item.ProductID,
+			VariantSku: item.VariantSKU,
+			Quantity:   item.Quantity,
+		}
+	}
+	return out, nil
+}
+
+func (s *server) EmptyCart(ctx context.Context, req *pb.EmptyCartRequest) (*pb.Empty, error) {
+	s.store.Empty(req.GetUserId())
+	return &pb.Empty{}, nil
+}
+
+func (s *server) UpdateItemQuantity(ctx context.Context, req *pb.UpdateItemQuantityRequest) (*pb.Empty, error) {
+	err := s.store.UpdateQuantity(req.GetUserId(), req.GetProductId(), req.GetVariantSku(), req.GetQuantity())
+	return &pb.Empty{}, grpcError(err)
+}
+
+func (s *server) RemoveItem(ctx context.Context, req *pb.RemoveItemRequest) (*pb.Empty, error) {
+	s.store.Remove(req.GetUserId(), req.GetProductId(), req.GetVariantSku())
+	return &pb.Empty{}, nil
+}
+
+func grpcError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, cart.ErrInvalidQuantity):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, cart.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
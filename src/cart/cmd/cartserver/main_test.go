@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/cart"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+)
+
+func dial(t *testing.T) pb.CartServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterCartServiceServer(srv, &server{store: cart.NewStore()})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewCartServiceClient(conn)
+}
+
+func TestCartService(t *testing.T) {
+	client := dial(t)
+	ctx := context.Background()
+
+	for _, item := range []*pb.CartItem{
+		{ProductId: "mug", Quantity: 1},
+		{ProductId: "shirt", VariantSku: "shirt-s", Quantity: 2},
+		{ProductId: "shirt", VariantSku: "shirt-l", Quantity: 1},
+	} {
+		if _, err := client.AddItem(ctx, &pb.AddItemRequest{UserId: "u", Item: item}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.UpdateItemQuantity(ctx, &pb.UpdateItemQuantityRequest{UserId: "u", ProductId: "shirt", VariantSku: "shirt-s", Quantity: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.RemoveItem(ctx, &pb.RemoveItemRequest{UserId: "u", ProductId: "mug"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := client.GetCart(ctx, &pb.GetCartRequest{UserId: "u"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &pb.Cart{UserId: "u", Items: []*pb.CartItem{
+		{ProductId: "shirt", VariantSku: "shirt-s", Quantity: 4},
+		{ProductId: "shirt", VariantSku: "shirt-l", Quantity: 1},
+	}}
+	if !proto.Equal(got, want) {
+		t.Errorf("GetCart() = %v, want %v", got, want)
+	}
+
+	if _, err := client.EmptyCart(ctx, &pb.EmptyCartRequest{UserId: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := client.GetCart(ctx, &pb.GetCartRequest{UserId: "u"}); len(got.GetItems()) != 0 {
+		t.Errorf("after EmptyCart: %v", got)
+	}
+}
+
+func TestCartServiceErrors(t *testing.T) {
+	client := dial(t)
+	ctx := context.Background()
+
+	_, err := client.AddItem(ctx, &pb.AddItemRequest{UserId: "u", Item: &pb.CartItem{ProductId: "mug"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("AddItem with no quantity: %v, want InvalidArgument", err)
+	}
+	_, err = client.UpdateItemQuantity(ctx, &pb.UpdateItemQuantityRequest{UserId: "u", ProductId: "mug", Quantity: 1})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("UpdateItemQuantity of a missing item: %v, want NotFound", err)
+	}
+	client.AddItem(ctx, &pb.AddItemRequest{UserId: "u", Item: &pb.CartItem{ProductId: "mug", Quantity: 1}})
+	_, err = client.UpdateItemQuantity(ctx, &pb.UpdateItemQuantityRequest{UserId: "u", ProductId: "mug", Quantity: -1})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("UpdateItemQuantity to -1: %v, want InvalidArgument", err)
+	}
+}
@@ -59,16 +59,19 @@ namespace cartservice.cartstore
         }
 
 
-    public async Task AddItemAsync(string userId, string productId, int quantity)
+    public async Task AddItemAsync(string userId, string productId, string variantSku, int quantity)
     {
         Console.WriteLine($"AddItemAsync for {userId} called");
         try
         {
             await using var dataSource = NpgsqlDataSource.Create(connectionString);
 
-            var fetchCmd = $"SELECT quantity FROM {tableName} WHERE userID='{userId}' AND productID='{productId}'";
+            var fetchCmd = $"SELECT quantity FROM {tableName} WHERE userID = @userId AND productID = @productId AND variantSku = @variantSku";
             var currentQuantity = 0;
             var cmdRead = dataSource.CreateCommand(fetchCmd);
+            cmdRead.Parameters.AddWithValue("userId", userId);
+            cmdRead.Parameters.AddWithValue("productId", productId);
+            cmdRead.Parameters.AddWithValue("variantSku", variantSku);
             await using (var reader = await cmdRead.ExecuteReaderAsync())
             {
                 while (await reader.ReadAsync())
@@ -79,14 +82,18 @@ namespace cartservice.cartstore
 
             // Use INSERT ... ON CONFLICT to prevent duplicate key error
             var insertCmd = $@"
-                INSERT INTO {tableName} (userId, productId, quantity)
-                VALUES ('{userId}', '{productId}', {totalQuantity})
-                ON CONFLICT (userId, productId)
-                DO UPDATE SET quantity = {totalQuantity};
+                INSERT INTO {tableName} (userId, productId, variantSku, quantity)
+                VALUES (@userId, @productId, @variantSku, @quantity)
+                ON CONFLICT (userId, productId, variantSku)
+                DO UPDATE SET quantity = @quantity;
             ";
 
             await using (var cmdInsert = dataSource.CreateCommand(insertCmd))
             {
+                cmdInsert.Parameters.AddWithValue("userId", userId);
+                cmdInsert.Parameters.AddWithValue("productId", productId);
+                cmdInsert.Parameters.AddWithValue("variantSku", variantSku);
+                cmdInsert.Parameters.AddWithValue("quantity", totalQuantity);
                 await Task.Run(() =>
                 {
                     return cmdInsert.ExecuteNonQueryAsync();
@@ -110,7 +117,7 @@ namespace cartservice.cartstore
             {
                 await using var dataSource = NpgsqlDataSource.Create(connectionString);
 
-                var cartFetchCmd = $"SELECT productId, quantity FROM {tableName} WHERE userId = '{userId}'";
+                var cartFetchCmd = $"SELECT productId, quantity, variantSku FROM {tableName} WHERE userId = '{userId}'";
                 var cmd = dataSource.CreateCommand(cartFetchCmd);
                 await using (var reader = await cmd.ExecuteReaderAsync())
                 {
@@ -119,7 +126,8 @@ namespace cartservice.cartstore
                         Hipstershop.CartItem item = new()
                         {
                             ProductId = reader.GetString(0),
-                            Quantity = reader.GetInt32(1)
+                            Quantity = reader.GetInt32(1),
+                            VariantSku = reader.GetString(2)
                         };
                         cart.Items.Add(item);
                     }
@@ -161,6 +169,55 @@ namespace cartservice.cartstore
             }
         }
 
+        public async Task<bool> UpdateItemQuantityAsync(string userId, string productId, string variantSku, int quantity)
+        {
+            Console.WriteLine($"UpdateItemQuantityAsync called for userId={userId}");
+
+            try
+            {
+                await using var dataSource = NpgsqlDataSource.Create(connectionString);
+                var sql = quantity == 0
+                    ? $"DELETE FROM {tableName} WHERE userId = @userId AND productId = @productId AND variantSku = @variantSku"
+                    : $"UPDATE {tableName} SET quantity = @quantity WHERE userId = @userId AND productId = @productId AND variantSku = @variantSku";
+                await using var cmd = dataSource.CreateCommand(sql);
+                cmd.Parameters.AddWithValue("userId", userId);
+                cmd.Parameters.AddWithValue("productId", productId);
+                cmd.Parameters.AddWithValue("variantSku", variantSku);
+                if (quantity != 0)
+                {
+                    cmd.Parameters.AddWithValue("quantity", quantity);
+                }
+                return await cmd.ExecuteNonQueryAsync() > 0;
+            }
+            catch (Exception ex)
+            {
+                throw new RpcException(
+                    new Status(StatusCode.FailedPrecondition, $"Unable to access cart storage due to an internal error. {ex}"));
+            }
+        }
+
+
+        public async Task RemoveItemAsync(string userId, string productId, string variantSku)
+        {
+            Console.WriteLine($"RemoveItemAsync called for userId={userId}");
+
+            try
+            {
+                await using var dataSource = NpgsqlDataSource.Create(connectionString);
+                await using var cmd = dataSource.CreateCommand(
+                    $"DELETE FROM {tableName} WHERE userId = @userId AND productId = @productId AND variantSku = @variantSku");
+                cmd.Parameters.AddWithValue("userId", userId);
+                cmd.Parameters.AddWithValue("productId", productId);
+                cmd.Parameters.AddWithValue("variantSku", variantSku);
+                await cmd.ExecuteNonQueryAsync();
+            }
+            catch (Exception ex)
+            {
+                throw new RpcException(
+                    new Status(StatusCode.FailedPrecondition, $"Unable to access cart storage due to an internal error. {ex}"));
+            }
+        }
+
         public bool Ping()
         {
             try
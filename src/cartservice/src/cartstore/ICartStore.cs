@@ -18,8 +18,14 @@ namespace cartservice.cartstore
 {
     public interface ICartStore
     {
-        Task AddItemAsync(string userId, string productId, int quantity);
+        // Items are identified by product ID and variant SKU, which is empty
+        // for products without variants.
+        Task AddItemAsync(string userId, string productId, string variantSku, int quantity);
         Task EmptyCartAsync(string userId);
+        // Sets the quantity of an item, removing it if the quantity is zero.
+        // Returns false if the item is not in the cart.
+        Task<bool> UpdateItemQuantityAsync(string userId, string productId, string variantSku, int quantity);
+        Task RemoveItemAsync(string userId, string productId, string variantSku);
         Task<Hipstershop.Cart> GetCartAsync(string userId);
         bool Ping();
     }
@@ -30,9 +30,9 @@ namespace cartservice.cartstore
             _cache = cache;
         }
 
-        public async Task AddItemAsync(string userId, string productId, int quantity)
+        public async Task AddItemAsync(string userId, string productId, string variantSku, int quantity)
         {
-            Console.WriteLine($"AddItemAsync called with userId={userId}, productId={productId}, quantity={quantity}");
+            Console.WriteLine($"AddItemAsync called with userId={userId}, productId={productId}, variantSku={variantSku}, quantity={quantity}");
 
             try
             {
@@ -42,15 +42,15 @@ namespace cartservice.cartstore
                 {
                     cart = new Hipstershop.Cart();
                     cart.UserId = userId;
-                    cart.Items.Add(new Hipstershop.CartItem { ProductId = productId, Quantity = quantity });
+                    cart.Items.Add(new Hipstershop.CartItem { ProductId = productId, VariantSku = variantSku, Quantity = quantity });
                 }
                 else
                 {
                     cart = Hipstershop.Cart.Parser.ParseFrom(value);
-                    var existingItem = cart.Items.SingleOrDefault(i => i.ProductId == productId);
+                    var existingItem = cart.Items.SingleOrDefault(i => i.ProductId == productId && i.VariantSku == variantSku);
                     if (existingItem == null)
                     {
-                        cart.Items.Add(new Hipstershop.CartItem { ProductId = productId, Quantity = quantity });
+                        cart.Items.Add(new Hipstershop.CartItem { ProductId = productId, VariantSku = variantSku, Quantity = quantity });
                     }
                     else
                     {
@@ -80,6 +80,65 @@ namespace cartservice.cartstore
             }
         }
 
+        public async Task<bool> UpdateItemQuantityAsync(string userId, string productId, string variantSku, int quantity)
+        {
+            Console.WriteLine($"UpdateItemQuantityAsync called with userId={userId}, productId={productId}, variantSku={variantSku}, quantity={quantity}");
+
+            try
+            {
+                var value = await _cache.GetAsync(userId);
+                if (value == null)
+                {
+                    return false;
+                }
+                var cart = Hipstershop.Cart.Parser.ParseFrom(value);
+                var existingItem = cart.Items.SingleOrDefault(i => i.ProductId == productId && i.VariantSku == variantSku);
+                if (existingItem == null)
+                {
+                    return false;
+                }
+                if (quantity == 0)
+                {
+                    cart.Items.Remove(existingItem);
+                }
+                else
+                {
+                    existingItem.Quantity = quantity;
+                }
+                await _cache.SetAsync(userId, cart.ToByteArray());
+                return true;
+            }
+            catch (Exception ex)
+            {
+                throw new RpcException(new Status(StatusCode.FailedPrecondition, $"Can't access cart storage. {ex}"));
+            }
+        }
+
+        public async Task RemoveItemAsync(string userId, string productId, string variantSku)
+        {
+            Console.WriteLine($"RemoveItemAsync called with userId={userId}, productId={productId}, variantSku={variantSku}");
+
+            try
+            {
+                var value = await _cache.GetAsync(userId);
+                if (value == null)
+                {
+                    return;
+                }
+                var cart = Hipstershop.Cart.Parser.ParseFrom(value);
+                var existingItem = cart.Items.SingleOrDefault(i => i.ProductId == productId && i.VariantSku == variantSku);
+                if (existingItem != null)
+                {
+                    cart.Items.Remove(existingItem);
+                    await _cache.SetAsync(userId, cart.ToByteArray());
+                }
+            }
+            catch (Exception ex)
+            {
+                throw new RpcException(new Status(StatusCode.FailedPrecondition, $"Can't access cart storage. {ex}"));
+            }
+        }
+
         public async Task<Hipstershop.Cart> GetCartAsync(string userId)
         {
             Console.WriteLine($"GetCartAsync called with userId={userId}");
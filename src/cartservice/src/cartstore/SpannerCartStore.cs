@@ -51,7 +51,7 @@ namespace cartservice.cartstore
         }
 
 
-        public async Task AddItemAsync(string userId, string productId, int quantity)
+        public async Task AddItemAsync(string userId, string productId, string variantSku, int quantity)
         {
             Console.WriteLine($"AddItemAsync for {userId} called");
             try
@@ -61,14 +61,16 @@ namespace cartservice.cartstore
                 {
                     int currentQuantity = 0;
                     var quantityLookup = spannerConnection.CreateSelectCommand(
-                        $"SELECT * FROM {TableName} WHERE userId = @userId AND productId = @productId",
+                        $"SELECT * FROM {TableName} WHERE userId = @userId AND productId = @productId AND variantSku = @variantSku",
                         new SpannerParameterCollection
                         {
                             { "userId", SpannerDbType.String },
-                            { "productId", SpannerDbType.String }
+                            { "productId", SpannerDbType.String },
+                            { "variantSku", SpannerDbType.String }
                         });
                     quantityLookup.Parameters["userId"].Value = userId;
                     quantityLookup.Parameters["productId"].Value = productId;
+                    quantityLookup.Parameters["variantSku"].Value = variantSku;
                     quantityLookup.Transaction = transaction;
                     using (var reader = await quantityLookup.ExecuteReaderAsync())
                     {
@@ -82,10 +84,12 @@ namespace cartservice.cartstore
                         {
                             { "userId", SpannerDbType.String },
                             { "productId", SpannerDbType.String },
+                            { "variantSku", SpannerDbType.String },
                             { "quantity", SpannerDbType.Int64 }
                         });
                     cmd.Parameters["userId"].Value = userId;
                     cmd.Parameters["productId"].Value = productId;
+                    cmd.Parameters["variantSku"].Value = variantSku;
                     cmd.Parameters["quantity"].Value = currentQuantity + quantity;
                     cmd.Transaction = transaction;
                     await Task.Run(() =>
@@ -127,6 +131,7 @@ namespace cartservice.cartstore
                     Hipstershop.CartItem item = new()
                     {
                         ProductId = reader.GetFieldValue<string>("productId"),
+                        VariantSku = reader.GetFieldValue<string>("variantSku"),
                         Quantity = reader.GetFieldValue<int>("quantity")
                     };
                     cart.Items.Add(item);
@@ -169,6 +174,64 @@ namespace cartservice.cartstore
             }
         }
 
+        public async Task<bool> UpdateItemQuantityAsync(string userId, string productId, string variantSku, int quantity)
+        {
+            Console.WriteLine($"UpdateItemQuantityAsync called for userId={userId}");
+
+            try
+            {
+                using SpannerConnection spannerConnection = new(databaseString);
+                var sql = quantity == 0
+                    ? $"DELETE FROM {TableName} WHERE userId = @userId AND productId = @productId AND variantSku = @variantSku"
+                    : $"UPDATE {TableName} SET quantity = @quantity WHERE userId = @userId AND productId = @productId AND variantSku = @variantSku";
+                var parameters = new SpannerParameterCollection
+                {
+                    { "userId", SpannerDbType.String, userId },
+                    { "productId", SpannerDbType.String, productId },
+                    { "variantSku", SpannerDbType.String, variantSku }
+                };
+                if (quantity != 0)
+                {
+                    parameters.Add("quantity", SpannerDbType.Int64, quantity);
+                }
+                var cmd = spannerConnection.CreateDmlCommand(sql, parameters);
+                return await cmd.ExecuteNonQueryAsync() > 0;
+            }
+            catch (Exception ex)
+            {
+                throw new RpcException(
+                    new Status(StatusCode.FailedPrecondition, $"Can't access cart storage at {databaseString}. {ex}"));
+            }
+        }
+
+
+        public async Task RemoveItemAsync(string userId, string productId, string variantSku)
+        {
+            Console.WriteLine($"RemoveItemAsync called for userId={userId}");
+
+            try
+            {
+                using SpannerConnection spannerConnection = new(databaseString);
+                var cmd = spannerConnection.CreateDmlCommand(
+                    $"DELETE FROM {TableName} WHERE userId = @userId AND productId = @productId AND variantSku = @variantSku",
+                    new SpannerParameterCollection
+                    {
+                        { "userId", SpannerDbType.String },
+                        { "productId", SpannerDbType.String },
+                        { "variantSku", SpannerDbType.String }
+                    });
+                cmd.Parameters["userId"].Value = userId;
+                cmd.Parameters["productId"].Value = productId;
+                cmd.Parameters["variantSku"].Value = variantSku;
+                await cmd.ExecuteNonQueryAsync();
+            }
+            catch (Exception ex)
+            {
+                throw new RpcException(
+                    new Status(StatusCode.FailedPrecondition, $"Can't access cart storage at {databaseString}. {ex}"));
+            }
+        }
+
         public bool Ping()
         {
             try
@@ -33,7 +33,7 @@ namespace cartservice.services
 
         public async override Task<Empty> AddItem(AddItemRequest request, ServerCallContext context)
         {
-            await _cartStore.AddItemAsync(request.UserId, request.Item.ProductId, request.Item.Quantity);
+            await _cartStore.AddItemAsync(request.UserId, request.Item.ProductId, request.Item.VariantSku, request.Item.Quantity);
             return Empty;
         }
 
@@ -47,5 +47,24 @@ namespace cartservice.services
             await _cartStore.EmptyCartAsync(request.UserId);
             return Empty;
         }
+
+        public async override Task<Empty> UpdateItemQuantity(UpdateItemQuantityRequest request, ServerCallContext context)
+        {
+            if (request.Quantity < 0)
+            {
+                throw new RpcException(new Status(StatusCode.InvalidArgument, "cart: invalid quantity"));
+            }
+            if (!await _cartStore.UpdateItemQuantityAsync(request.UserId, request.ProductId, request.VariantSku, request.Quantity))
+            {
+                throw new RpcException(new Status(StatusCode.NotFound, "cart: item not in cart"));
+            }
+            return Empty;
+        }
+
+        public async override Task<Empty> RemoveItem(RemoveItemRequest request, ServerCallContext context)
+        {
+            await _cartStore.RemoveItemAsync(request.UserId, request.ProductId, request.VariantSku);
+            return Empty;
+        }
     }
 }
\ No newline at end of file
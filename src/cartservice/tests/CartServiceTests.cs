@@ -14,6 +14,7 @@
 
 using System;
 using System.Threading.Tasks;
+using Grpc.Core;
 using Grpc.Net.Client;
 using Hipstershop;
 using Microsoft.AspNetCore.Hosting;
@@ -156,5 +157,120 @@ namespace cartservice.tests
             cart = await client.GetCartAsync(getCartRequest);
             Assert.Empty(cart.Items);
         }
+
+        [Fact]
+        public async Task AddItem_Variants_KeptApart()
+        {
+            // Setup test server and client
+            using var server = await _host.StartAsync();
+            var httpClient = server.GetTestClient();
+
+            string userId = Guid.NewGuid().ToString();
+
+            // Create a GRPC communication channel between the client and the server
+            var channel = GrpcChannel.ForAddress(httpClient.BaseAddress, new GrpcChannelOptions
+            {
+                HttpClient = httpClient
+            });
+
+            var client = new CartServiceClient(channel);
+            foreach (var sku in new[] { "1-S", "1-L", "1-S", "" })
+            {
+                await client.AddItemAsync(new AddItemRequest
+                {
+                    UserId = userId,
+                    Item = new CartItem { ProductId = "1", VariantSku = sku, Quantity = 1 }
+                });
+            }
+
+            // Each variant is a line of its own, with its SKU kept
+            var cart = await client.GetCartAsync(new GetCartRequest { UserId = userId });
+            Assert.Equal(3, cart.Items.Count);
+            Assert.Equal(new CartItem { ProductId = "1", VariantSku = "1-S", Quantity = 2 }, cart.Items[0]);
+            Assert.Equal(new CartItem { ProductId = "1", VariantSku = "1-L", Quantity = 1 }, cart.Items[1]);
+            Assert.Equal(new CartItem { ProductId = "1", Quantity = 1 }, cart.Items[2]);
+
+            // Cleanup
+            await client.EmptyCartAsync(new EmptyCartRequest { UserId = userId });
+        }
+
+        [Fact]
+        public async Task UpdateItemQuantity_SetsAndRemoves()
+        {
+            // Setup test server and client
+            using var server = await _host.StartAsync();
+            var httpClient = server.GetTestClient();
+
+            string userId = Guid.NewGuid().ToString();
+
+            // Create a GRPC communication channel between the client and the server
+            var channel = GrpcChannel.ForAddress(httpClient.BaseAddress, new GrpcChannelOptions
+            {
+                HttpClient = httpClient
+            });
+
+            var client = new CartServiceClient(channel);
+            foreach (var sku in new[] { "1-S", "1-L" })
+            {
+                await client.AddItemAsync(new AddItemRequest
+                {
+                    UserId = userId,
+                    Item = new CartItem { ProductId = "1", VariantSku = sku, Quantity = 1 }
+                });
+            }
+
+            await client.UpdateItemQuantityAsync(new UpdateItemQuantityRequest { UserId = userId, ProductId = "1", VariantSku = "1-L", Quantity = 5 });
+            var cart = await client.GetCartAsync(new GetCartRequest { UserId = userId });
+            Assert.Equal(1, cart.Items[0].Quantity);
+            Assert.Equal(5, cart.Items[1].Quantity);
+
+            // A quantity of zero removes the item
+            await client.UpdateItemQuantityAsync(new UpdateItemQuantityRequest { UserId = userId, ProductId = "1", VariantSku = "1-S", Quantity = 0 });
+            cart = await client.GetCartAsync(new GetCartRequest { UserId = userId });
+            Assert.Equal(new CartItem { ProductId = "1", VariantSku = "1-L", Quantity = 5 }, Assert.Single(cart.Items));
+
+            var notFound = await Assert.ThrowsAsync<RpcException>(async () =>
+                await client.UpdateItemQuantityAsync(new UpdateItemQuantityRequest { UserId = userId, ProductId = "1", VariantSku = "1-S", Quantity = 1 }));
+            Assert.Equal(StatusCode.NotFound, notFound.StatusCode);
+            var invalid = await Assert.ThrowsAsync<RpcException>(async () =>
+                await client.UpdateItemQuantityAsync(new UpdateItemQuantityRequest { UserId = userId, ProductId = "1", VariantSku = "1-L", Quantity = -1 }));
+            Assert.Equal(StatusCode.InvalidArgument, invalid.StatusCode);
+
+            // Cleanup
+            await client.EmptyCartAsync(new EmptyCartRequest { UserId = userId });
+        }
+
+        [Fact]
+        public async Task RemoveItem_RemovesOnlyThatItem()
+        {
+            // Setup test server and client
+            using var server = await _host.StartAsync();
+            var httpClient = server.GetTestClient();
+
+            string userId = Guid.NewGuid().ToString();
+
+            // Create a GRPC communication channel between the client and the server
+            var channel = GrpcChannel.ForAddress(httpClient.BaseAddress, new GrpcChannelOptions
+            {
+                HttpClient = httpClient
+            });
+
+            var client = new CartServiceClient(channel);
+            foreach (var item in new[] { new CartItem { ProductId = "1", Quantity = 1 }, new CartItem { ProductId = "2", Quantity = 3 } })
+            {
+                await client.AddItemAsync(new AddItemRequest { UserId = userId, Item = item });
+            }
+
+            await client.RemoveItemAsync(new RemoveItemRequest { UserId = userId, ProductId = "1" });
+            // Removing an item that is not in the cart succeeds
+            await client.RemoveItemAsync(new RemoveItemRequest { UserId = userId, ProductId = "1" });
+            await client.RemoveItemAsync(new RemoveItemRequest { UserId = Guid.NewGuid().ToString(), ProductId = "2" });
+
+            var cart = await client.GetCartAsync(new GetCartRequest { UserId = userId });
+            Assert.Equal(new CartItem { ProductId = "2", Quantity = 3 }, Assert.Single(cart.Items));
+
+            // Cleanup
+            await client.EmptyCartAsync(new EmptyCartRequest { UserId = userId });
+        }
     }
 }
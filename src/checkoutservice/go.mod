@@ -6,6 +6,9 @@ toolchain go1.26.5
 
 require (
 	cloud.google.com/go/profiler v0.6.0
+	github.com/GoogleCloudPlatform/microservices-demo/src/exchange v0.0.0
+	github.com/GoogleCloudPlatform/microservices-demo/src/genproto v0.0.0
+	github.com/GoogleCloudPlatform/microservices-demo/src/money v0.0.0
 	github.com/google/uuid v1.6.0
 	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.9.4
@@ -50,3 +53,9 @@ require (
 	google.golang.org/genproto/googleapis/api v0.0.0-20260803160001-6ac0973c030d // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20260803160001-6ac0973c030d // indirect
 )
+
+replace github.com/GoogleCloudPlatform/microservices-demo/src/exchange => ../exchange
+
+replace github.com/GoogleCloudPlatform/microservices-demo/src/genproto => ../genproto
+
+replace github.com/GoogleCloudPlatform/microservices-demo/src/money => ../money
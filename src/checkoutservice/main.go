@@ -12,11 +12,12 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package checkoutservice
 
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"time"
@@ -31,8 +32,9 @@ import (
 	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/status"
 
-	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
-	money "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/money"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/exchange"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
@@ -45,6 +47,10 @@ import (
 const (
 	listenPort  = "5050"
 	usdCurrency = "USD"
+
+	// stockReservationTTL bounds how long stock is held for an order that
+	// never completes, e.g. because this process died mid-checkout.
+	stockReservationTTL = 2 * time.Minute
 )
 
 var log *logrus.Logger
@@ -83,10 +89,30 @@ type checkoutService struct {
 
 	paymentSvcAddr string
 	paymentSvcConn *grpc.ClientConn
+
+	inventorySvcAddr string
+	inventorySvcConn *grpc.ClientConn
+
+	// exchangeRates converts prices when the currency service fails.
+	exchangeRates *exchange.Converter
 }
 
-func main() {
-	ctx := context.Background()
+// Main runs the checkout service on PORT until it fails.
+func Main() {
+	port := listenPort
+	if os.Getenv("PORT") != "" {
+		port = os.Getenv("PORT")
+	}
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Fatal(Serve(context.Background(), lis))
+}
+
+// Serve serves the checkout service on lis until ctx is done. It is configured
+// by the same environment variables as Main, apart from PORT.
+func Serve(ctx context.Context, lis net.Listener) error {
 	if os.Getenv("ENABLE_TRACING") == "1" {
 		log.Info("Tracing enabled.")
 		initTracing()
@@ -102,11 +128,6 @@ func main() {
 		log.Info("Profiling disabled.")
 	}
 
-	port := listenPort
-	if os.Getenv("PORT") != "" {
-		port = os.Getenv("PORT")
-	}
-
 	svc := new(checkoutService)
 	mustMapEnv(&svc.shippingSvcAddr, "SHIPPING_SERVICE_ADDR")
 	mustMapEnv(&svc.productCatalogSvcAddr, "PRODUCT_CATALOG_SERVICE_ADDR")
@@ -114,6 +135,13 @@ func main() {
 	mustMapEnv(&svc.currencySvcAddr, "CURRENCY_SERVICE_ADDR")
 	mustMapEnv(&svc.emailSvcAddr, "EMAIL_SERVICE_ADDR")
 	mustMapEnv(&svc.paymentSvcAddr, "PAYMENT_SERVICE_ADDR")
+	mapEnvOr(&svc.inventorySvcAddr, "INVENTORY_SERVICE_ADDR", svc.productCatalogSvcAddr)
+
+	var err error
+	if svc.exchangeRates, err = exchange.LoadFromEnv(); err != nil {
+		return errors.Wrap(err, "failed to load fallback exchange rates")
+	}
+	log.WithField("base", svc.exchangeRates.Rates().Base).Debug("loaded fallback exchange rates")
 
 	mustConnGRPC(ctx, &svc.shippingSvcConn, svc.shippingSvcAddr)
 	mustConnGRPC(ctx, &svc.productCatalogSvcConn, svc.productCatalogSvcAddr)
@@ -121,14 +149,10 @@ func main() {
 	mustConnGRPC(ctx, &svc.currencySvcConn, svc.currencySvcAddr)
 	mustConnGRPC(ctx, &svc.emailSvcConn, svc.emailSvcAddr)
 	mustConnGRPC(ctx, &svc.paymentSvcConn, svc.paymentSvcAddr)
+	mustConnGRPC(ctx, &svc.inventorySvcConn, svc.inventorySvcAddr)
 
 	log.Infof("service config: %+v", svc)
 
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
-	if err != nil {
-		log.Fatal(err)
-	}
-
 	var srv *grpc.Server
 
 	// Propagate trace context always
@@ -143,8 +167,13 @@ func main() {
 	healthcheck := health.NewServer()
 	healthpb.RegisterHealthServer(srv, healthcheck)
 	log.Infof("starting to listen on tcp: %q", lis.Addr().String())
-	err = srv.Serve(lis)
-	log.Fatal(err)
+	defer context.AfterFunc(ctx, srv.Stop)()
+	return srv.Serve(lis)
+}
+
+// SetLogOutput sends the service's logs to w instead of standard output.
+func SetLogOutput(w io.Writer) {
+	log.SetOutput(w)
 }
 
 func initStats() {
@@ -207,6 +236,15 @@ func mustMapEnv(target *string, envKey string) {
 	*target = v
 }
 
+// mapEnvOr sets target to the value of the environment variable envKey, or to
+// fallback if it is not set.
+func mapEnvOr(target *string, envKey, fallback string) {
+	*target = fallback
+	if v := os.Getenv(envKey); v != "" {
+		*target = v
+	}
+}
+
 func mustConnGRPC(ctx context.Context, conn **grpc.ClientConn, addr string) {
 	var err error
 	_, cancel := context.WithTimeout(ctx, time.Second*3)
@@ -237,29 +275,45 @@ func (cs *checkoutService) PlaceOrder(ctx context.Context, req *pb.PlaceOrderReq
 
 	prep, err := cs.prepareOrderItemsAndShippingQuoteFromCart(ctx, req.UserId, req.UserCurrency, req.Address)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	total := pb.Money{CurrencyCode: req.UserCurrency,
+	total := &pb.Money{CurrencyCode: req.UserCurrency,
 		Units: 0,
 		Nanos: 0}
-	total = money.Must(money.Sum(total, *prep.shippingCostLocalized))
+	total = money.Must(money.Sum(total, prep.shippingCostLocalized))
 	for _, it := range prep.orderItems {
-		multPrice := money.MultiplySlow(*it.Cost, uint32(it.GetItem().GetQuantity()))
+		multPrice := money.Must(money.Multiply(it.Cost, int64(it.GetItem().GetQuantity())))
 		total = money.Must(money.Sum(total, multPrice))
 	}
 
-	txID, err := cs.chargeCard(ctx, &total, req.CreditCard)
+	reservationID, err := cs.reserveStock(ctx, prep.cartItems)
+	if err != nil {
+		if status.Code(err) == codes.FailedPrecondition {
+			return nil, status.Errorf(codes.FailedPrecondition, "out of stock: %s", status.Convert(err).Message())
+		}
+		return nil, status.Errorf(codes.Unavailable, "failed to reserve stock: %+v", err)
+	}
+
+	txID, err := cs.chargeCard(ctx, total, req.CreditCard)
 	if err != nil {
+		cs.releaseReservation(ctx, reservationID)
 		return nil, status.Errorf(codes.Internal, "failed to charge card: %+v", err)
 	}
 	log.Infof("payment went through (transaction_id: %s)", txID)
 
 	shippingTrackingID, err := cs.shipOrder(ctx, req.Address, prep.cartItems)
 	if err != nil {
+		cs.releaseReservation(ctx, reservationID)
 		return nil, status.Errorf(codes.Unavailable, "shipping error: %+v", err)
 	}
 
+	if err := cs.commitReservation(ctx, reservationID); err != nil {
+		// The order is paid for and shipped; the reservation expires on its
+		// own and the stock count is corrected at the next restock.
+		log.Warnf("failed to commit stock reservation %q: %+v", reservationID, err)
+	}
+
 	_ = cs.emptyUserCart(ctx, req.UserId)
 
 	orderResult := &pb.OrderResult{
@@ -345,7 +399,11 @@ func (cs *checkoutService) prepOrderItems(ctx context.Context, items []*pb.CartI
 		if err != nil {
 			return nil, fmt.Errorf("failed to get product #%q", item.GetProductId())
 		}
-		price, err := cs.convertCurrency(ctx, product.GetPriceUsd(), userCurrency)
+		priceUsd, err := unitPriceUsd(product, item.GetVariantSku())
+		if err != nil {
+			return nil, err
+		}
+		price, err := cs.convertCurrency(ctx, priceUsd, userCurrency)
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert price of %q to %s", item.GetProductId(), userCurrency)
 		}
@@ -356,14 +414,45 @@ func (cs *checkoutService) prepOrderItems(ctx context.Context, items []*pb.CartI
 	return out, nil
 }
 
+// unitPriceUsd returns the price of one unit of the given variant of
+// product. Variants without a price override cost the same as the product.
+func unitPriceUsd(product *pb.Product, variantSKU string) (*pb.Money, error) {
+	if variantSKU == "" {
+		return product.GetPriceUsd(), nil
+	}
+	for _, v := range product.GetVariants() {
+		if v.GetSku() != variantSKU {
+			continue
+		}
+		if v.GetPriceOverrideUsd() != nil {
+			return v.GetPriceOverrideUsd(), nil
+		}
+		return product.GetPriceUsd(), nil
+	}
+	return nil, fmt.Errorf("product #%q has no variant %q", product.GetId(), variantSKU)
+}
+
+// convertCurrency converts from to the user's currency. Amounts already in that
+// currency are not sent to the currency service, and if the service fails the
+// local exchange rates are used instead.
 func (cs *checkoutService) convertCurrency(ctx context.Context, from *pb.Money, toCurrency string) (*pb.Money, error) {
-	result, err := pb.NewCurrencyServiceClient(cs.currencySvcConn).Convert(context.TODO(), &pb.CurrencyConversionRequest{
+	if from.GetCurrencyCode() == toCurrency {
+		return money.RoundToMinorUnit(from, money.RoundHalfEven)
+	}
+	result, err := pb.NewCurrencyServiceClient(cs.currencySvcConn).Convert(ctx, &pb.CurrencyConversionRequest{
 		From:   from,
 		ToCode: toCurrency})
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert currency: %+v", err)
+		if cs.exchangeRates == nil {
+			return nil, fmt.Errorf("failed to convert currency: %+v", err)
+		}
+		log.WithError(err).Warnf("currency service failed, converting %s to %s with local rates", from.GetCurrencyCode(), toCurrency)
+		if result, err = exchange.Convert(cs.exchangeRates, from, toCurrency); err != nil {
+			return nil, fmt.Errorf("failed to convert currency: %+v", err)
+		}
 	}
-	return result, err
+	// Charge what the frontend displayed: whole minor units of the currency.
+	return money.RoundToMinorUnit(result, money.RoundHalfEven)
 }
 
 func (cs *checkoutService) chargeCard(ctx context.Context, amount *pb.Money, paymentInfo *pb.CreditCardInfo) (string, error) {
@@ -383,6 +472,42 @@ func (cs *checkoutService) sendOrderConfirmation(ctx context.Context, email stri
 	return err
 }
 
+// reserveStock holds stock for the items until the order is placed. It returns
+// an empty reservation ID when there is nothing to reserve.
+func (cs *checkoutService) reserveStock(ctx context.Context, items []*pb.CartItem) (string, error) {
+	if len(items) == 0 {
+		return "", nil
+	}
+	resp, err := pb.NewInventoryServiceClient(cs.inventorySvcConn).ReserveStock(ctx, &pb.ReserveStockRequest{
+		Items:      items,
+		TtlSeconds: int32(stockReservationTTL / time.Second)})
+	if err != nil {
+		return "", err
+	}
+	return resp.GetReservationId(), nil
+}
+
+func (cs *checkoutService) commitReservation(ctx context.Context, reservationID string) error {
+	if reservationID == "" {
+		return nil
+	}
+	_, err := pb.NewInventoryServiceClient(cs.inventorySvcConn).CommitReservation(ctx, &pb.CommitReservationRequest{
+		ReservationId: reservationID})
+	return err
+}
+
+// releaseReservation returns reserved stock after a failed checkout. Failures
+// are only logged since the reservation expires anyway.
+func (cs *checkoutService) releaseReservation(ctx context.Context, reservationID string) {
+	if reservationID == "" {
+		return
+	}
+	if _, err := pb.NewInventoryServiceClient(cs.inventorySvcConn).ReleaseReservation(ctx, &pb.ReleaseReservationRequest{
+		ReservationId: reservationID}); err != nil {
+		log.Warnf("failed to release stock reservation %q: %+v", reservationID, err)
+	}
+}
+
 func (cs *checkoutService) shipOrder(ctx context.Context, address *pb.Address, items []*pb.CartItem) (string, error) {
 	resp, err := pb.NewShippingServiceClient(cs.shippingSvcConn).ShipOrder(ctx, &pb.ShipOrderRequest{
 		Address: address,
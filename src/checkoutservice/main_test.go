@@ -0,0 +1,229 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkoutservice
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/backendtest"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/cart"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/exchange"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
+)
+
+func init() {
+	log.Out = io.Discard
+}
+
+func usd(units int64, nanos int32) *pb.Money {
+	return &pb.Money{CurrencyCode: "USD", Units: units, Nanos: nanos}
+}
+
+// newTestCheckout returns a checkout service whose backends are fakes with
+// two products, 5 mugs in stock, and a cart with 2 mugs and a large shirt.
+func newTestCheckout(t *testing.T) (*checkoutService, *backendtest.Server) {
+	srv := backendtest.NewServer(t)
+	srv.SetProducts(
+		&pb.Product{Id: "mug", Name: "Mug", PriceUsd: usd(8, 990000000)},
+		&pb.Product{Id: "shirt", Name: "Shirt", PriceUsd: usd(20, 0), Variants: []*pb.ProductVariant{
+			{Sku: "shirt-s"},
+			{Sku: "shirt-l", PriceOverrideUsd: usd(22, 500000000)},
+		}},
+	)
+	srv.SetStock("mug", 5)
+	srv.Cart.Add("u", cart.Item{ProductID: "mug", Quantity: 2})
+	srv.Cart.Add("u", cart.Item{ProductID: "shirt", VariantSKU: "shirt-l", Quantity: 1})
+
+	conn := srv.Conn()
+	return &checkoutService{
+		productCatalogSvcConn: conn,
+		cartSvcConn:           conn,
+		currencySvcConn:       conn,
+		shippingSvcConn:       conn,
+		emailSvcConn:          conn,
+		paymentSvcConn:        conn,
+		inventorySvcConn:      conn,
+	}, srv
+}
+
+func orderRequest(currency string) *pb.PlaceOrderRequest {
+	return &pb.PlaceOrderRequest{
+		UserId:       "u",
+		UserCurrency: currency,
+		Email:        "someone@example.com",
+		Address:      &pb.Address{StreetAddress: "1600 Amphitheatre Parkway", City: "Mountain View", State: "CA", Country: "US", ZipCode: 94043},
+		CreditCard:   &pb.CreditCardInfo{CreditCardNumber: "4432801561520454", CreditCardCvv: 672, CreditCardExpirationYear: 2039, CreditCardExpirationMonth: 1},
+	}
+}
+
+func TestPlaceOrder(t *testing.T) {
+	cs, srv := newTestCheckout(t)
+
+	resp, err := cs.PlaceOrder(context.Background(), orderRequest("USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := resp.GetOrder()
+	want := []*pb.OrderItem{
+		{Item: &pb.CartItem{ProductId: "mug", Quantity: 2}, Cost: usd(8, 990000000)},
+		{Item: &pb.CartItem{ProductId: "shirt", VariantSku: "shirt-l", Quantity: 1}, Cost: usd(22, 500000000)},
+	}
+	if len(order.GetItems()) != len(want) {
+		t.Fatalf("order items = %v, want %v", order.GetItems(), want)
+	}
+	for i := range want {
+		if !proto.Equal(order.GetItems()[i], want[i]) {
+			t.Errorf("order item %d = %v, want %v", i, order.GetItems()[i], want[i])
+		}
+	}
+	if !proto.Equal(order.GetShippingCost(), usd(8, 990000000)) || order.GetShippingTrackingId() == "" {
+		t.Errorf("shipping = %v, tracking ID %q", order.GetShippingCost(), order.GetShippingTrackingId())
+	}
+
+	charges := backendtest.Calls[*pb.ChargeRequest](srv, "PaymentService/Charge")
+	if len(charges) != 1 || !proto.Equal(charges[0].GetAmount(), usd(49, 470000000)) {
+		t.Errorf("charges = %v, want one of 49.47 USD", charges)
+	}
+	if items := srv.Cart.Get("u"); len(items) != 0 {
+		t.Errorf("cart after checkout = %v, want empty", items)
+	}
+	if n, _ := srv.Stock("mug"); n != 3 {
+		t.Errorf("mug stock after checkout = %d, want 3", n)
+	}
+	emails := backendtest.Calls[*pb.SendOrderConfirmationRequest](srv, "EmailService/SendOrderConfirmation")
+	if len(emails) != 1 || emails[0].GetOrder().GetOrderId() != order.GetOrderId() {
+		t.Errorf("confirmation emails = %v", emails)
+	}
+}
+
+// TestPlaceOrderCurrencyFallback checks that prices are converted with the
+// local rates when the currency service fails, and charged in whole cents.
+func TestPlaceOrderCurrencyFallback(t *testing.T) {
+	cs, srv := newTestCheckout(t)
+	resp, err := cs.PlaceOrder(context.Background(), orderRequest("EUR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := resp.GetOrder()
+
+	cs, srv = newTestCheckout(t)
+	cs.exchangeRates = exchange.NewConverter(exchange.DefaultRates(), 0)
+	srv.SetError("CurrencyService", status.Error(codes.Unavailable, "currency service is down"))
+	resp, err = cs.PlaceOrder(context.Background(), orderRequest("EUR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := resp.GetOrder()
+	for i, item := range got.GetItems() {
+		if !proto.Equal(item.GetCost(), want.GetItems()[i].GetCost()) {
+			t.Errorf("item %d costs %s with local rates, %s with the currency service",
+				i, money.String(item.GetCost()), money.String(want.GetItems()[i].GetCost()))
+		}
+		if item.GetCost().GetNanos()%10000000 != 0 {
+			t.Errorf("item %d costs %s, not whole cents", i, money.String(item.GetCost()))
+		}
+	}
+}
+
+func TestPlaceOrderFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		setup       func(*backendtest.Server)
+		timeout     time.Duration
+		wantCode    codes.Code // codes.OK if the order is placed
+		wantCharges int        // attempts to charge the card
+	}{
+		{
+			name:     "out of stock",
+			setup:    func(srv *backendtest.Server) { srv.SetStock("mug", 1) },
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name: "card declined",
+			setup: func(srv *backendtest.Server) {
+				backendtest.Handle(srv, "PaymentService/Charge", func(context.Context, *pb.ChargeRequest) (*pb.ChargeResponse, error) {
+					return nil, status.Error(codes.InvalidArgument, "card declined")
+				})
+			},
+			wantCode:    codes.Internal,
+			wantCharges: 1,
+		},
+		{
+			name: "shipping fails",
+			setup: func(srv *backendtest.Server) {
+				srv.FailNext("ShippingService/ShipOrder", status.Error(codes.Unavailable, "no trucks"))
+			},
+			wantCode:    codes.Unavailable,
+			wantCharges: 1,
+		},
+		{
+			name:     "cart unavailable",
+			setup:    func(srv *backendtest.Server) { srv.SetError("CartService", status.Error(codes.Unavailable, "down")) },
+			wantCode: codes.Internal,
+		},
+		{
+			name:     "slow catalog",
+			setup:    func(srv *backendtest.Server) { srv.SetLatency("ProductCatalogService", time.Second) },
+			timeout:  50 * time.Millisecond,
+			wantCode: codes.Internal,
+		},
+		{
+			name: "email fails",
+			setup: func(srv *backendtest.Server) {
+				srv.SetError("EmailService", status.Error(codes.Unavailable, "down"))
+			},
+			wantCode:    codes.OK,
+			wantCharges: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs, srv := newTestCheckout(t)
+			tt.setup(srv)
+			stock, _ := srv.Stock("mug")
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			_, err := cs.PlaceOrder(ctx, orderRequest("USD"))
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("PlaceOrder() = %v, want %v", err, tt.wantCode)
+			}
+			if n := len(backendtest.Calls[*pb.ChargeRequest](srv, "PaymentService/Charge")); n != tt.wantCharges {
+				t.Errorf("%d attempts to charge the card, want %d", n, tt.wantCharges)
+			}
+			if tt.wantCode == codes.OK {
+				return
+			}
+			if n, _ := srv.Stock("mug"); n != stock {
+				t.Errorf("mug stock after a failed checkout = %d, want %d", n, stock)
+			}
+			if items := srv.Cart.Get("u"); len(items) != 2 {
+				t.Errorf("cart after a failed checkout = %v, want it kept", items)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command devstack runs the storefront on one machine, without Kubernetes or
+// network access. It runs frontend, checkoutservice, productcatalogservice,
+// shippingservice and the frontend's mock identity provider in its own
+// process, on listeners it opens on free local ports, serves in-memory
+// stand-ins for the other services, and sets every *_SERVICE_ADDR variable to
+// match. Stopping devstack stops everything.
+//
+// Usage, from src/devstack:
+//
+//	go run . [-port 8080] [-src ..]
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/oidc"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice"
+)
+
+const (
+	// stopTimeout is how long the services get to return after an interrupt.
+	stopTimeout = 5 * time.Second
+	// readyTimeout is how long the storefront gets to start answering.
+	readyTimeout = 30 * time.Second
+	// ssoClientID is the client the storefront signs in to the mock identity
+	// provider as.
+	ssoClientID = "storefront"
+)
+
+var log = logrus.New()
+
+// service is a Go service run by devstack.
+type service struct {
+	name    string
+	addrVar string // variable the other services find it by, if any
+	serve   func(ctx context.Context, lis net.Listener) error
+	// setLogOutput redirects the service's logs, if it has its own logger.
+	setLogOutput func(w io.Writer)
+}
+
+// mockOIDC is the mock identity provider the storefront signs in with.
+const mockOIDC = "mockoidc"
+
+var services = []service{
+	{name: "productcatalogservice", addrVar: "PRODUCT_CATALOG_SERVICE_ADDR", serve: productcatalogservice.Serve, setLogOutput: productcatalogservice.SetLogOutput},
+	{name: "shippingservice", addrVar: "SHIPPING_SERVICE_ADDR", serve: shippingservice.Serve, setLogOutput: shippingservice.SetLogOutput},
+	{name: "checkoutservice", addrVar: "CHECKOUT_SERVICE_ADDR", serve: checkoutservice.Serve, setLogOutput: checkoutservice.SetLogOutput},
+	{name: mockOIDC, serve: serveMockOIDC},
+	{name: "frontend", serve: frontend.Serve, setLogOutput: frontend.SetLogOutput},
+}
+
+// standInVars are the variables of the services devstack stands in for.
+var standInVars = []string{
+	"AD_SERVICE_ADDR",
+	"CART_SERVICE_ADDR",
+	"CURRENCY_SERVICE_ADDR",
+	"EMAIL_SERVICE_ADDR",
+	"INVENTORY_SERVICE_ADDR",
+	"PAYMENT_SERVICE_ADDR",
+	"RECOMMENDATION_SERVICE_ADDR",
+}
+
+func main() {
+	port := flag.Int("port", 8080, "port of the storefront, or 0 for any free port")
+	src := flag.String("src", "..", "src directory of the repository")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, *src, *port); err != nil && ctx.Err() == nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, src string, frontendPort int) error {
+	// Each service is handed a listener that is already open, so no other
+	// process can take its port before it starts serving.
+	listeners := make(map[string]net.Listener)
+	defer func() {
+		for _, lis := range listeners {
+			lis.Close()
+		}
+	}()
+	addrs := make(map[string]string)
+	for _, svc := range services {
+		port := 0
+		if svc.name == "frontend" {
+			port = frontendPort
+		}
+		lis, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			return fmt.Errorf("failed to listen for %s: %w", svc.name, err)
+		}
+		listeners[svc.name] = lis
+		if svc.addrVar != "" {
+			addrs[svc.addrVar] = lis.Addr().String()
+		}
+	}
+
+	standIns, err := startStandIns(addrs["PRODUCT_CATALOG_SERVICE_ADDR"])
+	if err != nil {
+		return err
+	}
+	defer standIns.stop()
+	for _, v := range standInVars {
+		addrs[v] = standIns.addr
+	}
+	addrs["SHOPPING_ASSISTANT_SERVICE_ADDR"] = standIns.assistantAddr
+
+	frontendAddr := listeners["frontend"].Addr().(*net.TCPAddr)
+	for k, v := range serviceEnv(src, addrs, listeners[mockOIDC].Addr().String(), frontendAddr.Port) {
+		os.Setenv(k, v)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var out sync.Mutex
+	exited := make(chan error, len(services))
+	for _, svc := range services {
+		if svc.setLogOutput != nil {
+			svc.setLogOutput(&prefixWriter{mu: &out, w: os.Stdout, prefix: svc.name})
+		}
+		go func() {
+			err := svc.serve(ctx, listeners[svc.name])
+			if ctx.Err() == nil {
+				log.Errorf("%s stopped: %v", svc.name, err)
+			}
+			exited <- err
+		}()
+	}
+	running := len(services)
+	// Stop the services when returning.
+	defer func() {
+		cancel()
+		timeout := time.After(stopTimeout)
+		for ; running > 0; running-- {
+			select {
+			case <-exited:
+			case <-timeout:
+				log.Warnf("%d services did not stop within %v", running, stopTimeout)
+				return
+			}
+		}
+	}()
+
+	url := fmt.Sprintf("http://localhost:%d", frontendAddr.Port)
+	go func() {
+		if err := waitReady(ctx, url+"/_healthz"); err != nil {
+			log.Warnf("storefront is not answering: %v", err)
+			return
+		}
+		log.Infof("storefront is at %s, press Ctrl-C to stop", url)
+	}()
+
+	// Stop everything when interrupted or when any service stops.
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-exited:
+		running--
+		return fmt.Errorf("a service stopped: %v", err)
+	}
+}
+
+// serviceEnv returns the variables that configure the services: the address
+// of every service, the catalog and inventory files under src, and single
+// sign-on with the mock identity provider at oidcAddr for the storefront on
+// frontendPort.
+func serviceEnv(src string, addrs map[string]string, oidcAddr string, frontendPort int) map[string]string {
+	env := map[string]string{
+		"CATALOG_FILE":         filepath.Join(src, "productcatalogservice", "products.json"),
+		"INVENTORY_FILE":       filepath.Join(src, "productcatalogservice", "inventory.json"),
+		"DISABLE_PROFILER":     "1",
+		"DISABLE_TRACING":      "1",
+		"DISABLE_STATS":        "1",
+		"ENABLE_CATALOG_WATCH": "1",
+		"SHOW_ERROR_DETAILS":   "true",
+		"OIDC_ISSUER":          "http://" + oidcAddr,
+		"OIDC_CLIENT_ID":       ssoClientID,
+		"OIDC_REDIRECT_URL":    fmt.Sprintf("http://localhost:%d/auth/callback", frontendPort),
+	}
+	for k, v := range addrs {
+		env[k] = v
+	}
+	return env
+}
+
+// serveMockOIDC serves the mock identity provider on lis until ctx is done.
+func serveMockOIDC(ctx context.Context, lis net.Listener) error {
+	issuer := "http://" + lis.Addr().String()
+	srv := &http.Server{Handler: oidc.NewMockProvider(issuer, ssoClientID, "")}
+	defer context.AfterFunc(ctx, func() { srv.Close() })()
+	log.Infof("mock OIDC provider %s for client %q", issuer, ssoClientID)
+	if err := srv.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// waitReady polls url until it answers 200 OK.
+func waitReady(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	for {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if res, err := http.DefaultClient.Do(req); err == nil {
+			res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// prefixWriter writes each line to w after a prefix. Writers that share mu
+// do not interleave lines.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if _, err := fmt.Fprintf(p.w, "%-22s %s", p.prefix, p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+}
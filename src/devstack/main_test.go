@@ -0,0 +1,88 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/backendtest"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+)
+
+func init() {
+	log.Out = io.Discard
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var out strings.Builder
+	var mu sync.Mutex
+	w := &prefixWriter{mu: &mu, w: &out, prefix: "frontend"}
+	for _, s := range []string{"start", "ed\nlisten", "ing\n", "partial"} {
+		w.Write([]byte(s))
+	}
+	want := "frontend               started\n" +
+		"frontend               listening\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestServiceEnv(t *testing.T) {
+	addrs := map[string]string{"CART_SERVICE_ADDR": "127.0.0.1:9000"}
+	got := serviceEnv("..", addrs, "127.0.0.1:5556", 8080)
+
+	want := map[string]string{
+		"CART_SERVICE_ADDR": "127.0.0.1:9000",
+		"CATALOG_FILE":      filepath.Join("..", "productcatalogservice", "products.json"),
+		"OIDC_ISSUER":       "http://127.0.0.1:5556",
+		"OIDC_REDIRECT_URL": "http://localhost:8080/auth/callback",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	srv := backendtest.NewServer(t)
+	var products []proto.Message
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		products = append(products, &pb.Product{Id: id})
+	}
+	srv.SetProducts(products...)
+	catalog := pb.NewProductCatalogServiceClient(srv.Conn())
+
+	resp, err := recommend(context.Background(), catalog, &pb.ListRecommendationsRequest{ProductIds: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := resp.GetProductIds()
+	if len(ids) != maxRecommendations {
+		t.Errorf("%d recommendations, want %d", len(ids), maxRecommendations)
+	}
+	for _, id := range ids {
+		if id == "a" {
+			t.Errorf("recommendations %v include a product in the request", ids)
+		}
+	}
+}
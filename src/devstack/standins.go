@@ -0,0 +1,128 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/backendtest"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+)
+
+// maxRecommendations is how many products the recommendation stand-in
+// recommends, like the recommendation service.
+const maxRecommendations = 5
+
+// standIns serves the services that are not written in Go: the backendtest
+// fakes over gRPC, and a shopping assistant that only says it is missing.
+type standIns struct {
+	addr          string
+	assistantAddr string
+
+	cleanups  []func()
+	assistant *http.Server
+}
+
+// startStandIns starts the stand-ins. Recommendations are products from
+// the catalog at catalogAddr.
+func startStandIns(catalogAddr string) (*standIns, error) {
+	s := &standIns{}
+	fakes := backendtest.NewServer(s)
+
+	catalog, err := grpc.NewClient(catalogAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	s.Cleanup(func() { catalog.Close() })
+	backendtest.Handle(fakes, "RecommendationService/ListRecommendations",
+		func(ctx context.Context, req *pb.ListRecommendationsRequest) (*pb.ListRecommendationsResponse, error) {
+			return recommend(ctx, pb.NewProductCatalogServiceClient(catalog), req)
+		})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		s.stop()
+		return nil, err
+	}
+	go fakes.Serve(lis)
+	s.addr = lis.Addr().String()
+
+	lis, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		s.stop()
+		return nil, err
+	}
+	s.assistant = &http.Server{Handler: http.HandlerFunc(serveAssistant)}
+	go s.assistant.Serve(lis)
+	s.assistantAddr = lis.Addr().String()
+	log.Infof("stand-ins for the other services are at %s", s.addr)
+	return s, nil
+}
+
+// Helper, Fatalf and Cleanup let the backendtest fakes run outside a test.
+
+func (s *standIns) Helper() {}
+
+func (s *standIns) Fatalf(format string, args ...interface{}) { log.Fatalf(format, args...) }
+
+func (s *standIns) Cleanup(f func()) { s.cleanups = append(s.cleanups, f) }
+
+func (s *standIns) stop() {
+	if s.assistant != nil {
+		s.assistant.Close()
+	}
+	for i := len(s.cleanups) - 1; i >= 0; i-- {
+		s.cleanups[i]()
+	}
+}
+
+// recommend picks random products from the catalog that are not in the
+// request.
+func recommend(ctx context.Context, catalog pb.ProductCatalogServiceClient, req *pb.ListRecommendationsRequest) (*pb.ListRecommendationsResponse, error) {
+	products, err := catalog.ListProducts(ctx, &pb.Empty{})
+	if err != nil {
+		return nil, err
+	}
+	exclude := make(map[string]bool)
+	for _, id := range req.GetProductIds() {
+		exclude[id] = true
+	}
+	var ids []string
+	for _, p := range products.GetProducts() {
+		if !exclude[p.GetId()] {
+			ids = append(ids, p.GetId())
+		}
+	}
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	if len(ids) > maxRecommendations {
+		ids = ids[:maxRecommendations]
+	}
+	return &pb.ListRecommendationsResponse{ProductIds: ids}, nil
+}
+
+// assistantReply is what the shopping assistant stand-in answers.
+var assistantReply = map[string]string{"content": "The shopping assistant does not run in devstack."}
+
+func serveAssistant(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(assistantReply)
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command currencyserver is a drop-in replacement for the currency service
+// for local testing. It serves the same gRPC API from a rates file, or from
+// the rates shipped with the currency service if none is given.
+//
+// Configuration, all optional:
+//
+//	PORT                   port to listen on (default 7000)
+//	RATES_FILE             JSON rates file (see exchange.ParseRates)
+//	RATES_MAX_AGE          refuse to convert with older rates, e.g. 48h
+//	RATES_RELOAD_INTERVAL  how often to re-read RATES_FILE, e.g. 1m
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/exchange"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	defaultPort = "7000"
+)
+
+var log *logrus.Logger
+
+func init() {
+	log = logrus.New()
+	log.Level = logrus.DebugLevel
+	log.Formatter = &logrus.JSONFormatter{
+		FieldMap: logrus.FieldMap{
+			logrus.FieldKeyTime:  "timestamp",
+			logrus.FieldKeyLevel: "severity",
+			logrus.FieldKeyMsg:   "message",
+		},
+		TimestampFormat: time.RFC3339Nano,
+	}
+	log.Out = os.Stdout
+}
+
+func main() {
+	port := defaultPort
+	if value, ok := os.LookupEnv("PORT"); ok {
+		port = value
+	}
+
+	maxAge := durationEnv("RATES_MAX_AGE")
+	ratesFile := os.Getenv("RATES_FILE")
+	rates := exchange.DefaultRates()
+	if ratesFile != "" {
+		var err error
+		if rates, err = exchange.LoadRates(ratesFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	conv := exchange.NewConverter(rates, maxAge)
+	log.WithField("base", rates.Base).WithField("currencies", len(rates.Currencies())).Info("loaded exchange rates")
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterCurrencyServiceServer(srv, &server{conv: conv})
+	healthcheck := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthcheck)
+	reflection.Register(srv)
+
+	if interval := durationEnv("RATES_RELOAD_INTERVAL"); ratesFile != "" && interval > 0 {
+		go reloadEvery(conv, ratesFile, interval)
+	}
+	go reportHealth(conv, healthcheck)
+
+	log.Infof("Currency Service listening on port %s", port)
+	if err := srv.Serve(lis); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+func durationEnv(name string) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("invalid %s %q: %v", name, v, err)
+	}
+	return d
+}
+
+// reloadEvery re-reads the rates file. A bad file is logged and the previous
+// rates are kept.
+func reloadEvery(conv *exchange.Converter, path string, interval time.Duration) {
+	for range time.Tick(interval) {
+		rates, err := exchange.LoadRates(path)
+		if err != nil {
+			log.WithError(err).Warn("failed to reload exchange rates")
+			continue
+		}
+		conv.SetRates(rates)
+	}
+}
+
+// reportHealth marks the server as not serving while its rates are stale.
+func reportHealth(conv *exchange.Converter, hs *health.Server) {
+	for {
+		st := healthpb.HealthCheckResponse_SERVING
+		if conv.Stale() {
+			st = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		hs.SetServingStatus("", st)
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// server implements the CurrencyService API with an exchange.Converter.
+type server struct {
+	pb.UnimplementedCurrencyServiceServer
+	conv *exchange.Converter
+}
+
+func (s *server) GetSupportedCurrencies(ctx context.Context, _ *pb.Empty) (*pb.GetSupportedCurrenciesResponse, error) {
+	return &pb.GetSupportedCurrenciesResponse{CurrencyCodes: s.conv.Rates().Currencies()}, nil
+}
+
+func (s *server) Convert(ctx context.Context, req *pb.CurrencyConversionRequest) (*pb.Money, error) {
+	out, err := exchange.Convert(s.conv, req.GetFrom(), req.GetToCode())
+	switch {
+	case err == nil:
+		return out, nil
+	case errors.Is(err, exchange.ErrUnsupportedCurrency), errors.Is(err, money.ErrInvalidValue):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, exchange.ErrStaleRates):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, money.ErrOverflow):
+		return nil, status.Error(codes.OutOfRange, err.Error())
+	}
+	return nil, status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/exchange"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+)
+
+func dial(t *testing.T, conv *exchange.Converter) pb.CurrencyServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterCurrencyServiceServer(srv, &server{conv: conv})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewCurrencyServiceClient(conn)
+}
+
+func TestGetSupportedCurrencies(t *testing.T) {
+	client := dial(t, exchange.NewConverter(exchange.DefaultRates(), 0))
+	res, err := client.GetSupportedCurrencies(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := res.GetCurrencyCodes()
+	if len(codes) != 33 {
+		t.Errorf("got %d currencies, want 33", len(codes))
+	}
+	for i := 1; i < len(codes); i++ {
+		if codes[i-1] >= codes[i] {
+			t.Fatalf("currencies are not sorted: %v", codes)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rates, err := exchange.ParseRates([]byte(`{"base": "EUR", "asOf": "2024-05-31", "rates": {"USD": "1.25"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh := dial(t, exchange.NewConverter(rates, 0))
+	stale := dial(t, exchange.NewConverter(rates, 1))
+
+	tests := []struct {
+		name     string
+		client   pb.CurrencyServiceClient
+		from     *pb.Money
+		to       string
+		want     *pb.Money
+		wantCode codes.Code
+	}{
+		{"converts", fresh, &pb.Money{CurrencyCode: "USD", Units: 10}, "EUR", &pb.Money{CurrencyCode: "EUR", Units: 8}, codes.OK},
+		{"unsupported", fresh, &pb.Money{CurrencyCode: "USD", Units: 10}, "XYZ", nil, codes.InvalidArgument},
+		{"invalid", fresh, &pb.Money{CurrencyCode: "USD", Units: 1, Nanos: -1}, "EUR", nil, codes.InvalidArgument},
+		{"overflow", fresh, &pb.Money{CurrencyCode: "EUR", Units: math.MaxInt64}, "USD", nil, codes.OutOfRange},
+		{"stale", stale, &pb.Money{CurrencyCode: "USD", Units: 10}, "EUR", nil, codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.client.Convert(context.Background(), &pb.CurrencyConversionRequest{From: tt.from, ToCode: tt.to})
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("Convert() code = %v, want %v (%v)", status.Code(err), tt.wantCode, err)
+			}
+			if tt.want != nil && (got.GetCurrencyCode() != tt.want.CurrencyCode || got.GetUnits() != tt.want.Units || got.GetNanos() != tt.want.Nanos) {
+				t.Errorf("Convert() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
+)
+
+var (
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrStaleRates          = errors.New("exchange rates are stale")
+)
+
+// Converter converts amounts with a table of rates that can be replaced
+// while in use. It is safe for concurrent use.
+type Converter struct {
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu    sync.RWMutex
+	rates *Rates
+}
+
+// NewConverter returns a converter using rates. If maxAge is positive,
+// conversions fail with ErrStaleRates once the rates are older than that;
+// rates without a publication date then count as stale.
+func NewConverter(rates *Rates, maxAge time.Duration) *Converter {
+	return &Converter{rates: rates, maxAge: maxAge, now: time.Now}
+}
+
+// LoadFromEnv returns the converter the services fall back on when the
+// currency service fails: it uses the rates in the file named by
+// CURRENCY_RATES_FILE, or DefaultRates, and CURRENCY_RATES_MAX_AGE (e.g.
+// "72h") as the maximum age.
+func LoadFromEnv() (*Converter, error) {
+	rates := DefaultRates()
+	if path := os.Getenv("CURRENCY_RATES_FILE"); path != "" {
+		var err error
+		if rates, err = LoadRates(path); err != nil {
+			return nil, err
+		}
+	}
+	var maxAge time.Duration
+	if v := os.Getenv("CURRENCY_RATES_MAX_AGE"); v != "" {
+		var err error
+		if maxAge, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid CURRENCY_RATES_MAX_AGE: %w", err)
+		}
+	}
+	return NewConverter(rates, maxAge), nil
+}
+
+// Rates returns the table in use.
+func (c *Converter) Rates() *Rates {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.rates
+}
+
+// SetRates replaces the table in use, e.g. after reloading a rates file.
+func (c *Converter) SetRates(r *Rates) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rates = r
+}
+
+// Stale reports whether the rates in use are older than the maximum age.
+func (c *Converter) Stale() bool {
+	if c.maxAge <= 0 {
+		return false
+	}
+	asOf := c.Rates().AsOf
+	return asOf.IsZero() || c.now().Sub(asOf) > c.maxAge
+}
+
+// Rate returns the exact rate from one currency to another. See Rates.Rate.
+func (c *Converter) Rate(from, to string) (*big.Rat, error) {
+	if c.Stale() {
+		return nil, ErrStaleRates
+	}
+	return c.Rates().Rate(from, to)
+}
+
+// Convert returns m in another currency, rounded half-even to whole nanos.
+// Amounts already in that currency are returned unchanged without consulting
+// the rates.
+func Convert[T any, P money.Ptr[T]](c *Converter, m P, to string) (P, error) {
+	if !money.IsValid(m) {
+		return nil, money.ErrInvalidValue
+	}
+	to = strings.ToUpper(to)
+	if strings.ToUpper(m.GetCurrencyCode()) == to {
+		return money.New[T, P](to, m.GetUnits(), m.GetNanos()), nil
+	}
+	rate, err := c.Rate(m.GetCurrencyCode(), to)
+	if err != nil {
+		return nil, err
+	}
+	v, err := money.Scale(m, rate, money.RoundHalfEven)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s to %s: %w", money.String(m), to, err)
+	}
+	return money.New[T, P](to, v.GetUnits(), v.GetNanos()), nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exchange
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
+)
+
+func usd(units int64, nanos int32) *pb.Money {
+	return &pb.Money{CurrencyCode: "USD", Units: units, Nanos: nanos}
+}
+
+func TestParseRates(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantBase string
+		wantAsOf time.Time
+		wantErr  bool
+	}{
+		{"structured", `{"base": "EUR", "asOf": "2024-05-31", "rates": {"USD": "1.0833"}}`, "EUR", time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC), false},
+		{"timestamp", `{"base": "EUR", "asOf": "2024-05-31T16:00:00Z", "rates": {"EUR": "1", "USD": 1.0833}}`, "EUR", time.Date(2024, 5, 31, 16, 0, 0, 0, time.UTC), false},
+		{"flat", `{"EUR": "1.0", "USD": "1.1305"}`, "EUR", time.Time{}, false},
+		{"flat without base", `{"USD": "1.1305", "JPY": "126.40"}`, "", time.Time{}, true},
+		{"flat with two bases", `{"EUR": "1.0", "XYZ": "1"}`, "", time.Time{}, true},
+		{"base not 1", `{"base": "EUR", "rates": {"EUR": "2"}}`, "", time.Time{}, true},
+		{"zero rate", `{"base": "EUR", "rates": {"USD": "0"}}`, "", time.Time{}, true},
+		{"negative rate", `{"base": "EUR", "rates": {"USD": "-1.1"}}`, "", time.Time{}, true},
+		{"exponent", `{"base": "EUR", "rates": {"USD": 1e2}}`, "", time.Time{}, true},
+		{"bad code", `{"base": "EUR", "rates": {"usd": "1.1"}}`, "", time.Time{}, true},
+		{"bad date", `{"base": "EUR", "asOf": "yesterday", "rates": {"USD": "1.1"}}`, "", time.Time{}, true},
+		{"not json", `EUR=1`, "", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseRates([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRates() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if r.Base != tt.wantBase || !r.AsOf.Equal(tt.wantAsOf) {
+				t.Errorf("ParseRates() = base %s as of %v, want %s as of %v", r.Base, r.AsOf, tt.wantBase, tt.wantAsOf)
+			}
+			if !r.Supports(tt.wantBase) {
+				t.Errorf("base %s is not supported", tt.wantBase)
+			}
+		})
+	}
+}
+
+func TestDefaultRatesMatchCurrencyService(t *testing.T) {
+	shipped, err := LoadRates(filepath.Join("..", "currencyservice", "data", "currency_conversion.json"))
+	if os.IsNotExist(errors.Unwrap(err)) {
+		t.Skip("currency service data not available")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	def := DefaultRates()
+	if got, want := def.Currencies(), shipped.Currencies(); len(got) != len(want) {
+		t.Fatalf("default rates have %d currencies, currency service has %d", len(got), len(want))
+	}
+	for _, code := range shipped.Currencies() {
+		a, _ := def.Rate("EUR", code)
+		b, _ := shipped.Rate("EUR", code)
+		if a.Cmp(b) != 0 {
+			t.Errorf("rate for %s: default %s, currency service %s", code, a.FloatString(6), b.FloatString(6))
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rates, err := ParseRates([]byte(`{"base": "EUR", "rates": {"EUR": "1.0", "USD": "1.25", "JPY": "125", "GBP": "0.8"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv := NewConverter(rates, 0)
+
+	tests := []struct {
+		name    string
+		in      *pb.Money
+		to      string
+		want    string
+		wantErr error
+	}{
+		{"to base", usd(10, 0), "EUR", "8 EUR", nil},
+		{"from base", &pb.Money{CurrencyCode: "EUR", Units: 8}, "USD", "10 USD", nil},
+		{"cross rate", usd(10, 0), "JPY", "1000 JPY", nil},
+		{"cross rate with fraction", usd(1, 990000000), "GBP", "1.2736 GBP", nil},
+		{"rounds half even", usd(0, 1), "EUR", "0.000000001 EUR", nil},
+		{"negative", usd(-10, 0), "GBP", "-6.4 GBP", nil},
+		{"same currency", usd(8, 990000000), "usd", "8.99 USD", nil},
+		{"unsupported target", usd(1, 0), "XYZ", "", ErrUnsupportedCurrency},
+		{"unsupported source", &pb.Money{CurrencyCode: "XYZ", Units: 1}, "USD", "", ErrUnsupportedCurrency},
+		{"invalid", usd(1, -1), "EUR", "", money.ErrInvalidValue},
+		{"overflow", usd(math.MaxInt64, 0), "JPY", "", money.ErrOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Convert(conv, tt.in, tt.to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Convert(%v, %s): expected err=%v got=%v", tt.in, tt.to, tt.wantErr, err)
+			}
+			if err == nil && money.String(got) != tt.want {
+				t.Errorf("Convert(%v, %s) = %s, want %s", tt.in, tt.to, money.String(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	conv := NewConverter(DefaultRates(), 0)
+	in := usd(1234, 560000000)
+	for _, code := range conv.Rates().Currencies() {
+		out, err := Convert(conv, in, code)
+		if err != nil {
+			t.Fatalf("Convert to %s: %v", code, err)
+		}
+		back, err := Convert(conv, out, "USD")
+		if err != nil {
+			t.Fatalf("Convert back from %s: %v", code, err)
+		}
+		cents, _ := money.RoundToMinorUnit(back, money.RoundHalfEven)
+		if !money.AreEquals(cents, in) {
+			t.Errorf("USD -> %s -> USD: %s, want %s", code, money.String(back), money.String(in))
+		}
+	}
+}
+
+func TestStaleRates(t *testing.T) {
+	asOf := time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)
+	rates, err := ParseRates([]byte(`{"base": "EUR", "asOf": "2024-05-31", "rates": {"USD": "1.25"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := asOf.Add(time.Hour)
+	conv := NewConverter(rates, 24*time.Hour)
+	conv.now = func() time.Time { return now }
+
+	if _, err := Convert(conv, usd(1, 0), "EUR"); err != nil {
+		t.Fatalf("fresh rates: %v", err)
+	}
+	now = asOf.Add(25 * time.Hour)
+	if _, err := Convert(conv, usd(1, 0), "EUR"); !errors.Is(err, ErrStaleRates) {
+		t.Errorf("stale rates: got %v, want ErrStaleRates", err)
+	}
+	if _, err := Convert(conv, usd(1, 0), "USD"); err != nil {
+		t.Errorf("same currency with stale rates: %v", err)
+	}
+
+	conv.SetRates(DefaultRates())
+	if !conv.Stale() {
+		t.Error("rates without a date should be stale when a maximum age is set")
+	}
+	if NewConverter(DefaultRates(), 0).Stale() {
+		t.Error("rates should never be stale without a maximum age")
+	}
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(`{"base": "EUR", "asOf": "2024-05-31", "rates": {"USD": "1.25"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	conv, err := LoadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := conv.Rates().Currencies(), DefaultRates().Currencies(); len(got) != len(want) || conv.Stale() {
+		t.Errorf("without variables: currencies %v, stale %v; want the default rates, not stale", got, conv.Stale())
+	}
+
+	t.Setenv("CURRENCY_RATES_FILE", path)
+	t.Setenv("CURRENCY_RATES_MAX_AGE", "24h")
+	if conv, err = LoadFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if got := conv.Rates().Currencies(); len(got) != 2 || !conv.Stale() {
+		t.Errorf("with variables: currencies %v, stale %v; want EUR and USD, stale", got, conv.Stale())
+	}
+
+	t.Setenv("CURRENCY_RATES_MAX_AGE", "3 days")
+	if _, err := LoadFromEnv(); err == nil {
+		t.Error("invalid CURRENCY_RATES_MAX_AGE: got no error")
+	}
+	t.Setenv("CURRENCY_RATES_MAX_AGE", "")
+	t.Setenv("CURRENCY_RATES_FILE", filepath.Join(t.TempDir(), "missing.json"))
+	if _, err := LoadFromEnv(); err == nil {
+		t.Error("missing CURRENCY_RATES_FILE: got no error")
+	}
+}
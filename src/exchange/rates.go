@@ -0,0 +1,167 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package exchange converts money between currencies using a table of
+// exchange rates, without calling the currency service.
+//
+// Rates are kept as exact decimals and conversions between two quoted
+// currencies go through the table's base currency, so converting with the
+// same table always gives the same result as the currency service's data
+// with no floating-point error.
+package exchange
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//go:embed data/rates.json
+var defaultRates []byte
+
+var (
+	currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+	decimal      = regexp.MustCompile(`^\d+(\.\d+)?$`)
+)
+
+// Rates is a table of exchange rates against a base currency. It is
+// immutable once loaded and safe for concurrent use.
+type Rates struct {
+	// Base is the currency every rate is quoted against.
+	Base string
+	// AsOf is when the rates were published. It is zero if unknown.
+	AsOf time.Time
+
+	rates map[string]*big.Rat // units of a currency per unit of Base
+}
+
+// ratesFile is the format of a rates file:
+//
+//	{"base": "EUR", "asOf": "2024-05-31", "rates": {"EUR": "1.0", "USD": "1.0833"}}
+//
+// The flat format used by the currency service, {"EUR": "1.0", ...}, is
+// also accepted; its base is the currency with a rate of exactly 1.
+type ratesFile struct {
+	Base  string                 `json:"base"`
+	AsOf  string                 `json:"asOf"`
+	Rates map[string]json.Number `json:"rates"`
+}
+
+// ParseRates reads a table of rates in JSON.
+func ParseRates(data []byte) (*Rates, error) {
+	var f ratesFile
+	if err := json.Unmarshal(data, &f); err != nil || f.Rates == nil {
+		var flat map[string]json.Number
+		if err := json.Unmarshal(data, &flat); err != nil {
+			return nil, errors.Wrap(err, "failed to parse rates")
+		}
+		f = ratesFile{Rates: flat}
+	}
+
+	r := &Rates{Base: f.Base, rates: make(map[string]*big.Rat, len(f.Rates))}
+	for code, n := range f.Rates {
+		if !currencyCode.MatchString(code) {
+			return nil, fmt.Errorf("invalid currency code %q", code)
+		}
+		if !decimal.MatchString(n.String()) {
+			return nil, fmt.Errorf("invalid rate %q for %s", n, code)
+		}
+		rate, _ := new(big.Rat).SetString(n.String())
+		if rate.Sign() == 0 {
+			return nil, fmt.Errorf("zero rate for %s", code)
+		}
+		r.rates[code] = rate
+		if f.Base == "" && rate.Cmp(big.NewRat(1, 1)) == 0 {
+			if r.Base != "" {
+				return nil, fmt.Errorf("ambiguous base currency: both %s and %s have a rate of 1", r.Base, code)
+			}
+			r.Base = code
+		}
+	}
+	if r.Base == "" {
+		return nil, errors.New("rates have no base currency")
+	}
+	if rate, ok := r.rates[r.Base]; !ok {
+		r.rates[r.Base] = big.NewRat(1, 1)
+	} else if rate.Cmp(big.NewRat(1, 1)) != 0 {
+		return nil, fmt.Errorf("base currency %s has rate %s, want 1", r.Base, rate.FloatString(4))
+	}
+
+	if f.AsOf != "" {
+		var err error
+		if r.AsOf, err = time.Parse(time.RFC3339, f.AsOf); err != nil {
+			if r.AsOf, err = time.Parse(time.DateOnly, f.AsOf); err != nil {
+				return nil, fmt.Errorf("invalid asOf %q: want a date or RFC 3339 timestamp", f.AsOf)
+			}
+		}
+	}
+	return r, nil
+}
+
+// LoadRates reads a table of rates from a JSON file.
+func LoadRates(path string) (*Rates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read rates")
+	}
+	r, err := ParseRates(data)
+	return r, errors.Wrapf(err, "%s", path)
+}
+
+// DefaultRates returns the rates shipped with the currency service.
+func DefaultRates() *Rates {
+	r, err := ParseRates(defaultRates)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Currencies returns the supported currency codes in order.
+func (r *Rates) Currencies() []string {
+	codes := make([]string, 0, len(r.rates))
+	for code := range r.rates {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Supports reports whether the table has a rate for the currency.
+func (r *Rates) Supports(code string) bool {
+	_, ok := r.rates[strings.ToUpper(code)]
+	return ok
+}
+
+// Rate returns the exact cross rate from one currency to another: the
+// number of units of to worth one unit of from.
+func (r *Rates) Rate(from, to string) (*big.Rat, error) {
+	fromRate, ok := r.rates[strings.ToUpper(from)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, from)
+	}
+	toRate, ok := r.rates[strings.ToUpper(to)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, to)
+	}
+	return new(big.Rat).Quo(toRate, fromRate), nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package account keeps the storefront's customer accounts: their sign-in
+// details, saved addresses and past orders. An account's ID is the user ID
+// the backend services know the customer by, so a customer who signs in
+// again finds their cart.
+package account
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrNotFound           = errors.New("account: not found")
+	ErrEmailTaken         = errors.New("account: email address already registered")
+	ErrInvalidCredentials = errors.New("account: wrong email address or password")
+)
+
+// Account is a customer account.
+type Account struct {
+	ID           string    `json:"id"`
+	Email        string    `json:"email"`
+	Name         string    `json:"name"`
+	PasswordHash []byte    `json:"password_hash"`
+	Addresses    []Address `json:"addresses,omitempty"`
+	Orders       []Order   `json:"orders,omitempty"`
+	Created      time.Time `json:"created"`
+}
+
+// Address is a saved shipping address.
+type Address struct {
+	ID            string `json:"id"`
+	StreetAddress string `json:"street_address"`
+	City          string `json:"city"`
+	State         string `json:"state"`
+	Country       string `json:"country"`
+	ZipCode       int32  `json:"zip_code"`
+}
+
+// Order is an order placed while signed in.
+type Order struct {
+	ID         string    `json:"id"`
+	TrackingID string    `json:"tracking_id"`
+	Placed     time.Time `json:"placed"`
+	Items      int32     `json:"items"`
+	// The total paid.
+	CurrencyCode string `json:"currency_code"`
+	Units        int64  `json:"units"`
+	Nanos        int32  `json:"nanos"`
+}
+
+// Service registers and signs in customers, and keeps their accounts in a
+// Store.
+type Service struct {
+	Store Store
+	// HashCost is the bcrypt cost of password hashes, bcrypt.DefaultCost if
+	// zero.
+	HashCost int
+}
+
+// dummyHash is compared against when signing in to an unknown email address,
+// so that the time taken does not tell which addresses have accounts.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+// normalizeEmail returns the form email addresses are kept in.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Register creates an account. The caller validates the email address and
+// password.
+func (s *Service) Register(ctx context.Context, email, name, password string) (*Account, error) {
+	cost := s.HashCost
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return nil, err
+	}
+	a := &Account{
+		ID:           uuid.NewString(),
+		Email:        normalizeEmail(email),
+		Name:         strings.TrimSpace(name),
+		PasswordHash: hash,
+		Created:      time.Now().UTC(),
+	}
+	if err := s.Store.Create(ctx, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Login returns the account with email and password, or
+// ErrInvalidCredentials.
+func (s *Service) Login(ctx context.Context, email, password string) (*Account, error) {
+	a, err := s.Store.GetByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, ErrNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword(a.PasswordHash, []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return a, nil
+}
+
+// SignInWith returns the account of the user known to an identity provider,
+// such as an OpenID Connect issuer, by subject, creating it on first use with
+// email and name. The account has no password, so it can only be signed in to
+// through the provider.
+func (s *Service) SignInWith(ctx context.Context, provider, subject, email, name string) (*Account, error) {
+	id := uuid.NewSHA1(uuid.NameSpaceURL, []byte(provider+"#"+subject)).String()
+	a, err := s.Store.Get(ctx, id)
+	if !errors.Is(err, ErrNotFound) {
+		return a, err
+	}
+	a = &Account{
+		ID:      id,
+		Email:   normalizeEmail(email),
+		Name:    strings.TrimSpace(name),
+		Created: time.Now().UTC(),
+	}
+	err = s.Store.Create(ctx, a)
+	if errors.Is(err, ErrEmailTaken) {
+		// Either the account was created meanwhile, or another account has
+		// the email address. The provider's word is not enough to join the
+		// two, so the new account goes without it.
+		if existing, err := s.Store.Get(ctx, id); err == nil {
+			return existing, nil
+		}
+		a.Email = ""
+		err = s.Store.Create(ctx, a)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Get returns the account with ID id.
+func (s *Service) Get(ctx context.Context, id string) (*Account, error) {
+	return s.Store.Get(ctx, id)
+}
+
+// AddAddress saves an address, unless the account has it already.
+func (s *Service) AddAddress(ctx context.Context, id string, addr Address) error {
+	return s.Store.Update(ctx, id, func(a *Account) error {
+		for _, saved := range a.Addresses {
+			addr.ID = saved.ID
+			if saved == addr {
+				return nil
+			}
+		}
+		addr.ID = uuid.NewString()
+		a.Addresses = append(a.Addresses, addr)
+		return nil
+	})
+}
+
+// RemoveAddress removes the address with ID addressID.
+func (s *Service) RemoveAddress(ctx context.Context, id, addressID string) error {
+	return s.Store.Update(ctx, id, func(a *Account) error {
+		for i, addr := range a.Addresses {
+			if addr.ID == addressID {
+				a.Addresses = append(a.Addresses[:i], a.Addresses[i+1:]...)
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+// RecordOrder adds an order to the account's history.
+func (s *Service) RecordOrder(ctx context.Context, id string, o Order) error {
+	return s.Store.Update(ctx, id, func(a *Account) error {
+		a.Orders = append(a.Orders, o)
+		return nil
+	})
+}
@@ -0,0 +1,205 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package account
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestService(t *testing.T, path string) *Service {
+	t.Helper()
+	store, err := NewEmbeddedStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Service{Store: store, HashCost: bcrypt.MinCost}
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, "")
+
+	a, err := s.Register(ctx, " Ada@Example.com ", "Ada", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Email != "ada@example.com" || a.Name != "Ada" || a.ID == "" {
+		t.Errorf("Register returned %+v", a)
+	}
+	if string(a.PasswordHash) == "correct horse" {
+		t.Error("password kept in the clear")
+	}
+
+	if _, err := s.Register(ctx, "ADA@example.com", "Other", "battery staple"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("registering a taken address returned %v, want %v", err, ErrEmailTaken)
+	}
+
+	got, err := s.Login(ctx, "ada@EXAMPLE.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != a.ID {
+		t.Errorf("Login returned account %s, want %s", got.ID, a.ID)
+	}
+	if _, err := s.Login(ctx, "ada@example.com", "wrong horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login with a wrong password returned %v, want %v", err, ErrInvalidCredentials)
+	}
+	if _, err := s.Login(ctx, "bob@example.com", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login to an unknown address returned %v, want %v", err, ErrInvalidCredentials)
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, "")
+	a, err := s.Register(ctx, "ada@example.com", "Ada", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := Address{StreetAddress: "1600 Amphitheatre Parkway", City: "Mountain View", State: "CA", Country: "United States", ZipCode: 94043}
+	for range 2 {
+		if err := s.AddAddress(ctx, a.ID, addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, _ = s.Get(ctx, a.ID)
+	if len(a.Addresses) != 1 || a.Addresses[0].ID == "" || a.Addresses[0].City != "Mountain View" {
+		t.Fatalf("after adding an address twice, addresses are %+v", a.Addresses)
+	}
+
+	if err := s.RemoveAddress(ctx, a.ID, "nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("removing an unknown address returned %v, want %v", err, ErrNotFound)
+	}
+	if err := s.RemoveAddress(ctx, a.ID, a.Addresses[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	a, _ = s.Get(ctx, a.ID)
+	if len(a.Addresses) != 0 {
+		t.Errorf("after removing the address, addresses are %+v", a.Addresses)
+	}
+	if err := s.AddAddress(ctx, "nobody", addr); !errors.Is(err, ErrNotFound) {
+		t.Errorf("adding an address to an unknown account returned %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestStoreReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, "")
+	a, err := s.Register(ctx, "ada@example.com", "Ada", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Name = "Eve"
+	a.PasswordHash[0] = 'x'
+	got, _ := s.Get(ctx, a.ID)
+	if got.Name != "Ada" || got.PasswordHash[0] == 'x' {
+		t.Error("changing a returned account changed the stored one")
+	}
+	err = s.Store.Update(ctx, a.ID, func(a *Account) error {
+		a.Email = "eve@example.com"
+		return nil
+	})
+	if err == nil {
+		t.Error("Update changed the email address")
+	}
+}
+
+func TestEmbeddedStoreFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	s := newTestService(t, path)
+	a, err := s.Register(ctx, "ada@example.com", "Ada", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := Order{ID: "o1", TrackingID: "t1", Placed: time.Now().UTC().Truncate(time.Second), Items: 2, CurrencyCode: "EUR", Units: 12, Nanos: 500000000}
+	if err := s.RecordOrder(ctx, a.ID, order); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen the store from its file.
+	s = newTestService(t, path)
+	if _, err := s.Login(ctx, "ada@example.com", "correct horse"); err != nil {
+		t.Fatalf("Login after reopening: %v", err)
+	}
+	got, err := s.Get(ctx, a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Orders) != 1 || !got.Orders[0].Placed.Equal(order.Placed) || got.Orders[0].Units != 12 {
+		t.Errorf("after reopening, orders are %+v", got.Orders)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEmbeddedStore(path); err == nil {
+		t.Error("NewEmbeddedStore opened a corrupt file")
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	for _, spec := range []string{"", "memory", "file:" + filepath.Join(t.TempDir(), "accounts.json")} {
+		if _, err := OpenStore(spec); err != nil {
+			t.Errorf("OpenStore(%q) returned %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"file:", "redis:localhost:6379"} {
+		if _, err := OpenStore(spec); err == nil {
+			t.Errorf("OpenStore(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestSignInWith(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, "")
+	a, err := s.SignInWith(ctx, "https://idp.example", "u1", "Staff@example.com", "Staff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Email != "staff@example.com" || a.Name != "Staff" || a.PasswordHash != nil {
+		t.Errorf("SignInWith created %+v", a)
+	}
+	again, err := s.SignInWith(ctx, "https://idp.example", "u1", "renamed@example.com", "Renamed")
+	if err != nil || again.ID != a.ID || again.Email != "staff@example.com" {
+		t.Errorf("signing in again returned %+v, %v, want account %s", again, err, a.ID)
+	}
+	if _, err := s.Login(ctx, "staff@example.com", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login without a password returned %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	// Another provider's user with the same email address gets an account of
+	// their own, without it.
+	other, err := s.SignInWith(ctx, "https://other.example", "u1", "staff@example.com", "Impostor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID == a.ID || other.Email != "" {
+		t.Errorf("another provider's user got %+v", other)
+	}
+	// Accounts without email addresses do not conflict.
+	if _, err := s.SignInWith(ctx, "https://idp.example", "u2", "", "Anonymous"); err != nil {
+		t.Errorf("signing in without an email address: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Store keeps accounts. Stores return copies, so callers may change the
+// accounts they get.
+type Store interface {
+	// Create adds an account, or fails with ErrEmailTaken if another account
+	// has its email address or ID. Accounts without an email address, from
+	// identity providers, do not conflict.
+	Create(ctx context.Context, a *Account) error
+	Get(ctx context.Context, id string) (*Account, error)
+	GetByEmail(ctx context.Context, email string) (*Account, error)
+	// Update changes the account with ID id with f, atomically, unless f
+	// fails.
+	Update(ctx context.Context, id string, f func(*Account) error) error
+}
+
+// OpenStore opens the store described by spec, as in the ACCOUNT_STORE
+// variable: "memory" (or "") or "file:<path>".
+func OpenStore(spec string) (Store, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "memory":
+		return NewEmbeddedStore("")
+	case "file":
+		if arg == "" {
+			return nil, errors.New("account: no path for the file store")
+		}
+		return NewEmbeddedStore(arg)
+	}
+	return nil, fmt.Errorf("account: unknown store %q", spec)
+}
+
+// EmbeddedStore keeps accounts in memory and, if it has a file, writes them
+// all to it after every change. It suits a single replica with a few
+// thousand accounts.
+type EmbeddedStore struct {
+	path string
+
+	mu       sync.Mutex
+	accounts map[string]*Account
+	byEmail  map[string]string // email to ID
+}
+
+// NewEmbeddedStore returns a store saved in the file at path, loading the
+// accounts already there, or a store in memory only if path is "".
+func NewEmbeddedStore(path string) (*EmbeddedStore, error) {
+	s := &EmbeddedStore{path: path, accounts: make(map[string]*Account), byEmail: make(map[string]string)}
+	if path == "" {
+		return s, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var accounts []*Account
+	if err := json.Unmarshal(b, &accounts); err != nil {
+		return nil, fmt.Errorf("account: corrupt store %s: %w", path, err)
+	}
+	for _, a := range accounts {
+		s.accounts[a.ID] = a
+		if a.Email != "" {
+			s.byEmail[a.Email] = a.ID
+		}
+	}
+	return s, nil
+}
+
+func (s *EmbeddedStore) Create(_ context.Context, a *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byEmail[a.Email]; ok && a.Email != "" {
+		return ErrEmailTaken
+	}
+	if _, ok := s.accounts[a.ID]; ok {
+		return ErrEmailTaken
+	}
+	s.accounts[a.ID] = clone(a)
+	if a.Email != "" {
+		s.byEmail[a.Email] = a.ID
+	}
+	if err := s.save(); err != nil {
+		delete(s.accounts, a.ID)
+		delete(s.byEmail, a.Email)
+		return err
+	}
+	return nil
+}
+
+func (s *EmbeddedStore) Get(_ context.Context, id string) (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.accounts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(a), nil
+}
+
+func (s *EmbeddedStore) GetByEmail(ctx context.Context, email string) (*Account, error) {
+	s.mu.Lock()
+	id, ok := s.byEmail[email]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *EmbeddedStore) Update(_ context.Context, id string, f func(*Account) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.accounts[id]
+	if !ok {
+		return ErrNotFound
+	}
+	a := clone(old)
+	if err := f(a); err != nil {
+		return err
+	}
+	if a.ID != id || a.Email != old.Email {
+		return errors.New("account: the ID and email address of an account cannot change")
+	}
+	s.accounts[id] = a
+	if err := s.save(); err != nil {
+		s.accounts[id] = old
+		return err
+	}
+	return nil
+}
+
+// save writes every account to the store's file, if it has one. The caller
+// holds s.mu.
+func (s *EmbeddedStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	accounts := make([]*Account, 0, len(s.accounts))
+	for _, a := range s.accounts {
+		accounts = append(accounts, a)
+	}
+	b, err := json.Marshal(accounts)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so that a crash cannot lose the store.
+	f, err := os.CreateTemp(filepath.Dir(s.path), ".accounts-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// clone returns a deep copy of a.
+func clone(a *Account) *Account {
+	c := *a
+	c.PasswordHash = append([]byte(nil), a.PasswordHash...)
+	c.Addresses = append([]Address(nil), a.Addresses...)
+	c.Orders = append([]Order(nil), a.Orders...)
+	return &c
+}
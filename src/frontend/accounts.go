@@ -0,0 +1,366 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/account"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/session"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/validator"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+)
+
+const (
+	// sessionKeyAccount and sessionKeyAccountName are the session values
+	// holding the ID and name of the signed-in account.
+	sessionKeyAccount     = "account_id"
+	sessionKeyAccountName = "account_name"
+)
+
+// checkoutDetails fills in the checkout form.
+type checkoutDetails struct {
+	Email string
+	account.Address
+}
+
+// defaultCheckout fills in the checkout form for visitors who have not saved
+// an address.
+var defaultCheckout = checkoutDetails{
+	Email: "someone@example.com",
+	Address: account.Address{
+		StreetAddress: "1600 Amphitheatre Parkway",
+		City:          "Mountain View",
+		State:         "CA",
+		Country:       "United States",
+		ZipCode:       94043,
+	},
+}
+
+// accountID returns the ID of the account the visitor is signed in to, or ""
+// if they are not signed in.
+func accountID(r *http.Request) string {
+	if s, ok := r.Context().Value(ctxKeySession{}).(*session.Session); ok {
+		return s.Get(sessionKeyAccount)
+	}
+	return ""
+}
+
+// accountName returns the name of the account the visitor is signed in to.
+func accountName(r *http.Request) string {
+	if s, ok := r.Context().Value(ctxKeySession{}).(*session.Session); ok {
+		return s.Get(sessionKeyAccountName)
+	}
+	return ""
+}
+
+func (fe *frontendServer) loginHandler(w http.ResponseWriter, r *http.Request) {
+	fe.renderAccountForm(w, r, "login", http.StatusOK, "")
+}
+
+func (fe *frontendServer) loginPostHandler(w http.ResponseWriter, r *http.Request) {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	payload := validator.LoginPayload{
+		Email:    r.FormValue("email"),
+		Password: r.FormValue("password"),
+	}
+	if err := payload.Validate(); err != nil {
+		fe.renderAccountForm(w, r, "login", http.StatusUnprocessableEntity, "Enter your email address and password.")
+		return
+	}
+	a, err := fe.accounts.Login(r.Context(), payload.Email, payload.Password)
+	if errors.Is(err, account.ErrInvalidCredentials) {
+		loginsTotal.WithLabelValues("invalid_credentials").Inc()
+		fe.renderAccountForm(w, r, "login", http.StatusUnauthorized, "Wrong email address or password.")
+		return
+	} else if err != nil {
+		loginsTotal.WithLabelValues("error").Inc()
+		renderHTTPError(log, r, w, errors.Wrap(err, "failed to sign in"), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+	if err := fe.signIn(w, r, a); err != nil {
+		loginsTotal.WithLabelValues("error").Inc()
+		renderHTTPError(log, r, w, err, http.StatusServiceUnavailable)
+		return
+	}
+	loginsTotal.WithLabelValues("success").Inc()
+	localRedirect(w, r, r.FormValue("next"))
+}
+
+func (fe *frontendServer) registerHandler(w http.ResponseWriter, r *http.Request) {
+	fe.renderAccountForm(w, r, "register", http.StatusOK, "")
+}
+
+func (fe *frontendServer) registerPostHandler(w http.ResponseWriter, r *http.Request) {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	payload := validator.RegisterPayload{
+		Email:    r.FormValue("email"),
+		Name:     r.FormValue("name"),
+		Password: r.FormValue("password"),
+	}
+	if err := payload.Validate(); err != nil {
+		fe.renderAccountForm(w, r, "register", http.StatusUnprocessableEntity,
+			"Enter your name, a valid email address and a password of 8 to 72 characters.")
+		return
+	}
+	a, err := fe.accounts.Register(r.Context(), payload.Email, payload.Name, payload.Password)
+	if errors.Is(err, account.ErrEmailTaken) {
+		fe.renderAccountForm(w, r, "register", http.StatusConflict, "That email address already has an account.")
+		return
+	} else if err != nil {
+		renderHTTPError(log, r, w, errors.Wrap(err, "failed to create account"), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+	log.WithField("account", a.ID).Info("account created")
+	if err := fe.signIn(w, r, a); err != nil {
+		renderHTTPError(log, r, w, err, http.StatusServiceUnavailable)
+		return
+	}
+	localRedirect(w, r, r.FormValue("next"))
+}
+
+// renderAccountForm renders the login or register page with an error
+// message, if any.
+func (fe *frontendServer) renderAccountForm(w http.ResponseWriter, r *http.Request, name string, code int, message string) {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	currencies, err := fe.getCurrencies(r.Context())
+	if err != nil {
+		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve currencies"), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+	w.WriteHeader(code)
+	if err := templates.ExecuteTemplate(w, name, injectCommonTemplateData(r, map[string]interface{}{
+		"show_currency": false,
+		"currencies":    currencies,
+		"next":          safeRedirectPath(r, r.FormValue("next")),
+		"email":         r.PostFormValue("email"),
+		"name":          r.PostFormValue("name"),
+		"message":       message,
+		"sso_enabled":   fe.sso != nil,
+	})); err != nil {
+		log.Println(err)
+	}
+}
+
+// signIn binds the visitor's session to account a. The items in the cart of
+// an anonymous visitor move to the account's cart, and the session moves to
+// a new ID and CSRF token, so that any learned before signing in are of no
+// use.
+func (fe *frontendServer) signIn(w http.ResponseWriter, r *http.Request, a *account.Account) error {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	s, ok := r.Context().Value(ctxKeySession{}).(*session.Session)
+	if !ok {
+		return errNoSession
+	}
+	if s.Get(sessionKeyAccount) == "" && s.UserID != a.ID {
+		if err := fe.mergeCart(r.Context(), s.UserID, a.ID); err != nil {
+			log.WithField("error", err).Warn("failed to move the cart to the account")
+		}
+	}
+	s.UserID = a.ID
+	s.Set(sessionKeyAccount, a.ID)
+	s.Set(sessionKeyAccountName, a.Name)
+	s.Set(sessionKeyCSRF, newCSRFToken())
+	if err := fe.sessions.Renew(w, r, s); err != nil {
+		return errors.Wrap(err, "failed to save session")
+	}
+	log.WithField("account", a.ID).Info("signed in")
+	return nil
+}
+
+// mergeCart adds the items in the cart of user from to the cart of user to,
+// and empties the cart of from.
+func (fe *frontendServer) mergeCart(ctx context.Context, from, to string) error {
+	items, err := fe.getCart(ctx, from)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	for _, item := range items {
+		if err := fe.insertCart(ctx, to, item.GetProductId(), item.GetVariantSku(), item.GetQuantity()); err != nil {
+			return err
+		}
+	}
+	return fe.emptyCart(ctx, from)
+}
+
+func (fe *frontendServer) accountHandler(w http.ResponseWriter, r *http.Request) {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	a, ok := fe.signedInAccount(w, r)
+	if !ok {
+		return
+	}
+	currencies, err := fe.getCurrencies(r.Context())
+	if err != nil {
+		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve currencies"), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	type orderView struct {
+		account.Order
+		Total *pb.Money
+	}
+	// Most recent first.
+	orders := make([]orderView, len(a.Orders))
+	for i, o := range a.Orders {
+		orders[len(orders)-1-i] = orderView{
+			Order: o,
+			Total: &pb.Money{CurrencyCode: o.CurrencyCode, Units: o.Units, Nanos: o.Nanos},
+		}
+	}
+	if err := templates.ExecuteTemplate(w, "account", injectCommonTemplateData(r, map[string]interface{}{
+		"show_currency": false,
+		"currencies":    currencies,
+		"account":       a,
+		"orders":        orders,
+	})); err != nil {
+		log.Println(err)
+	}
+}
+
+func (fe *frontendServer) addAddressHandler(w http.ResponseWriter, r *http.Request) {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	a, ok := fe.signedInAccount(w, r)
+	if !ok {
+		return
+	}
+	zipCode, _ := strconv.ParseInt(r.FormValue("zip_code"), 10, 32)
+	payload := validator.AddressPayload{
+		StreetAddress: r.FormValue("street_address"),
+		ZipCode:       zipCode,
+		City:          r.FormValue("city"),
+		State:         r.FormValue("state"),
+		Country:       r.FormValue("country"),
+	}
+	if err := fe.saveAddress(r.Context(), a.ID, payload); err != nil {
+		renderHTTPError(log, r, w, err, httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+	localRedirect(w, r, baseUrl+"/account")
+}
+
+// saveAddress validates payload and saves the address to the account.
+func (fe *frontendServer) saveAddress(ctx context.Context, accountID string, payload validator.AddressPayload) error {
+	if err := payload.Validate(); err != nil {
+		return withStatus(http.StatusUnprocessableEntity, validator.ValidationErrorResponse(err))
+	}
+	err := fe.accounts.AddAddress(ctx, accountID, account.Address{
+		StreetAddress: payload.StreetAddress,
+		City:          payload.City,
+		State:         payload.State,
+		Country:       payload.Country,
+		ZipCode:       int32(payload.ZipCode),
+	})
+	return errors.Wrap(err, "failed to save address")
+}
+
+func (fe *frontendServer) removeAddressHandler(w http.ResponseWriter, r *http.Request) {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	a, ok := fe.signedInAccount(w, r)
+	if !ok {
+		return
+	}
+	err := fe.accounts.RemoveAddress(r.Context(), a.ID, r.FormValue("address_id"))
+	if errors.Is(err, account.ErrNotFound) {
+		renderHTTPError(log, r, w, errors.New("no such address"), http.StatusNotFound)
+		return
+	} else if err != nil {
+		renderHTTPError(log, r, w, errors.Wrap(err, "failed to remove address"), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+	localRedirect(w, r, baseUrl+"/account")
+}
+
+// signedInAccount returns the account the visitor is signed in to. Otherwise
+// it sends them to sign in, then to come back, and returns false.
+func (fe *frontendServer) signedInAccount(w http.ResponseWriter, r *http.Request) (*account.Account, bool) {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	id := accountID(r)
+	if id == "" {
+		next := baseUrl + "/account"
+		if r.Method == http.MethodGet {
+			next = r.URL.RequestURI()
+		}
+		localRedirect(w, r, baseUrl+"/login?"+url.Values{"next": {next}}.Encode())
+		return nil, false
+	}
+	a, err := fe.accounts.Get(r.Context(), id)
+	if errors.Is(err, account.ErrNotFound) {
+		// The account is gone, as from an in-memory store that restarted.
+		if s, ok := r.Context().Value(ctxKeySession{}).(*session.Session); ok {
+			if err := fe.sessions.Destroy(w, r, s); err != nil {
+				log.WithField("error", err).Warn("failed to delete session")
+			}
+		}
+		localRedirect(w, r, baseUrl+"/login")
+		return nil, false
+	} else if err != nil {
+		renderHTTPError(log, r, w, errors.Wrap(err, "failed to retrieve account"), httpStatus(err, http.StatusInternalServerError))
+		return nil, false
+	}
+	return a, true
+}
+
+// checkoutFor returns the details to fill in the checkout form with: those of
+// the signed-in account, with its first saved address, if any.
+func (fe *frontendServer) checkoutFor(ctx context.Context, log logrus.FieldLogger, accountID string) checkoutDetails {
+	details := defaultCheckout
+	if accountID == "" {
+		return details
+	}
+	a, err := fe.accounts.Get(ctx, accountID)
+	if err != nil {
+		log.WithField("error", err).Warn("failed to retrieve account")
+		return details
+	}
+	details.Email = a.Email
+	if len(a.Addresses) > 0 {
+		details.Address = a.Addresses[0]
+	}
+	return details
+}
+
+// recordOrder adds an order to the history of the account userID, if it is
+// one.
+func (fe *frontendServer) recordOrder(ctx context.Context, log logrus.FieldLogger, userID string, order *pb.OrderResult, totalPaid *pb.Money) {
+	if fe.accounts == nil {
+		return
+	}
+	var items int32
+	for _, item := range order.GetItems() {
+		items += item.GetItem().GetQuantity()
+	}
+	err := fe.accounts.RecordOrder(ctx, userID, account.Order{
+		ID:           order.GetOrderId(),
+		TrackingID:   order.GetShippingTrackingId(),
+		Placed:       time.Now().UTC(),
+		Items:        items,
+		CurrencyCode: totalPaid.GetCurrencyCode(),
+		Units:        totalPaid.GetUnits(),
+		Nanos:        totalPaid.GetNanos(),
+	})
+	if err != nil && !errors.Is(err, account.ErrNotFound) {
+		log.WithField("error", err).Warn("failed to record the order in the account")
+	}
+}
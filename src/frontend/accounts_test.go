@@ -0,0 +1,178 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/backendtest"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/cart"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/account"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+)
+
+// accountsClient drives the account pages like a browser, keeping the
+// session cookie.
+type accountsClient struct {
+	t       *testing.T
+	handler http.Handler
+	cookie  *http.Cookie
+	// userID is the user ID of the last request's session.
+	userID string
+}
+
+func newAccountsClient(t *testing.T, fe *frontendServer) *accountsClient {
+	c := &accountsClient{t: t}
+	r := mux.NewRouter()
+	r.HandleFunc("/login", fe.loginHandler).Methods(http.MethodGet)
+	r.HandleFunc("/login", fe.loginPostHandler).Methods(http.MethodPost)
+	r.HandleFunc("/register", fe.registerPostHandler).Methods(http.MethodPost)
+	r.HandleFunc("/account", fe.accountHandler).Methods(http.MethodGet)
+	r.HandleFunc("/account/addresses", fe.addAddressHandler).Methods(http.MethodPost)
+	r.HandleFunc("/logout", fe.logoutHandler).Methods(http.MethodGet)
+	r.HandleFunc("/auth/login", fe.ssoLoginHandler).Methods(http.MethodGet)
+	r.HandleFunc("/auth/callback", fe.ssoCallbackHandler).Methods(http.MethodGet)
+	c.handler = fe.ensureSession(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		log := logrus.New()
+		log.Out = io.Discard
+		c.userID = sessionID(req)
+		r.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), ctxKeyLog{}, logrus.FieldLogger(log))))
+	}))
+	return c
+}
+
+func (c *accountsClient) do(method, path string, form url.Values) *httptest.ResponseRecorder {
+	c.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if c.cookie != nil {
+		req.AddCookie(c.cookie)
+	}
+	rr := httptest.NewRecorder()
+	c.handler.ServeHTTP(rr, req)
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == cookieSessionID {
+			c.cookie = cookie
+		}
+	}
+	return rr
+}
+
+func TestAccounts(t *testing.T) {
+	srv := backendtest.NewServer(t)
+	fe := newTestFrontend(t)
+	fe.cartSvcConn = srv.Conn()
+	fe.sessions = newTestSessions()
+	store, _ := account.NewEmbeddedStore("")
+	fe.accounts = &account.Service{Store: store, HashCost: bcrypt.MinCost}
+	c := newAccountsClient(t, fe)
+
+	// An anonymous visitor fills their cart, then registers.
+	if rr := c.do(http.MethodGet, "/login", nil); rr.Code != http.StatusOK {
+		t.Fatalf("GET /login returned %d", rr.Code)
+	}
+	anonymous, anonymousCookie := c.userID, c.cookie
+	srv.Cart.Add(anonymous, cart.Item{ProductID: "mug", Quantity: 1})
+	rr := c.do(http.MethodPost, "/register", url.Values{
+		"email": {"ada@example.com"}, "name": {"Ada"}, "password": {"correct horse"}, "next": {"/account"},
+	})
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/account" {
+		t.Fatalf("POST /register returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if c.cookie == anonymousCookie {
+		t.Fatal("registering kept the session ID")
+	}
+	a, err := fe.accounts.Login(context.Background(), "ada@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Cart.Get(anonymous); len(got) != 0 {
+		t.Errorf("anonymous cart after registering = %v, want it empty", got)
+	}
+	if got, want := srv.Cart.Get(a.ID), []cart.Item{{ProductID: "mug", Quantity: 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("account cart after registering = %v, want %v", got, want)
+	}
+
+	rr = c.do(http.MethodGet, "/account", nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "ada@example.com") || c.userID != a.ID {
+		t.Fatalf("GET /account returned %d as %s", rr.Code, c.userID)
+	}
+	rr = c.do(http.MethodPost, "/account/addresses", url.Values{
+		"street_address": {"1600 Amphitheatre Parkway"}, "zip_code": {"94043"}, "city": {"Mountain View"}, "state": {"CA"}, "country": {"United States"},
+	})
+	if rr.Code != http.StatusFound {
+		t.Fatalf("POST /account/addresses returned %d", rr.Code)
+	}
+	if got := fe.checkoutFor(context.Background(), logrus.New(), a.ID); got.Email != "ada@example.com" || got.City != "Mountain View" {
+		t.Errorf("checkout details = %+v", got)
+	}
+
+	// The session from before registering is not signed in.
+	old := &accountsClient{t: t, handler: c.handler, cookie: anonymousCookie}
+	rr = old.do(http.MethodGet, "/account", nil)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/login?next=%2Faccount" {
+		t.Errorf("GET /account with the old cookie returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// After signing out, the visitor has a new cart, which joins the
+	// account's when they sign in again.
+	c.do(http.MethodGet, "/logout", nil)
+	c.do(http.MethodGet, "/login", nil)
+	if c.userID == a.ID {
+		t.Fatal("still signed in after signing out")
+	}
+	srv.Cart.Add(c.userID, cart.Item{ProductID: "mug", Quantity: 2})
+	rr = c.do(http.MethodPost, "/login", url.Values{"email": {"ada@example.com"}, "password": {"wrong horse"}})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("POST /login with a wrong password returned %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+	rr = c.do(http.MethodPost, "/login", url.Values{"email": {"ADA@example.com"}, "password": {"correct horse"}, "next": {"https://evil.example/"}})
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/" {
+		t.Fatalf("POST /login returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if got, want := srv.Cart.Get(a.ID), []cart.Item{{ProductID: "mug", Quantity: 3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("account cart after signing in = %v, want %v", got, want)
+	}
+
+	// Orders placed while signed in are kept.
+	fe.recordOrder(context.Background(), logrus.New(), a.ID, &pb.OrderResult{
+		OrderId: "o1",
+		Items:   []*pb.OrderItem{{Item: &pb.CartItem{ProductId: "mug", Quantity: 3}}},
+	}, usd(26, 970000000))
+	rr = c.do(http.MethodGet, "/account", nil)
+	if !strings.Contains(rr.Body.String(), "o1") || !strings.Contains(rr.Body.String(), "26.97") {
+		t.Errorf("account page does not show the order:\n%s", rr.Body)
+	}
+
+	rr = c.do(http.MethodPost, "/register", url.Values{
+		"email": {"ada@example.com"}, "name": {"Ada"}, "password": {"battery staple"},
+	})
+	if rr.Code != http.StatusConflict {
+		t.Errorf("registering a taken address returned %d, want %d", rr.Code, http.StatusConflict)
+	}
+}
@@ -0,0 +1,654 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/validator"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
+)
+
+const (
+	apiPrefix = "/api/v1"
+
+	defaultAPIPageSize = 20
+	maxAPIPageSize     = 100
+
+	// maxAPIBodyBytes bounds the JSON body of API requests.
+	maxAPIBodyBytes = 64 << 10
+)
+
+// apiRoute defines an endpoint of the JSON API. The routes are registered
+// with the router and described in the OpenAPI document from the same table,
+// so the document can't drift from what is served.
+type apiRoute struct {
+	method  string
+	path    string // relative to apiPrefix, with mux-style {variables}
+	name    string // operationId in the OpenAPI document
+	summary string
+	params  []apiParam
+	// request and response are zero values of the JSON bodies, used to
+	// describe them. A nil response means the route has no body.
+	request  interface{}
+	response interface{}
+	status   int // on success, http.StatusOK if zero
+	handle   func(fe *frontendServer, r *http.Request) (interface{}, error)
+}
+
+type apiParam struct {
+	name        string
+	in          string // "path" or "query"
+	typ         string // JSON schema type
+	description string
+}
+
+var currencyParam = apiParam{"currency", "query", "string",
+	"Currency to show prices in. Defaults to the shopper's currency."}
+
+var apiRoutes = []apiRoute{
+	{
+		method: http.MethodGet, path: "/currencies", name: "listCurrencies",
+		summary:  "List the currencies prices can be shown in.",
+		response: apiCurrencies{},
+		handle:   (*frontendServer).apiListCurrencies,
+	},
+	{
+		method: http.MethodGet, path: "/products", name: "listProducts",
+		summary: "List products, a page at a time.",
+		params: []apiParam{
+			{"page_size", "query", "integer", "Maximum number of products to return, at most 100. Defaults to 20."},
+			{"page_token", "query", "string", "nextPageToken of the previous page."},
+			currencyParam,
+		},
+		response: apiProductList{},
+		handle:   (*frontendServer).apiListProducts,
+	},
+	{
+		method: http.MethodGet, path: "/products/{id}", name: "getProduct",
+		summary:  "Get a product with its variants and stock.",
+		params:   []apiParam{{"id", "path", "string", "Product ID."}, currencyParam},
+		response: apiProduct{},
+		handle:   (*frontendServer).apiGetProduct,
+	},
+	{
+		method: http.MethodGet, path: "/cart", name: "getCart",
+		summary:  "Get the shopper's cart with prices and the shipping cost.",
+		params:   []apiParam{currencyParam},
+		response: apiCart{},
+		handle:   (*frontendServer).apiGetCart,
+	},
+	{
+		method: http.MethodPost, path: "/cart/items", name: "addCartItem",
+		summary:  "Add a product to the shopper's cart.",
+		request:  validator.AddToCartPayload{},
+		response: validator.AddToCartPayload{},
+		status:   http.StatusCreated,
+		handle:   (*frontendServer).apiAddCartItem,
+	},
+	{
+		method: http.MethodPatch, path: "/cart/items", name: "updateCartItem",
+		summary:  "Set the quantity of an item in the shopper's cart. Zero removes it.",
+		request:  validator.UpdateCartItemPayload{},
+		response: validator.UpdateCartItemPayload{},
+		handle:   (*frontendServer).apiUpdateCartItem,
+	},
+	{
+		method: http.MethodDelete, path: "/cart/items/{productId}", name: "removeCartItem",
+		summary: "Remove an item from the shopper's cart.",
+		params: []apiParam{
+			{"productId", "path", "string", "Product ID."},
+			{"variant_sku", "query", "string", "SKU of the variant, for products with variants."},
+		},
+		status: http.StatusNoContent,
+		handle: (*frontendServer).apiRemoveCartItem,
+	},
+	{
+		method: http.MethodDelete, path: "/cart", name: "emptyCart",
+		summary: "Remove every item from the shopper's cart.",
+		status:  http.StatusNoContent,
+		handle:  (*frontendServer).apiEmptyCart,
+	},
+	{
+		method: http.MethodGet, path: "/shipping-quote", name: "getShippingQuote",
+		summary:  "Quote the cost of shipping the shopper's cart.",
+		params:   []apiParam{currencyParam},
+		response: apiShippingQuote{},
+		handle:   (*frontendServer).apiGetShippingQuote,
+	},
+	{
+		method: http.MethodPost, path: "/checkout", name: "placeOrder",
+		summary:  "Place an order for the shopper's cart.",
+		params:   []apiParam{currencyParam},
+		request:  validator.PlaceOrderPayload{},
+		response: apiOrder{},
+		handle:   (*frontendServer).apiPlaceOrder,
+	},
+}
+
+// registerAPI serves the JSON API and its OpenAPI document under apiPrefix.
+// Unknown paths and methods get JSON errors rather than the HTML ones.
+func (fe *frontendServer) registerAPI(r *mux.Router) {
+	prefix := baseUrl + apiPrefix
+	allowed := make(map[string][]string)
+	var paths []string
+	for _, route := range apiRoutes {
+		r.HandleFunc(prefix+route.path, fe.apiHandler(route)).Methods(route.method)
+		if allowed[route.path] == nil {
+			paths = append(paths, route.path)
+		}
+		allowed[route.path] = append(allowed[route.path], route.method)
+	}
+	r.HandleFunc(prefix+"/openapi.json", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, openAPIDocument(apiRoutes))
+	}).Methods(http.MethodGet)
+
+	for _, path := range paths {
+		methods := strings.Join(allowed[path], ", ")
+		r.HandleFunc(prefix+path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", methods)
+			renderAPIError(r, w, errors.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		})
+	}
+	r.PathPrefix(prefix + "/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		renderAPIError(r, w, errors.Errorf("no such endpoint %s", r.URL.Path), http.StatusNotFound)
+	})
+}
+
+func (fe *frontendServer) apiHandler(route apiRoute) http.HandlerFunc {
+	code := route.status
+	if code == 0 {
+		code = http.StatusOK
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := route.handle(fe, r)
+		if err != nil {
+			renderAPIError(r, w, err, httpStatus(err, http.StatusInternalServerError))
+			return
+		}
+		if body == nil {
+			w.WriteHeader(code)
+			return
+		}
+		writeJSON(w, code, body)
+	}
+}
+
+// apiError is the body of every API error response.
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	Code      int    `json:"code"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+func renderAPIError(r *http.Request, w http.ResponseWriter, err error, code int) {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	log.WithField("error", err).WithField("status", code).Error("api request error")
+	writeJSON(w, code, newAPIError(r, err, code))
+}
+
+// newAPIError returns the body reporting err with the HTTP status code, with
+// only its publicMessage.
+func newAPIError(r *http.Request, err error, code int) apiError {
+	requestID, _ := r.Context().Value(ctxKeyRequestID{}).(string)
+	return apiError{apiErrorDetail{
+		Code:      code,
+		Status:    http.StatusText(code),
+		Message:   publicMessage(err, code),
+		RequestID: requestID,
+	}}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// decodeJSON decodes the JSON request body into v, rejecting unknown fields.
+func decodeJSON(r *http.Request, v interface{}) error {
+	return decodeJSONLimit(r, v, maxAPIBodyBytes)
+}
+
+// decodeJSONLimit is decodeJSON for bodies of up to limit bytes. Larger
+// bodies are refused with 413 Request Entity Too Large.
+func decodeJSONLimit(r *http.Request, v interface{}, limit int64) error {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mt, _, _ := mime.ParseMediaType(ct); mt != "application/json" {
+			return withStatus(http.StatusUnsupportedMediaType, errors.Errorf("unsupported content type %q, want application/json", ct))
+		}
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, limit))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return withStatus(http.StatusRequestEntityTooLarge, errors.Errorf("request body larger than %d bytes", limit))
+		}
+		return withStatus(http.StatusBadRequest, errors.Wrap(err, "invalid request body"))
+	}
+	return nil
+}
+
+// apiCurrency returns the currency requested with the currency query
+// parameter, or else the shopper's currency.
+func apiCurrency(r *http.Request) (string, error) {
+	c := strings.ToUpper(r.URL.Query().Get("currency"))
+	if c == "" {
+		return currentCurrency(r), nil
+	}
+	if !supportedCurrencies.isSupported(c) {
+		return "", withStatus(http.StatusBadRequest, errors.Errorf("currency %s is not supported", c))
+	}
+	return c, nil
+}
+
+// apiMoney encodes an amount as {"currencyCode": "EUR", "amount": "12.3"}.
+type apiMoney struct{ m *pb.Money }
+
+func (m apiMoney) MarshalJSON() ([]byte, error) {
+	if m.m == nil {
+		return []byte("null"), nil
+	}
+	return money.MarshalJSON(m.m)
+}
+
+type apiCurrencies struct {
+	Currencies []string `json:"currencies"`
+	Current    string   `json:"current"`
+}
+
+type apiProductList struct {
+	Products      []apiProduct `json:"products"`
+	NextPageToken string       `json:"nextPageToken,omitempty"`
+}
+
+type apiProduct struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Picture     string       `json:"picture"`
+	Images      []string     `json:"images,omitempty"`
+	Categories  []string     `json:"categories"`
+	Price       apiMoney     `json:"price"`
+	Variants    []apiVariant `json:"variants,omitempty"`
+	// InStock is only set when stock levels were requested and known.
+	InStock *bool `json:"inStock,omitempty"`
+}
+
+type apiVariant struct {
+	SKU        string            `json:"sku"`
+	Name       string            `json:"name"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Images     []string          `json:"images,omitempty"`
+	Price      apiMoney          `json:"price"`
+	InStock    *bool             `json:"inStock,omitempty"`
+}
+
+type apiCart struct {
+	Items        []apiCartItem `json:"items"`
+	Size         int           `json:"size"`
+	ShippingCost apiMoney      `json:"shippingCost"`
+	Total        apiMoney      `json:"total"`
+}
+
+type apiCartItem struct {
+	ProductID  string   `json:"productId"`
+	VariantSKU string   `json:"variantSku,omitempty"`
+	Name       string   `json:"name"`
+	Picture    string   `json:"picture"`
+	Quantity   int32    `json:"quantity"`
+	UnitPrice  apiMoney `json:"unitPrice"`
+	Price      apiMoney `json:"price"`
+	InStock    bool     `json:"inStock"`
+}
+
+type apiShippingQuote struct {
+	Cost apiMoney `json:"cost"`
+}
+
+type apiOrder struct {
+	OrderID            string         `json:"orderId"`
+	ShippingTrackingID string         `json:"shippingTrackingId"`
+	ShippingCost       apiMoney       `json:"shippingCost"`
+	ShippingAddress    apiAddress     `json:"shippingAddress"`
+	Items              []apiOrderItem `json:"items"`
+	Total              apiMoney       `json:"total"`
+}
+
+type apiAddress struct {
+	StreetAddress string `json:"streetAddress"`
+	City          string `json:"city"`
+	State         string `json:"state"`
+	Country       string `json:"country"`
+	ZipCode       int32  `json:"zipCode"`
+}
+
+type apiOrderItem struct {
+	ProductID  string   `json:"productId"`
+	VariantSKU string   `json:"variantSku,omitempty"`
+	Quantity   int32    `json:"quantity"`
+	Cost       apiMoney `json:"cost"`
+}
+
+func (fe *frontendServer) apiListCurrencies(r *http.Request) (interface{}, error) {
+	currencies, err := fe.getCurrencies(r.Context())
+	if err != nil {
+		return nil, errors.Wrap(err, "could not retrieve currencies")
+	}
+	return apiCurrencies{Currencies: currencies, Current: currentCurrency(r)}, nil
+}
+
+func (fe *frontendServer) apiListProducts(r *http.Request) (interface{}, error) {
+	currency, err := apiCurrency(r)
+	if err != nil {
+		return nil, err
+	}
+	size, offset := defaultAPIPageSize, 0
+	if v := r.URL.Query().Get("page_size"); v != "" {
+		if size, err = strconv.Atoi(v); err != nil || size < 1 || size > maxAPIPageSize {
+			return nil, withStatus(http.StatusBadRequest, errors.Errorf("page_size must be between 1 and %d", maxAPIPageSize))
+		}
+	}
+	// Page tokens are opaque to clients; they hold the offset of the page.
+	if v := r.URL.Query().Get("page_token"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return nil, withStatus(http.StatusBadRequest, errors.New("invalid page_token"))
+		}
+	}
+
+	products, err := fe.getProducts(r.Context())
+	if err != nil {
+		return nil, errors.Wrap(err, "could not retrieve products")
+	}
+	var list apiProductList
+	if offset < len(products) {
+		end := min(offset+size, len(products))
+		if end < len(products) {
+			list.NextPageToken = strconv.Itoa(end)
+		}
+		products = products[offset:end]
+	} else {
+		products = nil
+	}
+	if list.Products, err = fe.apiProducts(r.Context(), products, currency, nil); err != nil {
+		return nil, errors.Wrap(err, "could not convert prices")
+	}
+	return list, nil
+}
+
+func (fe *frontendServer) apiGetProduct(r *http.Request) (interface{}, error) {
+	currency, err := apiCurrency(r)
+	if err != nil {
+		return nil, err
+	}
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	p, err := fe.getProduct(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return nil, errors.Wrap(err, "could not retrieve product")
+	}
+
+	var stock map[string]*pb.StockLevel
+	pg := newPage(r.Context(), "api_product", log)
+	defer pg.close()
+	// stock levels are optional since checkout enforces them
+	pg.optional("stock", optionalFragmentTimeout, func(ctx context.Context) (err error) {
+		stock, err = fe.getStock(ctx, productSKUs(p))
+		return err
+	})
+	if err := pg.wait(); err != nil {
+		return nil, err
+	}
+	products, err := fe.apiProducts(r.Context(), []*pb.Product{p}, currency, stock)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not convert prices")
+	}
+	return products[0], nil
+}
+
+// apiProducts describes products with their prices converted to currency,
+// looking the rates up in one batch. Stock is reported if stock is not nil.
+func (fe *frontendServer) apiProducts(ctx context.Context, products []*pb.Product, currency string, stock map[string]*pb.StockLevel) ([]apiProduct, error) {
+	var pricesUsd []*pb.Money
+	for _, p := range products {
+		pricesUsd = append(pricesUsd, p.GetPriceUsd())
+		for _, v := range p.GetVariants() {
+			pricesUsd = append(pricesUsd, unitPriceUsd(p, v))
+		}
+	}
+	prices, err := fe.convertCurrencies(ctx, pricesUsd, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]apiProduct, len(products))
+	for i, p := range products {
+		out[i] = apiProduct{
+			ID:          p.GetId(),
+			Name:        p.GetName(),
+			Description: p.GetDescription(),
+			Picture:     p.GetPicture(),
+			Images:      p.GetImages(),
+			Categories:  p.GetCategories(),
+			Price:       apiMoney{prices[0]},
+		}
+		prices = prices[1:]
+		inStockAny := len(p.GetVariants()) == 0 && inStock(stock, p.GetId(), 1)
+		for _, v := range p.GetVariants() {
+			variant := apiVariant{
+				SKU:        v.GetSku(),
+				Name:       v.GetName(),
+				Attributes: v.GetAttributes(),
+				Images:     v.GetImages(),
+				Price:      apiMoney{prices[0]},
+			}
+			prices = prices[1:]
+			if stock != nil {
+				available := inStock(stock, v.GetSku(), 1)
+				variant.InStock = &available
+				inStockAny = inStockAny || available
+			}
+			out[i].Variants = append(out[i].Variants, variant)
+		}
+		if stock != nil {
+			out[i].InStock = &inStockAny
+		}
+	}
+	return out, nil
+}
+
+func (fe *frontendServer) apiGetCart(r *http.Request) (interface{}, error) {
+	currency, err := apiCurrency(r)
+	if err != nil {
+		return nil, err
+	}
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	cart, err := fe.getCart(r.Context(), sessionID(r))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not retrieve cart")
+	}
+
+	var (
+		shippingCost *pb.Money
+		stock        map[string]*pb.StockLevel
+		products     = make([]*pb.Product, len(cart))
+	)
+	skus := make([]string, len(cart))
+	for i, item := range cart {
+		skus[i] = stockKey(item.GetProductId(), item.GetVariantSku())
+	}
+	pg := newPage(r.Context(), "api_cart", log)
+	defer pg.close()
+	pg.critical("shipping quote", criticalFragmentTimeout, func(ctx context.Context) (err error) {
+		shippingCost, err = fe.getShippingQuote(ctx, cart, currency)
+		return err
+	})
+	// stock levels are optional since checkout enforces them
+	pg.optional("stock", optionalFragmentTimeout, func(ctx context.Context) (err error) {
+		stock, err = fe.getStock(ctx, skus)
+		return err
+	})
+	for i, item := range cart {
+		pg.critical("product #"+item.GetProductId(), criticalFragmentTimeout, func(ctx context.Context) (err error) {
+			products[i], err = fe.getProduct(ctx, item.GetProductId())
+			return err
+		})
+	}
+	if err := pg.wait(); err != nil {
+		return nil, err
+	}
+
+	unitPricesUsd := make([]*pb.Money, len(cart))
+	for i, item := range cart {
+		unitPricesUsd[i] = unitPriceUsd(products[i], findVariant(products[i], item.GetVariantSku()))
+	}
+	unitPrices, err := fe.convertCurrencies(r.Context(), unitPricesUsd, currency)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not convert currency for cart items")
+	}
+
+	out := apiCart{Items: make([]apiCartItem, len(cart)), Size: cartSize(cart), ShippingCost: apiMoney{shippingCost}}
+	total := &pb.Money{CurrencyCode: currency}
+	for i, item := range cart {
+		price := money.Must(money.Multiply(unitPrices[i], int64(item.GetQuantity())))
+		out.Items[i] = apiCartItem{
+			ProductID:  item.GetProductId(),
+			VariantSKU: item.GetVariantSku(),
+			Name:       products[i].GetName(),
+			Picture:    products[i].GetPicture(),
+			Quantity:   item.GetQuantity(),
+			UnitPrice:  apiMoney{unitPrices[i]},
+			Price:      apiMoney{price},
+			InStock:    inStock(stock, skus[i], item.GetQuantity()),
+		}
+		total = money.Must(money.Sum(total, price))
+	}
+	out.Total = apiMoney{money.Must(money.Sum(total, shippingCost))}
+	return out, nil
+}
+
+func (fe *frontendServer) apiAddCartItem(r *http.Request) (interface{}, error) {
+	var payload validator.AddToCartPayload
+	if err := decodeJSON(r, &payload); err != nil {
+		return nil, err
+	}
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	if err := fe.addToCart(r.Context(), log, sessionID(r), payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (fe *frontendServer) apiUpdateCartItem(r *http.Request) (interface{}, error) {
+	var payload validator.UpdateCartItemPayload
+	if err := decodeJSON(r, &payload); err != nil {
+		return nil, err
+	}
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	if err := fe.updateCartItemQuantity(r.Context(), log, sessionID(r), payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (fe *frontendServer) apiRemoveCartItem(r *http.Request) (interface{}, error) {
+	payload := validator.RemoveCartItemPayload{
+		ProductID:  mux.Vars(r)["productId"],
+		VariantSKU: r.URL.Query().Get("variant_sku"),
+	}
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	return nil, fe.removeFromCart(r.Context(), log, sessionID(r), payload)
+}
+
+func (fe *frontendServer) apiEmptyCart(r *http.Request) (interface{}, error) {
+	if err := fe.emptyCart(r.Context(), sessionID(r)); err != nil {
+		recordCartOperation("empty", "error")
+		return nil, errors.Wrap(err, "failed to empty cart")
+	}
+	recordCartOperation("empty", "success")
+	return nil, nil
+}
+
+func (fe *frontendServer) apiGetShippingQuote(r *http.Request) (interface{}, error) {
+	currency, err := apiCurrency(r)
+	if err != nil {
+		return nil, err
+	}
+	cart, err := fe.getCart(r.Context(), sessionID(r))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not retrieve cart")
+	}
+	cost, err := fe.getShippingQuote(r.Context(), cart, currency)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get shipping quote")
+	}
+	return apiShippingQuote{Cost: apiMoney{cost}}, nil
+}
+
+func (fe *frontendServer) apiPlaceOrder(r *http.Request) (interface{}, error) {
+	currency, err := apiCurrency(r)
+	if err != nil {
+		return nil, err
+	}
+	var payload validator.PlaceOrderPayload
+	if err := decodeJSON(r, &payload); err != nil {
+		return nil, err
+	}
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	order, total, err := fe.placeOrder(r.Context(), log, sessionID(r), currency, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	a := order.GetShippingAddress()
+	out := apiOrder{
+		OrderID:            order.GetOrderId(),
+		ShippingTrackingID: order.GetShippingTrackingId(),
+		ShippingCost:       apiMoney{order.GetShippingCost()},
+		ShippingAddress: apiAddress{
+			StreetAddress: a.GetStreetAddress(),
+			City:          a.GetCity(),
+			State:         a.GetState(),
+			Country:       a.GetCountry(),
+			ZipCode:       a.GetZipCode(),
+		},
+		Items: make([]apiOrderItem, len(order.GetItems())),
+		Total: apiMoney{total},
+	}
+	for i, item := range order.GetItems() {
+		out.Items[i] = apiOrderItem{
+			ProductID:  item.GetItem().GetProductId(),
+			VariantSKU: item.GetItem().GetVariantSku(),
+			Quantity:   item.GetItem().GetQuantity(),
+			Cost:       apiMoney{item.GetCost()},
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,321 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/backendtest"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/cart"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+)
+
+// newTestFrontend returns a frontend with products from a fake catalog.
+// Other backends are unreachable.
+func newTestFrontend(t *testing.T, products ...*pb.Product) *frontendServer {
+	catalog := newFakeCatalog()
+	for _, p := range products {
+		catalog.set(p)
+	}
+	fe := &frontendServer{inventorySvcConn: unreachableConn(t), cartSvcConn: unreachableConn(t)}
+	fe.products = newProductCache(time.Minute, 100, catalog.get, catalog.list)
+	return fe
+}
+
+// newAPITestServer serves the API of newTestFrontend.
+func newAPITestServer(t *testing.T, products ...*pb.Product) http.Handler {
+	r := mux.NewRouter()
+	newTestFrontend(t, products...).registerAPI(r)
+	return r
+}
+
+func serveAPI(t *testing.T, h http.Handler, method, path, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	req := createTestRequest(method, path, "")
+	if body != "" {
+		req = createTestRequest(method, path, body)
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	var out map[string]interface{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("%s %s: invalid JSON %q: %v", method, path, w.Body.String(), err)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Errorf("%s %s: Content-Type = %q", method, path, ct)
+		}
+	}
+	return w, out
+}
+
+func usd(units int64, nanos int32) *pb.Money {
+	return &pb.Money{CurrencyCode: "USD", Units: units, Nanos: nanos}
+}
+
+func TestAPIListProducts(t *testing.T) {
+	var products []*pb.Product
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		products = append(products, &pb.Product{Id: id, Name: id, PriceUsd: usd(1, 500000000)})
+	}
+	h := newAPITestServer(t, products...)
+
+	var ids []string
+	path := "/api/v1/products?page_size=2"
+	for pages := 0; path != ""; pages++ {
+		if pages == 3 {
+			t.Fatal("too many pages")
+		}
+		w, body := serveAPI(t, h, http.MethodGet, path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d %s", path, w.Code, w.Body)
+		}
+		for _, p := range body["products"].([]interface{}) {
+			p := p.(map[string]interface{})
+			ids = append(ids, p["id"].(string))
+			if price := p["price"].(map[string]interface{}); price["amount"] != "1.5" || price["currencyCode"] != "USD" {
+				t.Errorf("price = %v", price)
+			}
+		}
+		path = ""
+		if token, ok := body["nextPageToken"].(string); ok {
+			path = "/api/v1/products?page_size=2&page_token=" + token
+		}
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("listed %v, want %v", ids, want)
+	}
+
+	for _, query := range []string{"page_size=0", "page_size=101", "page_token=x", "currency=XYZ"} {
+		if w, _ := serveAPI(t, h, http.MethodGet, "/api/v1/products?"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /api/v1/products?%s = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAPIGetProduct(t *testing.T) {
+	h := newAPITestServer(t, &pb.Product{
+		Id:       "shirt",
+		Name:     "Shirt",
+		PriceUsd: usd(10, 0),
+		Variants: []*pb.ProductVariant{
+			{Sku: "shirt-s", Name: "S"},
+			{Sku: "shirt-xl", Name: "XL", PriceOverrideUsd: usd(12, 990000000)},
+		},
+	})
+
+	w, body := serveAPI(t, h, http.MethodGet, "/api/v1/products/shirt", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d %s", w.Code, w.Body)
+	}
+	variants := body["variants"].([]interface{})
+	var prices []string
+	for _, v := range variants {
+		prices = append(prices, v.(map[string]interface{})["price"].(map[string]interface{})["amount"].(string))
+	}
+	if want := []string{"10", "12.99"}; !reflect.DeepEqual(prices, want) {
+		t.Errorf("variant prices = %v, want %v", prices, want)
+	}
+	if _, ok := body["inStock"]; ok {
+		t.Error("inStock should be omitted when stock levels are unavailable")
+	}
+	if got := w.Header().Get("X-Skipped-Fragments"); got != "" {
+		t.Errorf("X-Skipped-Fragments = %q, the API does not report skipped fragments", got)
+	}
+
+	w, body = serveAPI(t, h, http.MethodGet, "/api/v1/products/missing", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("missing product: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	apiErr := body["error"].(map[string]interface{})
+	if apiErr["code"] != float64(http.StatusNotFound) || apiErr["status"] != "Not Found" ||
+		!strings.Contains(apiErr["message"].(string), "no product with ID missing") ||
+		apiErr["requestId"] != "test-request-123" {
+		t.Errorf("error = %v", apiErr)
+	}
+}
+
+func TestAPICartItems(t *testing.T) {
+	srv := backendtest.NewServer(t)
+	srv.Cart.Add("", cart.Item{ProductID: "mug", Quantity: 1})
+	srv.Cart.Add("", cart.Item{ProductID: "shirt", VariantSKU: "shirt-s", Quantity: 2})
+	fe := newTestFrontend(t)
+	fe.cartSvcConn = srv.Conn()
+	h := mux.NewRouter()
+	fe.registerAPI(h)
+
+	w, body := serveAPI(t, h, http.MethodPatch, "/api/v1/cart/items", `{"productId":"shirt","variantSku":"shirt-s","quantity":3}`)
+	if w.Code != http.StatusOK || body["quantity"] != float64(3) {
+		t.Fatalf("PATCH = %d %s", w.Code, w.Body)
+	}
+	w, _ = serveAPI(t, h, http.MethodPatch, "/api/v1/cart/items", `{"productId":"hat","quantity":1}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("PATCH of a missing item = %d, want 404", w.Code)
+	}
+	w, _ = serveAPI(t, h, http.MethodDelete, "/api/v1/cart/items/mug", "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d %s", w.Code, w.Body)
+	}
+	if got, want := srv.Cart.Get(""), []cart.Item{{ProductID: "shirt", VariantSKU: "shirt-s", Quantity: 3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cart = %v, want %v", got, want)
+	}
+}
+
+func TestAPIPlaceOrder(t *testing.T) {
+	srv := backendtest.NewServer(t)
+	backendtest.Handle(srv, "CheckoutService/PlaceOrder", func(ctx context.Context, req *pb.PlaceOrderRequest) (*pb.PlaceOrderResponse, error) {
+		if req.GetCreditCard().GetCreditCardNumber() == "4000000000000002" {
+			return nil, status.Error(codes.FailedPrecondition, "out of stock: mug")
+		}
+		return &pb.PlaceOrderResponse{Order: &pb.OrderResult{
+			OrderId:         "o1",
+			ShippingCost:    usd(8, 990000000),
+			ShippingAddress: req.GetAddress(),
+			Items: []*pb.OrderItem{
+				{Item: &pb.CartItem{ProductId: "mug", Quantity: 2}, Cost: usd(8, 990000000)},
+			},
+		}}, nil
+	})
+	fe := newTestFrontend(t)
+	fe.checkoutSvcConn = srv.Conn()
+	h := mux.NewRouter()
+	fe.registerAPI(h)
+	order := `{"email":"someone@example.com","streetAddress":"1600 Amphitheatre Parkway","zipCode":94043,` +
+		`"city":"Mountain View","state":"CA","country":"US","creditCardNumber":"%s",` +
+		`"creditCardExpirationMonth":1,"creditCardExpirationYear":2039,"creditCardCvv":672}`
+
+	w, body := serveAPI(t, h, http.MethodPost, "/api/v1/checkout", fmt.Sprintf(order, "4432801561520454"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /checkout = %d %s", w.Code, w.Body)
+	}
+	if total := body["total"].(map[string]interface{}); total["amount"] != "26.97" {
+		t.Errorf("total = %v, want 26.97", total)
+	}
+	reqs := backendtest.Calls[*pb.PlaceOrderRequest](srv, "CheckoutService/PlaceOrder")
+	if len(reqs) != 1 || reqs[0].GetUserCurrency() != "USD" || reqs[0].GetAddress().GetZipCode() != 94043 {
+		t.Errorf("PlaceOrder requests = %v", reqs)
+	}
+
+	w, _ = serveAPI(t, h, http.MethodPost, "/api/v1/checkout", fmt.Sprintf(order, "4000000000000002"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("POST /checkout out of stock = %d, want 409", w.Code)
+	}
+	srv.SetError("CheckoutService", status.Error(codes.Unavailable, "down"))
+	w, _ = serveAPI(t, h, http.MethodPost, "/api/v1/checkout", fmt.Sprintf(order, "4432801561520454"))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("POST /checkout with checkout down = %d, want 503", w.Code)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	h := newAPITestServer(t, &pb.Product{Id: "a", PriceUsd: usd(1, 0)})
+	tests := []struct {
+		name, method, path, body string
+		want                     int
+	}{
+		{"unknown endpoint", http.MethodGet, "/api/v1/nope", "", http.StatusNotFound},
+		{"wrong method", http.MethodPut, "/api/v1/cart", "", http.StatusMethodNotAllowed},
+		{"malformed body", http.MethodPost, "/api/v1/cart/items", `{"quantity":`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/api/v1/cart/items", `{"productId":"a","quantity":1,"size":"L"}`, http.StatusBadRequest},
+		{"invalid payload", http.MethodPost, "/api/v1/cart/items", `{"productId":"a","quantity":0}`, http.StatusUnprocessableEntity},
+		{"invalid variant", http.MethodPost, "/api/v1/cart/items", `{"productId":"a","quantity":1,"variantSku":"a-l"}`, http.StatusUnprocessableEntity},
+		{"missing product", http.MethodPost, "/api/v1/cart/items", `{"productId":"b","quantity":1}`, http.StatusNotFound},
+		{"backend unavailable", http.MethodGet, "/api/v1/cart", "", http.StatusServiceUnavailable},
+		{"invalid order", http.MethodPost, "/api/v1/checkout", `{"email":"not an email"}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, body := serveAPI(t, h, tt.method, tt.path, tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			apiErr, ok := body["error"].(map[string]interface{})
+			if !ok || apiErr["code"] != float64(tt.want) || apiErr["message"] == "" {
+				t.Errorf("body = %s, want a JSON error", w.Body)
+			}
+		})
+	}
+
+	w, _ := serveAPI(t, h, http.MethodPut, "/api/v1/cart", "")
+	if got := w.Header().Get("Allow"); got != "GET, DELETE" {
+		t.Errorf("Allow = %q", got)
+	}
+	req := createTestRequest(http.MethodPost, "/api/v1/cart/items", "productId=a")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("form body: status = %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	h := newAPITestServer(t)
+	w, doc := serveAPI(t, h, http.MethodGet, "/api/v1/openapi.json", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	paths := doc["paths"].(map[string]interface{})
+	for _, route := range apiRoutes {
+		op, ok := paths[route.path].(map[string]interface{})[strings.ToLower(route.method)].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s %s is not documented", route.method, route.path)
+			continue
+		}
+		if op["operationId"] != route.name {
+			t.Errorf("%s %s: operationId = %v", route.method, route.path, op["operationId"])
+		}
+	}
+
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	required := schemas["AddToCartPayload"].(map[string]interface{})["required"]
+	if want := []interface{}{"quantity", "productId"}; !reflect.DeepEqual(required, want) {
+		t.Errorf("AddToCartPayload required = %v, want %v", required, want)
+	}
+
+	// Every reference resolves.
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				if _, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+					t.Errorf("unresolved reference %s", ref)
+				}
+			}
+			for _, e := range v {
+				walk(e)
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(doc)
+}
@@ -0,0 +1,179 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package assistant is a client of the shopping assistant service, which
+// answers shoppers' questions about the catalog with a language model.
+//
+// The assistant is sent a JSON Request. It answers with a JSON object whose
+// content is the whole answer, or, if it streams its answer, with server-sent
+// events whose data are JSON objects holding the next piece of the answer as
+// their content, optionally ending with an event whose data is [DONE].
+package assistant
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds a turn of the conversation if the Client has no
+	// Timeout. Answers take two calls to the language model.
+	DefaultTimeout = time.Minute
+	// maxAnswerBytes bounds the answer read from the assistant.
+	maxAnswerBytes = 1 << 20
+	// maxErrorBytes is how much of the body of a failed response is kept
+	// in the Error.
+	maxErrorBytes = 512
+)
+
+// Message is a past message of the conversation.
+type Message struct {
+	// Role is "user" for the shopper's messages and "assistant" for the
+	// answers.
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Request is a turn of the conversation.
+type Request struct {
+	Message string `json:"message"`
+	// Image is a data URL of a picture of the shopper's room, if any.
+	Image string `json:"image,omitempty"`
+	// History is the conversation so far, oldest first.
+	History []Message `json:"history,omitempty"`
+}
+
+// Error is a failure response of the assistant.
+type Error struct {
+	StatusCode int
+	// Body is the start of the response body.
+	Body string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("assistant returned %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// Client talks to the shopping assistant. It is safe for concurrent use.
+type Client struct {
+	// URL is the address requests are posted to.
+	URL string
+	// Timeout bounds each call to Chat, including reading a streamed answer;
+	// DefaultTimeout if zero.
+	Timeout time.Duration
+	// HTTPClient sends the requests; http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// Chat sends a turn of the conversation to the assistant and returns its
+// answer. If the assistant streams the answer, onDelta, if not nil, is called
+// with each piece as it arrives; if onDelta fails, so does Chat. The call is
+// cancelled with ctx.
+func (c *Client) Chat(ctx context.Context, req *Request, onDelta func(string) error) (string, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream, application/json;q=0.9")
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBytes))
+		return "", &Error{StatusCode: res.StatusCode, Body: strings.TrimSpace(string(b))}
+	}
+	answer := io.LimitReader(res.Body, maxAnswerBytes)
+	if mt, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mt == "text/event-stream" {
+		return readStream(answer, onDelta)
+	}
+	var out struct {
+		Content *string `json:"content"`
+	}
+	if err := json.NewDecoder(answer).Decode(&out); err != nil {
+		return "", fmt.Errorf("invalid answer from assistant: %w", err)
+	}
+	if out.Content == nil {
+		return "", errors.New("invalid answer from assistant: no content")
+	}
+	return *out.Content, nil
+}
+
+// readStream reads an answer streamed as server-sent events.
+func readStream(r io.Reader, onDelta func(string) error) (string, error) {
+	var answer, data strings.Builder
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), maxAnswerBytes)
+	for sc.Scan() {
+		line := sc.Text()
+		if v, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(v, " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue // other fields, comments and empty events
+		}
+		// A blank line ends the event.
+		if data.String() == "[DONE]" {
+			return answer.String(), nil
+		}
+		var event struct {
+			Content string `json:"content"`
+		}
+		if err := json.Unmarshal([]byte(data.String()), &event); err != nil {
+			return "", fmt.Errorf("invalid event from assistant: %w", err)
+		}
+		data.Reset()
+		answer.WriteString(event.Content)
+		if onDelta != nil && event.Content != "" {
+			if err := onDelta(event.Content); err != nil {
+				return "", err
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+	return answer.String(), nil
+}
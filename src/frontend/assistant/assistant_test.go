@@ -0,0 +1,135 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package assistant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChat(t *testing.T) {
+	var got Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"content": "Try the [0PUK6V6EV0] sunglasses."}`)
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL}
+	req := &Request{
+		Message: "sunglasses?",
+		History: []Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "Hello!"}},
+	}
+	answer, err := c.Chat(context.Background(), req, func(string) error {
+		t.Error("onDelta called for an answer that was not streamed")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "Try the [0PUK6V6EV0] sunglasses." {
+		t.Errorf("answer = %q", answer)
+	}
+	if !reflect.DeepEqual(&got, req) {
+		t.Errorf("assistant got %+v, want %+v", got, req)
+	}
+}
+
+func TestChatStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": thinking\n\n")
+		fmt.Fprint(w, "data: {\"content\": \"Try the \"}\n\n")
+		fmt.Fprint(w, "event: delta\ndata: {\"content\":\n")
+		fmt.Fprint(w, "data: \"sunglasses.\"}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		fmt.Fprint(w, "data: {\"content\": \"ignored\"}\n\n")
+	}))
+	defer srv.Close()
+
+	var deltas []string
+	answer, err := (&Client{URL: srv.URL}).Chat(context.Background(), &Request{Message: "hi"}, func(d string) error {
+		deltas = append(deltas, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Try the ", "sunglasses."}; answer != "Try the sunglasses." || !reflect.DeepEqual(deltas, want) {
+		t.Errorf("answer = %q in %q, want %q in %q", answer, deltas, "Try the sunglasses.", want)
+	}
+
+	stop := errors.New("client gone")
+	if _, err := (&Client{URL: srv.URL}).Chat(context.Background(), &Request{Message: "hi"}, func(string) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("Chat with a failing onDelta returned %v, want %v", err, stop)
+	}
+}
+
+func TestChatErrors(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fail":
+			http.Error(w, "KeyError: 'image'", http.StatusInternalServerError)
+		case "/slow":
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		case "/garbage":
+			fmt.Fprint(w, "<html>")
+		case "/empty":
+			fmt.Fprint(w, "{}")
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	_, err := (&Client{URL: srv.URL + "/fail"}).Chat(context.Background(), &Request{Message: "hi"}, nil)
+	var assistantErr *Error
+	if !errors.As(err, &assistantErr) || assistantErr.StatusCode != http.StatusInternalServerError || assistantErr.Body != "KeyError: 'image'" {
+		t.Errorf("failing assistant: Chat returned %v", err)
+	}
+
+	start := time.Now()
+	_, err = (&Client{URL: srv.URL + "/slow", Timeout: 50 * time.Millisecond}).Chat(context.Background(), &Request{Message: "hi"}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second {
+		t.Errorf("slow assistant: Chat returned %v after %v", err, time.Since(start))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = (&Client{URL: srv.URL + "/slow"}).Chat(ctx, &Request{Message: "hi"}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Chat returned %v", err)
+	}
+
+	for _, path := range []string{"/garbage", "/empty"} {
+		if _, err := (&Client{URL: srv.URL + path}).Chat(context.Background(), &Request{Message: "hi"}, nil); err == nil {
+			t.Errorf("Chat accepted the answer from %s", path)
+		}
+	}
+}
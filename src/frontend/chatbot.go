@@ -0,0 +1,247 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/assistant"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/session"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/validator"
+)
+
+const (
+	// maxChatBodyBytes bounds messages to the assistant, which may carry a
+	// picture.
+	maxChatBodyBytes = 8 << 20
+	// sessionKeyChatHistory is the session value holding the conversation
+	// with the assistant.
+	sessionKeyChatHistory = "chat_history"
+	// maxChatHistory is how many of the latest messages of the conversation
+	// are kept and sent along with the next one, and maxChatHistoryRunes how
+	// much of each.
+	maxChatHistory      = 10
+	maxChatHistoryRunes = 2000
+	// chatKeepAlive is how often a streamed answer gets a comment while the
+	// assistant thinks, so that proxies do not drop the idle connection.
+	chatKeepAlive = 15 * time.Second
+)
+
+// chatBotHandler passes the shopper's message to the shopping assistant, with
+// the conversation so far, and returns the answer. Clients that accept
+// text/event-stream get it as server-sent events: "delta" events with pieces
+// of the answer as the assistant streams them, then a "done" event with the
+// whole answer, or an "error" event. Other clients get a JSON object with the
+// whole answer as its message.
+func (fe *frontendServer) chatBotHandler(w http.ResponseWriter, r *http.Request) {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	s, ok := r.Context().Value(ctxKeySession{}).(*session.Session)
+	if !ok {
+		renderAPIError(r, w, errNoSession, http.StatusInternalServerError)
+		return
+	}
+	var payload validator.ChatPayload
+	if err := decodeJSONLimit(r, &payload, maxChatBodyBytes); err != nil {
+		renderAPIError(r, w, err, httpStatus(err, http.StatusBadRequest))
+		return
+	}
+	payload.Message = strings.TrimSpace(payload.Message)
+	if err := payload.Validate(); err != nil {
+		renderAPIError(r, w, validator.ValidationErrorResponse(err), http.StatusUnprocessableEntity)
+		return
+	}
+	history := chatHistory(s)
+	req := &assistant.Request{Message: payload.Message, Image: payload.Image, History: history}
+
+	var events *sseWriter
+	var onDelta func(string) error
+	if acceptsEventStream(r) {
+		if events = newSSEWriter(w); events != nil {
+			stop := events.keepAlive(chatKeepAlive)
+			defer stop()
+			onDelta = func(d string) error { return events.send("delta", map[string]string{"content": d}) }
+		}
+	}
+	answer, err := fe.assistant.Chat(r.Context(), req, onDelta)
+	if err != nil {
+		if r.Context().Err() != nil {
+			log.WithField("error", err).Debug("shopper left before the assistant answered")
+			return
+		}
+		code := assistantStatus(err)
+		if events == nil {
+			renderAPIError(r, w, errors.Wrap(err, "failed to ask the shopping assistant"), code)
+			return
+		}
+		log.WithField("error", err).WithField("status", code).Error("api request error")
+		events.send("error", newAPIError(r, err, code))
+		return
+	}
+
+	history = append(history,
+		assistant.Message{Role: "user", Content: payload.Message},
+		assistant.Message{Role: "assistant", Content: answer})
+	setChatHistory(s, history)
+	if err := fe.sessions.Save(r.Context(), s); err != nil {
+		// The shopper still gets the answer, which the assistant will not
+		// remember.
+		log.WithField("error", err).Warn("failed to save the conversation with the shopping assistant")
+	}
+	if events != nil {
+		events.send("done", map[string]string{"message": answer})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": answer})
+}
+
+// assistantStatus returns the HTTP status to report a failure to ask the
+// assistant with.
+func assistantStatus(err error) int {
+	var assistantErr *assistant.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &assistantErr) && retryable(assistantErr.StatusCode):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+// chatHistory returns the conversation kept in the session.
+func chatHistory(s *session.Session) []assistant.Message {
+	var history []assistant.Message
+	if v := s.Get(sessionKeyChatHistory); v != "" {
+		// A history that does not decode is started afresh.
+		_ = json.Unmarshal([]byte(v), &history)
+	}
+	return history
+}
+
+// setChatHistory keeps the latest messages of the conversation in the session.
+func setChatHistory(s *session.Session, history []assistant.Message) {
+	if len(history) > maxChatHistory {
+		history = history[len(history)-maxChatHistory:]
+	}
+	for i, m := range history {
+		if r := []rune(m.Content); len(r) > maxChatHistoryRunes {
+			history[i].Content = string(r[:maxChatHistoryRunes])
+		}
+	}
+	b, err := json.Marshal(history)
+	if err != nil {
+		panic(err)
+	}
+	s.Set(sessionKeyChatHistory, string(b))
+}
+
+// acceptsEventStream reports whether the request's Accept header lists
+// text/event-stream.
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range strings.Split(strings.Join(r.Header.Values("Accept"), ","), ",") {
+		mediaType, _, _ := strings.Cut(accept, ";")
+		if strings.EqualFold(strings.TrimSpace(mediaType), "text/event-stream") {
+			return true
+		}
+	}
+	return false
+}
+
+// sseWriter writes server-sent events, flushing each. It is safe for
+// concurrent use.
+type sseWriter struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+	f  http.Flusher
+}
+
+// newSSEWriter starts an event stream as the response, or returns nil if the
+// response cannot be flushed as it is written.
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	f := flusher(w)
+	if f == nil {
+		return nil
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // for nginx
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+	return &sseWriter{w: w, f: f}
+}
+
+// flusher returns the http.Flusher of w, or of the writer it wraps, if any.
+func flusher(w http.ResponseWriter) http.Flusher {
+	for {
+		switch v := w.(type) {
+		case http.Flusher:
+			return v
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// send writes an event named event with v as its JSON data.
+func (e *sseWriter) send(event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return e.write(fmt.Sprintf("event: %s\ndata: %s\n\n", event, data))
+}
+
+func (e *sseWriter) write(s string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := fmt.Fprint(e.w, s); err != nil {
+		return err
+	}
+	e.f.Flush()
+	return nil
+}
+
+// keepAlive writes a comment every interval until stop is called.
+func (e *sseWriter) keepAlive(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				e.write(": keep-alive\n\n")
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/assistant"
+)
+
+// fakeAssistant answers with the number of messages it was sent, streaming
+// the answer if asked in the message.
+type fakeAssistant struct {
+	requests []assistant.Request
+}
+
+func (a *fakeAssistant) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req assistant.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.requests = append(a.requests, req)
+	answer := fmt.Sprintf("Answer %d.", len(a.requests))
+	switch req.Message {
+	case "fail":
+		http.Error(w, "KeyError: 'image'", http.StatusInternalServerError)
+	case "overloaded":
+		http.Error(w, "try later", http.StatusServiceUnavailable)
+	case "slow":
+		<-r.Context().Done()
+	case "stream":
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range strings.SplitAfter(answer, " ") {
+			fmt.Fprintf(w, "data: {\"content\": %q}\n\n", word)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	default:
+		fmt.Fprintf(w, `{"content": %q}`, answer)
+	}
+}
+
+// chatClient posts messages to chatBotHandler, keeping the session cookie.
+type chatClient struct {
+	t       *testing.T
+	handler http.Handler
+	cookie  *http.Cookie
+}
+
+func newChatClient(t *testing.T, fe *frontendServer) *chatClient {
+	return &chatClient{t: t, handler: fe.ensureSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := logrus.New()
+		log.Out = io.Discard
+		fe.chatBotHandler(w, r.WithContext(context.WithValue(r.Context(), ctxKeyLog{}, logrus.FieldLogger(log))))
+	}))}
+}
+
+func (c *chatClient) post(body, accept string) *httptest.ResponseRecorder {
+	c.t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/bot", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if c.cookie != nil {
+		req.AddCookie(c.cookie)
+	}
+	rr := httptest.NewRecorder()
+	c.handler.ServeHTTP(rr, req)
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == cookieSessionID {
+			c.cookie = cookie
+		}
+	}
+	return rr
+}
+
+// chat posts the message and returns the JSON answer.
+func (c *chatClient) chat(message string) string {
+	c.t.Helper()
+	rr := c.post(fmt.Sprintf(`{"message": %q}`, message), "")
+	if rr.Code != http.StatusOK {
+		c.t.Fatalf("POST /bot %q returned %d: %s", message, rr.Code, rr.Body)
+	}
+	var out struct{ Message string }
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		c.t.Fatal(err)
+	}
+	return out.Message
+}
+
+func newChatFrontend(t *testing.T) (*frontendServer, *fakeAssistant) {
+	fake := &fakeAssistant{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return &frontendServer{
+		sessions:  newTestSessions(),
+		assistant: &assistant.Client{URL: srv.URL, Timeout: 100 * time.Millisecond},
+	}, fake
+}
+
+func TestChatBotHistory(t *testing.T) {
+	fe, fake := newChatFrontend(t)
+	c := newChatClient(t, fe)
+
+	if got := c.chat("Do you sell sunglasses?"); got != "Answer 1." {
+		t.Errorf("first answer = %q", got)
+	}
+	if got := c.chat("In blue?"); got != "Answer 2." {
+		t.Errorf("second answer = %q", got)
+	}
+	want := []assistant.Message{
+		{Role: "user", Content: "Do you sell sunglasses?"},
+		{Role: "assistant", Content: "Answer 1."},
+	}
+	if got := fake.requests[1].History; !reflect.DeepEqual(got, want) {
+		t.Errorf("second message sent with history %+v, want %+v", got, want)
+	}
+
+	// Only the latest messages are kept.
+	for range maxChatHistory {
+		c.chat("more")
+	}
+	if got := fake.requests[len(fake.requests)-1].History; len(got) != maxChatHistory || got[len(got)-1].Role != "assistant" {
+		t.Errorf("history after many messages = %+v, want the last %d", got, maxChatHistory)
+	}
+
+	// Failed turns are not remembered, and another shopper has a
+	// conversation of their own.
+	c.post(`{"message": "fail"}`, "")
+	c.chat("again")
+	if got := fake.requests[len(fake.requests)-1].History; got[len(got)-2].Content == "fail" {
+		t.Error("failed message kept in the history")
+	}
+	newChatClient(t, fe).chat("hello")
+	if got := fake.requests[len(fake.requests)-1].History; got != nil {
+		t.Errorf("new shopper's message sent with history %+v", got)
+	}
+}
+
+func TestChatBotStream(t *testing.T) {
+	fe, _ := newChatFrontend(t)
+	c := newChatClient(t, fe)
+
+	rr := c.post(`{"message": "stream"}`, "text/event-stream")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("streamed answer returned %d with %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	want := "event: delta\ndata: {\"content\":\"Answer \"}\n\n" +
+		"event: delta\ndata: {\"content\":\"1.\"}\n\n" +
+		"event: done\ndata: {\"message\":\"Answer 1.\"}\n\n"
+	if got := rr.Body.String(); got != want {
+		t.Errorf("stream = %q, want %q", got, want)
+	}
+
+	// An answer that is not streamed comes whole.
+	rr = c.post(`{"message": "hi"}`, "text/event-stream")
+	if want := "event: done\ndata: {\"message\":\"Answer 2.\"}\n\n"; rr.Body.String() != want {
+		t.Errorf("stream = %q, want %q", rr.Body, want)
+	}
+
+	rr = c.post(`{"message": "fail"}`, "text/event-stream")
+	if !strings.HasPrefix(rr.Body.String(), "event: error\ndata: {\"error\":{\"code\":502,") || strings.Contains(rr.Body.String(), "KeyError") {
+		t.Errorf("failed stream = %q", rr.Body)
+	}
+
+	// Streams go through the request logger.
+	if flusher(&responseRecorder{w: httptest.NewRecorder()}) == nil {
+		t.Error("logged responses cannot be streamed")
+	}
+}
+
+func TestChatBotErrors(t *testing.T) {
+	fe, _ := newChatFrontend(t)
+	c := newChatClient(t, fe)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"empty message", `{"message": " "}`, http.StatusUnprocessableEntity},
+		{"long message", fmt.Sprintf(`{"message": %q}`, strings.Repeat("a", 2001)), http.StatusUnprocessableEntity},
+		{"not an image", `{"message": "hi", "image": "data:text/plain;base64,aGk="}`, http.StatusUnprocessableEntity},
+		{"unknown field", `{"message": "hi", "history": []}`, http.StatusBadRequest},
+		{"not json", `hi`, http.StatusBadRequest},
+		{"too large", fmt.Sprintf(`{"message": "hi", "image": "data:image/png;base64,%s"}`, strings.Repeat("A", maxChatBodyBytes)), http.StatusRequestEntityTooLarge},
+		{"assistant fails", `{"message": "fail"}`, http.StatusBadGateway},
+		{"assistant overloaded", `{"message": "overloaded"}`, http.StatusServiceUnavailable},
+		{"assistant too slow", `{"message": "slow"}`, http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		rr := c.post(tt.body, "")
+		if rr.Code != tt.want {
+			t.Errorf("%s: POST /bot returned %d, want %d: %s", tt.name, rr.Code, tt.want, rr.Body)
+		}
+		if strings.Contains(rr.Body.String(), "KeyError") {
+			t.Errorf("%s: the assistant's error was shown: %s", tt.name, rr.Body)
+		}
+	}
+
+	// A shopper who leaves stops the call to the assistant.
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodPost, "/bot", strings.NewReader(`{"message": "slow"}`)).WithContext(ctx)
+	fe.assistant.Timeout = time.Minute
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("chatBotHandler still waits for the assistant after the shopper left")
+	}
+}
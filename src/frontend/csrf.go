@@ -0,0 +1,165 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/session"
+)
+
+const (
+	// csrfField is the form field, and csrfHeader the header, that carry the
+	// CSRF token of a request.
+	csrfField  = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+	// sessionKeyCSRF is the session value holding the CSRF token.
+	sessionKeyCSRF = "csrf_token"
+)
+
+var (
+	errCrossOrigin = errors.New("cross-origin request refused")
+	errInvalidCSRF = errors.New("missing or invalid CSRF token")
+	errNoSession   = errors.New("no session")
+)
+
+// csrfProtect refuses requests that change state unless they come from the
+// storefront itself. Their Origin, or else their Referer, must be this host
+// when present, and, outside the JSON API, they must carry the session's CSRF
+// token in the csrf_token form field or the X-CSRF-Token header. The JSON API
+// is for clients without the token; browsers cannot send it JSON from other
+// sites, which the origin check and the JSON content type rule out.
+func (fe *frontendServer) csrfProtect(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, _ := r.Context().Value(ctxKeySession{}).(*session.Session)
+		if s != nil && s.Get(sessionKeyCSRF) == "" {
+			s.Set(sessionKeyCSRF, newCSRFToken())
+			if err := fe.sessions.Save(r.Context(), s); err != nil {
+				log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+				renderHTTPError(log, r, w, errors.Wrap(err, "failed to save session"), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		api := strings.HasPrefix(r.URL.Path, baseUrl+apiPrefix+"/")
+		var err error
+		if !sameOrigin(r) {
+			err = errCrossOrigin
+		} else if !api && s == nil {
+			err = errNoSession
+		} else if !api && !validCSRFToken(r, s.Get(sessionKeyCSRF)) {
+			err = errInvalidCSRF
+		}
+		if err != nil {
+			csrfRejectionsTotal.Inc()
+			if api {
+				renderAPIError(r, w, err, http.StatusForbidden)
+			} else {
+				log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+				renderHTTPError(log, r, w, err, http.StatusForbidden)
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// csrfToken returns the CSRF token of the request's session, for forms.
+func csrfToken(r *http.Request) string {
+	if s, ok := r.Context().Value(ctxKeySession{}).(*session.Session); ok {
+		return s.Get(sessionKeyCSRF)
+	}
+	return ""
+}
+
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// validCSRFToken reports whether the request carries the token want.
+func validCSRFToken(r *http.Request, want string) bool {
+	got := r.Header.Get(csrfHeader)
+	if got == "" {
+		got = r.PostFormValue(csrfField)
+	}
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// sameOrigin reports whether the request's Origin header, or else its
+// Referer, names this host. Requests with neither, as from other programs
+// than browsers, are taken to be same-origin.
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+	u, err := url.Parse(source)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && strings.EqualFold(u.Host, r.Host)
+}
+
+// localRedirect redirects to target if it is a page of the storefront, and to
+// the home page otherwise, so that addresses taken from the request cannot
+// redirect elsewhere.
+func localRedirect(w http.ResponseWriter, r *http.Request, target string) {
+	w.Header().Set("Location", safeRedirectPath(r, target))
+	w.WriteHeader(http.StatusFound)
+}
+
+// safeRedirectPath returns the path and query of target if it is under
+// baseUrl, either as a path or as a URL of this host, or else the home page.
+func safeRedirectPath(r *http.Request, target string) string {
+	home := baseUrl + "/"
+	u, err := url.Parse(target)
+	if err != nil || u.Opaque != "" || u.User != nil || strings.Contains(target, "\\") {
+		return home
+	}
+	if u.Scheme != "" || u.Host != "" {
+		if (u.Scheme != "http" && u.Scheme != "https") || !strings.EqualFold(u.Host, r.Host) {
+			return home
+		}
+	}
+	if !strings.HasPrefix(u.Path, "/") {
+		return home
+	}
+	p := path.Clean(u.Path)
+	if !strings.HasPrefix(p, baseUrl+"/") {
+		return home
+	}
+	if strings.HasSuffix(u.Path, "/") && p != "/" {
+		p += "/"
+	}
+	return (&url.URL{Path: p, RawQuery: u.RawQuery}).String()
+}
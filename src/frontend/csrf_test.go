@@ -0,0 +1,175 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	fe := &frontendServer{sessions: newTestSessions()}
+	var token string
+	handler := fe.ensureSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := logrus.New()
+		log.Out = io.Discard
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyLog{}, logrus.FieldLogger(log)))
+		fe.csrfProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token = csrfToken(r)
+			w.WriteHeader(http.StatusNoContent)
+		})).ServeHTTP(w, r)
+	}))
+
+	// Start a session, whose token is then known.
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://shop.example/", nil))
+	cookie := rr.Result().Cookies()[0]
+	if rr.Code != http.StatusNoContent || token == "" {
+		t.Fatalf("GET returned %d with token %q", rr.Code, token)
+	}
+	sessionToken := token
+
+	tests := []struct {
+		name     string
+		path     string
+		form     url.Values
+		header   http.Header
+		wantCode int
+	}{
+		{
+			name:     "form token",
+			path:     "/cart",
+			form:     url.Values{csrfField: {sessionToken}},
+			header:   http.Header{"Origin": {"http://shop.example"}},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "header token",
+			path:     "/bot",
+			header:   http.Header{csrfHeader: {sessionToken}, "Referer": {"http://shop.example/assistant"}},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "no token",
+			path:     "/cart",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "wrong token",
+			path:     "/cart/checkout",
+			form:     url.Values{csrfField: {newCSRFToken()}},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "other origin",
+			path:     "/setCurrency",
+			form:     url.Values{csrfField: {sessionToken}},
+			header:   http.Header{"Origin": {"https://evil.example"}},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "other referer",
+			path:     "/cart/empty",
+			form:     url.Values{csrfField: {sessionToken}},
+			header:   http.Header{"Referer": {"https://evil.example/shop.example/"}},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "null origin",
+			path:     "/cart",
+			form:     url.Values{csrfField: {sessionToken}},
+			header:   http.Header{"Origin": {"null"}},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "API without a token",
+			path:     apiPrefix + "/cart/items",
+			header:   http.Header{"Content-Type": {"application/json"}},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "API from another origin",
+			path:     apiPrefix + "/checkout",
+			header:   http.Header{"Origin": {"https://evil.example"}},
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://shop.example"+tt.path, strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for k, v := range tt.header {
+				req.Header[http.CanonicalHeaderKey(k)] = v
+			}
+			req.AddCookie(cookie)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.wantCode {
+				t.Errorf("POST %s returned %d, want %d", tt.path, rr.Code, tt.wantCode)
+			}
+			if rr.Code == http.StatusForbidden && strings.HasPrefix(tt.path, apiPrefix) &&
+				!strings.HasPrefix(rr.Header().Get("Content-Type"), "application/json") {
+				t.Errorf("API error has content type %q", rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	// A token from another session does not do.
+	req := httptest.NewRequest(http.MethodPost, "http://shop.example/cart", strings.NewReader(url.Values{csrfField: {sessionToken}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("POST with another session's token returned %d, want %d", rr.Code, http.StatusForbidden)
+	}
+}
+
+func TestSafeRedirectPath(t *testing.T) {
+	tests := []struct {
+		base   string
+		target string
+		want   string
+	}{
+		{"", "/cart", "/cart"},
+		{"", "/product/OLJCESPC7Z?x=1", "/product/OLJCESPC7Z?x=1"},
+		{"", "http://shop.example/cart", "/cart"},
+		{"", "https://evil.example/cart", "/"},
+		{"", "//evil.example/cart", "/"},
+		{"", "/\\evil.example", "/"},
+		{"", "javascript:alert(1)", "/"},
+		{"", "cart", "/"},
+		{"", "", "/"},
+		{"/shop", "/shop/cart/", "/shop/cart/"},
+		{"/shop", "/shop", "/shop/"},
+		{"/shop", "/cart", "/shop/"},
+		{"/shop", "/shop/../admin", "/shop/"},
+		{"/shop", "/shopping", "/shop/"},
+	}
+	defer func(b string) { baseUrl = b }(baseUrl)
+	for _, tt := range tests {
+		baseUrl = tt.base
+		r := httptest.NewRequest(http.MethodPost, "http://shop.example/setCurrency", nil)
+		if got := safeRedirectPath(r, tt.target); got != tt.want {
+			t.Errorf("with base %q, safeRedirectPath(%q) = %q, want %q", tt.base, tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+)
+
+const defaultCurrencyRefreshInterval = 5 * time.Minute
+
+// geoCountryHeaders are request headers set by load balancers and CDNs with
+// the client's country as an ISO 3166-1 alpha-2 code.
+var geoCountryHeaders = []string{
+	"X-Client-Geo-Country", // Google Cloud load balancer custom header
+	"CloudFront-Viewer-Country",
+	"CF-IPCountry",
+	"X-AppEngine-Country",
+}
+
+// currencyConfig is the format of SUPPORTED_CURRENCIES_FILE:
+//
+//	{"currencies": ["USD", "EUR", "CHF"], "default": "USD", "countries": {"LI": "CHF"}}
+//
+// Currencies are offered in the order given. Countries maps a country to
+// its default currency where the ISO 4217 currency of that country is not
+// wanted.
+type currencyConfig struct {
+	Currencies []string          `json:"currencies"`
+	Default    string            `json:"default"`
+	Countries  map[string]string `json:"countries"`
+}
+
+var defaultCurrencyConfig = currencyConfig{
+	Currencies: []string{"USD", "EUR", "CAD", "JPY", "GBP", "TRY"},
+	Default:    defaultCurrency,
+}
+
+// loadCurrencyConfig reads the currency configuration from
+// SUPPORTED_CURRENCIES_FILE if set, then applies SUPPORTED_CURRENCIES (a
+// comma-separated list) and DEFAULT_CURRENCY.
+func loadCurrencyConfig() (currencyConfig, error) {
+	cfg := defaultCurrencyConfig
+	if path := os.Getenv("SUPPORTED_CURRENCIES_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, errors.Wrap(err, "failed to read currency config")
+		}
+		cfg = currencyConfig{Default: defaultCurrency}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, errors.Wrapf(err, "failed to parse %s", path)
+		}
+	}
+	if v := os.Getenv("SUPPORTED_CURRENCIES"); v != "" {
+		cfg.Currencies = strings.Split(v, ",")
+	}
+	if v := os.Getenv("DEFAULT_CURRENCY"); v != "" {
+		cfg.Default = v
+	}
+	return cfg, cfg.normalize()
+}
+
+// normalize upper-cases and checks the codes in the configuration.
+func (cfg *currencyConfig) normalize() error {
+	if len(cfg.Currencies) == 0 {
+		return errors.New("no currencies configured")
+	}
+	seen := make(map[string]bool, len(cfg.Currencies))
+	codes := make([]string, 0, len(cfg.Currencies))
+	for _, c := range cfg.Currencies {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if _, err := currency.ParseISO(c); err != nil {
+			return fmt.Errorf("invalid currency %q", c)
+		}
+		if !seen[c] {
+			seen[c] = true
+			codes = append(codes, c)
+		}
+	}
+	cfg.Currencies = codes
+
+	cfg.Default = strings.ToUpper(cfg.Default)
+	if !seen[cfg.Default] {
+		return fmt.Errorf("default currency %q is not one of the configured currencies", cfg.Default)
+	}
+	countries := make(map[string]string, len(cfg.Countries))
+	for country, c := range cfg.Countries {
+		region, err := language.ParseRegion(country)
+		if err != nil || !region.IsCountry() {
+			return fmt.Errorf("invalid country %q", country)
+		}
+		if c = strings.ToUpper(c); !seen[c] {
+			return fmt.Errorf("currency %q for %s is not one of the configured currencies", c, country)
+		}
+		countries[region.String()] = c
+	}
+	cfg.Countries = countries
+	return nil
+}
+
+// currencySettings holds the currencies offered to shoppers: the configured
+// currencies that the currency service also supports. It is safe for
+// concurrent use.
+type currencySettings struct {
+	config currencyConfig
+	fetch  func(ctx context.Context) ([]string, error)
+
+	mu        sync.RWMutex
+	fetched   bool
+	supported []string
+	set       map[string]bool
+}
+
+// newCurrencySettings offers the configured currencies until the first
+// successful refresh. With a nil fetch, they are offered as configured.
+func newCurrencySettings(cfg currencyConfig, fetch func(ctx context.Context) ([]string, error)) *currencySettings {
+	s := &currencySettings{config: cfg, fetch: fetch}
+	s.setSupported(cfg.Currencies)
+	return s
+}
+
+func (s *currencySettings) setSupported(codes []string) {
+	set := make(map[string]bool, len(codes))
+	for _, c := range codes {
+		set[c] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.supported, s.set = codes, set
+}
+
+// refresh intersects the configured currencies with those the currency
+// service supports. On error the previous list is kept.
+func (s *currencySettings) refresh(ctx context.Context) error {
+	if s.fetch == nil {
+		return nil
+	}
+	codes, err := s.fetch(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not retrieve supported currencies")
+	}
+	available := make(map[string]bool, len(codes))
+	for _, c := range codes {
+		available[strings.ToUpper(c)] = true
+	}
+	var supported []string
+	for _, c := range s.config.Currencies {
+		if available[c] {
+			supported = append(supported, c)
+		}
+	}
+	if len(supported) == 0 {
+		return errors.Errorf("currency service supports none of the configured currencies %v", s.config.Currencies)
+	}
+	s.setSupported(supported)
+	s.mu.Lock()
+	s.fetched = true
+	s.mu.Unlock()
+	return nil
+}
+
+// refreshEvery refreshes the list until ctx is done.
+func (s *currencySettings) refreshEvery(ctx context.Context, interval time.Duration, log logrus.FieldLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.refresh(ctx); err != nil {
+				log.WithField("error", err).Warn("failed to refresh supported currencies")
+			}
+		}
+	}
+}
+
+// list returns the currencies to offer. Until the currency service has
+// answered once, it asks the service and fails if it can't.
+func (s *currencySettings) list(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	fetched := s.fetched
+	s.mu.RUnlock()
+	if !fetched && s.fetch != nil {
+		if err := s.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.supported, nil
+}
+
+// isSupported reports whether the currency is offered.
+func (s *currencySettings) isSupported(code string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.set[code]
+}
+
+// defaultFor picks the currency for a shopper who has not chosen one: that
+// of their country, taken from a geo header set by the load balancer or else
+// from the regions in Accept-Language, if it is offered.
+func (s *currencySettings) defaultFor(r *http.Request) string {
+	for _, h := range geoCountryHeaders {
+		if region, err := language.ParseRegion(r.Header.Get(h)); err == nil {
+			if c, ok := s.countryCurrency(region); ok {
+				return c
+			}
+		}
+	}
+	for _, tag := range acceptedLanguages(r) {
+		if region, conf := tag.Region(); conf != language.No {
+			if c, ok := s.countryCurrency(region); ok {
+				return c
+			}
+		}
+	}
+	return s.config.Default
+}
+
+func (s *currencySettings) countryCurrency(region language.Region) (string, bool) {
+	c, ok := s.config.Countries[region.String()]
+	if !ok {
+		unit, found := currency.FromRegion(region)
+		if !found {
+			return "", false
+		}
+		c = unit.String()
+	}
+	return c, s.isSupported(c)
+}
+
+// supportedCurrencies are the currencies offered to shoppers. main replaces
+// them with the configured ones.
+var supportedCurrencies = newCurrencySettings(defaultCurrencyConfig, nil)
@@ -0,0 +1,142 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadCurrencyConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "currencies.json")
+	if err := os.WriteFile(file, []byte(`{"currencies": ["chf", "EUR", "USD", "EUR"], "default": "EUR", "countries": {"li": "CHF"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    currencyConfig
+		wantErr bool
+	}{
+		{"defaults", nil, currencyConfig{Currencies: []string{"USD", "EUR", "CAD", "JPY", "GBP", "TRY"}, Default: "USD", Countries: map[string]string{}}, false},
+		{"env", map[string]string{"SUPPORTED_CURRENCIES": "usd, jpy", "DEFAULT_CURRENCY": "jpy"}, currencyConfig{Currencies: []string{"USD", "JPY"}, Default: "JPY", Countries: map[string]string{}}, false},
+		{"file", map[string]string{"SUPPORTED_CURRENCIES_FILE": file}, currencyConfig{Currencies: []string{"CHF", "EUR", "USD"}, Default: "EUR", Countries: map[string]string{"LI": "CHF"}}, false},
+		{"file and env", map[string]string{"SUPPORTED_CURRENCIES_FILE": file, "SUPPORTED_CURRENCIES": "EUR,CHF"}, currencyConfig{Currencies: []string{"EUR", "CHF"}, Default: "EUR", Countries: map[string]string{"LI": "CHF"}}, false},
+		{"missing file", map[string]string{"SUPPORTED_CURRENCIES_FILE": file + ".missing"}, currencyConfig{}, true},
+		{"unknown currency", map[string]string{"SUPPORTED_CURRENCIES": "USD,XYZ"}, currencyConfig{}, true},
+		{"default not offered", map[string]string{"SUPPORTED_CURRENCIES": "EUR,GBP"}, currencyConfig{}, true},
+		{"country currency not offered", map[string]string{"SUPPORTED_CURRENCIES_FILE": file, "SUPPORTED_CURRENCIES": "EUR,USD"}, currencyConfig{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"SUPPORTED_CURRENCIES_FILE", "SUPPORTED_CURRENCIES", "DEFAULT_CURRENCY"} {
+				t.Setenv(k, tt.env[k])
+			}
+			got, err := loadCurrencyConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadCurrencyConfig() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadCurrencyConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrencySettingsRefresh(t *testing.T) {
+	var (
+		available = []string{"JPY", "EUR", "USD", "CHF"}
+		fetchErr  error
+		calls     int
+	)
+	s := newCurrencySettings(defaultCurrencyConfig, func(context.Context) ([]string, error) {
+		calls++
+		return available, fetchErr
+	})
+	ctx := context.Background()
+
+	if !s.isSupported("GBP") {
+		t.Error("configured currencies should be supported before the first refresh")
+	}
+	got, err := s.list(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"USD", "EUR", "JPY"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("list() = %v, want %v in configured order", got, want)
+	}
+	if s.isSupported("GBP") || s.isSupported("CHF") {
+		t.Error("only configured currencies the service supports should be offered")
+	}
+	if _, err := s.list(ctx); err != nil || calls != 1 {
+		t.Errorf("list() after refresh: err = %v, %d fetches, want 1", err, calls)
+	}
+
+	fetchErr = errors.New("unavailable")
+	if err := s.refresh(ctx); err == nil {
+		t.Error("refresh() should fail")
+	}
+	available, fetchErr = []string{"CHF"}, nil
+	if err := s.refresh(ctx); err == nil {
+		t.Error("refresh() should fail when no configured currency is available")
+	}
+	if got, _ := s.list(ctx); len(got) != 3 {
+		t.Errorf("list() = %v, want the previous currencies after failed refreshes", got)
+	}
+}
+
+func TestCurrencySettingsListError(t *testing.T) {
+	s := newCurrencySettings(defaultCurrencyConfig, func(context.Context) ([]string, error) {
+		return nil, errors.New("unavailable")
+	})
+	if _, err := s.list(context.Background()); err == nil {
+		t.Error("list() should fail until the currency service has answered")
+	}
+}
+
+func TestCurrencySettingsDefaultFor(t *testing.T) {
+	cfg := currencyConfig{Currencies: []string{"USD", "EUR", "CHF"}, Default: "USD", Countries: map[string]string{"LI": "EUR"}}
+	s := newCurrencySettings(cfg, nil)
+	tests := []struct {
+		header string
+		value  string
+		want   string
+	}{
+		{"", "", "USD"},
+		{"Accept-Language", "de-CH", "CHF"},
+		{"Accept-Language", "de", "EUR"},
+		{"Accept-Language", "de-LI", "EUR"},
+		{"Accept-Language", "ja-JP, de-AT;q=0.5", "EUR"},
+		{"Accept-Language", "*", "USD"},
+		{"CloudFront-Viewer-Country", "CH", "CHF"},
+		{"X-AppEngine-Country", "ZZ", "USD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header+" "+tt.value, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			if got := s.defaultFor(r); got != tt.want {
+				t.Errorf("defaultFor() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultRateCacheTTL = 5 * time.Minute
+
+	// rateFetchTimeout bounds a rate fetch shared by several requests, which
+	// is not cancelled when the request that started it is.
+	rateFetchTimeout = 3 * time.Second
+)
+
+type currencyPair struct{ from, to string }
+
+type cachedRate struct {
+	rate    *big.Rat
+	expires time.Time
+}
+
+// rateCache caches exchange rates learned from the currency service, so that
+// converting every price on a page costs at most one Convert call per pair of
+// currencies instead of one per price. Concurrent misses for the same pair
+// share a single fetch, and failed fetches are not cached. It is safe for
+// concurrent use.
+type rateCache struct {
+	ttl   time.Duration
+	now   func() time.Time
+	fetch func(ctx context.Context, from, to string) (*big.Rat, error)
+
+	group singleflight.Group
+
+	mu    sync.Mutex
+	rates map[currencyPair]cachedRate
+}
+
+// newRateCache returns a cache that keeps rates from fetch for ttl. With a
+// ttl of zero, rates are not kept but concurrent fetches are still shared.
+func newRateCache(ttl time.Duration, fetch func(ctx context.Context, from, to string) (*big.Rat, error)) *rateCache {
+	return &rateCache{
+		ttl:   ttl,
+		now:   time.Now,
+		fetch: fetch,
+		rates: make(map[currencyPair]cachedRate),
+	}
+}
+
+// get returns the rate from one currency to another.
+func (c *rateCache) get(ctx context.Context, from, to string) (*big.Rat, error) {
+	pair := currencyPair{from, to}
+	c.mu.Lock()
+	cached, ok := c.rates[pair]
+	c.mu.Unlock()
+	if ok && c.now().Before(cached.expires) {
+		recordCurrencyRateCache("hit")
+		return cached.rate, nil
+	}
+
+	ch := c.group.DoChan(from+"/"+to, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rateFetchTimeout)
+		defer cancel()
+		rate, err := c.fetch(ctx, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if c.ttl > 0 {
+			c.mu.Lock()
+			c.rates[pair] = cachedRate{rate: rate, expires: c.now().Add(c.ttl)}
+			c.mu.Unlock()
+		}
+		return rate, nil
+	})
+	select {
+	case res := <-ch:
+		switch {
+		case res.Err != nil:
+			recordCurrencyRateCache("error")
+			return nil, res.Err
+		case res.Shared:
+			recordCurrencyRateCache("shared")
+		default:
+			recordCurrencyRateCache("miss")
+		}
+		return res.Val.(*big.Rat), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateCache(t *testing.T) {
+	var calls atomic.Int32
+	fail := false
+	cache := newRateCache(time.Minute, func(_ context.Context, from, to string) (*big.Rat, error) {
+		calls.Add(1)
+		if fail {
+			return nil, errors.New("unavailable")
+		}
+		return big.NewRat(23, 25), nil
+	})
+	now := time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		rate, err := cache.get(ctx, "USD", "EUR")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rate.Cmp(big.NewRat(23, 25)) != 0 {
+			t.Errorf("get() = %s, want 23/25", rate)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("fetched %d times, want 1", got)
+	}
+
+	if _, err := cache.get(ctx, "USD", "JPY"); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("other pair: fetched %d times, want 2", got)
+	}
+
+	now = now.Add(time.Minute)
+	fail = true
+	if _, err := cache.get(ctx, "USD", "EUR"); err == nil {
+		t.Error("expired rate: want fetch error")
+	}
+	if _, err := cache.get(ctx, "USD", "EUR"); err == nil {
+		t.Error("errors should not be cached")
+	}
+	if got := calls.Load(); got != 4 {
+		t.Errorf("after expiry: fetched %d times, want 4", got)
+	}
+}
+
+func TestRateCacheSharesFetches(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	cache := newRateCache(time.Minute, func(context.Context, string, string) (*big.Rat, error) {
+		calls.Add(1)
+		<-release
+		return big.NewRat(1, 2), nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.get(context.Background(), "USD", "GBP"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("fetched %d times, want 1", got)
+	}
+}
+
+func TestRateCacheCancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	cache := newRateCache(time.Minute, func(ctx context.Context, _, _ string) (*big.Rat, error) {
+		<-release
+		return big.NewRat(1, 1), nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.get(ctx, "USD", "CAD"); !errors.Is(err, context.Canceled) {
+		t.Errorf("get() with cancelled context = %v, want context.Canceled", err)
+	}
+}
@@ -1,15 +1,19 @@
-package main
+package frontend
 
 import (
 	"net/http"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"cloud.google.com/go/compute/metadata"
 	"github.com/sirupsen/logrus"
 )
 
-var deploymentDetailsMap map[string]string
+// deploymentDetailsMap holds the details of where the frontend runs once
+// loadDeploymentDetails has found them. Pages are served meanwhile, so it is
+// replaced as a whole rather than filled in.
+var deploymentDetailsMap atomic.Pointer[map[string]string]
 var log *logrus.Logger
 
 func init() {
@@ -33,8 +37,16 @@ func initializeLogger() {
 	log.Out = os.Stdout
 }
 
+// deploymentDetails returns the details of where the frontend runs, or nil
+// while they are being loaded.
+func deploymentDetails() map[string]string {
+	if m := deploymentDetailsMap.Load(); m != nil {
+		return *m
+	}
+	return nil
+}
+
 func loadDeploymentDetails() {
-	deploymentDetailsMap = make(map[string]string)
 	var metaServerClient = metadata.NewClient(&http.Client{})
 
 	podHostname, err := os.Hostname()
@@ -52,9 +64,11 @@ func loadDeploymentDetails() {
 		log.Error("Failed to fetch the Zone of the node where the pod is scheduled", err)
 	}
 
-	deploymentDetailsMap["HOSTNAME"] = podHostname
-	deploymentDetailsMap["CLUSTERNAME"] = podCluster
-	deploymentDetailsMap["ZONE"] = podZone
+	deploymentDetailsMap.Store(&map[string]string{
+		"HOSTNAME":    podHostname,
+		"CLUSTERNAME": podCluster,
+		"ZONE":        podZone,
+	})
 
 	log.WithFields(logrus.Fields{
 		"cluster":  podCluster,
@@ -0,0 +1,174 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// unavailableRetryAfter is when visitors are told to try again after a backend
+// was unavailable.
+const unavailableRetryAfter = 5 * time.Second
+
+// renderHTTPError reports err to the visitor with the HTTP status code: as the
+// error page, or as a JSON error to clients that prefer JSON to HTML. Only
+// publicMessage is shown; the error itself is logged, with the request ID
+// the visitor is given to quote.
+func renderHTTPError(log logrus.FieldLogger, r *http.Request, w http.ResponseWriter, err error, code int) {
+	log.WithField("error", err).WithField("status", code).Error("request error")
+	if code == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+		w.Header().Set("Retry-After", strconv.Itoa(int(unavailableRetryAfter.Seconds())))
+	}
+	if prefersJSON(r) {
+		writeJSON(w, code, newAPIError(r, err, code))
+		return
+	}
+
+	w.WriteHeader(code)
+	data := map[string]interface{}{
+		"message":     publicMessage(err, code),
+		"status_code": code,
+		"status":      http.StatusText(code),
+		"retry":       retryable(code) && r.Method == http.MethodGet,
+	}
+	if showErrorDetails {
+		data["error"] = fmt.Sprintf("%+v", err)
+	}
+	if templateErr := templates.ExecuteTemplate(w, "error", injectCommonTemplateData(r, data)); templateErr != nil {
+		log.Println(templateErr)
+	}
+}
+
+// publicMessage returns what the visitor is told about err, reported with the
+// HTTP status code. Client errors say what was wrong with the request, so
+// their message is told, with that of a backend's status but not its code.
+// Server errors carry internal details, such as addresses and backend
+// messages, so only the kind of failure is told.
+func publicMessage(err error, code int) string {
+	if code >= 400 && code < 500 {
+		msg := err.Error()
+		var grpcErr interface {
+			error
+			GRPCStatus() *status.Status
+		}
+		if errors.As(err, &grpcErr) {
+			msg = strings.Replace(msg, grpcErr.Error(), grpcErr.GRPCStatus().Message(), 1)
+		}
+		return strings.TrimSpace(msg)
+	}
+	switch code {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return "This part of the store is temporarily unavailable. Please try again in a moment."
+	case http.StatusNotImplemented:
+		return "This is not supported."
+	}
+	return "Something went wrong on our side. It has been logged; please try again later."
+}
+
+// retryable reports whether a request that failed with the HTTP status code
+// may succeed if sent again unchanged.
+func retryable(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// prefersJSON reports whether the request's Accept header ranks JSON above
+// HTML, as API clients' do and browsers' do not.
+func prefersJSON(r *http.Request) bool {
+	var jsonQ, htmlQ float64
+	for _, accept := range strings.Split(strings.Join(r.Header.Values("Accept"), ","), ",") {
+		mediaType, params, _ := strings.Cut(accept, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && k == "q" {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "text/html":
+			htmlQ = max(htmlQ, q)
+		}
+	}
+	return jsonQ > htmlQ
+}
+
+// statusError is an error reported with a specific HTTP status.
+type statusError struct {
+	code int
+	err  error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+func (e *statusError) Unwrap() error { return e.err }
+
+// withStatus marks err to be reported with the given HTTP status.
+func withStatus(code int, err error) error {
+	return &statusError{code: code, err: err}
+}
+
+// httpStatus returns the HTTP status to report err with: the one given to
+// withStatus, else one matching the gRPC status of a failed call, else
+// fallback.
+func httpStatus(err error, fallback int) int {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return fallback
+	}
+	switch st.Code() {
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusUnprocessableEntity
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted, codes.FailedPrecondition:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return fallback
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"plain", errors.New("failed"), http.StatusInternalServerError},
+		{"with status", withStatus(http.StatusConflict, errors.New("out of stock")), http.StatusConflict},
+		{"wrapped status", errors.Wrap(withStatus(http.StatusUnprocessableEntity, errors.New("invalid")), "add"), http.StatusUnprocessableEntity},
+		{"grpc not found", status.Error(codes.NotFound, "no such product"), http.StatusNotFound},
+		{"wrapped grpc", errors.Wrap(status.Error(codes.Unavailable, "down"), "could not retrieve cart"), http.StatusServiceUnavailable},
+		{"grpc invalid argument", status.Error(codes.InvalidArgument, "invalid card"), http.StatusUnprocessableEntity},
+		{"grpc internal", status.Error(codes.Internal, "bug"), http.StatusInternalServerError},
+		{"deadline", errors.Wrap(context.DeadlineExceeded, "could not retrieve products"), http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := httpStatus(tt.err, http.StatusInternalServerError); got != tt.want {
+				t.Errorf("httpStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublicMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code int
+		want string
+	}{
+		{"client error", errors.New("invalid quantity"), http.StatusUnprocessableEntity, "invalid quantity"},
+		{"grpc client error", errors.Wrap(status.Error(codes.NotFound, "no product with ID x"), "could not retrieve product"), http.StatusNotFound, "could not retrieve product: no product with ID x"},
+		{"server error", errors.New("dial tcp 10.0.0.7:3550: connection refused"), http.StatusInternalServerError, "Something went wrong on our side. It has been logged; please try again later."},
+		{"unavailable", status.Error(codes.Unavailable, "connection refused"), http.StatusServiceUnavailable, "This part of the store is temporarily unavailable. Please try again in a moment."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := publicMessage(tt.err, tt.code); got != tt.want {
+				t.Errorf("publicMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefersJSON(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":                 false,
+		"*/*":              false,
+		"application/json": true,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": false,
+		"application/json, text/html;q=0.5":                               true,
+		"text/html;q=0.5, Application/JSON;q=0.9":                         true,
+		"application/json;q=0.1, text/html":                               false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		if got := prefersJSON(r); got != want {
+			t.Errorf("prefersJSON(Accept: %q) = %v, want %v", accept, got, want)
+		}
+	}
+}
+
+func TestRenderHTTPError(t *testing.T) {
+	log := logrus.New()
+	log.Out = io.Discard
+	err := errors.Wrap(status.Error(codes.Unavailable, "dial tcp 10.0.0.7:7070: connection refused"), "could not retrieve cart")
+	request := func(accept string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/cart", nil)
+		r.Header.Set("Accept", accept)
+		return r.WithContext(context.WithValue(r.Context(), ctxKeyRequestID{}, "req-42"))
+	}
+
+	rr := httptest.NewRecorder()
+	renderHTTPError(log, request("text/html"), rr, err, httpStatus(err, http.StatusInternalServerError))
+	body := rr.Body.String()
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "5" {
+		t.Errorf("status %d with Retry-After %q, want %d with 5", rr.Code, rr.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+	if !strings.Contains(body, "temporarily unavailable") || !strings.Contains(body, "req-42") || !strings.Contains(body, "Try again") {
+		t.Errorf("error page lacks the message, reference or retry link:\n%s", body)
+	}
+	if strings.Contains(body, "10.0.0.7") {
+		t.Errorf("error page shows internal details:\n%s", body)
+	}
+
+	showErrorDetails = true
+	t.Cleanup(func() { showErrorDetails = false })
+	rr = httptest.NewRecorder()
+	renderHTTPError(log, request("text/html"), rr, err, http.StatusServiceUnavailable)
+	if !strings.Contains(rr.Body.String(), "10.0.0.7") {
+		t.Errorf("error page lacks the details:\n%s", rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	renderHTTPError(log, request("application/json"), rr, err, http.StatusServiceUnavailable)
+	var got apiError
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rr.Body, err)
+	}
+	want := apiErrorDetail{Code: http.StatusServiceUnavailable, Status: "Service Unavailable", Message: publicMessage(err, http.StatusServiceUnavailable), RequestID: "req-42"}
+	if got.Error != want {
+		t.Errorf("JSON error = %+v, want %+v", got.Error, want)
+	}
+}
@@ -12,29 +12,34 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package frontend
 
 import (
 	"context"
-	"encoding/json"
+	"embed"
 	"fmt"
 	"html/template"
-	"io"
 	"math/rand"
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/text/language"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
-	pb "github.com/GoogleCloudPlatform/microservices-demo/src/frontend/genproto"
-	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/money"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/session"
 	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/validator"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
 )
 
 type platformDetails struct {
@@ -42,15 +47,21 @@ type platformDetails struct {
 	provider string
 }
 
+// assets are the page templates and static files, built into the binary so
+// that the frontend does not depend on its working directory.
+//
+//go:embed templates/*.html static
+var assets embed.FS
+
 var (
 	frontendMessage  = strings.TrimSpace(os.Getenv("FRONTEND_MESSAGE"))
 	isCymbalBrand    = "true" == strings.ToLower(os.Getenv("CYMBAL_BRANDING"))
 	assistantEnabled = "true" == strings.ToLower(os.Getenv("ENABLE_ASSISTANT"))
 	templates        = template.Must(template.New("").
 				Funcs(template.FuncMap{
-			"renderMoney":        func(money pb.Money) string { return renderMoney(&money) },
+			"renderMoney":        renderMoney,
 			"renderCurrencyLogo": renderCurrencyLogo,
-		}).ParseGlob("templates/*.html"))
+		}).ParseFS(assets, "templates/*.html"))
 	plat platformDetails
 )
 
@@ -59,19 +70,33 @@ var validEnvs = []string{"local", "gcp", "azure", "aws", "onprem", "alibaba"}
 func (fe *frontendServer) homeHandler(w http.ResponseWriter, r *http.Request) {
 	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
 	log.WithField("currency", currentCurrency(r)).Info("home")
-	currencies, err := fe.getCurrencies(r.Context())
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve currencies"), http.StatusInternalServerError)
-		return
-	}
-	products, err := fe.getProducts(r.Context())
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve products"), http.StatusInternalServerError)
-		return
-	}
-	cart, err := fe.getCart(r.Context(), sessionID(r))
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve cart"), http.StatusInternalServerError)
+
+	var (
+		currencies []string
+		products   []*pb.Product
+		cart       []*pb.CartItem
+		ad         *pb.Ad
+	)
+	pg := newPage(r.Context(), "home", log)
+	defer pg.close()
+	pg.critical("currencies", criticalFragmentTimeout, func(ctx context.Context) (err error) {
+		currencies, err = fe.getCurrencies(ctx)
+		return err
+	})
+	pg.critical("products", criticalFragmentTimeout, func(ctx context.Context) (err error) {
+		products, err = fe.getProducts(ctx)
+		return err
+	})
+	pg.critical("cart", criticalFragmentTimeout, func(ctx context.Context) (err error) {
+		cart, err = fe.getCart(ctx, sessionID(r))
+		return err
+	})
+	pg.optional("ad", optionalFragmentTimeout, func(ctx context.Context) (err error) {
+		ad, err = fe.chooseAd(ctx, []string{})
+		return err
+	})
+	if err := pg.wait(); err != nil {
+		renderHTTPError(log, r, w, err, httpStatus(err, http.StatusInternalServerError))
 		return
 	}
 
@@ -79,14 +104,18 @@ func (fe *frontendServer) homeHandler(w http.ResponseWriter, r *http.Request) {
 		Item  *pb.Product
 		Price *pb.Money
 	}
+	pricesUsd := make([]*pb.Money, len(products))
+	for i, p := range products {
+		pricesUsd[i] = p.GetPriceUsd()
+	}
+	prices, err := fe.convertCurrencies(r.Context(), pricesUsd, currentCurrency(r))
+	if err != nil {
+		renderHTTPError(log, r, w, errors.Wrap(err, "failed to do currency conversion for products"), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
 	ps := make([]productView, len(products))
 	for i, p := range products {
-		price, err := fe.convertCurrency(r.Context(), p.GetPriceUsd(), currentCurrency(r))
-		if err != nil {
-			renderHTTPError(log, r, w, errors.Wrapf(err, "failed to do currency conversion for product %s", p.GetId()), http.StatusInternalServerError)
-			return
-		}
-		ps[i] = productView{p, price}
+		ps[i] = productView{p, prices[i]}
 	}
 
 	// Set ENV_PLATFORM (default to local if not set; use env var if set; otherwise detect GCP, which overrides env)_
@@ -107,13 +136,14 @@ func (fe *frontendServer) homeHandler(w http.ResponseWriter, r *http.Request) {
 	plat = platformDetails{}
 	plat.setPlatformDetails(strings.ToLower(env))
 
+	pg.setSkippedHeader(w)
 	if err := templates.ExecuteTemplate(w, "home", injectCommonTemplateData(r, map[string]interface{}{
 		"show_currency": true,
 		"currencies":    currencies,
 		"products":      ps,
 		"cart_size":     cartSize(cart),
 		"banner_color":  os.Getenv("BANNER_COLOR"), // illustrates canary deployments
-		"ad":            fe.chooseAd(r.Context(), []string{}, log),
+		"ad":            ad,
 	})); err != nil {
 		log.Error(err)
 	}
@@ -151,52 +181,97 @@ func (fe *frontendServer) productHandler(w http.ResponseWriter, r *http.Request)
 	log.WithField("id", id).WithField("currency", currentCurrency(r)).
 		Debug("serving product page")
 
-	p, err := fe.getProduct(r.Context(), id)
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve product"), http.StatusInternalServerError)
-		return
+	var (
+		p               *pb.Product
+		currencies      []string
+		cart            []*pb.CartItem
+		recommendations []*pb.Product
+		packagingInfo   *PackagingInfo
+		stock           map[string]*pb.StockLevel
+		ad              *pb.Ad
+	)
+	pg := newPage(r.Context(), "product", log)
+	defer pg.close()
+	pg.critical("product", criticalFragmentTimeout, func(ctx context.Context) (err error) {
+		p, err = fe.getProduct(ctx, id)
+		return err
+	})
+	pg.critical("currencies", criticalFragmentTimeout, func(ctx context.Context) (err error) {
+		currencies, err = fe.getCurrencies(ctx)
+		return err
+	})
+	pg.critical("cart", criticalFragmentTimeout, func(ctx context.Context) (err error) {
+		cart, err = fe.getCart(ctx, sessionID(r))
+		return err
+	})
+	pg.optional("recommendations", optionalFragmentTimeout, func(ctx context.Context) (err error) {
+		recommendations, err = fe.getRecommendations(ctx, sessionID(r), []string{id})
+		return err
+	})
+	// The packaging service is an optional microservice you can run as part of a Google Cloud demo.
+	if isPackagingServiceConfigured() {
+		pg.optional("packaging", optionalFragmentTimeout, func(ctx context.Context) (err error) {
+			packagingInfo, err = httpGetPackagingInfo(ctx, id)
+			return err
+		})
 	}
-	currencies, err := fe.getCurrencies(r.Context())
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve currencies"), http.StatusInternalServerError)
+	if err := pg.wait(); err != nil {
+		renderHTTPError(log, r, w, err, httpStatus(err, http.StatusInternalServerError))
 		return
 	}
 
-	cart, err := fe.getCart(r.Context(), sessionID(r))
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve cart"), http.StatusInternalServerError)
-		return
+	// stock levels are optional since checkout enforces them
+	pg.optional("stock", optionalFragmentTimeout, func(ctx context.Context) (err error) {
+		stock, err = fe.getStock(ctx, productSKUs(p))
+		return err
+	})
+	pg.optional("ad", optionalFragmentTimeout, func(ctx context.Context) (err error) {
+		ad, err = fe.chooseAd(ctx, p.Categories)
+		return err
+	})
+	pricesUsd := []*pb.Money{p.GetPriceUsd()}
+	for _, v := range p.GetVariants() {
+		if v.GetPriceOverrideUsd() != nil {
+			pricesUsd = append(pricesUsd, v.GetPriceOverrideUsd())
+		}
 	}
-
-	price, err := fe.convertCurrency(r.Context(), p.GetPriceUsd(), currentCurrency(r))
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "failed to convert currency"), http.StatusInternalServerError)
+	var prices []*pb.Money
+	pg.critical("prices", criticalFragmentTimeout, func(ctx context.Context) (err error) {
+		prices, err = fe.convertCurrencies(ctx, pricesUsd, currentCurrency(r))
+		return err
+	})
+	if err := pg.wait(); err != nil {
+		renderHTTPError(log, r, w, err, httpStatus(err, http.StatusInternalServerError))
 		return
 	}
-
-	// ignores the error retrieving recommendations since it is not critical
-	recommendations, err := fe.getRecommendations(r.Context(), sessionID(r), []string{id})
-	if err != nil {
-		log.WithField("error", err).Warn("failed to get product recommendations")
+	price := prices[0]
+
+	type variantView struct {
+		Variant *pb.ProductVariant
+		Price   *pb.Money
+		InStock bool
+	}
+	inStockAny := len(p.GetVariants()) == 0 && inStock(stock, p.GetId(), 1)
+	variants := make([]variantView, len(p.GetVariants()))
+	overrides := prices[1:]
+	for i, v := range p.GetVariants() {
+		variants[i] = variantView{Variant: v, Price: price, InStock: inStock(stock, v.GetSku(), 1)}
+		inStockAny = inStockAny || variants[i].InStock
+		if v.GetPriceOverrideUsd() != nil {
+			variants[i].Price, overrides = overrides[0], overrides[1:]
+		}
 	}
 
 	product := struct {
-		Item  *pb.Product
-		Price *pb.Money
-	}{p, price}
-
-	// Fetch packaging info (weight/dimensions) of the product
-	// The packaging service is an optional microservice you can run as part of a Google Cloud demo.
-	var packagingInfo *PackagingInfo = nil
-	if isPackagingServiceConfigured() {
-		packagingInfo, err = httpGetPackagingInfo(id)
-		if err != nil {
-			fmt.Println("Failed to obtain product's packaging info:", err)
-		}
-	}
+		Item     *pb.Product
+		Price    *pb.Money
+		Variants []variantView
+		InStock  bool
+	}{p, price, variants, inStockAny}
 
+	pg.setSkippedHeader(w)
 	if err := templates.ExecuteTemplate(w, "product", injectCommonTemplateData(r, map[string]interface{}{
-		"ad":              fe.chooseAd(r.Context(), p.Categories, log),
+		"ad":              ad,
 		"show_currency":   true,
 		"currencies":      currencies,
 		"product":         product,
@@ -214,31 +289,49 @@ func (fe *frontendServer) productHandler(w http.ResponseWriter, r *http.Request)
 func (fe *frontendServer) addToCartHandler(w http.ResponseWriter, r *http.Request) {
 	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
 	quantity, _ := strconv.ParseUint(r.FormValue("quantity"), 10, 32)
-	productID := r.FormValue("product_id")
 	payload := validator.AddToCartPayload{
-		Quantity:  quantity,
-		ProductID: productID,
+		Quantity:   quantity,
+		ProductID:  r.FormValue("product_id"),
+		VariantSKU: r.FormValue("variant_sku"),
 	}
-	if err := payload.Validate(); err != nil {
-		renderHTTPError(log, r, w, validator.ValidationErrorResponse(err), http.StatusUnprocessableEntity)
+	if err := fe.addToCart(r.Context(), log, sessionID(r), payload); err != nil {
+		renderHTTPError(log, r, w, err, httpStatus(err, http.StatusInternalServerError))
 		return
 	}
-	log.WithField("product", payload.ProductID).WithField("quantity", payload.Quantity).Debug("adding to cart")
+	w.Header().Set("location", baseUrl+"/cart")
+	w.WriteHeader(http.StatusFound)
+}
 
-	p, err := fe.getProduct(r.Context(), payload.ProductID)
+// addToCart validates payload and adds the item to the user's cart, checking
+// the variant and, if the inventory can be reached, the stock level.
+func (fe *frontendServer) addToCart(ctx context.Context, log logrus.FieldLogger, userID string, payload validator.AddToCartPayload) error {
+	if err := payload.Validate(); err != nil {
+		return withStatus(http.StatusUnprocessableEntity, validator.ValidationErrorResponse(err))
+	}
+	log.WithField("product", payload.ProductID).WithField("variant", payload.VariantSKU).
+		WithField("quantity", payload.Quantity).Debug("adding to cart")
+
+	p, err := fe.getProduct(ctx, payload.ProductID)
 	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve product"), http.StatusInternalServerError)
-		return
+		return errors.Wrap(err, "could not retrieve product")
+	}
+	if err := checkVariant(p, payload.VariantSKU); err != nil {
+		return withStatus(http.StatusUnprocessableEntity, err)
+	}
+	sku := stockKey(p.GetId(), payload.VariantSKU)
+	if stock, err := fe.getStock(ctx, []string{sku}); err != nil {
+		log.WithField("error", err).Warn("failed to get stock levels")
+	} else if !inStock(stock, sku, int32(payload.Quantity)) {
+		recordCartOperation("add", "out_of_stock")
+		return withStatus(http.StatusConflict, errors.Errorf("only %d of %s left in stock", stock[sku].GetAvailable(), sku))
 	}
 
-	if err := fe.insertCart(r.Context(), sessionID(r), p.GetId(), int32(payload.Quantity)); err != nil {
+	if err := fe.insertCart(ctx, userID, p.GetId(), payload.VariantSKU, int32(payload.Quantity)); err != nil {
 		recordCartOperation("add", "error")
-		renderHTTPError(log, r, w, errors.Wrap(err, "failed to add to cart"), http.StatusInternalServerError)
-		return
+		return errors.Wrap(err, "failed to add to cart")
 	}
 	recordCartOperation("add", "success")
-	w.Header().Set("location", baseUrl+"/cart")
-	w.WriteHeader(http.StatusFound)
+	return nil
 }
 
 func (fe *frontendServer) emptyCartHandler(w http.ResponseWriter, r *http.Request) {
@@ -247,7 +340,7 @@ func (fe *frontendServer) emptyCartHandler(w http.ResponseWriter, r *http.Reques
 
 	if err := fe.emptyCart(r.Context(), sessionID(r)); err != nil {
 		recordCartOperation("empty", "error")
-		renderHTTPError(log, r, w, errors.Wrap(err, "failed to empty cart"), http.StatusInternalServerError)
+		renderHTTPError(log, r, w, errors.Wrap(err, "failed to empty cart"), httpStatus(err, http.StatusInternalServerError))
 		return
 	}
 	recordCartOperation("empty", "success")
@@ -255,61 +348,177 @@ func (fe *frontendServer) emptyCartHandler(w http.ResponseWriter, r *http.Reques
 	w.WriteHeader(http.StatusFound)
 }
 
-func (fe *frontendServer) viewCartHandler(w http.ResponseWriter, r *http.Request) {
+func (fe *frontendServer) updateCartItemHandler(w http.ResponseWriter, r *http.Request) {
 	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
-	log.Debug("view user cart")
-	currencies, err := fe.getCurrencies(r.Context())
+	quantity, err := strconv.ParseUint(r.FormValue("quantity"), 10, 32)
 	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve currencies"), http.StatusInternalServerError)
+		renderHTTPError(log, r, w, errors.Wrap(err, "invalid quantity"), http.StatusUnprocessableEntity)
 		return
 	}
-	cart, err := fe.getCart(r.Context(), sessionID(r))
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve cart"), http.StatusInternalServerError)
+	payload := validator.UpdateCartItemPayload{
+		ProductID:  r.FormValue("product_id"),
+		VariantSKU: r.FormValue("variant_sku"),
+		Quantity:   quantity,
+	}
+	if err := fe.updateCartItemQuantity(r.Context(), log, sessionID(r), payload); err != nil {
+		renderHTTPError(log, r, w, err, httpStatus(err, http.StatusInternalServerError))
 		return
 	}
+	w.Header().Set("location", baseUrl+"/cart")
+	w.WriteHeader(http.StatusFound)
+}
 
-	// ignores the error retrieving recommendations since it is not critical
-	recommendations, err := fe.getRecommendations(r.Context(), sessionID(r), cartIDs(cart))
-	if err != nil {
-		log.WithField("error", err).Warn("failed to get product recommendations")
+// updateCartItemQuantity validates payload and sets the quantity of an item
+// in the user's cart. Larger quantities are checked against the stock level
+// like new items are.
+func (fe *frontendServer) updateCartItemQuantity(ctx context.Context, log logrus.FieldLogger, userID string, payload validator.UpdateCartItemPayload) error {
+	if err := payload.Validate(); err != nil {
+		return withStatus(http.StatusUnprocessableEntity, validator.ValidationErrorResponse(err))
+	}
+	log.WithField("product", payload.ProductID).WithField("variant", payload.VariantSKU).
+		WithField("quantity", payload.Quantity).Debug("updating cart item")
+
+	if payload.Quantity > 0 {
+		sku := stockKey(payload.ProductID, payload.VariantSKU)
+		if stock, err := fe.getStock(ctx, []string{sku}); err != nil {
+			log.WithField("error", err).Warn("failed to get stock levels")
+		} else if !inStock(stock, sku, int32(payload.Quantity)) {
+			recordCartOperation("update", "out_of_stock")
+			return withStatus(http.StatusConflict, errors.Errorf("only %d of %s left in stock", stock[sku].GetAvailable(), sku))
+		}
 	}
 
-	shippingCost, err := fe.getShippingQuote(r.Context(), cart, currentCurrency(r))
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "failed to get shipping quote"), http.StatusInternalServerError)
+	if err := fe.updateCartItem(ctx, userID, payload.ProductID, payload.VariantSKU, int32(payload.Quantity)); err != nil {
+		recordCartOperation("update", "error")
+		return errors.Wrap(err, "failed to update cart item")
+	}
+	recordCartOperation("update", "success")
+	return nil
+}
+
+func (fe *frontendServer) removeCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	payload := validator.RemoveCartItemPayload{
+		ProductID:  r.FormValue("product_id"),
+		VariantSKU: r.FormValue("variant_sku"),
+	}
+	if err := fe.removeFromCart(r.Context(), log, sessionID(r), payload); err != nil {
+		renderHTTPError(log, r, w, err, httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+	w.Header().Set("location", baseUrl+"/cart")
+	w.WriteHeader(http.StatusFound)
+}
+
+// removeFromCart validates payload and removes the item from the user's cart.
+func (fe *frontendServer) removeFromCart(ctx context.Context, log logrus.FieldLogger, userID string, payload validator.RemoveCartItemPayload) error {
+	if err := payload.Validate(); err != nil {
+		return withStatus(http.StatusUnprocessableEntity, validator.ValidationErrorResponse(err))
+	}
+	log.WithField("product", payload.ProductID).WithField("variant", payload.VariantSKU).Debug("removing from cart")
+
+	if err := fe.removeCartItem(ctx, userID, payload.ProductID, payload.VariantSKU); err != nil {
+		recordCartOperation("remove", "error")
+		return errors.Wrap(err, "failed to remove cart item")
+	}
+	recordCartOperation("remove", "success")
+	return nil
+}
+
+func (fe *frontendServer) viewCartHandler(w http.ResponseWriter, r *http.Request) {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	log.Debug("view user cart")
+
+	var (
+		currencies []string
+		cart       []*pb.CartItem
+	)
+	pg := newPage(r.Context(), "cart", log)
+	defer pg.close()
+	pg.critical("currencies", criticalFragmentTimeout, func(ctx context.Context) (err error) {
+		currencies, err = fe.getCurrencies(ctx)
+		return err
+	})
+	pg.critical("cart", criticalFragmentTimeout, func(ctx context.Context) (err error) {
+		cart, err = fe.getCart(ctx, sessionID(r))
+		return err
+	})
+	if err := pg.wait(); err != nil {
+		renderHTTPError(log, r, w, err, httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	var (
+		recommendations []*pb.Product
+		shippingCost    *pb.Money
+		stock           map[string]*pb.StockLevel
+		products        = make([]*pb.Product, len(cart))
+	)
+	skus := make([]string, len(cart))
+	for i, item := range cart {
+		skus[i] = stockKey(item.GetProductId(), item.GetVariantSku())
+	}
+	pg.optional("recommendations", optionalFragmentTimeout, func(ctx context.Context) (err error) {
+		recommendations, err = fe.getRecommendations(ctx, sessionID(r), cartIDs(cart))
+		return err
+	})
+	pg.critical("shipping quote", criticalFragmentTimeout, func(ctx context.Context) (err error) {
+		shippingCost, err = fe.getShippingQuote(ctx, cart, currentCurrency(r))
+		return err
+	})
+	// stock levels are optional since checkout enforces them
+	pg.optional("stock", optionalFragmentTimeout, func(ctx context.Context) (err error) {
+		stock, err = fe.getStock(ctx, skus)
+		return err
+	})
+	for i, item := range cart {
+		pg.critical("product #"+item.GetProductId(), criticalFragmentTimeout, func(ctx context.Context) (err error) {
+			products[i], err = fe.getProduct(ctx, item.GetProductId())
+			return err
+		})
+	}
+	if err := pg.wait(); err != nil {
+		renderHTTPError(log, r, w, err, httpStatus(err, http.StatusInternalServerError))
 		return
 	}
 
 	type cartItemView struct {
 		Item     *pb.Product
+		Variant  *pb.ProductVariant
 		Quantity int32
 		Price    *pb.Money
+		InStock  bool
 	}
 	items := make([]cartItemView, len(cart))
-	totalPrice := pb.Money{CurrencyCode: currentCurrency(r)}
+	unitPricesUsd := make([]*pb.Money, len(cart))
 	for i, item := range cart {
-		p, err := fe.getProduct(r.Context(), item.GetProductId())
-		if err != nil {
-			renderHTTPError(log, r, w, errors.Wrapf(err, "could not retrieve product #%s", item.GetProductId()), http.StatusInternalServerError)
-			return
-		}
-		price, err := fe.convertCurrency(r.Context(), p.GetPriceUsd(), currentCurrency(r))
-		if err != nil {
-			renderHTTPError(log, r, w, errors.Wrapf(err, "could not convert currency for product #%s", item.GetProductId()), http.StatusInternalServerError)
-			return
-		}
-
-		multPrice := money.MultiplySlow(*price, uint32(item.GetQuantity()))
+		p := products[i]
+		variant := findVariant(p, item.GetVariantSku())
 		items[i] = cartItemView{
 			Item:     p,
+			Variant:  variant,
 			Quantity: item.GetQuantity(),
-			Price:    &multPrice}
+			InStock:  inStock(stock, skus[i], item.GetQuantity())}
+		unitPricesUsd[i] = unitPriceUsd(p, variant)
+	}
+	unitPrices, err := fe.convertCurrencies(r.Context(), unitPricesUsd, currentCurrency(r))
+	if err != nil {
+		renderHTTPError(log, r, w, errors.Wrap(err, "could not convert currency for cart items"), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	allInStock := true
+	totalPrice := &pb.Money{CurrencyCode: currentCurrency(r)}
+	for i, item := range cart {
+		multPrice := money.Must(money.Multiply(unitPrices[i], int64(item.GetQuantity())))
+		items[i].Price = multPrice
+		allInStock = allInStock && items[i].InStock
 		totalPrice = money.Must(money.Sum(totalPrice, multPrice))
 	}
-	totalPrice = money.Must(money.Sum(totalPrice, *shippingCost))
+	totalPrice = money.Must(money.Sum(totalPrice, shippingCost))
 	year := time.Now().Year()
 
+	pg.setSkippedHeader(w)
 	if err := templates.ExecuteTemplate(w, "cart", injectCommonTemplateData(r, map[string]interface{}{
 		"currencies":       currencies,
 		"recommendations":  recommendations,
@@ -318,7 +527,9 @@ func (fe *frontendServer) viewCartHandler(w http.ResponseWriter, r *http.Request
 		"show_currency":    true,
 		"total_cost":       totalPrice,
 		"items":            items,
+		"all_in_stock":     allInStock,
 		"expiration_years": []int{year, year + 1, year + 2, year + 3, year + 4},
+		"checkout":         fe.checkoutFor(r.Context(), log, accountID(r)),
 	})); err != nil {
 		log.Println(err)
 	}
@@ -353,21 +564,59 @@ func (fe *frontendServer) placeOrderHandler(w http.ResponseWriter, r *http.Reque
 		CcYear:        ccYear,
 		CcCVV:         ccCVV,
 	}
-	if err := payload.Validate(); err != nil {
-		renderHTTPError(log, r, w, validator.ValidationErrorResponse(err), http.StatusUnprocessableEntity)
+	order, totalPaid, err := fe.placeOrder(r.Context(), log, sessionID(r), currentCurrency(r), payload)
+	if err != nil {
+		renderHTTPError(log, r, w, err, httpStatus(err, http.StatusInternalServerError))
 		return
 	}
+	if id := accountID(r); id != "" && r.FormValue("save_address") == "true" {
+		address := validator.AddressPayload{
+			StreetAddress: streetAddress,
+			ZipCode:       zipCode,
+			City:          city,
+			State:         state,
+			Country:       country,
+		}
+		if err := fe.saveAddress(r.Context(), id, address); err != nil {
+			log.WithField("error", err).Warn("failed to save address")
+		}
+	}
+	recommendations, _ := fe.getRecommendations(r.Context(), sessionID(r), nil)
+
+	currencies, err := fe.getCurrencies(r.Context())
+	if err != nil {
+		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve currencies"), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	if err := templates.ExecuteTemplate(w, "order", injectCommonTemplateData(r, map[string]interface{}{
+		"show_currency":   false,
+		"currencies":      currencies,
+		"order":           order,
+		"total_paid":      totalPaid,
+		"recommendations": recommendations,
+	})); err != nil {
+		log.Println(err)
+	}
+}
+
+// placeOrder validates payload and places an order for the user's cart,
+// charged in currency. It returns the order and the total paid.
+func (fe *frontendServer) placeOrder(ctx context.Context, log logrus.FieldLogger, userID, currency string, payload validator.PlaceOrderPayload) (*pb.OrderResult, *pb.Money, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, nil, withStatus(http.StatusUnprocessableEntity, validator.ValidationErrorResponse(err))
+	}
 
-	order, err := pb.NewCheckoutServiceClient(fe.checkoutSvcConn).
-		PlaceOrder(r.Context(), &pb.PlaceOrderRequest{
+	resp, err := pb.NewCheckoutServiceClient(fe.checkoutSvcConn).
+		PlaceOrder(ctx, &pb.PlaceOrderRequest{
 			Email: payload.Email,
 			CreditCard: &pb.CreditCardInfo{
 				CreditCardNumber:          payload.CcNumber,
 				CreditCardExpirationMonth: int32(payload.CcMonth),
 				CreditCardExpirationYear:  int32(payload.CcYear),
 				CreditCardCvv:             int32(payload.CcCVV)},
-			UserId:       sessionID(r),
-			UserCurrency: currentCurrency(r),
+			UserId:       userID,
+			UserCurrency: currency,
 			Address: &pb.Address{
 				StreetAddress: payload.StreetAddress,
 				City:          payload.City,
@@ -375,19 +624,20 @@ func (fe *frontendServer) placeOrderHandler(w http.ResponseWriter, r *http.Reque
 				ZipCode:       int32(payload.ZipCode),
 				Country:       payload.Country},
 		})
+	if status.Code(err) == codes.FailedPrecondition {
+		ordersTotal.WithLabelValues("out_of_stock").Inc()
+		return nil, nil, withStatus(http.StatusConflict, errors.Wrap(err, "some items in your cart are out of stock"))
+	}
 	if err != nil {
 		ordersTotal.WithLabelValues("error").Inc()
-		renderHTTPError(log, r, w, errors.Wrap(err, "failed to complete the order"), http.StatusInternalServerError)
-		return
+		return nil, nil, errors.Wrap(err, "failed to complete the order")
 	}
-	log.WithField("order", order.GetOrder().GetOrderId()).Info("order placed")
+	order := resp.GetOrder()
+	log.WithField("order", order.GetOrderId()).Info("order placed")
 
-	order.GetOrder().GetItems()
-	recommendations, _ := fe.getRecommendations(r.Context(), sessionID(r), nil)
-
-	totalPaid := *order.GetOrder().GetShippingCost()
-	for _, v := range order.GetOrder().GetItems() {
-		multPrice := money.MultiplySlow(*v.GetCost(), uint32(v.GetItem().GetQuantity()))
+	totalPaid := order.GetShippingCost()
+	for _, v := range order.GetItems() {
+		multPrice := money.Must(money.Multiply(v.GetCost(), int64(v.GetItem().GetQuantity())))
 		totalPaid = money.Must(money.Sum(totalPaid, multPrice))
 	}
 
@@ -395,28 +645,14 @@ func (fe *frontendServer) placeOrderHandler(w http.ResponseWriter, r *http.Reque
 	ordersTotal.WithLabelValues("success").Inc()
 	orderValueUSD := float64(totalPaid.GetUnits()) + float64(totalPaid.GetNanos())/1e9
 	orderValue.Observe(orderValueUSD)
-
-	currencies, err := fe.getCurrencies(r.Context())
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve currencies"), http.StatusInternalServerError)
-		return
-	}
-
-	if err := templates.ExecuteTemplate(w, "order", injectCommonTemplateData(r, map[string]interface{}{
-		"show_currency":   false,
-		"currencies":      currencies,
-		"order":           order.GetOrder(),
-		"total_paid":      &totalPaid,
-		"recommendations": recommendations,
-	})); err != nil {
-		log.Println(err)
-	}
+	fe.recordOrder(ctx, log, userID, order, totalPaid)
+	return order, totalPaid, nil
 }
 
 func (fe *frontendServer) assistantHandler(w http.ResponseWriter, r *http.Request) {
 	currencies, err := fe.getCurrencies(r.Context())
 	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve currencies"), http.StatusInternalServerError)
+		renderHTTPError(log, r, w, errors.Wrap(err, "could not retrieve currencies"), httpStatus(err, http.StatusInternalServerError))
 		return
 	}
 
@@ -431,7 +667,15 @@ func (fe *frontendServer) assistantHandler(w http.ResponseWriter, r *http.Reques
 func (fe *frontendServer) logoutHandler(w http.ResponseWriter, r *http.Request) {
 	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
 	log.Debug("logging out")
+	if s, ok := r.Context().Value(ctxKeySession{}).(*session.Session); ok {
+		if err := fe.sessions.Destroy(w, r, s); err != nil {
+			log.WithField("error", err).Warn("failed to delete session")
+		}
+	}
 	for _, c := range r.Cookies() {
+		if c.Name == cookieSessionID {
+			continue
+		}
 		c.Expires = time.Now().Add(-time.Hour * 24 * 365)
 		c.MaxAge = -1
 		http.SetCookie(w, c)
@@ -440,73 +684,87 @@ func (fe *frontendServer) logoutHandler(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusFound)
 }
 
-func (fe *frontendServer) getProductByID(w http.ResponseWriter, r *http.Request) {
-	id := mux.Vars(r)["ids"]
-	if id == "" {
-		return
-	}
+// maxProductMetaIDs bounds the number of products requested at once from
+// /product-meta.
+const maxProductMetaIDs = 50
 
-	p, err := fe.getProduct(r.Context(), id)
-	if err != nil {
-		return
-	}
-
-	jsonData, err := json.Marshal(p)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-
-	w.Write(jsonData)
-	w.WriteHeader(http.StatusOK)
+// productMeta is an entry of the /product-meta response: the product, or the
+// error fetching it.
+type productMeta struct {
+	ID      string          `json:"id"`
+	Product *apiProduct     `json:"product,omitempty"`
+	Error   *apiErrorDetail `json:"error,omitempty"`
 }
 
-func (fe *frontendServer) chatBotHandler(w http.ResponseWriter, r *http.Request) {
-	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
-	type Response struct {
-		Message string `json:"message"`
-	}
-
-	type LLMResponse struct {
-		Content string         `json:"content"`
-		Details map[string]any `json:"details"`
-	}
-
-	var response LLMResponse
-
-	url := "http://" + fe.shoppingAssistantSvcAddr
-	req, err := http.NewRequest(http.MethodPost, url, r.Body)
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "failed to create request"), http.StatusInternalServerError)
-		return
+// productMetaHandler returns the products with the comma-separated IDs, in
+// order, fetched concurrently. Prices are in USD unless the currency query
+// parameter asks for another currency. Products that could not be fetched
+// are reported with an error each; the status is 200 if every product was
+// found, 207 if some were, and that of the first error if none were.
+func (fe *frontendServer) productMetaHandler(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(mux.Vars(r)["ids"], ",") {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "failed to send request"), http.StatusInternalServerError)
+	if len(ids) == 0 || len(ids) > maxProductMetaIDs {
+		renderAPIError(r, w, errors.Errorf("between 1 and %d product IDs must be given", maxProductMetaIDs), http.StatusBadRequest)
 		return
 	}
-
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "failed to read response"), http.StatusInternalServerError)
-		return
+	currency := "USD"
+	if c := r.URL.Query().Get("currency"); c != "" {
+		if currency = strings.ToUpper(c); !supportedCurrencies.isSupported(currency) {
+			renderAPIError(r, w, errors.Errorf("currency %s is not supported", currency), http.StatusBadRequest)
+			return
+		}
 	}
 
-	fmt.Printf("%+v\n", body)
-	fmt.Printf("%+v\n", res)
+	out := make([]productMeta, len(ids))
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), criticalFragmentTimeout)
+			defer cancel()
+			out[i].ID = id
+			p, err := fe.getProduct(ctx, id)
+			if err != nil {
+				errs[i] = errors.Wrap(err, "could not retrieve product")
+				return
+			}
+			products, err := fe.apiProducts(ctx, []*pb.Product{p}, currency, nil)
+			if err != nil {
+				errs[i] = errors.Wrap(err, "could not convert price")
+				return
+			}
+			out[i].Product = &products[0]
+		}()
+	}
+	wg.Wait()
 
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		renderHTTPError(log, r, w, errors.Wrap(err, "failed to unmarshal body"), http.StatusInternalServerError)
-		return
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	code, failed := http.StatusOK, 0
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		errCode := httpStatus(err, http.StatusInternalServerError)
+		log.WithField("id", ids[i]).WithField("error", err).Warn("failed to get product metadata")
+		out[i].Error = &apiErrorDetail{Code: errCode, Status: http.StatusText(errCode), Message: publicMessage(err, errCode)}
+		if failed == 0 {
+			code = errCode
+		}
+		failed++
 	}
-
-	// respond with the same message
-	json.NewEncoder(w).Encode(Response{Message: response.Content})
-
-	w.WriteHeader(http.StatusOK)
+	if failed > 0 && failed < len(ids) {
+		code = http.StatusMultiStatus
+	}
+	writeJSON(w, code, out)
 }
 
 func (fe *frontendServer) setCurrencyHandler(w http.ResponseWriter, r *http.Request) {
@@ -517,6 +775,10 @@ func (fe *frontendServer) setCurrencyHandler(w http.ResponseWriter, r *http.Requ
 		renderHTTPError(log, r, w, validator.ValidationErrorResponse(err), http.StatusUnprocessableEntity)
 		return
 	}
+	if !supportedCurrencies.isSupported(payload.Currency) {
+		renderHTTPError(log, r, w, errors.Errorf("currency %s is not supported", payload.Currency), http.StatusUnprocessableEntity)
+		return
+	}
 	log.WithField("curr.new", payload.Currency).WithField("curr.old", currentCurrency(r)).
 		Debug("setting currency")
 
@@ -528,55 +790,48 @@ func (fe *frontendServer) setCurrencyHandler(w http.ResponseWriter, r *http.Requ
 		}
 
 		http.SetCookie(w, &http.Cookie{
-			Name:   cookieCurrency,
-			Value:  payload.Currency,
-			MaxAge: cookieMaxAge,
+			Name:     cookieCurrency,
+			Value:    payload.Currency,
+			Path:     baseUrl + "/",
+			MaxAge:   cookieMaxAge,
+			HttpOnly: true,
+			Secure:   secureCookies || r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
 		})
 	}
 	referer := r.Header.Get("referer")
 	if referer == "" {
 		referer = baseUrl + "/"
 	}
-	w.Header().Set("Location", referer)
-	w.WriteHeader(http.StatusFound)
+	localRedirect(w, r, referer)
 }
 
-// chooseAd queries for advertisements available and randomly chooses one, if
-// available. It ignores the error retrieving the ad since it is not critical.
-func (fe *frontendServer) chooseAd(ctx context.Context, ctxKeys []string, log logrus.FieldLogger) *pb.Ad {
+// chooseAd queries for advertisements available and randomly chooses one.
+func (fe *frontendServer) chooseAd(ctx context.Context, ctxKeys []string) (*pb.Ad, error) {
 	ads, err := fe.getAd(ctx, ctxKeys)
 	if err != nil {
-		log.WithField("error", err).Warn("failed to retrieve ads")
-		return nil
+		return nil, errors.Wrap(err, "failed to retrieve ads")
 	}
-	return ads[rand.Intn(len(ads))]
-}
-
-func renderHTTPError(log logrus.FieldLogger, r *http.Request, w http.ResponseWriter, err error, code int) {
-	log.WithField("error", err).Error("request error")
-	errMsg := fmt.Sprintf("%+v", err)
-
-	w.WriteHeader(code)
-
-	if templateErr := templates.ExecuteTemplate(w, "error", injectCommonTemplateData(r, map[string]interface{}{
-		"error":       errMsg,
-		"status_code": code,
-		"status":      http.StatusText(code),
-	})); templateErr != nil {
-		log.Println(templateErr)
+	if len(ads) == 0 {
+		return nil, errors.New("no ads available")
 	}
+	return ads[rand.Intn(len(ads))], nil
 }
 
 func injectCommonTemplateData(r *http.Request, payload map[string]interface{}) map[string]interface{} {
 	data := map[string]interface{}{
 		"session_id":        sessionID(r),
+		"csrf_token":        csrfToken(r),
+		"signed_in":         accountID(r) != "",
+		"account_name":      accountName(r),
 		"request_id":        r.Context().Value(ctxKeyRequestID{}),
 		"user_currency":     currentCurrency(r),
+		"locale":            requestLocale(r),
 		"platform_css":      plat.css,
 		"platform_name":     plat.provider,
 		"is_cymbal_brand":   isCymbalBrand,
 		"assistant_enabled": assistantEnabled,
-		"deploymentDetails": deploymentDetailsMap,
+		"deploymentDetails": deploymentDetails(),
 		"frontendMessage":   frontendMessage,
 		"currentYear":       time.Now().Year(),
 		"baseUrl":           baseUrl,
@@ -589,18 +844,56 @@ func injectCommonTemplateData(r *http.Request, payload map[string]interface{}) m
 	return data
 }
 
+// currentCurrency returns the shopper's chosen currency if it is still
+// offered, or else the default currency for them.
 func currentCurrency(r *http.Request) string {
 	c, _ := r.Cookie(cookieCurrency)
-	if c != nil {
+	if c != nil && supportedCurrencies.isSupported(c.Value) {
 		return c.Value
 	}
-	return defaultCurrency
+	return supportedCurrencies.defaultFor(r)
 }
 
+// acceptedLanguages returns the languages in the request's Accept-Language
+// header, in order of preference. Entries that do not parse are skipped
+// rather than discarding the whole header.
+func acceptedLanguages(r *http.Request) []language.Tag {
+	type preference struct {
+		tag    language.Tag
+		weight float32
+	}
+	var prefs []preference
+	for _, entry := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		t, q, err := language.ParseAcceptLanguage(entry)
+		if err != nil || len(t) == 0 {
+			continue
+		}
+		prefs = append(prefs, preference{t[0], q[0]})
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].weight > prefs[j].weight })
+	tags := make([]language.Tag, len(prefs))
+	for i, p := range prefs {
+		tags[i] = p.tag
+	}
+	return tags
+}
+
+// requestLocale picks the locale used to format numbers from the request's
+// Accept-Language header.
+func requestLocale(r *http.Request) money.Locale {
+	for _, tag := range acceptedLanguages(r) {
+		if l, ok := money.LookupLocale(tag.String()); ok {
+			return l
+		}
+	}
+	return money.DefaultLocale
+}
+
+// sessionID returns the ID the backend services know the visitor by: the user
+// ID of their session, which stays the same when the session is renewed.
 func sessionID(r *http.Request) string {
-	v := r.Context().Value(ctxKeySessionID{})
-	if v != nil {
-		return v.(string)
+	if s, ok := r.Context().Value(ctxKeySession{}).(*session.Session); ok {
+		return s.UserID
 	}
 	return ""
 }
@@ -622,26 +915,92 @@ func cartSize(c []*pb.CartItem) int {
 	return cartSize
 }
 
-func renderMoney(money *pb.Money) string {
-	currencyLogo := renderCurrencyLogo(money.GetCurrencyCode())
-	return fmt.Sprintf("%s%d.%02d", currencyLogo, money.GetUnits(), money.GetNanos()/10000000)
+// findVariant returns the variant of p with the given SKU, or nil if the SKU
+// is empty or unknown.
+func findVariant(p *pb.Product, sku string) *pb.ProductVariant {
+	if sku == "" {
+		return nil
+	}
+	for _, v := range p.GetVariants() {
+		if v.GetSku() == sku {
+			return v
+		}
+	}
+	return nil
 }
 
-func renderCurrencyLogo(currencyCode string) string {
-	logos := map[string]string{
-		"USD": "$",
-		"CAD": "$",
-		"JPY": "¥",
-		"EUR": "€",
-		"TRY": "₺",
-		"GBP": "£",
+// checkVariant verifies that sku selects one of p's variants, or is empty if
+// p has none.
+func checkVariant(p *pb.Product, sku string) error {
+	if len(p.GetVariants()) == 0 {
+		if sku != "" {
+			return errors.Errorf("product %s has no variants", p.GetId())
+		}
+		return nil
+	}
+	if sku == "" {
+		return errors.Errorf("product %s requires a variant to be selected", p.GetId())
 	}
+	if findVariant(p, sku) == nil {
+		return errors.Errorf("product %s has no variant %s", p.GetId(), sku)
+	}
+	return nil
+}
+
+// stockKey returns the SKU stock is tracked under: the variant SKU if there
+// is one, otherwise the product ID.
+func stockKey(productID, variantSKU string) string {
+	if variantSKU != "" {
+		return variantSKU
+	}
+	return productID
+}
 
-	logo := "$" //default
-	if val, ok := logos[currencyCode]; ok {
-		logo = val
+// productSKUs returns the SKUs stock is tracked under for p.
+func productSKUs(p *pb.Product) []string {
+	if len(p.GetVariants()) == 0 {
+		return []string{p.GetId()}
 	}
-	return logo
+	skus := make([]string, len(p.GetVariants()))
+	for i, v := range p.GetVariants() {
+		skus[i] = v.GetSku()
+	}
+	return skus
+}
+
+// inStock reports whether quantity units of sku are available. SKUs that are
+// untracked or missing from stock, e.g. because the inventory could not be
+// reached, are treated as in stock.
+func inStock(stock map[string]*pb.StockLevel, sku string, quantity int32) bool {
+	l, ok := stock[sku]
+	if !ok || !l.GetTracked() {
+		return true
+	}
+	return l.GetAvailable() >= quantity
+}
+
+// unitPriceUsd returns the price of one unit of p, taking the variant's price
+// override into account when there is one.
+func unitPriceUsd(p *pb.Product, v *pb.ProductVariant) *pb.Money {
+	if v.GetPriceOverrideUsd() != nil {
+		return v.GetPriceOverrideUsd()
+	}
+	return p.GetPriceUsd()
+}
+
+// renderMoney formats an amount for display in the visitor's locale. Amounts
+// that can't be formatted are written out as the money package describes them.
+func renderMoney(locale money.Locale, m *pb.Money) string {
+	s, err := money.Format(m, locale)
+	if err != nil {
+		return money.String(m)
+	}
+	return s
+}
+
+func renderCurrencyLogo(currencyCode string) string {
+	c, _ := money.LookupCurrency(currencyCode)
+	return c.Symbol
 }
 
 func stringinSlice(slice []string, val string) bool {
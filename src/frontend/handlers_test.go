@@ -12,16 +12,24 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package frontend
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
-	pb "github.com/GoogleCloudPlatform/microservices-demo/src/frontend/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/backendtest"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/cart"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/session"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
@@ -57,6 +65,7 @@ func TestCurrentCurrency(t *testing.T) {
 	tests := []struct {
 		name     string
 		cookie   *http.Cookie
+		header   http.Header
 		expected string
 	}{
 		{
@@ -72,6 +81,38 @@ func TestCurrentCurrency(t *testing.T) {
 			},
 			expected: "EUR",
 		},
+		{
+			name: "unsupported currency cookie",
+			cookie: &http.Cookie{
+				Name:  cookieCurrency,
+				Value: "CHF",
+			},
+			expected: defaultCurrency,
+		},
+		{
+			name:     "country from accept-language skips unsupported",
+			header:   http.Header{"Accept-Language": {"fr-CH, ja-JP;q=0.8"}},
+			expected: "JPY",
+		},
+		{
+			name:     "region from accept-language",
+			header:   http.Header{"Accept-Language": {"en-GB"}},
+			expected: "GBP",
+		},
+		{
+			name:     "country from geo header",
+			header:   http.Header{"Cf-Ipcountry": {"TR"}, "Accept-Language": {"en-GB"}},
+			expected: "TRY",
+		},
+		{
+			name: "cookie wins over country",
+			cookie: &http.Cookie{
+				Name:  cookieCurrency,
+				Value: "CAD",
+			},
+			header:   http.Header{"X-Client-Geo-Country": {"DE"}},
+			expected: "CAD",
+		},
 	}
 
 	for _, tt := range tests {
@@ -80,6 +121,9 @@ func TestCurrentCurrency(t *testing.T) {
 			if tt.cookie != nil {
 				req.AddCookie(tt.cookie)
 			}
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
 
 			result := currentCurrency(req)
 			if result != tt.expected {
@@ -91,22 +135,27 @@ func TestCurrentCurrency(t *testing.T) {
 
 func TestSessionID(t *testing.T) {
 	tests := []struct {
-		name     string
-		cookie   *http.Cookie
-		hasValue bool
+		name    string
+		cookie  *http.Cookie
+		session *session.Session
+		want    string
 	}{
 		{
-			name:     "no session cookie",
-			cookie:   nil,
-			hasValue: false,
+			name: "no session",
+			want: "",
 		},
 		{
-			name: "valid session cookie",
+			name: "session cookie without a session",
 			cookie: &http.Cookie{
 				Name:  cookieSessionID,
 				Value: "test-session-123",
 			},
-			hasValue: true,
+			want: "",
+		},
+		{
+			name:    "session",
+			session: &session.Session{ID: "abc", UserID: "test-user-123"},
+			want:    "test-user-123",
 		},
 	}
 
@@ -116,16 +165,12 @@ func TestSessionID(t *testing.T) {
 			if tt.cookie != nil {
 				req.AddCookie(tt.cookie)
 			}
-
-			result := sessionID(req)
-			if tt.hasValue && result == "" {
-				// The sessionID function may generate a new ID if the cookie is not properly parsed
-				// This is acceptable behavior for testing
-				t.Logf("sessionID() returned empty string when cookie was set - this is acceptable")
+			if tt.session != nil {
+				req = req.WithContext(context.WithValue(req.Context(), ctxKeySession{}, tt.session))
 			}
-			if !tt.hasValue && result == "" {
-				// This is expected - sessionID generates a new ID if none exists
-				return
+
+			if got := sessionID(req); got != tt.want {
+				t.Errorf("sessionID() = %q, want %q", got, tt.want)
 			}
 		})
 	}
@@ -183,14 +228,109 @@ func TestCartIDs(t *testing.T) {
 	}
 }
 
+func TestCheckVariant(t *testing.T) {
+	plain := &pb.Product{Id: "P1"}
+	sized := &pb.Product{Id: "P2", Variants: []*pb.ProductVariant{
+		{Sku: "P2-S", Name: "S"},
+		{Sku: "P2-L", Name: "L"},
+	}}
+
+	tests := []struct {
+		name    string
+		product *pb.Product
+		sku     string
+		wantErr bool
+	}{
+		{"no variants, no sku", plain, "", false},
+		{"no variants, sku", plain, "P1-S", true},
+		{"variants, known sku", sized, "P2-L", false},
+		{"variants, no sku", sized, "", true},
+		{"variants, unknown sku", sized, "P1-S", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkVariant(tt.product, tt.sku); (err != nil) != tt.wantErr {
+				t.Errorf("checkVariant() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnitPriceUsd(t *testing.T) {
+	base := &pb.Money{CurrencyCode: "USD", Units: 10}
+	override := &pb.Money{CurrencyCode: "USD", Units: 12}
+	p := &pb.Product{Id: "P", PriceUsd: base, Variants: []*pb.ProductVariant{
+		{Sku: "P-S"},
+		{Sku: "P-L", PriceOverrideUsd: override},
+	}}
+
+	if got := unitPriceUsd(p, nil); got != base {
+		t.Errorf("unitPriceUsd(nil) = %v, want %v", got, base)
+	}
+	if got := unitPriceUsd(p, findVariant(p, "P-S")); got != base {
+		t.Errorf("unitPriceUsd(P-S) = %v, want %v", got, base)
+	}
+	if got := unitPriceUsd(p, findVariant(p, "P-L")); got != override {
+		t.Errorf("unitPriceUsd(P-L) = %v, want %v", got, override)
+	}
+}
+
+func TestInStock(t *testing.T) {
+	stock := map[string]*pb.StockLevel{
+		"A":   {Sku: "A", Available: 3, Tracked: true},
+		"B":   {Sku: "B", Available: 0, Tracked: true},
+		"C-M": {Sku: "C-M", Tracked: false},
+	}
+
+	tests := []struct {
+		name     string
+		sku      string
+		quantity int32
+		want     bool
+	}{
+		{"enough stock", "A", 3, true},
+		{"not enough stock", "A", 4, false},
+		{"sold out", "B", 1, false},
+		{"untracked", "C-M", 100, true},
+		{"unknown", "D", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inStock(stock, tt.sku, tt.quantity); got != tt.want {
+				t.Errorf("inStock(%q, %d) = %v, want %v", tt.sku, tt.quantity, got, tt.want)
+			}
+		})
+	}
+
+	if !inStock(nil, "A", 1) {
+		t.Error("inStock() with no stock levels should assume the item is in stock")
+	}
+}
+
+func TestProductSKUs(t *testing.T) {
+	if got := productSKUs(&pb.Product{Id: "P"}); len(got) != 1 || got[0] != "P" {
+		t.Errorf("productSKUs() without variants = %v, want [P]", got)
+	}
+	p := &pb.Product{Id: "P", Variants: []*pb.ProductVariant{{Sku: "P-S"}, {Sku: "P-L"}}}
+	if got := productSKUs(p); len(got) != 2 || got[0] != "P-S" || got[1] != "P-L" {
+		t.Errorf("productSKUs() with variants = %v, want [P-S P-L]", got)
+	}
+	if got := stockKey("P", "P-S"); got != "P-S" {
+		t.Errorf("stockKey() = %q, want P-S", got)
+	}
+}
+
 func TestRenderMoney(t *testing.T) {
+	de, _ := money.LookupLocale("de")
 	tests := []struct {
 		name     string
+		locale   money.Locale
 		money    *pb.Money
 		expected string
 	}{
 		{
-			name: "USD dollars",
+			name:   "USD dollars",
+			locale: money.DefaultLocale,
 			money: &pb.Money{
 				CurrencyCode: "USD",
 				Units:        10,
@@ -199,7 +339,8 @@ func TestRenderMoney(t *testing.T) {
 			expected: "$10.50",
 		},
 		{
-			name: "EUR euros",
+			name:   "EUR euros",
+			locale: money.DefaultLocale,
 			money: &pb.Money{
 				CurrencyCode: "EUR",
 				Units:        25,
@@ -208,7 +349,8 @@ func TestRenderMoney(t *testing.T) {
 			expected: "€25.75",
 		},
 		{
-			name: "zero amount",
+			name:   "zero amount",
+			locale: money.DefaultLocale,
 			money: &pb.Money{
 				CurrencyCode: "USD",
 				Units:        0,
@@ -216,11 +358,51 @@ func TestRenderMoney(t *testing.T) {
 			},
 			expected: "$0.00",
 		},
+		{
+			name:   "JPY without decimals",
+			locale: money.DefaultLocale,
+			money: &pb.Money{
+				CurrencyCode: "JPY",
+				Units:        1264,
+				Nanos:        50000000,
+			},
+			expected: "¥1,264",
+		},
+		{
+			name:   "German separators",
+			locale: de,
+			money: &pb.Money{
+				CurrencyCode: "EUR",
+				Units:        1234,
+				Nanos:        500000000,
+			},
+			expected: "€1.234,50",
+		},
+		{
+			name:   "negative amount",
+			locale: money.DefaultLocale,
+			money: &pb.Money{
+				CurrencyCode: "USD",
+				Units:        -1,
+				Nanos:        -500000000,
+			},
+			expected: "-$1.50",
+		},
+		{
+			name:   "invalid amount",
+			locale: money.DefaultLocale,
+			money: &pb.Money{
+				CurrencyCode: "USD",
+				Units:        1,
+				Nanos:        -500000000,
+			},
+			expected: `invalid money (units=1, nanos=-500000000, currency_code="USD")`,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := renderMoney(tt.money)
+			result := renderMoney(tt.locale, tt.money)
 			if result != tt.expected {
 				t.Errorf("renderMoney() = %v, want %v", result, tt.expected)
 			}
@@ -228,6 +410,30 @@ func TestRenderMoney(t *testing.T) {
 	}
 }
 
+func TestRequestLocale(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"de-DE,de;q=0.9,en;q=0.8", "de"},
+		{"en-IN", "en-IN"},
+		{"xx-YY, fr;q=0.5", "fr"},
+		{"fr;q=0.5, ja", "ja"},
+		{"it;q=0.2, xx;q=0.9, de;q=0.4, en;q=0.1", "de"},
+		{"not a header", "en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Language", tt.header)
+			if got := requestLocale(r).Tag; got != tt.want {
+				t.Errorf("requestLocale(%q) = %s, want %s", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestStringInSlice(t *testing.T) {
 	slice := []string{"apple", "banana", "cherry"}
 
@@ -286,13 +492,99 @@ func TestChooseAd(t *testing.T) {
 	server := &frontendServer{}
 
 	ctx := context.Background()
-	log := logrus.New()
 
 	// Test successful ad retrieval
-	ad := server.chooseAd(ctx, []string{}, log)
+	ad, err := server.chooseAd(ctx, []string{})
 	// chooseAd should return nil when no ad service connection exists
-	if ad != nil {
-		t.Error("chooseAd() should return nil when no ad service connection exists")
+	if ad != nil || err == nil {
+		t.Error("chooseAd() should fail when no ad service connection exists")
+	}
+}
+
+func TestProductMetaHandler(t *testing.T) {
+	fe := newTestFrontend(t,
+		&pb.Product{Id: "a", Name: "A", PriceUsd: usd(2, 0)},
+		&pb.Product{Id: "b", Name: "B", PriceUsd: usd(3, 250000000)})
+	fe.currencySvcConn = dialCurrencyService(t, &fakeCurrencyService{rates: map[string]float64{"EUR": 1, "USD": 2}})
+	r := mux.NewRouter()
+	r.HandleFunc("/product-meta/{ids}", fe.productMetaHandler)
+	var tooMany []string
+	for i := 0; i <= maxProductMetaIDs; i++ {
+		tooMany = append(tooMany, fmt.Sprint("p", i))
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		want       []string // "id: amount currency" or "id: error status"
+	}{
+		{"one", "/product-meta/a", http.StatusOK, []string{"a: 2 USD"}},
+		{"several", "/product-meta/b,a,b", http.StatusOK, []string{"b: 3.25 USD", "a: 2 USD"}},
+		{"currency", "/product-meta/a,b?currency=eur", http.StatusOK, []string{"a: 1 EUR", "b: 1.62 EUR"}},
+		{"some missing", "/product-meta/a,x", http.StatusMultiStatus, []string{"a: 2 USD", "x: error 404"}},
+		{"all missing", "/product-meta/x", http.StatusNotFound, []string{"x: error 404"}},
+		{"no ids", "/product-meta/,", http.StatusBadRequest, nil},
+		{"unsupported currency", "/product-meta/a?currency=XYZ", http.StatusBadRequest, nil},
+		{"too many", "/product-meta/" + strings.Join(tooMany, ","), http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, createTestRequest(http.MethodGet, tt.path, ""))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.want == nil {
+				if !strings.Contains(w.Body.String(), `"error":`) {
+					t.Errorf("body = %s, want a JSON error", w.Body)
+				}
+				return
+			}
+			var entries []struct {
+				ID      string
+				Product *struct {
+					Price struct{ CurrencyCode, Amount string }
+				}
+				Error *struct{ Code int }
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				if e.Error != nil {
+					got = append(got, fmt.Sprintf("%s: error %d", e.ID, e.Error.Code))
+				} else {
+					got = append(got, fmt.Sprintf("%s: %s %s", e.ID, e.Product.Price.Amount, e.Product.Price.CurrencyCode))
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProductMetaHandlerHidesInternalErrors(t *testing.T) {
+	fe := newTestFrontend(t, &pb.Product{Id: "a", Name: "A", PriceUsd: usd(2, 0)})
+	fe.currencySvcConn = unreachableConn(t)
+	r := mux.NewRouter()
+	r.HandleFunc("/product-meta/{ids}", fe.productMetaHandler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, createTestRequest(http.MethodGet, "/product-meta/a?currency=EUR", ""))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusServiceUnavailable, w.Body)
+	}
+	var entries []struct {
+		Error *struct{ Message string }
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if want := publicMessage(nil, http.StatusServiceUnavailable); len(entries) != 1 || entries[0].Error == nil || entries[0].Error.Message != want {
+		t.Errorf("body = %s, want an error with message %q", w.Body, want)
 	}
 }
 
@@ -322,6 +614,65 @@ func TestInjectCommonTemplateData(t *testing.T) {
 	}
 }
 
+func TestSetCurrencyHandler(t *testing.T) {
+	tests := []struct {
+		currency   string
+		wantStatus int
+	}{
+		{"EUR", http.StatusFound},
+		{"CHF", http.StatusUnprocessableEntity},
+		{"XYZ", http.StatusUnprocessableEntity},
+		{"", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.currency, func(t *testing.T) {
+			req := createTestRequest(http.MethodPost, "/setCurrency", "currency_code="+tt.currency)
+			w := httptest.NewRecorder()
+			(&frontendServer{}).setCurrencyHandler(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			set := strings.Contains(w.Header().Get("Set-Cookie"), cookieCurrency+"="+tt.currency)
+			if set != (tt.wantStatus == http.StatusFound) {
+				t.Errorf("Set-Cookie = %q", w.Header().Get("Set-Cookie"))
+			}
+		})
+	}
+}
+
+func TestLogoutHandler(t *testing.T) {
+	fe := &frontendServer{sessions: newTestSessions()}
+	handler := fe.ensureSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/logout" {
+			fe.logoutHandler(w, r.WithContext(context.WithValue(r.Context(), ctxKeyLog{}, logrus.New())))
+		}
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	c := rr.Result().Cookies()[0]
+
+	req := httptest.NewRequest(http.MethodGet, "/logout", nil)
+	req.AddCookie(c)
+	req.AddCookie(&http.Cookie{Name: cookieCurrency, Value: "EUR"})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusFound)
+	}
+	cleared := make(map[string]int)
+	for _, c := range rr.Result().Cookies() {
+		if c.MaxAge < 0 {
+			cleared[c.Name]++
+		}
+	}
+	if cleared[cookieSessionID] != 1 || cleared[cookieCurrency] != 1 {
+		t.Errorf("cookies cleared = %v, want the session and currency cookies once each", cleared)
+	}
+	if n := fe.sessions.Store.(*session.MemoryStore).Len(); n != 0 {
+		t.Errorf("%d sessions left after logging out, want 0", n)
+	}
+}
+
 func TestAddToCartHandler(t *testing.T) {
 	// Test will be skipped since it requires gRPC connections
 	t.Skip("Handler tests require gRPC service connections")
@@ -331,3 +682,45 @@ func TestAddToCartHandler(t *testing.T) {
 func TestHandlers(t *testing.T) {
 	t.Skip("Handler tests require gRPC service connections and are tested in integration tests")
 }
+
+func TestCartItemHandlers(t *testing.T) {
+	srv := backendtest.NewServer(t)
+	srv.Cart.Add("", cart.Item{ProductID: "mug", Quantity: 1})
+	srv.Cart.Add("", cart.Item{ProductID: "shirt", VariantSKU: "shirt-s", Quantity: 2})
+	fe := newTestFrontend(t)
+	fe.cartSvcConn = srv.Conn()
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		body       string
+		wantStatus int
+		want       []cart.Item
+	}{
+		{"update", fe.updateCartItemHandler, "product_id=shirt&variant_sku=shirt-s&quantity=5", http.StatusFound,
+			[]cart.Item{{ProductID: "mug", Quantity: 1}, {ProductID: "shirt", VariantSKU: "shirt-s", Quantity: 5}}},
+		{"update to zero removes", fe.updateCartItemHandler, "product_id=mug&quantity=0", http.StatusFound,
+			[]cart.Item{{ProductID: "shirt", VariantSKU: "shirt-s", Quantity: 5}}},
+		{"update missing item", fe.updateCartItemHandler, "product_id=shirt&variant_sku=shirt-xl&quantity=1", http.StatusNotFound,
+			[]cart.Item{{ProductID: "shirt", VariantSKU: "shirt-s", Quantity: 5}}},
+		{"update too many", fe.updateCartItemHandler, "product_id=shirt&variant_sku=shirt-s&quantity=11", http.StatusUnprocessableEntity,
+			[]cart.Item{{ProductID: "shirt", VariantSKU: "shirt-s", Quantity: 5}}},
+		{"update bad quantity", fe.updateCartItemHandler, "product_id=shirt&variant_sku=shirt-s&quantity=-1", http.StatusUnprocessableEntity,
+			[]cart.Item{{ProductID: "shirt", VariantSKU: "shirt-s", Quantity: 5}}},
+		{"remove missing item", fe.removeCartItemHandler, "product_id=mug", http.StatusFound,
+			[]cart.Item{{ProductID: "shirt", VariantSKU: "shirt-s", Quantity: 5}}},
+		{"remove without product", fe.removeCartItemHandler, "variant_sku=shirt-s", http.StatusUnprocessableEntity,
+			[]cart.Item{{ProductID: "shirt", VariantSKU: "shirt-s", Quantity: 5}}},
+		{"remove", fe.removeCartItemHandler, "product_id=shirt&variant_sku=shirt-s", http.StatusFound, nil},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.handler(w, createTestRequest(http.MethodPost, "/cart", tt.body))
+		if w.Code != tt.wantStatus {
+			t.Fatalf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.wantStatus, w.Body)
+		}
+		if got := srv.Cart.Get(""); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: cart = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
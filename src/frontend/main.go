@@ -12,16 +12,22 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package frontend
 
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/fs"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/profiler"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -33,6 +39,12 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/exchange"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/account"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/assistant"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/oidc"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/session"
 )
 
 const (
@@ -46,19 +58,16 @@ const (
 )
 
 var (
-	whitelistedCurrencies = map[string]bool{
-		"USD": true,
-		"EUR": true,
-		"CAD": true,
-		"JPY": true,
-		"GBP": true,
-		"TRY": true,
-	}
-
 	baseUrl = ""
+	// secureCookies marks cookies Secure on plain HTTP requests too, for when
+	// TLS ends at a load balancer.
+	secureCookies = false
+	// showErrorDetails shows the internal details of errors, such as backend
+	// messages and stack traces, on the error page, for development.
+	showErrorDetails = false
 )
 
-type ctxKeySessionID struct{}
+type ctxKeySession struct{}
 
 type frontendServer struct {
 	productCatalogSvcAddr string
@@ -82,26 +91,50 @@ type frontendServer struct {
 	adSvcAddr string
 	adSvcConn *grpc.ClientConn
 
+	inventorySvcAddr string
+	inventorySvcConn *grpc.ClientConn
+
 	collectorAddr string
 	collectorConn *grpc.ClientConn
 
 	shoppingAssistantSvcAddr string
+
+	// products caches products from the product catalog.
+	products *productCache
+	// currencyRates caches exchange rates from the currency service.
+	currencyRates *rateCache
+	// exchangeRates converts prices when the currency service fails.
+	exchangeRates *exchange.Converter
+	// sessions loads and saves the visitors' sessions.
+	sessions *session.Manager
+	// accounts registers and signs in customers.
+	accounts *account.Service
+	// sso signs in staff with the identity provider, if there is one.
+	sso *oidc.Client
+	// rateLimits limits how often visitors may make requests.
+	rateLimits *rateLimiter
+	// assistant answers shoppers' questions.
+	assistant *assistant.Client
 }
 
-func main() {
-	ctx := context.Background()
-	log := logrus.New()
-	log.Level = logrus.DebugLevel
-	log.Formatter = &logrus.JSONFormatter{
-		FieldMap: logrus.FieldMap{
-			logrus.FieldKeyTime:  "timestamp",
-			logrus.FieldKeyLevel: "severity",
-			logrus.FieldKeyMsg:   "message",
-		},
-		TimestampFormat: time.RFC3339Nano,
+// Main runs the frontend on LISTEN_ADDR and PORT until it fails.
+func Main() {
+	srvPort := port
+	if os.Getenv("PORT") != "" {
+		srvPort = os.Getenv("PORT")
+	}
+	addr := os.Getenv("LISTEN_ADDR")
+	lis, err := net.Listen("tcp", addr+":"+srvPort)
+	if err != nil {
+		log.Fatal(err)
 	}
-	log.Out = os.Stdout
+	log.Infof("starting server on %s:%s", addr, srvPort)
+	log.Fatal(Serve(context.Background(), lis))
+}
 
+// Serve serves the frontend on lis until ctx is done. It is configured by the
+// same environment variables as Main, apart from LISTEN_ADDR and PORT.
+func Serve(ctx context.Context, lis net.Listener) error {
 	svc := new(frontendServer)
 
 	otel.SetTextMapPropagator(
@@ -109,6 +142,8 @@ func main() {
 			propagation.TraceContext{}, propagation.Baggage{}))
 
 	baseUrl = os.Getenv("BASE_URL")
+	secureCookies = os.Getenv("SECURE_COOKIES") == "true"
+	showErrorDetails = os.Getenv("SHOW_ERROR_DETAILS") == "true"
 
 	if os.Getenv("ENABLE_TRACING") == "1" {
 		log.Info("Tracing enabled.")
@@ -124,11 +159,6 @@ func main() {
 		log.Info("Profiling disabled.")
 	}
 
-	srvPort := port
-	if os.Getenv("PORT") != "" {
-		srvPort = os.Getenv("PORT")
-	}
-	addr := os.Getenv("LISTEN_ADDR")
 	mustMapEnv(&svc.productCatalogSvcAddr, "PRODUCT_CATALOG_SERVICE_ADDR")
 	mustMapEnv(&svc.currencySvcAddr, "CURRENCY_SERVICE_ADDR")
 	mustMapEnv(&svc.cartSvcAddr, "CART_SERVICE_ADDR")
@@ -137,39 +167,92 @@ func main() {
 	mustMapEnv(&svc.shippingSvcAddr, "SHIPPING_SERVICE_ADDR")
 	mustMapEnv(&svc.adSvcAddr, "AD_SERVICE_ADDR")
 	mustMapEnv(&svc.shoppingAssistantSvcAddr, "SHOPPING_ASSISTANT_SERVICE_ADDR")
+	mapEnvOr(&svc.inventorySvcAddr, "INVENTORY_SERVICE_ADDR", svc.productCatalogSvcAddr)
+
+	var err error
+	if svc.exchangeRates, err = exchange.LoadFromEnv(); err != nil {
+		return errors.Wrap(err, "failed to load fallback exchange rates")
+	}
+	log.WithField("base", svc.exchangeRates.Rates().Base).Debug("loaded fallback exchange rates")
+	rateCacheTTL := defaultRateCacheTTL
+	if v := os.Getenv("CURRENCY_RATE_CACHE_TTL"); v != "" {
+		if rateCacheTTL, err = time.ParseDuration(v); err != nil {
+			panic(errors.Wrap(err, "invalid CURRENCY_RATE_CACHE_TTL"))
+		}
+	}
+	svc.currencyRates = newRateCache(rateCacheTTL, svc.getCurrencyRate)
+	svc.sessions = mustInitSessions(log)
+	svc.accounts = mustInitAccounts(log)
+	svc.sso = mustInitSSO(log)
+	svc.rateLimits = mustInitRateLimits(log)
+	svc.assistant = mustInitAssistant(svc.shoppingAssistantSvcAddr)
 
 	mustConnGRPC(ctx, &svc.currencySvcConn, svc.currencySvcAddr)
+	mustInitCurrencies(ctx, log, svc)
 	mustConnGRPC(ctx, &svc.productCatalogSvcConn, svc.productCatalogSvcAddr)
+	initProductCache(ctx, log, svc)
 	mustConnGRPC(ctx, &svc.cartSvcConn, svc.cartSvcAddr)
 	mustConnGRPC(ctx, &svc.recommendationSvcConn, svc.recommendationSvcAddr)
 	mustConnGRPC(ctx, &svc.shippingSvcConn, svc.shippingSvcAddr)
 	mustConnGRPC(ctx, &svc.checkoutSvcConn, svc.checkoutSvcAddr)
 	mustConnGRPC(ctx, &svc.adSvcConn, svc.adSvcAddr)
+	mustConnGRPC(ctx, &svc.inventorySvcConn, svc.inventorySvcAddr)
 
+	static, err := fs.Sub(assets, "static")
+	if err != nil {
+		return err
+	}
 	r := mux.NewRouter()
 	r.HandleFunc(baseUrl+"/", svc.homeHandler).Methods(http.MethodGet, http.MethodHead)
 	r.HandleFunc(baseUrl+"/product/{id}", svc.productHandler).Methods(http.MethodGet, http.MethodHead)
 	r.HandleFunc(baseUrl+"/cart", svc.viewCartHandler).Methods(http.MethodGet, http.MethodHead)
 	r.HandleFunc(baseUrl+"/cart", svc.addToCartHandler).Methods(http.MethodPost)
 	r.HandleFunc(baseUrl+"/cart/empty", svc.emptyCartHandler).Methods(http.MethodPost)
+	r.HandleFunc(baseUrl+"/cart/update", svc.updateCartItemHandler).Methods(http.MethodPost)
+	r.HandleFunc(baseUrl+"/cart/remove", svc.removeCartItemHandler).Methods(http.MethodPost)
 	r.HandleFunc(baseUrl+"/setCurrency", svc.setCurrencyHandler).Methods(http.MethodPost)
 	r.HandleFunc(baseUrl+"/logout", svc.logoutHandler).Methods(http.MethodGet)
+	r.HandleFunc(baseUrl+"/login", svc.loginHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc(baseUrl+"/login", svc.loginPostHandler).Methods(http.MethodPost)
+	r.HandleFunc(baseUrl+"/register", svc.registerHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc(baseUrl+"/register", svc.registerPostHandler).Methods(http.MethodPost)
+	r.HandleFunc(baseUrl+"/account", svc.accountHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc(baseUrl+"/account/addresses", svc.addAddressHandler).Methods(http.MethodPost)
+	r.HandleFunc(baseUrl+"/account/addresses/remove", svc.removeAddressHandler).Methods(http.MethodPost)
+	if svc.sso != nil {
+		r.HandleFunc(baseUrl+"/auth/login", svc.ssoLoginHandler).Methods(http.MethodGet)
+		r.HandleFunc(baseUrl+"/auth/callback", svc.ssoCallbackHandler).Methods(http.MethodGet)
+	}
 	r.HandleFunc(baseUrl+"/cart/checkout", svc.placeOrderHandler).Methods(http.MethodPost)
 	r.HandleFunc(baseUrl+"/assistant", svc.assistantHandler).Methods(http.MethodGet)
-	r.PathPrefix(baseUrl + "/static/").Handler(http.StripPrefix(baseUrl+"/static/", http.FileServer(http.Dir("./static/"))))
+	r.PathPrefix(baseUrl + "/static/").Handler(http.StripPrefix(baseUrl+"/static/", http.FileServer(http.FS(static))))
 	r.HandleFunc(baseUrl+"/robots.txt", func(w http.ResponseWriter, _ *http.Request) { fmt.Fprint(w, "User-agent: *\nDisallow: /") })
 	r.HandleFunc(baseUrl+"/_healthz", func(w http.ResponseWriter, _ *http.Request) { fmt.Fprint(w, "ok") })
-	r.HandleFunc(baseUrl+"/product-meta/{ids}", svc.getProductByID).Methods(http.MethodGet)
+	r.HandleFunc(baseUrl+"/product-meta/{ids}", svc.productMetaHandler).Methods(http.MethodGet)
 	r.HandleFunc(baseUrl+"/bot", svc.chatBotHandler).Methods(http.MethodPost)
+	svc.registerAPI(r)
 
 	var handler http.Handler = r
+	handler = svc.csrfProtect(handler)                 // refuse cross-site requests
+	handler = svc.limitSessions(handler)               // refuse sessions over the rate limits
+	handler = svc.ensureSession(handler)               // add session
+	handler = svc.limitClients(handler)                // refuse addresses over the rate limits
 	handler = &logHandler{log: log, next: handler}     // add logging
-	handler = ensureSessionID(handler)                 // add session ID
 	handler = otelhttp.NewHandler(handler, "frontend") // add OTel tracing
 
-	log.Infof("starting server on %s:%s", addr, srvPort)
-	log.Fatal(http.ListenAndServe(addr+":"+srvPort, handler))
+	srv := &http.Server{Handler: handler}
+	defer context.AfterFunc(ctx, func() { srv.Close() })()
+	if err := srv.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
+
+// SetLogOutput sends the frontend's logs to w instead of standard output.
+func SetLogOutput(w io.Writer) {
+	log.SetOutput(w)
+}
+
 func initStats(log logrus.FieldLogger) {
 	// TODO(arbrown) Implement OpenTelemtry stats
 }
@@ -222,6 +305,189 @@ func mustMapEnv(target *string, envKey string) {
 	*target = v
 }
 
+// mapEnvOr sets target to the value of the environment variable envKey, or to
+// fallback if it is not set.
+func mapEnvOr(target *string, envKey, fallback string) {
+	*target = fallback
+	if v := os.Getenv(envKey); v != "" {
+		*target = v
+	}
+}
+
+// mustInitSessions configures sessions. Cookies are sealed with SESSION_KEYS,
+// comma-separated base64 AES keys with the newest first, or with a random key
+// if it is not set. Sessions are kept in SESSION_STORE ("memory", the
+// default, "file:<directory>" or "redis:<host:port>") and end after
+// SESSION_IDLE_TIMEOUT (default 48h) without requests. With
+// ENABLE_SINGLE_SHARED_SESSION=true, every session shares one cart: that of
+// SHARED_SESSION_USER_ID, or of a random user ID.
+func mustInitSessions(log logrus.FieldLogger) *session.Manager {
+	m := &session.Manager{
+		CookieName:  cookieSessionID,
+		CookiePath:  baseUrl + "/",
+		Secure:      secureCookies,
+		IdleTimeout: cookieMaxAge * time.Second,
+	}
+	var err error
+	if v := os.Getenv("SESSION_KEYS"); v != "" {
+		if m.Keys, err = session.ParseKeys(v); err != nil {
+			panic(errors.Wrap(err, "invalid SESSION_KEYS"))
+		}
+	} else {
+		log.Warn("SESSION_KEYS not set: sessions end when the frontend restarts and are not shared between replicas")
+		m.Keys = session.RandomKeys()
+	}
+	if m.Store, err = session.OpenStore(os.Getenv("SESSION_STORE")); err != nil {
+		panic(errors.Wrap(err, "invalid SESSION_STORE"))
+	}
+	if v := os.Getenv("SESSION_IDLE_TIMEOUT"); v != "" {
+		if m.IdleTimeout, err = time.ParseDuration(v); err != nil || m.IdleTimeout <= 0 {
+			panic(fmt.Sprintf("invalid SESSION_IDLE_TIMEOUT %q", v))
+		}
+	}
+	if os.Getenv("ENABLE_SINGLE_SHARED_SESSION") == "true" {
+		userID := os.Getenv("SHARED_SESSION_USER_ID")
+		if userID == "" {
+			userID = uuid.NewString()
+		}
+		log.WithField("session", userID).Info("Single shared session enabled.")
+		m.NewUserID = func() string { return userID }
+	}
+	return m
+}
+
+// mustInitAccounts configures customer accounts, kept in ACCOUNT_STORE:
+// "memory", the default, or "file:<path>" for a JSON file.
+func mustInitAccounts(log logrus.FieldLogger) *account.Service {
+	spec := os.Getenv("ACCOUNT_STORE")
+	store, err := account.OpenStore(spec)
+	if err != nil {
+		panic(errors.Wrap(err, "invalid ACCOUNT_STORE"))
+	}
+	if spec == "" || spec == "memory" {
+		log.Warn("ACCOUNT_STORE not set: accounts are lost when the frontend restarts and are not shared between replicas")
+	}
+	return &account.Service{Store: store}
+}
+
+// mustInitRateLimits configures the rate limits, which RATE_LIMITS overrides
+// as a comma-separated list of "<policy>.<session|ip>=<n>/<s|m|h>" or
+// "<policy>.<session|ip>=off", or turns off if "off". X-Forwarded-For headers
+// are only believed from TRUSTED_PROXIES, comma-separated IP addresses and
+// CIDR prefixes.
+func mustInitRateLimits(log logrus.FieldLogger) *rateLimiter {
+	spec := os.Getenv("RATE_LIMITS")
+	if spec == "off" {
+		log.Info("Rate limits disabled.")
+		return nil
+	}
+	proxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		panic(errors.Wrap(err, "invalid TRUSTED_PROXIES"))
+	}
+	rl, err := newRateLimiter(spec, proxies)
+	if err != nil {
+		panic(errors.Wrap(err, "invalid RATE_LIMITS"))
+	}
+	fields := logrus.Fields{"trusted_proxies": len(proxies)}
+	for _, p := range rl.policies {
+		fields[p.name] = p.session.limit.String() + " per session, " + p.ip.limit.String() + " per ip"
+	}
+	log.WithFields(fields).Info("Rate limits enabled.")
+	go rl.trackBuckets(time.Minute)
+	return rl
+}
+
+// mustInitAssistant configures the client of the shopping assistant at addr.
+// ASSISTANT_TIMEOUT, if set, bounds how long a shopper waits for an answer.
+func mustInitAssistant(addr string) *assistant.Client {
+	c := &assistant.Client{URL: "http://" + addr}
+	if v := os.Getenv("ASSISTANT_TIMEOUT"); v != "" {
+		var err error
+		if c.Timeout, err = time.ParseDuration(v); err != nil || c.Timeout <= 0 {
+			panic(errors.Errorf("invalid ASSISTANT_TIMEOUT %q", v))
+		}
+	}
+	return c
+}
+
+// mustInitSSO configures single sign-on with the OpenID Connect provider at
+// OIDC_ISSUER, if set, as the client OIDC_CLIENT_ID with OIDC_CLIENT_SECRET,
+// if any. OIDC_REDIRECT_URL is the address of /auth/callback registered with
+// the provider, and OIDC_SCOPES the space-separated scopes to ask for besides
+// openid (default "email profile").
+func mustInitSSO(log logrus.FieldLogger) *oidc.Client {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil
+	}
+	c := &oidc.Client{
+		Issuer:       issuer,
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+	mustMapEnv(&c.ClientID, "OIDC_CLIENT_ID")
+	mustMapEnv(&c.RedirectURL, "OIDC_REDIRECT_URL")
+	if v := os.Getenv("OIDC_SCOPES"); v != "" {
+		c.Scopes = strings.Fields(v)
+	}
+	log.WithField("issuer", issuer).Info("Single sign-on enabled.")
+	return c
+}
+
+// initProductCache caches products for PRODUCT_CACHE_TTL (default 1m, 0 to
+// disable), up to PRODUCT_CACHE_SIZE products. With ENABLE_CATALOG_WATCH=1 it
+// also follows the catalog's change stream so that changes show immediately.
+func initProductCache(ctx context.Context, log logrus.FieldLogger, svc *frontendServer) {
+	ttl := defaultProductCacheTTL
+	if v := os.Getenv("PRODUCT_CACHE_TTL"); v != "" {
+		var err error
+		if ttl, err = time.ParseDuration(v); err != nil {
+			panic(errors.Wrap(err, "invalid PRODUCT_CACHE_TTL"))
+		}
+	}
+	size := defaultProductCacheSize
+	if v := os.Getenv("PRODUCT_CACHE_SIZE"); v != "" {
+		var err error
+		if size, err = strconv.Atoi(v); err != nil {
+			panic(errors.Wrap(err, "invalid PRODUCT_CACHE_SIZE"))
+		}
+	}
+	if ttl <= 0 || size <= 0 {
+		log.Info("Product cache disabled.")
+		return
+	}
+	svc.products = newProductCache(ttl, size, svc.fetchProduct, svc.fetchProducts)
+	if os.Getenv("ENABLE_CATALOG_WATCH") == "1" {
+		log.Info("Catalog watch enabled.")
+		go svc.products.watch(ctx, log, svc.watchCatalog)
+	}
+}
+
+// mustInitCurrencies loads the currency configuration, fetches the currencies
+// the currency service supports and keeps them up to date every
+// SUPPORTED_CURRENCIES_REFRESH_INTERVAL.
+func mustInitCurrencies(ctx context.Context, log logrus.FieldLogger, svc *frontendServer) {
+	cfg, err := loadCurrencyConfig()
+	if err != nil {
+		panic(err)
+	}
+	interval := defaultCurrencyRefreshInterval
+	if v := os.Getenv("SUPPORTED_CURRENCIES_REFRESH_INTERVAL"); v != "" {
+		if interval, err = time.ParseDuration(v); err != nil || interval <= 0 {
+			panic(fmt.Sprintf("invalid SUPPORTED_CURRENCIES_REFRESH_INTERVAL %q", v))
+		}
+	}
+	supportedCurrencies = newCurrencySettings(cfg, svc.getSupportedCurrencies)
+
+	initCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := supportedCurrencies.refresh(initCtx); err != nil {
+		log.WithField("error", err).Warn("failed to fetch supported currencies, will retry")
+	}
+	go supportedCurrencies.refreshEvery(ctx, interval, log)
+}
+
 func mustConnGRPC(ctx context.Context, conn **grpc.ClientConn, addr string) {
 	var err error
 	_, cancel := context.WithTimeout(ctx, time.Second*3)
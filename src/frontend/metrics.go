@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package frontend
 
 import (
 	"time"
@@ -118,6 +118,14 @@ var (
 		},
 	)
 
+	loginsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "frontend_logins_total",
+			Help: "Total number of attempts to sign in to an account by status (success, invalid_credentials or error)",
+		},
+		[]string{"status"},
+	)
+
 	// Currency conversion metrics
 	currencyConversionsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -127,6 +135,47 @@ var (
 		[]string{"from_currency", "to_currency"},
 	)
 
+	currencyRateCacheTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "frontend_currency_rate_cache_requests_total",
+			Help: "Total number of exchange rate lookups by result (hit, miss, shared or error)",
+		},
+		[]string{"result"},
+	)
+
+	currencyFallbacksTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "frontend_currency_fallback_conversions_total",
+			Help: "Total number of conversions done with local exchange rates because the currency service failed",
+		},
+		[]string{"from_currency", "to_currency"},
+	)
+
+	// Product cache metrics
+	productCacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "frontend_product_cache_requests_total",
+			Help: "Total number of product cache lookups by kind (product or list) and result (hit, miss, shared or error)",
+		},
+		[]string{"kind", "result"},
+	)
+
+	productCacheEntries = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "frontend_product_cache_entries",
+			Help: "Number of products in the product cache",
+		},
+	)
+
+	// Page composition metrics
+	pageFragmentsSkippedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "frontend_page_fragments_skipped_total",
+			Help: "Total number of optional page fragments left out because their backend failed or was too slow",
+		},
+		[]string{"page", "fragment"},
+	)
+
 	// Recommendation metrics
 	recommendationsServedTotal = promauto.NewCounter(
 		prometheus.CounterOpts{
@@ -143,6 +192,29 @@ var (
 		},
 		[]string{"error_type", "handler"},
 	)
+
+	rateLimitedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "frontend_rate_limited_requests_total",
+			Help: "Total number of requests refused for going over a rate limit, by policy and by the key (session or ip) whose limit they went over",
+		},
+		[]string{"policy", "key"},
+	)
+
+	rateLimitBuckets = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "frontend_rate_limit_buckets",
+			Help: "Number of sessions or client IP addresses a rate limit policy is tracking",
+		},
+		[]string{"policy", "key"},
+	)
+
+	csrfRejectionsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "frontend_csrf_rejections_total",
+			Help: "Total number of requests refused for coming from another site or lacking a valid CSRF token",
+		},
+	)
 )
 
 // Helper functions for recording metrics
@@ -168,6 +240,22 @@ func recordGRPCRequest(service, method, status string, duration time.Duration) {
 	grpcRequestDuration.WithLabelValues(service, method).Observe(duration.Seconds())
 }
 
+func recordProductCache(kind, result string) {
+	productCacheRequestsTotal.WithLabelValues(kind, result).Inc()
+}
+
+func recordCurrencyRateCache(result string) {
+	currencyRateCacheTotal.WithLabelValues(result).Inc()
+}
+
+func recordCurrencyFallback(from, to string) {
+	currencyFallbacksTotal.WithLabelValues(from, to).Inc()
+}
+
+func recordSkippedFragment(page, fragment string) {
+	pageFragmentsSkippedTotal.WithLabelValues(page, fragment).Inc()
+}
+
 func recordError(errorType, handler string) {
 	errorsTotal.WithLabelValues(errorType, handler).Inc()
 }
@@ -12,12 +12,11 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package frontend
 
 import (
 	"context"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -60,21 +59,23 @@ func (r *responseRecorder) WriteHeader(statusCode int) {
 	r.w.WriteHeader(statusCode)
 }
 
+// Unwrap returns the recorded writer, for http.ResponseController and
+// streaming responses.
+func (r *responseRecorder) Unwrap() http.ResponseWriter { return r.w }
+
 func (lh *logHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	requestID, _ := uuid.NewRandom()
 	ctx = context.WithValue(ctx, ctxKeyRequestID{}, requestID.String())
 
 	start := time.Now()
+	w.Header().Set("X-Request-Id", requestID.String())
 	rr := &responseRecorder{w: w}
 	log := lh.log.WithFields(logrus.Fields{
 		"http.req.path":   r.URL.Path,
 		"http.req.method": r.Method,
 		"http.req.id":     requestID.String(),
 	})
-	if v, ok := r.Context().Value(ctxKeySessionID{}).(string); ok {
-		log = log.WithField("session", v)
-	}
 	log.Debug("request started")
 	defer func() {
 		log.WithFields(logrus.Fields{
@@ -97,7 +98,12 @@ func (mh *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	handlerName := path
 
 	// Normalize paths with IDs to avoid high cardinality
-	if strings.Contains(path, "/product/") {
+	if strings.Contains(path, apiPrefix+"/products/") {
+		path = apiPrefix + "/products/{id}"
+		handlerName = "api"
+	} else if strings.Contains(path, apiPrefix+"/") {
+		handlerName = "api"
+	} else if strings.Contains(path, "/product/") {
 		path = "/product/{id}"
 		handlerName = "product"
 	} else if strings.Contains(path, "/product-meta/") {
@@ -135,37 +141,30 @@ func (mh *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	recordHandlerResponseTime(handlerName, r.Method, statusCode, duration)
 }
 
-func ensureSessionID(next http.Handler) http.HandlerFunc {
+// ensureSession adds the visitor's session to the request context, starting a
+// new one if the request has none, and names it in the request's log. Health
+// checks get no session.
+func (fe *frontendServer) ensureSession(next http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var sessionID string
-		var newSession bool
-		c, err := r.Cookie(cookieSessionID)
-		if err == http.ErrNoCookie {
-			newSession = true
-			if os.Getenv("ENABLE_SINGLE_SHARED_SESSION") == "true" {
-				// Hard coded user id, shared across sessions
-				sessionID = "12345678-1234-1234-1234-123456789123"
-			} else {
-				u, _ := uuid.NewRandom()
-				sessionID = u.String()
-			}
-			http.SetCookie(w, &http.Cookie{
-				Name:   cookieSessionID,
-				Value:  sessionID,
-				MaxAge: cookieMaxAge,
-			})
-		} else if err != nil {
+		if r.URL.Path == baseUrl+"/_healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s, created, err := fe.sessions.Load(w, r)
+		if err != nil {
+			http.Error(w, "session store unavailable", http.StatusServiceUnavailable)
 			return
-		} else {
-			sessionID = c.Value
 		}
 
 		// Record session metrics for new sessions
-		if newSession {
+		if created {
 			activeSessionsTotal.Inc()
 		}
 
-		ctx := context.WithValue(r.Context(), ctxKeySessionID{}, sessionID)
+		ctx := context.WithValue(r.Context(), ctxKeySession{}, s)
+		if log, ok := ctx.Value(ctxKeyLog{}).(logrus.FieldLogger); ok {
+			ctx = context.WithValue(ctx, ctxKeyLog{}, log.WithField("session", s.UserID))
+		}
 		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r)
 	}
@@ -12,25 +12,30 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package frontend
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/session"
 )
 
 func TestLogHandler(t *testing.T) {
 	// Create a test handler that the log handler will wrap
+	var requestID interface{}
 	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Verify that context values are set
 		if r.Context().Value(ctxKeyLog{}) == nil {
 			t.Error("log context not set")
 		}
-		if r.Context().Value(ctxKeyRequestID{}) == nil {
+		if requestID = r.Context().Value(ctxKeyRequestID{}); requestID == nil {
 			t.Error("request ID context not set")
 		}
 		w.WriteHeader(http.StatusOK)
@@ -56,6 +61,9 @@ func TestLogHandler(t *testing.T) {
 	if body != "test response" {
 		t.Errorf("logHandler returned wrong body: got %v want %v", body, "test response")
 	}
+	if got := rr.Header().Get("X-Request-Id"); got != requestID {
+		t.Errorf("X-Request-Id = %q, want the request ID %v", got, requestID)
+	}
 }
 
 func TestMetricsHandler(t *testing.T) {
@@ -79,6 +87,7 @@ func TestMetricsHandler(t *testing.T) {
 		{"cart page", "/cart", "GET"},
 		{"health check", "/_healthz", "GET"},
 		{"static file", "/static/style.css", "GET"},
+		{"api product", "/api/v1/products/123", "GET"},
 	}
 
 	for _, tt := range tests {
@@ -130,62 +139,77 @@ func TestResponseRecorder(t *testing.T) {
 	}
 }
 
-func TestEnsureSessionID(t *testing.T) {
-	// Test handler that checks for session ID in context
-	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Verify session ID is in context
-		sessionID := r.Context().Value(ctxKeySessionID{})
-		if sessionID == nil {
-			t.Error("session ID not in context")
-			return
-		}
-		if sessionID.(string) == "" {
-			t.Error("session ID in context is empty")
-			return
-		}
+// newTestSessions returns a session manager with an in-memory store.
+func newTestSessions() *session.Manager {
+	return &session.Manager{
+		Store:       session.NewMemoryStore(),
+		Keys:        session.RandomKeys(),
+		CookieName:  cookieSessionID,
+		IdleTimeout: cookieMaxAge * time.Second,
+	}
+}
 
-		w.WriteHeader(http.StatusOK)
-	})
+// failingStore is a session store that is down.
+type failingStore struct{}
 
-	handler := ensureSessionID(testHandler)
+func (failingStore) Get(context.Context, string) ([]byte, error) { return nil, errors.New("down") }
 
-	// Test with no existing session
-	req := httptest.NewRequest("GET", "/", nil)
-	rr := httptest.NewRecorder()
+func (failingStore) Set(context.Context, string, []byte, time.Time) error { return errors.New("down") }
 
-	handler.ServeHTTP(rr, req)
+func (failingStore) Delete(context.Context, string) error { return errors.New("down") }
 
-	if rr.Code != http.StatusOK {
-		t.Errorf("ensureSessionID handler returned wrong status: got %v want %v", rr.Code, http.StatusOK)
+func TestEnsureSession(t *testing.T) {
+	fe := &frontendServer{sessions: newTestSessions()}
+	var got string
+	handler := fe.ensureSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = sessionID(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(path string, c *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if c != nil {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		got = ""
+		handler.ServeHTTP(rr, req)
+		return rr
 	}
 
-	// Check that Set-Cookie header was added
-	cookies := rr.Header()["Set-Cookie"]
-	if len(cookies) == 0 {
-		t.Error("ensureSessionID should set a session cookie")
+	// Test with no existing session
+	rr := serve("/", nil)
+	if rr.Code != http.StatusOK || got == "" {
+		t.Fatalf("ensureSession returned %v with session %q", rr.Code, got)
 	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != cookieSessionID {
+		t.Fatalf("ensureSession should set a session cookie, set %v", cookies)
+	}
+	c := cookies[0]
+	if !c.HttpOnly || c.SameSite != http.SameSiteLaxMode || c.Value == got {
+		t.Errorf("session cookie = %+v", c)
+	}
+	first := got
 
 	// Test with existing session
-	req2 := httptest.NewRequest("GET", "/", nil)
-	req2.AddCookie(&http.Cookie{
-		Name:  cookieSessionID,
-		Value: "existing-session-123",
-	})
-	rr2 := httptest.NewRecorder()
+	if rr := serve("/", c); got != first || len(rr.Result().Cookies()) != 0 {
+		t.Errorf("existing session: got %q and cookies %v, want %q and none", got, rr.Result().Cookies(), first)
+	}
 
-	testHandler2 := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		sessionCookie, _ := r.Cookie(cookieSessionID)
-		if sessionCookie.Value != "existing-session-123" {
-			t.Error("existing session ID should be preserved")
-		}
-		w.WriteHeader(http.StatusOK)
-	})
+	// A session ID made up by the client is not trusted.
+	serve("/", &http.Cookie{Name: cookieSessionID, Value: first})
+	if got == first || got == "" {
+		t.Errorf("a raw session cookie gave session %q", got)
+	}
 
-	handler2 := ensureSessionID(testHandler2)
-	handler2.ServeHTTP(rr2, req2)
+	// Health checks get no session.
+	if rr := serve("/_healthz", nil); got != "" || len(rr.Result().Cookies()) != 0 {
+		t.Errorf("health check got session %q and cookies %v", got, rr.Result().Cookies())
+	}
 
-	if rr2.Code != http.StatusOK {
-		t.Errorf("ensureSessionID with existing session returned wrong status: got %v want %v", rr2.Code, http.StatusOK)
+	fe.sessions.Store = failingStore{}
+	if rr := serve("/", nil); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("with the store down, ensureSession returned %v, want %v", rr.Code, http.StatusServiceUnavailable)
 	}
 }
 
@@ -199,8 +223,8 @@ func TestMiddlewareChain(t *testing.T) {
 		if r.Context().Value(ctxKeyRequestID{}) == nil {
 			t.Error("request ID context not set in middleware chain")
 		}
-		if r.Context().Value(ctxKeySessionID{}) == nil {
-			t.Error("session ID context not set in middleware chain")
+		if r.Context().Value(ctxKeySession{}) == nil {
+			t.Error("session context not set in middleware chain")
 		}
 
 		w.WriteHeader(http.StatusOK)
@@ -210,8 +234,8 @@ func TestMiddlewareChain(t *testing.T) {
 	// Build the middleware chain like in main.go
 	var handler http.Handler = finalHandler
 	log := logrus.New()
+	handler = (&frontendServer{sessions: newTestSessions()}).ensureSession(handler)
 	handler = &logHandler{log: log, next: handler}
-	handler = ensureSessionID(handler)
 	handler = &metricsHandler{next: handler}
 
 	req := httptest.NewRequest("GET", "/test", nil)
@@ -248,11 +272,11 @@ func TestContextKeys(t *testing.T) {
 		t.Error("ctxKeyRequestID not working correctly")
 	}
 
-	// Test ctxKeySessionID
-	sessionID := "test-session-123"
-	ctx = context.WithValue(ctx, ctxKeySessionID{}, sessionID)
-	retrievedSessionID := ctx.Value(ctxKeySessionID{})
-	if retrievedSessionID != sessionID {
-		t.Error("ctxKeySessionID not working correctly")
+	// Test ctxKeySession
+	s := &session.Session{UserID: "test-user-123"}
+	ctx = context.WithValue(ctx, ctxKeySession{}, s)
+	retrievedSession := ctx.Value(ctxKeySession{})
+	if retrievedSession != s {
+		t.Error("ctxKeySession not working correctly")
 	}
 }
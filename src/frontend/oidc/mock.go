@@ -0,0 +1,296 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockUser is a user of a MockProvider.
+type MockUser struct {
+	Subject string
+	Email   string
+	Name    string
+}
+
+// MockProvider is an OpenID Connect provider for tests and local
+// development. It knows one client and signs in anyone as the user they
+// claim to be, asking for an email address on a page or, if User is set,
+// signing in User without asking.
+type MockProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+
+	mu    sync.Mutex
+	user  *MockUser
+	key   *rsa.PrivateKey
+	kid   string
+	codes map[string]mockGrant
+}
+
+// mockGrant is what a code given to the client stands for.
+type mockGrant struct {
+	user        MockUser
+	redirectURI string
+	challenge   string
+	nonce       string
+	expires     time.Time
+}
+
+// NewMockProvider returns a provider that is the issuer issuer, to be served
+// at that address, for the client clientID with clientSecret, which may be
+// empty for a public client.
+func NewMockProvider(issuer, clientID, clientSecret string) *MockProvider {
+	p := &MockProvider{issuer: issuer, clientID: clientID, clientSecret: clientSecret, codes: make(map[string]mockGrant)}
+	p.RotateKey()
+	return p
+}
+
+// SetUser makes the provider sign in u without asking, or ask again if u is
+// nil.
+func (p *MockProvider) SetUser(u *MockUser) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = u
+}
+
+// RotateKey makes the provider sign tokens with a new key.
+func (p *MockProvider) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key = key
+	p.kid = RandomString()[:8]
+}
+
+func (p *MockProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                p.issuer,
+			"authorization_endpoint":                p.issuer + "/authorize",
+			"token_endpoint":                        p.issuer + "/token",
+			"jwks_uri":                              p.issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	case "/jwks":
+		p.mu.Lock()
+		pub, kid := p.key.PublicKey, p.kid
+		p.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []jwk{{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}}})
+	case "/authorize":
+		p.authorize(w, r)
+	case "/token":
+		p.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+var mockLoginPage = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="UTF-8"><title>Mock sign-in</title></head>
+<body>
+<h1>Mock sign-in</h1>
+<p>Sign in to {{ .Client }} as anyone.</p>
+<form method="POST">
+<label>E-mail Address <input type="email" name="email" value="staff@example.com" required></label>
+<label>Name <input type="text" name="name" value="Staff Member"></label>
+<button type="submit">Sign In</button>
+</form>
+</body>
+</html>
+`))
+
+func (p *MockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	target, err := url.Parse(redirectURI)
+	if q.Get("client_id") != p.clientID || redirectURI == "" || err != nil || !target.IsAbs() {
+		// Errors about the client go to the user, not to the client.
+		http.Error(w, "unknown client or invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	reply := func(v url.Values) {
+		v.Set("state", q.Get("state"))
+		target.RawQuery = v.Encode()
+		http.Redirect(w, r, target.String(), http.StatusFound)
+	}
+	switch {
+	case q.Get("response_type") != "code":
+		reply(url.Values{"error": {"unsupported_response_type"}})
+		return
+	case !strings.Contains(" "+q.Get("scope")+" ", " openid "):
+		reply(url.Values{"error": {"invalid_scope"}})
+		return
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		reply(url.Values{"error": {"invalid_request"}, "error_description": {"PKCE with S256 is required"}})
+		return
+	}
+
+	p.mu.Lock()
+	user := p.user
+	p.mu.Unlock()
+	if user == nil {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			mockLoginPage.Execute(w, map[string]string{"Client": p.clientID})
+			return
+		}
+		email := strings.TrimSpace(r.PostFormValue("email"))
+		if email == "" {
+			http.Error(w, "no email address", http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256([]byte(strings.ToLower(email)))
+		user = &MockUser{Subject: hex.EncodeToString(sum[:8]), Email: email, Name: strings.TrimSpace(r.PostFormValue("name"))}
+	}
+
+	code := RandomString()
+	p.mu.Lock()
+	now := time.Now()
+	for c, g := range p.codes {
+		if now.After(g.expires) {
+			delete(p.codes, c)
+		}
+	}
+	p.codes[code] = mockGrant{
+		user:        *user,
+		redirectURI: redirectURI,
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		expires:     now.Add(time.Minute),
+	}
+	p.mu.Unlock()
+	reply(url.Values{"code": {code}})
+}
+
+func (p *MockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostFormValue("client_id")
+	}
+	if clientID != p.clientID || subtle.ConstantTimeCompare([]byte(secret), []byte(p.clientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, Error{Code: "invalid_client"})
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, Error{Code: "unsupported_grant_type"})
+		return
+	}
+
+	p.mu.Lock()
+	code := r.PostFormValue("code")
+	g, ok := p.codes[code]
+	delete(p.codes, code) // codes are used once
+	key, kid := p.key, p.kid
+	p.mu.Unlock()
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	switch {
+	case !ok || time.Now().After(g.expires):
+		writeJSON(w, http.StatusBadRequest, Error{Code: "invalid_grant", Description: "unknown or expired code"})
+		return
+	case r.PostFormValue("redirect_uri") != g.redirectURI:
+		writeJSON(w, http.StatusBadRequest, Error{Code: "invalid_grant", Description: "redirect_uri does not match"})
+		return
+	case base64.RawURLEncoding.EncodeToString(challenge[:]) != g.challenge:
+		writeJSON(w, http.StatusBadRequest, Error{Code: "invalid_grant", Description: "code_verifier does not match"})
+		return
+	}
+
+	now := time.Now()
+	idToken, err := signToken(key, kid, map[string]interface{}{
+		"iss":            p.issuer,
+		"sub":            g.user.Subject,
+		"aud":            p.clientID,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          g.nonce,
+		"email":          g.user.Email,
+		"email_verified": g.user.Email != "",
+		"name":           g.user.Name,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Error{Code: "server_error"})
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, Token{
+		AccessToken: RandomString(),
+		TokenType:   "Bearer",
+		IDToken:     idToken,
+		ExpiresIn:   3600,
+	})
+}
+
+// signToken returns a JWT of claims signed with key using RS256.
+func signToken(key *rsa.PrivateKey, kid string, claims interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
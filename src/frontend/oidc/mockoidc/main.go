@@ -0,0 +1,47 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command mockoidc serves an OpenID Connect provider that signs in anyone, for
+// trying the frontend's single sign-on locally. It listens on LISTEN_ADDR
+// (default 127.0.0.1) and PORT (default 5556), and knows the client
+// MOCK_OIDC_CLIENT_ID (default "storefront") with MOCK_OIDC_CLIENT_SECRET,
+// if set.
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/oidc"
+)
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func main() {
+	log := logrus.New()
+	addr := net.JoinHostPort(getenv("LISTEN_ADDR", "127.0.0.1"), getenv("PORT", "5556"))
+	issuer := "http://" + addr
+	clientID := getenv("MOCK_OIDC_CLIENT_ID", "storefront")
+	p := oidc.NewMockProvider(issuer, clientID, os.Getenv("MOCK_OIDC_CLIENT_SECRET"))
+	log.Infof("mock OIDC provider %s for client %q", issuer, clientID)
+	log.Fatal(http.ListenAndServe(addr, p))
+}
@@ -0,0 +1,274 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	clientID    = "storefront"
+	redirectURL = "http://shop.example/auth/callback"
+)
+
+// startMock serves a MockProvider for a client with secret, and returns it
+// with a client of it.
+func startMock(t *testing.T, secret string) (*MockProvider, *Client) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := "http://" + lis.Addr().String()
+	p := NewMockProvider(issuer, clientID, secret)
+	srv := &http.Server{Handler: p}
+	go srv.Serve(lis)
+	t.Cleanup(func() { srv.Close() })
+	return p, &Client{Issuer: issuer, ClientID: clientID, ClientSecret: secret, RedirectURL: redirectURL}
+}
+
+// noRedirects is an HTTP client that returns redirects rather than following
+// them, as the callback is not served.
+var noRedirects = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+// authorize signs in at the provider and returns the query of the callback.
+func authorize(t *testing.T, c *Client, state, nonce, verifier string) url.Values {
+	t.Helper()
+	u, err := c.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := noRedirects.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || err != nil || !strings.HasPrefix(loc.String(), redirectURL+"?") {
+		t.Fatalf("authorize returned %s to %q", resp.Status, resp.Header.Get("Location"))
+	}
+	return loc.Query()
+}
+
+func TestSignIn(t *testing.T) {
+	for _, secret := range []string{"", "s3cret:/"} {
+		p, c := startMock(t, secret)
+		p.SetUser(&MockUser{Subject: "u1", Email: "staff@example.com", Name: "Staff"})
+		ctx := context.Background()
+
+		state, nonce, verifier := RandomString(), RandomString(), RandomString()
+		q := authorize(t, c, state, nonce, verifier)
+		if q.Get("state") != state || q.Get("code") == "" {
+			t.Fatalf("callback query = %v", q)
+		}
+		token, err := c.Exchange(ctx, q.Get("code"), verifier)
+		if err != nil {
+			t.Fatalf("Exchange with secret %q: %v", secret, err)
+		}
+		claims, err := c.Verify(ctx, token.IDToken, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Subject != "u1" || claims.Email != "staff@example.com" || claims.Name != "Staff" || claims.Issuer != c.Issuer {
+			t.Errorf("claims = %+v", claims)
+		}
+		if _, err := c.Verify(ctx, token.IDToken, RandomString()); err == nil {
+			t.Error("Verify accepted another nonce")
+		}
+		var oidcErr *Error
+		if _, err := c.Exchange(ctx, q.Get("code"), verifier); !errors.As(err, &oidcErr) || oidcErr.Code != "invalid_grant" {
+			t.Errorf("reusing a code returned %v, want invalid_grant", err)
+		}
+
+		q = authorize(t, c, state, nonce, verifier)
+		if _, err := c.Exchange(ctx, q.Get("code"), RandomString()); !errors.As(err, &oidcErr) || oidcErr.Code != "invalid_grant" {
+			t.Errorf("exchanging with another verifier returned %v, want invalid_grant", err)
+		}
+	}
+}
+
+func TestSignInPage(t *testing.T) {
+	_, c := startMock(t, "")
+	u, err := c.AuthCodeURL(context.Background(), "st", "n", "v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := noRedirects.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("sign-in page returned %s", resp.Status)
+	}
+	resp, err = noRedirects.PostForm(u, url.Values{"email": {"Ada@example.com"}, "name": {"Ada"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	loc, _ := url.Parse(resp.Header.Get("Location"))
+	token, err := c.Exchange(context.Background(), loc.Query().Get("code"), "v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := c.Verify(context.Background(), token.IDToken, "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Email != "Ada@example.com" || claims.Subject == "" {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	p, c := startMock(t, "")
+	ctx := context.Background()
+	now := time.Now()
+	valid := map[string]interface{}{
+		"iss": c.Issuer, "sub": "u1", "aud": clientID, "exp": now.Add(time.Hour).Unix(), "iat": now.Unix(), "nonce": "n",
+	}
+	sign := func(change func(map[string]interface{})) string {
+		claims := make(map[string]interface{})
+		for k, v := range valid {
+			claims[k] = v
+		}
+		change(claims)
+		token, err := signToken(p.key, p.kid, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	if _, err := c.Verify(ctx, sign(func(map[string]interface{}) {}), "n"); err != nil {
+		t.Fatalf("Verify rejected a valid token: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"other issuer", sign(func(c map[string]interface{}) { c["iss"] = "https://evil.example" })},
+		{"other audience", sign(func(c map[string]interface{}) { c["aud"] = "other" })},
+		{"several audiences", sign(func(c map[string]interface{}) { c["aud"] = []string{clientID, "other"} })},
+		{"expired", sign(func(c map[string]interface{}) { c["exp"] = now.Add(-time.Hour).Unix() })},
+		{"no expiry", sign(func(c map[string]interface{}) { delete(c, "exp") })},
+		{"from the future", sign(func(c map[string]interface{}) { c["iat"] = now.Add(time.Hour).Unix() })},
+		{"no subject", sign(func(c map[string]interface{}) { delete(c, "sub") })},
+		{"tampered", func() string {
+			parts := strings.Split(sign(func(map[string]interface{}) {}), ".")
+			parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"` + c.Issuer + `","sub":"admin"}`))
+			return strings.Join(parts, ".")
+		}()},
+		{"unsigned", func() string {
+			parts := strings.Split(sign(func(map[string]interface{}) {}), ".")
+			parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"` + p.kid + `"}`))
+			return parts[0] + "." + parts[1] + "."
+		}()},
+		{"malformed", "not.a-token"},
+	}
+	for _, tt := range tests {
+		if _, err := c.Verify(ctx, tt.token, "n"); err == nil {
+			t.Errorf("Verify accepted a token that is %s", tt.name)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	p, c := startMock(t, "")
+	p.SetUser(&MockUser{Subject: "u1"})
+	ctx := context.Background()
+	signIn := func() error {
+		q := authorize(t, c, "st", "n", "v")
+		token, err := c.Exchange(ctx, q.Get("code"), "v")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.Verify(ctx, token.IDToken, "n")
+		return err
+	}
+	if err := signIn(); err != nil {
+		t.Fatal(err)
+	}
+	p.RotateKey()
+	// The keys were fetched too recently to fetch them again.
+	if err := signIn(); err == nil {
+		t.Fatal("Verify accepted a token signed with a key it had not fetched")
+	}
+	c.keys.fetched = time.Time{}
+	if err := signIn(); err != nil {
+		t.Errorf("after the keys were rotated: %v", err)
+	}
+}
+
+func TestDiscoveryErrors(t *testing.T) {
+	_, c := startMock(t, "")
+	c.Issuer += "/"
+	if _, err := c.AuthCodeURL(context.Background(), "st", "n", "v"); err == nil {
+		t.Error("discovery accepted a provider that is another issuer")
+	}
+	c = &Client{Issuer: "http://127.0.0.1:1", ClientID: clientID}
+	if _, err := c.AuthCodeURL(context.Background(), "st", "n", "v"); err == nil {
+		t.Error("discovery succeeded without a provider")
+	}
+}
+
+func TestES256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point, err := key.PublicKey.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := jwk{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(point[1:33]),
+		Y:   base64.RawURLEncoding.EncodeToString(point[33:]),
+	}.publicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := "header.payload"
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	if err := verifySignature(pub, "ES256", signed, sig); err != nil {
+		t.Errorf("ES256 signature rejected: %v", err)
+	}
+	if err := verifySignature(pub, "RS256", signed, sig); err == nil {
+		t.Error("EC key accepted for RS256")
+	}
+	sig[0] ^= 1
+	if err := verifySignature(pub, "ES256", signed, sig); err == nil {
+		t.Error("bad ES256 signature accepted")
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// object is a JSON object of the OpenAPI document.
+type object = map[string]interface{}
+
+var (
+	apiMoneyType = reflect.TypeOf(apiMoney{})
+	apiErrorType = reflect.TypeOf(apiError{})
+)
+
+// openAPIDocument describes routes as an OpenAPI 3 document. Request and
+// response bodies are described from their Go types: struct fields by their
+// JSON tags, required unless they are omitempty or, for request payloads,
+// unless their validate tag requires them.
+func openAPIDocument(routes []apiRoute) object {
+	schemas := make(object)
+	errorResponse := object{
+		"description": "Error",
+		"content":     jsonContent(schemaOf(apiErrorType, schemas)),
+	}
+
+	paths := make(object)
+	for _, route := range routes {
+		op := object{
+			"operationId": route.name,
+			"summary":     route.summary,
+		}
+		var params []object
+		for _, p := range route.params {
+			params = append(params, object{
+				"name":        p.name,
+				"in":          p.in,
+				"required":    p.in == "path",
+				"description": p.description,
+				"schema":      object{"type": p.typ},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if route.request != nil {
+			op["requestBody"] = object{
+				"required": true,
+				"content":  jsonContent(schemaOf(reflect.TypeOf(route.request), schemas)),
+			}
+		}
+		code := route.status
+		if code == 0 {
+			code = http.StatusOK
+		}
+		success := object{"description": http.StatusText(code)}
+		if route.response != nil {
+			success["content"] = jsonContent(schemaOf(reflect.TypeOf(route.response), schemas))
+		}
+		op["responses"] = object{
+			strconv.Itoa(code): success,
+			"default":          errorResponse,
+		}
+
+		path, ok := paths[route.path].(object)
+		if !ok {
+			path = make(object)
+			paths[route.path] = path
+		}
+		path[strings.ToLower(route.method)] = op
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "Online Boutique storefront API",
+			"version": "v1",
+		},
+		"servers":    []object{{"url": baseUrl + apiPrefix}},
+		"paths":      paths,
+		"components": object{"schemas": schemas},
+	}
+}
+
+func jsonContent(schema object) object {
+	return object{"application/json": object{"schema": schema}}
+}
+
+// schemaOf returns the schema of values of type t. Named structs are added to
+// schemas and referenced.
+func schemaOf(t reflect.Type, schemas object) object {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == apiMoneyType {
+		if _, ok := schemas["Money"]; !ok {
+			schemas["Money"] = object{
+				"type":     "object",
+				"required": []string{"currencyCode", "amount"},
+				"properties": object{
+					"currencyCode": object{"type": "string", "description": "ISO 4217 currency code."},
+					"amount":       object{"type": "string", "description": "Decimal amount, e.g. \"12.3\"."},
+				},
+			}
+		}
+		return object{"$ref": "#/components/schemas/Money"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return object{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := strings.TrimPrefix(t.Name(), "api")
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = nil // reserve the name in case t refers to itself
+			schemas[name] = structSchema(t, schemas)
+		}
+		return object{"$ref": "#/components/schemas/" + name}
+	}
+	return object{}
+}
+
+func structSchema(t reflect.Type, schemas object) object {
+	properties := make(object)
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = schemaOf(f.Type, schemas)
+		if validate, ok := f.Tag.Lookup("validate"); ok {
+			if strings.Contains(","+validate+",", ",required,") {
+				required = append(required, name)
+			}
+		} else if !strings.Contains(","+opts+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+	s := object{"type": "object", "properties": properties}
+	if required != nil {
+		s["required"] = required
+	}
+	return s
+}
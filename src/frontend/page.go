@@ -0,0 +1,137 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// criticalFragmentTimeout bounds a fragment the page can't be shown
+	// without.
+	criticalFragmentTimeout = 3 * time.Second
+	// optionalFragmentTimeout bounds a fragment the page is shown without
+	// if it is slow.
+	optionalFragmentTimeout = 500 * time.Millisecond
+)
+
+// page composes a page from fragments fetched from the backends in parallel.
+// Each fragment writes its result to variables of the handler, which are set
+// once wait returns. Fragments that depend on others are started after
+// waiting for those:
+//
+//	pg := newPage(ctx, "product", log)
+//	pg.critical("product", criticalFragmentTimeout, func(ctx context.Context) (err error) {
+//		p, err = fe.getProduct(ctx, id)
+//		return err
+//	})
+//	pg.optional("recommendations", optionalFragmentTimeout, ...)
+//	if err := pg.wait(); err != nil { ... }
+//	pg.optional("stock", optionalFragmentTimeout, ...) // needs p
+//
+// If a critical fragment fails, the others are cancelled and wait returns its
+// error. If an optional fragment fails or runs out of time, it is skipped:
+// its variables keep their zero value and skipped reports it.
+type page struct {
+	name   string
+	log    logrus.FieldLogger
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	err     error
+	skipped []string
+}
+
+func newPage(ctx context.Context, name string, log logrus.FieldLogger) *page {
+	ctx, cancel := context.WithCancel(ctx)
+	return &page{name: name, log: log, ctx: ctx, cancel: cancel}
+}
+
+// critical starts a fragment that the page fails without.
+func (pg *page) critical(name string, timeout time.Duration, fetch func(ctx context.Context) error) {
+	pg.start(timeout, fetch, func(err error) {
+		pg.mu.Lock()
+		defer pg.mu.Unlock()
+		if pg.err == nil {
+			pg.err = errors.Wrapf(err, "could not retrieve %s", name)
+			pg.cancel()
+		}
+	})
+}
+
+// optional starts a fragment that the page is shown without if it fails.
+func (pg *page) optional(name string, timeout time.Duration, fetch func(ctx context.Context) error) {
+	pg.start(timeout, fetch, func(err error) {
+		pg.log.WithField("fragment", name).WithField("error", err).Warn("skipping optional page fragment")
+		recordSkippedFragment(pg.name, name)
+		pg.mu.Lock()
+		defer pg.mu.Unlock()
+		pg.skipped = append(pg.skipped, name)
+	})
+}
+
+func (pg *page) start(timeout time.Duration, fetch func(ctx context.Context) error, failed func(error)) {
+	pg.wg.Add(1)
+	go func() {
+		defer pg.wg.Done()
+		ctx, cancel := context.WithTimeout(pg.ctx, timeout)
+		defer cancel()
+		if err := fetch(ctx); err != nil {
+			failed(err)
+		}
+	}()
+}
+
+// wait waits for the fragments started so far and returns the error of the
+// first critical fragment that failed.
+func (pg *page) wait() error {
+	pg.wg.Wait()
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	return pg.err
+}
+
+// skippedFragments returns the optional fragments that failed so far, in
+// order of name.
+func (pg *page) skippedFragments() []string {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	skipped := append([]string(nil), pg.skipped...)
+	sort.Strings(skipped)
+	return skipped
+}
+
+// setSkippedHeader lists the skipped fragments in the X-Skipped-Fragments
+// response header, if any.
+func (pg *page) setSkippedHeader(w http.ResponseWriter) {
+	if skipped := pg.skippedFragments(); len(skipped) > 0 {
+		w.Header().Set("X-Skipped-Fragments", strings.Join(skipped, ","))
+	}
+}
+
+// close releases the page's resources once it is rendered.
+func (pg *page) close() {
+	pg.cancel()
+}
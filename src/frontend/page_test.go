@@ -0,0 +1,121 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestPageRunsFragmentsConcurrently(t *testing.T) {
+	pg := newPage(context.Background(), "test", logrus.New())
+	defer pg.close()
+	var a, b, c string
+	start := time.Now()
+	pg.critical("a", time.Second, func(ctx context.Context) error { a = "a"; return sleep(ctx, 100*time.Millisecond) })
+	pg.critical("b", time.Second, func(ctx context.Context) error { b = "b"; return sleep(ctx, 100*time.Millisecond) })
+	pg.optional("c", time.Second, func(ctx context.Context) error { c = "c"; return sleep(ctx, 100*time.Millisecond) })
+	if err := pg.wait(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("fragments took %v, want them to run concurrently", elapsed)
+	}
+	if a+b+c != "abc" {
+		t.Errorf("results = %q, want all fragments to have run", a+b+c)
+	}
+	if skipped := pg.skippedFragments(); len(skipped) != 0 {
+		t.Errorf("skipped = %v, want none", skipped)
+	}
+}
+
+func TestPageCriticalFailure(t *testing.T) {
+	pg := newPage(context.Background(), "test", logrus.New())
+	defer pg.close()
+	cancelled := make(chan error, 1)
+	pg.critical("products", time.Second, func(ctx context.Context) error { return errors.New("unavailable") })
+	pg.critical("cart", time.Second, func(ctx context.Context) error {
+		err := sleep(ctx, 5*time.Second)
+		cancelled <- err
+		return err
+	})
+	err := pg.wait()
+	if err == nil || !strings.Contains(err.Error(), "could not retrieve products: unavailable") {
+		t.Errorf("wait() = %v, want the products error", err)
+	}
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Errorf("other fragment: %v, want it cancelled", err)
+	}
+}
+
+func TestPageOptionalFragments(t *testing.T) {
+	before := testutil.ToFloat64(pageFragmentsSkippedTotal.WithLabelValues("test", "recommendations"))
+	pg := newPage(context.Background(), "test", logrus.New())
+	defer pg.close()
+
+	var cart, ad string
+	pg.critical("cart", time.Second, func(context.Context) error { cart = "cart"; return nil })
+	pg.optional("recommendations", time.Second, func(context.Context) error { return errors.New("unavailable") })
+	pg.optional("ad", 10*time.Millisecond, func(ctx context.Context) error {
+		if err := sleep(ctx, time.Second); err != nil {
+			return err
+		}
+		ad = "ad"
+		return nil
+	})
+	if err := pg.wait(); err != nil {
+		t.Fatalf("wait() = %v, optional fragments should not fail the page", err)
+	}
+	if cart != "cart" || ad != "" {
+		t.Errorf("cart = %q, ad = %q", cart, ad)
+	}
+	if got, want := pg.skippedFragments(), []string{"ad", "recommendations"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("skipped = %v, want %v", got, want)
+	}
+	if got := testutil.ToFloat64(pageFragmentsSkippedTotal.WithLabelValues("test", "recommendations")); got != before+1 {
+		t.Errorf("skipped metric = %v, want %v", got, before+1)
+	}
+
+	// Fragments that need earlier results start after waiting.
+	var stock string
+	pg.optional("stock", time.Second, func(context.Context) error { stock = cart + " stock"; return nil })
+	if err := pg.wait(); err != nil || stock != "cart stock" {
+		t.Errorf("second stage: stock = %q, err = %v", stock, err)
+	}
+
+	w := httptest.NewRecorder()
+	pg.setSkippedHeader(w)
+	if got := w.Header().Get("X-Skipped-Fragments"); got != "ad,recommendations" {
+		t.Errorf("X-Skipped-Fragments = %q", got)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+)
+
+const (
+	defaultProductCacheTTL  = time.Minute
+	defaultProductCacheSize = 1000
+
+	// productFetchTimeout bounds a fetch shared by several requests, which
+	// is not cancelled when the request that started it is.
+	productFetchTimeout = 3 * time.Second
+
+	maxWatchBackoff = 30 * time.Second
+)
+
+type cachedProduct struct {
+	id      string
+	product *pb.Product
+	expires time.Time
+}
+
+// productCache caches products from the product catalog. Products are kept
+// for a TTL, the least recently used are evicted beyond a size limit, and
+// concurrent misses for the same product or for the whole list share a
+// single call. Errors are not cached. If it follows the catalog's change
+// stream (see watch), changed products are replaced as soon as they change.
+//
+// Cached products are shared between requests and must not be modified.
+type productCache struct {
+	ttl      time.Duration
+	maxSize  int
+	now      func() time.Time
+	fetch    func(ctx context.Context, id string) (*pb.Product, error)
+	fetchAll func(ctx context.Context) ([]*pb.Product, error)
+
+	group singleflight.Group
+
+	mu         sync.Mutex
+	lru        *list.List // of *cachedProduct, most recently used first
+	byID       map[string]*list.Element
+	all        []*pb.Product
+	allExpires time.Time
+	generation uint64 // incremented on every change, so older fetches are not stored
+}
+
+func newProductCache(ttl time.Duration, maxSize int,
+	fetch func(ctx context.Context, id string) (*pb.Product, error),
+	fetchAll func(ctx context.Context) ([]*pb.Product, error)) *productCache {
+	return &productCache{
+		ttl:      ttl,
+		maxSize:  maxSize,
+		now:      time.Now,
+		fetch:    fetch,
+		fetchAll: fetchAll,
+		lru:      list.New(),
+		byID:     make(map[string]*list.Element),
+	}
+}
+
+// get returns a product by ID.
+func (c *productCache) get(ctx context.Context, id string) (*pb.Product, error) {
+	c.mu.Lock()
+	if e, ok := c.byID[id]; ok {
+		if cp := e.Value.(*cachedProduct); c.now().Before(cp.expires) {
+			c.lru.MoveToFront(e)
+			c.mu.Unlock()
+			recordProductCache("product", "hit")
+			return cp.product, nil
+		}
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	v, err := c.do(ctx, "product", "product/"+id, func(ctx context.Context) (interface{}, error) {
+		p, err := c.fetch(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.generation == generation {
+			c.put(p)
+		}
+		return p, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*pb.Product), nil
+}
+
+// list returns every product.
+func (c *productCache) list(ctx context.Context) ([]*pb.Product, error) {
+	c.mu.Lock()
+	if c.all != nil && c.now().Before(c.allExpires) {
+		all := c.all
+		c.mu.Unlock()
+		recordProductCache("list", "hit")
+		return all, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	v, err := c.do(ctx, "list", "list", func(ctx context.Context) (interface{}, error) {
+		all, err := c.fetchAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.generation == generation && c.ttl > 0 {
+			c.all, c.allExpires = all, c.now().Add(c.ttl)
+			for _, p := range all {
+				c.put(p)
+			}
+		}
+		return all, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]*pb.Product), nil
+}
+
+// do runs fill once for concurrent callers with the same key and records the
+// outcome for kind.
+func (c *productCache) do(ctx context.Context, kind, key string, fill func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), productFetchTimeout)
+		defer cancel()
+		return fill(ctx)
+	})
+	select {
+	case res := <-ch:
+		switch {
+		case res.Err != nil:
+			recordProductCache(kind, "error")
+		case res.Shared:
+			recordProductCache(kind, "shared")
+		default:
+			recordProductCache(kind, "miss")
+		}
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// put stores p, evicting the least recently used products beyond the size
+// limit. c.mu must be held.
+func (c *productCache) put(p *pb.Product) {
+	if c.ttl <= 0 || c.maxSize <= 0 {
+		return
+	}
+	expires := c.now().Add(c.ttl)
+	if e, ok := c.byID[p.GetId()]; ok {
+		e.Value = &cachedProduct{id: p.GetId(), product: p, expires: expires}
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.byID[p.GetId()] = c.lru.PushFront(&cachedProduct{id: p.GetId(), product: p, expires: expires})
+	for c.lru.Len() > c.maxSize {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.byID, oldest.Value.(*cachedProduct).id)
+	}
+	productCacheEntries.Set(float64(c.lru.Len()))
+}
+
+// apply updates the cache with a change from the catalog.
+func (c *productCache) apply(change *pb.CatalogChange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.all = nil
+	if change.GetSnapshot() {
+		c.lru.Init()
+		c.byID = make(map[string]*list.Element)
+	}
+	for _, id := range change.GetRemovedIds() {
+		if e, ok := c.byID[id]; ok {
+			c.lru.Remove(e)
+			delete(c.byID, id)
+		}
+	}
+	for _, p := range change.GetUpdated() {
+		c.put(p)
+	}
+	for _, p := range change.GetAdded() {
+		c.put(p)
+	}
+	productCacheEntries.Set(float64(c.lru.Len()))
+}
+
+// watch follows the catalog's change stream until ctx is done, reconnecting
+// from the last version received when the stream breaks. Changes missed
+// while disconnected are still bounded by the TTL.
+func (c *productCache) watch(ctx context.Context, log logrus.FieldLogger,
+	open func(ctx context.Context, sinceVersion int64) (pb.ProductCatalogService_WatchCatalogClient, error)) {
+	var version int64
+	backoff := time.Second
+	for ctx.Err() == nil {
+		stream, err := open(ctx, version)
+		for err == nil {
+			var change *pb.CatalogChange
+			if change, err = stream.Recv(); err == nil {
+				c.apply(change)
+				version = change.GetVersion()
+				backoff = time.Second
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != io.EOF {
+			log.WithField("error", err).Warn("catalog change stream failed, reconnecting")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+)
+
+// fakeCatalog serves products by ID and counts calls.
+type fakeCatalog struct {
+	mu       sync.Mutex
+	products map[string]*pb.Product
+	gets     atomic.Int32
+	lists    atomic.Int32
+	block    chan struct{} // if set, calls wait for it to be closed
+}
+
+func newFakeCatalog(ids ...string) *fakeCatalog {
+	c := &fakeCatalog{products: make(map[string]*pb.Product)}
+	for _, id := range ids {
+		c.set(&pb.Product{Id: id, Name: id})
+	}
+	return c
+}
+
+func (c *fakeCatalog) set(p *pb.Product) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.products[p.GetId()] = p
+}
+
+func (c *fakeCatalog) get(_ context.Context, id string) (*pb.Product, error) {
+	c.gets.Add(1)
+	if c.block != nil {
+		<-c.block
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.products[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no product with ID %s", id)
+	}
+	return p, nil
+}
+
+func (c *fakeCatalog) list(context.Context) ([]*pb.Product, error) {
+	c.lists.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []*pb.Product
+	for _, p := range c.products {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetId() < out[j].GetId() })
+	return out, nil
+}
+
+func TestProductCache(t *testing.T) {
+	catalog := newFakeCatalog("a", "b", "c")
+	cache := newProductCache(time.Minute, 2, catalog.get, catalog.list)
+	now := time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if p, err := cache.get(ctx, "a"); err != nil || p.GetId() != "a" {
+			t.Fatalf("get(a) = %v, %v", p, err)
+		}
+	}
+	if got := catalog.gets.Load(); got != 1 {
+		t.Errorf("fetched %d times, want 1", got)
+	}
+
+	if _, err := cache.get(ctx, "missing"); err == nil {
+		t.Error("get(missing) should fail")
+	}
+	if _, err := cache.get(ctx, "missing"); err == nil || catalog.gets.Load() != 3 {
+		t.Errorf("errors should not be cached: %d fetches, want 3", catalog.gets.Load())
+	}
+
+	// b and c evict a, the least recently used.
+	cache.get(ctx, "b")
+	cache.get(ctx, "c")
+	cache.get(ctx, "a")
+	if got := catalog.gets.Load(); got != 6 {
+		t.Errorf("after eviction: fetched %d times, want 6", got)
+	}
+
+	now = now.Add(time.Minute)
+	catalog.set(&pb.Product{Id: "a", Name: "new"})
+	if p, _ := cache.get(ctx, "a"); p.GetName() != "new" {
+		t.Errorf("expired product not refetched: got %q", p.GetName())
+	}
+}
+
+func TestProductCacheList(t *testing.T) {
+	catalog := newFakeCatalog("a", "b", "c")
+	cache := newProductCache(time.Minute, 10, catalog.get, catalog.list)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if all, err := cache.list(ctx); err != nil || len(all) != 3 {
+			t.Fatalf("list() = %v, %v", all, err)
+		}
+	}
+	if got := catalog.lists.Load(); got != 1 {
+		t.Errorf("listed %d times, want 1", got)
+	}
+	// Listing fills the cache for lookups by ID.
+	for _, id := range []string{"a", "b", "c"} {
+		cache.get(ctx, id)
+	}
+	if got := catalog.gets.Load(); got != 0 {
+		t.Errorf("fetched %d products after listing, want 0", got)
+	}
+}
+
+func TestProductCacheSharesFetches(t *testing.T) {
+	catalog := newFakeCatalog("a")
+	catalog.block = make(chan struct{})
+	cache := newProductCache(time.Minute, 10, catalog.get, catalog.list)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.get(context.Background(), "a"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(catalog.block)
+	wg.Wait()
+	if got := catalog.gets.Load(); got != 1 {
+		t.Errorf("fetched %d times, want 1", got)
+	}
+}
+
+func TestProductCacheApply(t *testing.T) {
+	catalog := newFakeCatalog("a", "b")
+	cache := newProductCache(time.Minute, 10, catalog.get, catalog.list)
+	ctx := context.Background()
+	cache.list(ctx)
+
+	cache.apply(&pb.CatalogChange{
+		Version:    2,
+		Updated:    []*pb.Product{{Id: "a", Name: "updated"}},
+		Added:      []*pb.Product{{Id: "c", Name: "c"}},
+		RemovedIds: []string{"b"},
+	})
+	if p, _ := cache.get(ctx, "a"); p.GetName() != "updated" {
+		t.Errorf("get(a) = %q, want the updated product", p.GetName())
+	}
+	if p, _ := cache.get(ctx, "c"); p.GetName() != "c" {
+		t.Errorf("get(c) = %v, want the added product", p)
+	}
+	if got := catalog.gets.Load(); got != 0 {
+		t.Errorf("fetched %d products, want 0", got)
+	}
+	cache.get(ctx, "b")
+	if got := catalog.gets.Load(); got != 1 {
+		t.Errorf("removed product should be fetched again")
+	}
+	cache.list(ctx)
+	if got := catalog.lists.Load(); got != 2 {
+		t.Errorf("list should be fetched again after a change")
+	}
+
+	cache.apply(&pb.CatalogChange{Version: 3, Snapshot: true, Added: []*pb.Product{{Id: "d"}}})
+	cache.get(ctx, "a")
+	cache.get(ctx, "d")
+	if got := catalog.gets.Load(); got != 2 {
+		t.Errorf("after snapshot: fetched %d times, want 2", got)
+	}
+}
+
+func TestProductCacheDropsFetchesOlderThanChanges(t *testing.T) {
+	catalog := newFakeCatalog("a")
+	catalog.block = make(chan struct{})
+	cache := newProductCache(time.Minute, 10, catalog.get, catalog.list)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.get(context.Background(), "a")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cache.apply(&pb.CatalogChange{Version: 2, Updated: []*pb.Product{{Id: "b"}}})
+	close(catalog.block)
+	<-done
+
+	cache.get(context.Background(), "a")
+	if got := catalog.gets.Load(); got != 2 {
+		t.Errorf("a fetch that raced with a change was cached: %d fetches, want 2", got)
+	}
+}
+
+// fakeWatchStream replays changes, then fails with err.
+type fakeWatchStream struct {
+	grpc.ClientStream
+	changes []*pb.CatalogChange
+	err     error
+}
+
+func (s *fakeWatchStream) Recv() (*pb.CatalogChange, error) {
+	if len(s.changes) == 0 {
+		return nil, s.err
+	}
+	c := s.changes[0]
+	s.changes = s.changes[1:]
+	return c, nil
+}
+
+func TestProductCacheWatch(t *testing.T) {
+	catalog := newFakeCatalog()
+	cache := newProductCache(time.Minute, 10, catalog.get, catalog.list)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var versions []int64
+	opened := make(chan struct{})
+	open := func(_ context.Context, since int64) (pb.ProductCatalogService_WatchCatalogClient, error) {
+		versions = append(versions, since)
+		switch len(versions) {
+		case 1:
+			return &fakeWatchStream{
+				changes: []*pb.CatalogChange{
+					{Version: 1, Snapshot: true, Added: []*pb.Product{{Id: "a"}, {Id: "b"}}},
+					{Version: 2, Updated: []*pb.Product{{Id: "a", Name: "v2"}}},
+				},
+				err: io.EOF,
+			}, nil
+		default:
+			close(opened)
+			cancel()
+			return nil, context.Canceled
+		}
+	}
+	go cache.watch(ctx, logrus.New(), open)
+	select {
+	case <-opened:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not reconnect")
+	}
+
+	if len(versions) != 2 || versions[0] != 0 || versions[1] != 2 {
+		t.Errorf("opened the stream since versions %v, want [0 2]", versions)
+	}
+	if p, _ := cache.get(context.Background(), "a"); p.GetName() != "v2" {
+		t.Errorf("get(a) = %v, want the product from the stream", p)
+	}
+	if got := catalog.gets.Load(); got != 0 {
+		t.Errorf("fetched %d products, want 0", got)
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/session"
+)
+
+// sweepInterval is how often a limiter forgets the keys whose buckets have
+// filled up again, which are the same as new ones.
+const sweepInterval = time.Minute
+
+var errRateLimited = errors.New("too many requests, please try again later")
+
+// rateLimit allows n requests at once, refilled evenly over per: "10/m"
+// allows a burst of 10 requests, then one every 6 seconds. The zero rateLimit
+// allows everything.
+type rateLimit struct {
+	n   int
+	per time.Duration
+}
+
+// parseRateLimit parses a limit written as "<n>/<s|m|h>", or "off".
+func parseRateLimit(s string) (rateLimit, error) {
+	if s == "off" {
+		return rateLimit{}, nil
+	}
+	count, unit, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n <= 0 {
+		return rateLimit{}, fmt.Errorf("invalid rate limit %q", s)
+	}
+	per, ok := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[unit]
+	if !ok {
+		return rateLimit{}, fmt.Errorf("invalid rate limit %q: unit must be s, m or h", s)
+	}
+	return rateLimit{n: n, per: per}, nil
+}
+
+func (l rateLimit) String() string {
+	if l.n == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.n, map[time.Duration]string{time.Second: "s", time.Minute: "m", time.Hour: "h"}[l.per])
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// limiter keeps a token bucket per key, such as a client IP address. Keys not
+// seen for long enough to refill are forgotten. It is safe for concurrent use.
+type limiter struct {
+	limit rateLimit
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func newLimiter(limit rateLimit) *limiter {
+	return &limiter{limit: limit, buckets: make(map[string]*bucket)}
+}
+
+// allow takes a token from the bucket of key at time now. If there is none,
+// it returns false and how long until there is.
+func (l *limiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if l.limit.n == 0 {
+		return true, 0
+	}
+	rate := float64(l.limit.n) / float64(l.limit.per) // tokens per nanosecond
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) >= sweepInterval {
+		for k, b := range l.buckets {
+			if b.tokens+float64(now.Sub(b.updated))*rate >= float64(l.limit.n) {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.n), updated: now}
+		l.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(float64(l.limit.n), b.tokens+float64(elapsed)*rate)
+		b.updated = now
+	}
+	if b.tokens < 1 {
+		return false, time.Duration(math.Ceil((1 - b.tokens) / rate))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// size returns the number of keys the limiter keeps a bucket for.
+func (l *limiter) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// rateLimitPolicy limits the requests to some routes, both per session and per
+// client IP address: limiting sessions alone would not stop clients that drop
+// their cookies, and limiting addresses alone would throttle everyone behind
+// a shared NAT as soon as one visitor did.
+type rateLimitPolicy struct {
+	name string
+	// routes are "METHOD /path" or "/path", under baseUrl. A policy without
+	// routes applies to the requests no other policy does.
+	routes  []string
+	session *limiter
+	ip      *limiter
+}
+
+func (p *rateLimitPolicy) matches(r *http.Request) bool {
+	path := strings.TrimPrefix(r.URL.Path, baseUrl)
+	for _, route := range p.routes {
+		method, routePath, ok := strings.Cut(route, " ")
+		if !ok {
+			method, routePath = "", route
+		}
+		if (method == "" || method == r.Method) && routePath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultRateLimits are the policies, with their limits per session and per
+// client IP address. The latter are higher, for the visitors sharing one.
+var defaultRateLimits = []struct {
+	name, session, ip string
+	routes            []string
+}{
+	// Each checkout charges a card: limit card testing.
+	{"checkout", "5/m", "30/m", []string{"POST /cart/checkout", "POST " + apiPrefix + "/checkout"}},
+	// Each message costs a call to the language model.
+	{"bot", "10/m", "60/m", []string{"POST /bot"}},
+	// Limit password guessing.
+	{"login", "10/m", "60/m", []string{"POST /login", "POST /register", "GET /auth/login", "GET /auth/callback"}},
+	{"default", "300/m", "3000/m", nil},
+}
+
+// rateLimiter holds the rate limit policies of the storefront.
+type rateLimiter struct {
+	policies []*rateLimitPolicy
+	// trustedProxies are the addresses of the proxies whose X-Forwarded-For
+	// headers are believed.
+	trustedProxies []netip.Prefix
+	now            func() time.Time
+}
+
+// newRateLimiter returns the default policies with the limits given by spec,
+// a comma-separated list of "<policy>.<session|ip>=<limit>" overrides such as
+// "checkout.ip=100/m,bot.session=off".
+func newRateLimiter(spec string, trustedProxies []netip.Prefix) (*rateLimiter, error) {
+	limits := make(map[string]rateLimit)
+	for _, p := range defaultRateLimits {
+		for key, v := range map[string]string{p.name + ".session": p.session, p.name + ".ip": p.ip} {
+			l, err := parseRateLimit(v)
+			if err != nil {
+				panic(err)
+			}
+			limits[key] = l
+		}
+	}
+	for _, override := range strings.Split(spec, ",") {
+		if override = strings.TrimSpace(override); override == "" {
+			continue
+		}
+		key, v, _ := strings.Cut(override, "=")
+		key = strings.TrimSpace(key)
+		if _, ok := limits[key]; !ok {
+			return nil, fmt.Errorf("unknown rate limit %q", key)
+		}
+		l, err := parseRateLimit(strings.TrimSpace(v))
+		if err != nil {
+			return nil, err
+		}
+		limits[key] = l
+	}
+
+	rl := &rateLimiter{trustedProxies: trustedProxies, now: time.Now}
+	for _, p := range defaultRateLimits {
+		rl.policies = append(rl.policies, &rateLimitPolicy{
+			name:    p.name,
+			routes:  p.routes,
+			session: newLimiter(limits[p.name+".session"]),
+			ip:      newLimiter(limits[p.name+".ip"]),
+		})
+	}
+	return rl, nil
+}
+
+// parseTrustedProxies parses a comma-separated list of IP addresses and CIDR
+// prefixes.
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// policy returns the policy for the request, or nil if it is not limited.
+func (rl *rateLimiter) policy(r *http.Request) *rateLimitPolicy {
+	if r.URL.Path == baseUrl+"/_healthz" || strings.HasPrefix(r.URL.Path, baseUrl+"/static/") {
+		return nil
+	}
+	var fallback *rateLimitPolicy
+	for _, p := range rl.policies {
+		if p.routes == nil {
+			fallback = p
+		} else if p.matches(r) {
+			return p
+		}
+	}
+	return fallback
+}
+
+// clientIP returns the address of the client that sent the request. Requests
+// from trusted proxies are from the address the proxies put last in
+// X-Forwarded-For that is not itself a trusted proxy; other clients could
+// put anything there, so it is ignored for them.
+func (rl *rateLimiter) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+	if !rl.trusted(addr) {
+		return addr.String()
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !rl.trusted(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+func (rl *rateLimiter) trusted(addr netip.Addr) bool {
+	for _, p := range rl.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitClients refuses requests over the limits of their policy per client
+// IP address. It comes before ensureSession, so that refused requests don't
+// start sessions and fill the session store.
+func (fe *frontendServer) limitClients(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rl := fe.rateLimits
+		if rl == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if p := rl.policy(r); p != nil {
+			if ok, wait := p.ip.allow(rl.clientIP(r), rl.now()); !ok {
+				refuseRateLimited(w, r, p, "ip", wait)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// limitSessions refuses requests over the limits of their policy per session.
+func (fe *frontendServer) limitSessions(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rl := fe.rateLimits
+		s, _ := r.Context().Value(ctxKeySession{}).(*session.Session)
+		if rl == nil || s == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if p := rl.policy(r); p != nil {
+			if ok, wait := p.session.allow(s.ID, rl.now()); !ok {
+				refuseRateLimited(w, r, p, "session", wait)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// refuseRateLimited responds with 429 Too Many Requests, and says when to
+// retry in the Retry-After header.
+func refuseRateLimited(w http.ResponseWriter, r *http.Request, p *rateLimitPolicy, key string, wait time.Duration) {
+	rateLimitedTotal.WithLabelValues(p.name, key).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	if strings.HasPrefix(r.URL.Path, baseUrl+apiPrefix+"/") {
+		renderAPIError(r, w, errRateLimited, http.StatusTooManyRequests)
+		return
+	}
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	renderHTTPError(log.WithFields(logrus.Fields{"rate_limit": p.name, "key": key}), r, w, errRateLimited, http.StatusTooManyRequests)
+}
+
+// trackBuckets reports how many keys the limiters keep buckets for,
+// every interval.
+func (rl *rateLimiter) trackBuckets(interval time.Duration) {
+	for range time.Tick(interval) {
+		for _, p := range rl.policies {
+			rateLimitBuckets.WithLabelValues(p.name, "session").Set(float64(p.session.size()))
+			rateLimitBuckets.WithLabelValues(p.name, "ip").Set(float64(p.ip.size()))
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/session"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	for s, want := range map[string]rateLimit{
+		"10/m": {n: 10, per: time.Minute},
+		"5/s":  {n: 5, per: time.Second},
+		"1/h":  {n: 1, per: time.Hour},
+		"off":  {},
+	} {
+		got, err := parseRateLimit(s)
+		if err != nil || got != want {
+			t.Errorf("parseRateLimit(%q) = %v, %v, want %v", s, got, err, want)
+		}
+		if got.String() != s {
+			t.Errorf("%v.String() = %q, want %q", got, got.String(), s)
+		}
+	}
+	for _, s := range []string{"", "10", "0/m", "-1/m", "10/d", "ten/m"} {
+		if _, err := parseRateLimit(s); err == nil {
+			t.Errorf("parseRateLimit(%q) succeeded", s)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(rateLimit{n: 3, per: time.Minute})
+	now := time.Now()
+	for i := range 3 {
+		if ok, _ := l.allow("a", now); !ok {
+			t.Fatalf("request %d of the burst refused", i+1)
+		}
+	}
+	if ok, wait := l.allow("a", now); ok || wait != 20*time.Second {
+		t.Errorf("request over the burst returned %v, %v, want false, 20s", ok, wait)
+	}
+	if ok, _ := l.allow("b", now); !ok {
+		t.Error("another key's request refused")
+	}
+	if ok, wait := l.allow("a", now.Add(15*time.Second)); ok || wait != 5*time.Second {
+		t.Errorf("request before the refill returned %v, %v, want false, 5s", ok, wait)
+	}
+	if ok, _ := l.allow("a", now.Add(20*time.Second)); !ok {
+		t.Error("request after the refill refused")
+	}
+
+	// Full buckets are forgotten.
+	l.allow("c", now.Add(time.Hour))
+	if got := l.size(); got != 1 {
+		t.Errorf("after an hour, the limiter keeps %d buckets, want 1", got)
+	}
+
+	off := newLimiter(rateLimit{})
+	for range 100 {
+		if ok, _ := off.allow("a", now); !ok {
+			t.Fatal("limiter without a limit refused a request")
+		}
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	rl, err := newRateLimiter(" checkout.ip=100/m, bot.session=off", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range rl.policies {
+		switch p.name {
+		case "checkout":
+			if p.ip.limit != (rateLimit{n: 100, per: time.Minute}) || p.session.limit != (rateLimit{n: 5, per: time.Minute}) {
+				t.Errorf("checkout limits are %v per session and %v per ip", p.session.limit, p.ip.limit)
+			}
+		case "bot":
+			if p.session.limit != (rateLimit{}) {
+				t.Errorf("bot limit per session is %v, want off", p.session.limit)
+			}
+		}
+	}
+	for _, spec := range []string{"checkout=5/m", "search.ip=5/m", "checkout.ip=5", "checkout.ip"} {
+		if _, err := newRateLimiter(spec, nil); err == nil {
+			t.Errorf("newRateLimiter(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestRateLimitPolicies(t *testing.T) {
+	rl, err := newRateLimiter("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := map[string]string{
+		"POST /cart/checkout": "checkout",
+		"POST /bot":           "bot",
+		"POST /login":         "login",
+		"POST /register":      "login",
+		"GET /auth/login":     "login",
+		"GET /auth/callback":  "login",
+		"GET /login":          "default",
+		"GET /cart":           "default",
+	}
+	// Every way of placing an order is limited as a checkout.
+	for _, route := range apiRoutes {
+		if route.name == "placeOrder" {
+			routes[route.method+" "+apiPrefix+route.path] = "checkout"
+		}
+	}
+	for route, want := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		if got := rl.policy(httptest.NewRequest(method, path, nil)); got == nil || got.name != want {
+			t.Errorf("%s is limited by %v, want %s", route, got, want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, 192.0.2.1,2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl := &rateLimiter{trustedProxies: proxies}
+	tests := []struct {
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"203.0.113.7:1234", nil, "203.0.113.7"},
+		// Only trusted proxies may say who the client is.
+		{"203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"10.1.2.3:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"[::ffff:10.1.2.3]:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		// The client may put anything before the address the proxies add.
+		{"10.1.2.3:1234", []string{"1.1.1.1, 198.51.100.1, 192.0.2.1"}, "198.51.100.1"},
+		{"10.1.2.3:1234", []string{"1.1.1.1", "198.51.100.1,192.0.2.1"}, "198.51.100.1"},
+		{"[2001:db8::1]:1234", []string{"2001:db9::1"}, "2001:db9::1"},
+		{"10.1.2.3:1234", []string{"garbage, 198.51.100.1"}, "198.51.100.1"},
+		{"10.1.2.3:1234", []string{"198.51.100.1, garbage"}, "10.1.2.3"},
+		{"10.1.2.3:1234", []string{"10.4.5.6"}, "10.4.5.6"},
+		{"10.1.2.3:1234", nil, "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		for _, v := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := rl.clientIP(r); got != tt.want {
+			t.Errorf("clientIP from %s forwarded for %q = %s, want %s", tt.remote, tt.forwarded, got, tt.want)
+		}
+	}
+
+	if _, err := parseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("parseTrustedProxies accepted an invalid prefix")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	store := session.NewMemoryStore()
+	fe := &frontendServer{sessions: newTestSessions()}
+	fe.sessions.Store = store
+	var err error
+	if fe.rateLimits, err = newRateLimiter("checkout.session=2/m,checkout.ip=4/m,default.ip=off", nil); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	fe.rateLimits.now = func() time.Time { return now }
+	// The middleware in the order of main.
+	limited := fe.limitClients(fe.ensureSession(fe.limitSessions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := logrus.New()
+		log.Out = io.Discard
+		limited.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyLog{}, logrus.FieldLogger(log))))
+	})
+	do := func(method, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := do(http.MethodGet, "/", nil)
+	cookie := rr.Result().Cookies()[0]
+	refused := testutil.ToFloat64(rateLimitedTotal.WithLabelValues("checkout", "session"))
+	for i := range 2 {
+		if rr := do(http.MethodPost, "/cart/checkout", cookie); rr.Code != http.StatusNoContent {
+			t.Fatalf("checkout %d returned %d", i+1, rr.Code)
+		}
+	}
+	rr = do(http.MethodPost, "/cart/checkout", cookie)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "30" {
+		t.Errorf("third checkout returned %d with Retry-After %q, want %d with 30", rr.Code, rr.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+	if got := testutil.ToFloat64(rateLimitedTotal.WithLabelValues("checkout", "session")); got != refused+1 {
+		t.Errorf("refused checkouts counted %v times, want once", got-refused)
+	}
+	// Other pages have limits of their own.
+	if rr := do(http.MethodGet, "/cart", cookie); rr.Code != http.StatusNoContent {
+		t.Errorf("GET /cart returned %d", rr.Code)
+	}
+
+	// Dropping the cookie only helps until the address's limit.
+	if rr := do(http.MethodPost, "/cart/checkout", nil); rr.Code != http.StatusNoContent {
+		t.Errorf("checkout in a new session returned %d", rr.Code)
+	}
+	sessions := store.Len()
+	if rr := do(http.MethodPost, "/cart/checkout", nil); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("checkout over the address's limit returned %d", rr.Code)
+	}
+	// Refused requests start no sessions.
+	if got := store.Len(); got != sessions {
+		t.Errorf("refused request stored %d sessions", got-sessions)
+	}
+
+	// The API's checkout shares the limits of the storefront's.
+	if rr := do(http.MethodPost, apiPrefix+"/checkout", cookie); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("API checkout over the limit returned %d", rr.Code)
+	}
+
+	now = now.Add(time.Minute)
+	if rr := do(http.MethodPost, "/cart/checkout", cookie); rr.Code != http.StatusNoContent {
+		t.Errorf("checkout a minute later returned %d", rr.Code)
+	}
+
+	// API clients get JSON.
+	fe.rateLimits, _ = newRateLimiter("default.ip=1/m", nil)
+	do(http.MethodGet, apiPrefix+"/products", nil)
+	rr = do(http.MethodGet, apiPrefix+"/products", nil)
+	if rr.Code != http.StatusTooManyRequests || !strings.HasPrefix(rr.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("API request over the limit returned %d with %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	for _, path := range []string{"/static/styles/styles.css", "/_healthz"} {
+		if rr := do(http.MethodGet, path, nil); rr.Code != http.StatusNoContent {
+			t.Errorf("GET %s returned %d, want it not limited", path, rr.Code)
+		}
+	}
+}
@@ -12,43 +12,79 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package frontend
 
 import (
 	"context"
+	"math/big"
 	"time"
 
-	pb "github.com/GoogleCloudPlatform/microservices-demo/src/frontend/genproto"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
 
 	"github.com/pkg/errors"
 )
 
-const (
-	avoidNoopCurrencyConversionRPC = false
-)
-
+// getCurrencies returns the currencies offered to shoppers.
 func (fe *frontendServer) getCurrencies(ctx context.Context) ([]string, error) {
+	return supportedCurrencies.list(ctx)
+}
+
+// getSupportedCurrencies returns the currencies the currency service supports,
+// or those of the local exchange rates if it fails.
+func (fe *frontendServer) getSupportedCurrencies(ctx context.Context) ([]string, error) {
+	start := time.Now()
 	currs, err := pb.NewCurrencyServiceClient(fe.currencySvcConn).
 		GetSupportedCurrencies(ctx, &pb.Empty{})
+	duration := time.Since(start)
+
+	status := "success"
 	if err != nil {
-		return nil, err
+		status = "error"
 	}
-	var out []string
-	for _, c := range currs.CurrencyCodes {
-		if _, ok := whitelistedCurrencies[c]; ok {
-			out = append(out, c)
+	recordGRPCRequest("CurrencyService", "GetSupportedCurrencies", status, duration)
+
+	if err != nil {
+		if fe.exchangeRates == nil {
+			return nil, err
 		}
+		return fe.exchangeRates.Rates().Currencies(), nil
 	}
-	return out, nil
+	return currs.GetCurrencyCodes(), nil
 }
 
+// getProducts returns every product, from the cache if there is one.
 func (fe *frontendServer) getProducts(ctx context.Context) ([]*pb.Product, error) {
+	if fe.products == nil {
+		return fe.fetchProducts(ctx)
+	}
+	return fe.products.list(ctx)
+}
+
+// getProduct returns a product, from the cache if there is one.
+func (fe *frontendServer) getProduct(ctx context.Context, id string) (*pb.Product, error) {
+	if fe.products == nil {
+		return fe.fetchProduct(ctx, id)
+	}
+	return fe.products.get(ctx, id)
+}
+
+func (fe *frontendServer) fetchProducts(ctx context.Context) ([]*pb.Product, error) {
+	start := time.Now()
 	resp, err := pb.NewProductCatalogServiceClient(fe.productCatalogSvcConn).
 		ListProducts(ctx, &pb.Empty{})
+	duration := time.Since(start)
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	recordGRPCRequest("ProductCatalogService", "ListProducts", status, duration)
+
 	return resp.GetProducts(), err
 }
 
-func (fe *frontendServer) getProduct(ctx context.Context, id string) (*pb.Product, error) {
+func (fe *frontendServer) fetchProduct(ctx context.Context, id string) (*pb.Product, error) {
 	start := time.Now()
 	resp, err := pb.NewProductCatalogServiceClient(fe.productCatalogSvcConn).
 		GetProduct(ctx, &pb.GetProductRequest{Id: id})
@@ -63,6 +99,12 @@ func (fe *frontendServer) getProduct(ctx context.Context, id string) (*pb.Produc
 	return resp, err
 }
 
+// watchCatalog opens the catalog's change stream.
+func (fe *frontendServer) watchCatalog(ctx context.Context, sinceVersion int64) (pb.ProductCatalogService_WatchCatalogClient, error) {
+	return pb.NewProductCatalogServiceClient(fe.productCatalogSvcConn).
+		WatchCatalog(ctx, &pb.WatchCatalogRequest{SinceVersion: sinceVersion})
+}
+
 func (fe *frontendServer) getCart(ctx context.Context, userID string) ([]*pb.CartItem, error) {
 	start := time.Now()
 	resp, err := pb.NewCartServiceClient(fe.cartSvcConn).GetCart(ctx, &pb.GetCartRequest{UserId: userID})
@@ -77,6 +119,28 @@ func (fe *frontendServer) getCart(ctx context.Context, userID string) ([]*pb.Car
 	return resp.GetItems(), err
 }
 
+// getStock returns the stock levels of the given SKUs, keyed by SKU.
+func (fe *frontendServer) getStock(ctx context.Context, skus []string) (map[string]*pb.StockLevel, error) {
+	start := time.Now()
+	resp, err := pb.NewInventoryServiceClient(fe.inventorySvcConn).GetStock(ctx, &pb.GetStockRequest{Skus: skus})
+	duration := time.Since(start)
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	recordGRPCRequest("InventoryService", "GetStock", status, duration)
+
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]*pb.StockLevel, len(resp.GetLevels()))
+	for _, l := range resp.GetLevels() {
+		out[l.GetSku()] = l
+	}
+	return out, nil
+}
+
 func (fe *frontendServer) emptyCart(ctx context.Context, userID string) error {
 	start := time.Now()
 	_, err := pb.NewCartServiceClient(fe.cartSvcConn).EmptyCart(ctx, &pb.EmptyCartRequest{UserId: userID})
@@ -91,13 +155,14 @@ func (fe *frontendServer) emptyCart(ctx context.Context, userID string) error {
 	return err
 }
 
-func (fe *frontendServer) insertCart(ctx context.Context, userID, productID string, quantity int32) error {
+func (fe *frontendServer) insertCart(ctx context.Context, userID, productID, variantSKU string, quantity int32) error {
 	start := time.Now()
 	_, err := pb.NewCartServiceClient(fe.cartSvcConn).AddItem(ctx, &pb.AddItemRequest{
 		UserId: userID,
 		Item: &pb.CartItem{
-			ProductId: productID,
-			Quantity:  quantity},
+			ProductId:  productID,
+			VariantSku: variantSKU,
+			Quantity:   quantity},
 	})
 	duration := time.Since(start)
 
@@ -110,16 +175,55 @@ func (fe *frontendServer) insertCart(ctx context.Context, userID, productID stri
 	return err
 }
 
-func (fe *frontendServer) convertCurrency(ctx context.Context, money *pb.Money, currency string) (*pb.Money, error) {
-	if avoidNoopCurrencyConversionRPC && money.GetCurrencyCode() == currency {
-		return money, nil
+func (fe *frontendServer) updateCartItem(ctx context.Context, userID, productID, variantSKU string, quantity int32) error {
+	start := time.Now()
+	_, err := pb.NewCartServiceClient(fe.cartSvcConn).UpdateItemQuantity(ctx, &pb.UpdateItemQuantityRequest{
+		UserId:     userID,
+		ProductId:  productID,
+		VariantSku: variantSKU,
+		Quantity:   quantity,
+	})
+	duration := time.Since(start)
+
+	status := "success"
+	if err != nil {
+		status = "error"
 	}
+	recordGRPCRequest("CartService", "UpdateItemQuantity", status, duration)
+
+	return err
+}
+
+func (fe *frontendServer) removeCartItem(ctx context.Context, userID, productID, variantSKU string) error {
+	start := time.Now()
+	_, err := pb.NewCartServiceClient(fe.cartSvcConn).RemoveItem(ctx, &pb.RemoveItemRequest{
+		UserId:     userID,
+		ProductId:  productID,
+		VariantSku: variantSKU,
+	})
+	duration := time.Since(start)
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	recordGRPCRequest("CartService", "RemoveItem", status, duration)
+
+	return err
+}
+
+// rateProbeUnits is the amount converted to learn an exchange rate. A large
+// amount keeps digits that the currency service would round away.
+const rateProbeUnits = 1000000
 
+// getCurrencyRate learns the exact rate from one currency to another by
+// converting rateProbeUnits with the currency service.
+func (fe *frontendServer) getCurrencyRate(ctx context.Context, from, to string) (*big.Rat, error) {
 	start := time.Now()
 	resp, err := pb.NewCurrencyServiceClient(fe.currencySvcConn).
 		Convert(ctx, &pb.CurrencyConversionRequest{
-			From:   money,
-			ToCode: currency})
+			From:   &pb.Money{CurrencyCode: from, Units: rateProbeUnits},
+			ToCode: to})
 	duration := time.Since(start)
 
 	status := "success"
@@ -128,7 +232,64 @@ func (fe *frontendServer) convertCurrency(ctx context.Context, money *pb.Money,
 	}
 	recordGRPCRequest("CurrencyService", "Convert", status, duration)
 
-	return resp, err
+	if err != nil {
+		return nil, err
+	}
+	if !money.IsValid(resp) || !money.IsPositive(resp) {
+		return nil, errors.Errorf("currency service returned invalid amount %v for %d %s", resp, rateProbeUnits, from)
+	}
+	nanos := new(big.Int).Mul(big.NewInt(resp.GetUnits()), big.NewInt(1e9))
+	nanos.Add(nanos, big.NewInt(int64(resp.GetNanos())))
+	return new(big.Rat).SetFrac(nanos, big.NewInt(rateProbeUnits*1e9)), nil
+}
+
+// currencyRate returns the rate from one currency to another, from the cache
+// if there is one.
+func (fe *frontendServer) currencyRate(ctx context.Context, from, to string) (*big.Rat, error) {
+	if fe.currencyRates == nil {
+		return fe.getCurrencyRate(ctx, from, to)
+	}
+	return fe.currencyRates.get(ctx, from, to)
+}
+
+// convertCurrency converts amount to the given currency, rounded to the
+// minor unit of that currency so that displayed prices add up to the total.
+// Amounts already in that currency need no rate, and if the currency service
+// fails the local exchange rates are used instead.
+func (fe *frontendServer) convertCurrency(ctx context.Context, amount *pb.Money, currency string) (*pb.Money, error) {
+	if amount.GetCurrencyCode() == currency {
+		return money.RoundToMinorUnit(amount, money.RoundHalfEven)
+	}
+
+	rate, err := fe.currencyRate(ctx, amount.GetCurrencyCode(), currency)
+	if err != nil {
+		if fe.exchangeRates == nil {
+			return nil, err
+		}
+		if rate, err = fe.exchangeRates.Rate(amount.GetCurrencyCode(), currency); err != nil {
+			return nil, errors.Wrap(err, "currency service unavailable and local conversion failed")
+		}
+		recordCurrencyFallback(amount.GetCurrencyCode(), currency)
+	}
+	converted, err := money.Scale(amount, rate, money.RoundHalfEven)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert %s to %s", money.String(amount), currency)
+	}
+	converted.CurrencyCode = currency
+	return money.RoundToMinorUnit(converted, money.RoundHalfEven)
+}
+
+// convertCurrencies converts each amount like convertCurrency. It looks up one
+// rate per source currency rather than making a call per amount.
+func (fe *frontendServer) convertCurrencies(ctx context.Context, amounts []*pb.Money, currency string) ([]*pb.Money, error) {
+	out := make([]*pb.Money, len(amounts))
+	for i, amount := range amounts {
+		var err error
+		if out[i], err = fe.convertCurrency(ctx, amount, currency); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
 }
 
 func (fe *frontendServer) getShippingQuote(ctx context.Context, items []*pb.CartItem, currency string) (*pb.Money, error) {
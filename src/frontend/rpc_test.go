@@ -0,0 +1,176 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"math"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/exchange"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
+)
+
+// unreachableConn returns a connection whose calls fail immediately.
+func unreachableConn(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	conn, err := grpc.NewClient("passthrough:///unreachable",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return nil, net.ErrClosed }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// fakeCurrencyService converts with float rates against EUR, like the Node
+// currency service, and counts Convert calls.
+type fakeCurrencyService struct {
+	pb.UnimplementedCurrencyServiceServer
+	rates map[string]float64
+	calls atomic.Int32
+}
+
+func (s *fakeCurrencyService) Convert(_ context.Context, req *pb.CurrencyConversionRequest) (*pb.Money, error) {
+	s.calls.Add(1)
+	from, ok := s.rates[req.GetFrom().GetCurrencyCode()]
+	to, ok2 := s.rates[req.GetToCode()]
+	if !ok || !ok2 {
+		return nil, status.Error(codes.InvalidArgument, "unsupported currency")
+	}
+	v := (float64(req.GetFrom().GetUnits()) + float64(req.GetFrom().GetNanos())/1e9) / from * to
+	units, frac := math.Modf(v)
+	return &pb.Money{CurrencyCode: req.GetToCode(), Units: int64(units), Nanos: int32(math.Round(frac * 1e9))}, nil
+}
+
+func dialCurrencyService(t *testing.T, svc pb.CurrencyServiceServer) *grpc.ClientConn {
+	return dialService(t, func(srv *grpc.Server) { pb.RegisterCurrencyServiceServer(srv, svc) })
+}
+
+// dialService connects to an in-process server with the services that
+// register adds.
+func dialService(t *testing.T, register func(*grpc.Server)) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	register(srv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestConvertCurrencies(t *testing.T) {
+	svc := &fakeCurrencyService{rates: map[string]float64{"EUR": 1, "USD": 1.1305, "JPY": 126.4, "GBP": 0.85970}}
+	fe := &frontendServer{currencySvcConn: dialCurrencyService(t, svc)}
+	fe.currencyRates = newRateCache(time.Minute, fe.getCurrencyRate)
+	ctx := context.Background()
+
+	amounts := []*pb.Money{
+		{CurrencyCode: "USD", Units: 19, Nanos: 990000000},
+		{CurrencyCode: "USD", Units: 67, Nanos: 990000000},
+		{CurrencyCode: "USD", Units: 1, Nanos: 0},
+		{CurrencyCode: "USD", Units: 0, Nanos: 990000000},
+		{CurrencyCode: "EUR", Units: 10, Nanos: 0},
+	}
+	want := []string{"2235 JPY", "7602 JPY", "112 JPY", "111 JPY", "1264 JPY"}
+	for page := 0; page < 3; page++ {
+		got, err := fe.convertCurrencies(ctx, amounts, "JPY")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range got {
+			if money.String(got[i]) != want[i] {
+				t.Errorf("convertCurrencies()[%d] = %s, want %s", i, money.String(got[i]), want[i])
+			}
+		}
+	}
+	// One call per source currency, however many amounts and pages.
+	if got := svc.calls.Load(); got != 2 {
+		t.Errorf("made %d Convert calls, want 2", got)
+	}
+
+	// Results match what the service gives for each amount.
+	for _, a := range amounts[:3] {
+		got, err := fe.convertCurrency(ctx, a, "GBP")
+		if err != nil {
+			t.Fatal(err)
+		}
+		direct, err := svc.Convert(ctx, &pb.CurrencyConversionRequest{From: a, ToCode: "GBP"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if direct, _ = money.RoundToMinorUnit(direct, money.RoundHalfEven); !money.AreEquals(got, direct) {
+			t.Errorf("convertCurrency(%s) = %s, currency service gives %s", money.String(a), money.String(got), money.String(direct))
+		}
+	}
+
+	if _, err := fe.convertCurrencies(ctx, amounts, "XYZ"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("unsupported currency: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestConvertCurrency(t *testing.T) {
+	rates, err := exchange.ParseRates([]byte(`{"base": "EUR", "rates": {"USD": "1.25", "JPY": "125"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name    string
+		fe      *frontendServer
+		in      *pb.Money
+		to      string
+		want    string
+		wantErr bool
+	}{
+		// A nil connection would panic if the currency service were called.
+		{"same currency", &frontendServer{}, &pb.Money{CurrencyCode: "USD", Units: 8, Nanos: 994000000}, "USD", "8.99 USD", false},
+		{"fallback", &frontendServer{currencySvcConn: unreachableConn(t), exchangeRates: exchange.NewConverter(rates, 0)}, &pb.Money{CurrencyCode: "USD", Units: 19, Nanos: 990000000}, "JPY", "1999 JPY", false},
+		{"fallback unsupported", &frontendServer{currencySvcConn: unreachableConn(t), exchangeRates: exchange.NewConverter(rates, 0)}, &pb.Money{CurrencyCode: "USD", Units: 1}, "GBP", "", true},
+		{"no fallback", &frontendServer{currencySvcConn: unreachableConn(t)}, &pb.Money{CurrencyCode: "USD", Units: 1}, "EUR", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.fe.convertCurrency(ctx, tt.in, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("convertCurrency() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && money.String(got) != tt.want {
+				t.Errorf("convertCurrency() = %s, want %s", money.String(got), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errInvalidCookie is returned for cookie values that no key opens.
+var errInvalidCookie = errors.New("session: invalid cookie")
+
+// Keys seal cookie values with AES-GCM, so that they can be neither read nor
+// forged. The first key seals; every key opens. To rotate, put the new key
+// first and drop the old one once the sessions it sealed have expired.
+type Keys struct {
+	aeads []cipher.AEAD
+}
+
+// NewKeys returns keys for AES-128, AES-192 or AES-256 keys of 16, 24 or 32
+// bytes.
+func NewKeys(keys ...[]byte) (*Keys, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("session: no keys")
+	}
+	k := &Keys{}
+	for i, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("session: key %d: %w", i+1, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads = append(k.aeads, aead)
+	}
+	return k, nil
+}
+
+// ParseKeys parses comma-separated base64 keys, newest first, as in the
+// SESSION_KEYS variable.
+func ParseKeys(s string) (*Keys, error) {
+	var keys [][]byte
+	for i, v := range strings.Split(s, ",") {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("session: key %d is not base64: %w", i+1, err)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeys(keys...)
+}
+
+// RandomKeys returns a single random AES-256 key. Cookies it seals cannot be
+// opened after a restart, nor by other replicas.
+func RandomKeys() *Keys {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	k, _ := NewKeys(key)
+	return k
+}
+
+// Seal seals the value of the cookie called name. The name is authenticated
+// too, so a value cannot be moved to another cookie.
+func (k *Keys) Seal(name, value string) string {
+	aead := k.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(value), []byte(name)))
+}
+
+// Open returns the value sealed in the cookie called name.
+func (k *Keys) Open(name, sealed string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", errInvalidCookie
+	}
+	for _, aead := range k.aeads {
+		if len(b) < aead.NonceSize() {
+			continue
+		}
+		nonce, ciphertext := b[:aead.NonceSize()], b[aead.NonceSize():]
+		if value, err := aead.Open(nil, nonce, ciphertext, []byte(name)); err == nil {
+			return string(value), nil
+		}
+	}
+	return "", errInvalidCookie
+}
@@ -0,0 +1,291 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// redisKeyPrefix namespaces the sessions in a shared Redis.
+	redisKeyPrefix = "session:"
+	// redisTimeout bounds a command sent without a context deadline.
+	redisTimeout = 2 * time.Second
+	// maxIdleRedisConns is how many connections the store keeps open.
+	maxIdleRedisConns = 8
+	// maxRedisBulk bounds the strings read from the wire.
+	maxRedisBulk = 1 << 20
+)
+
+// redisError is an error reply.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// RedisStore keeps sessions in a server that speaks the Redis protocol, such
+// as Redis, Valkey, Memorystore, or RedisServer. Sessions expire with their
+// keys.
+type RedisStore struct {
+	addr   string
+	dialer net.Dialer
+	idle   chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// NewRedisStore returns a store at addr, in host:port form. Connections are
+// made when needed.
+func NewRedisStore(addr string) *RedisStore {
+	return &RedisStore{addr: addr, idle: make(chan *redisConn, maxIdleRedisConns)}
+}
+
+func (s *RedisStore) Get(ctx context.Context, id string) ([]byte, error) {
+	reply, err := s.do(ctx, "GET", redisKeyPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrNotFound
+	}
+	v, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %v to GET", reply)
+	}
+	return []byte(v), nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, id string, data []byte, expires time.Time) error {
+	ttl := time.Until(expires).Milliseconds()
+	if ttl <= 0 {
+		return s.Delete(ctx, id)
+	}
+	_, err := s.do(ctx, "SET", redisKeyPrefix+id, string(data), "PX", strconv.FormatInt(ttl, 10))
+	return err
+}
+
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	_, err := s.do(ctx, "DEL", redisKeyPrefix+id)
+	return err
+}
+
+// do sends a command and returns its reply. Connections are reused unless
+// they fail.
+func (s *RedisStore) do(ctx context.Context, args ...string) (interface{}, error) {
+	var c *redisConn
+	select {
+	case c = <-s.idle:
+	default:
+		conn, err := s.dialer.DialContext(ctx, "tcp", s.addr)
+		if err != nil {
+			return nil, err
+		}
+		c = &redisConn{Conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	c.SetDeadline(deadline)
+
+	if err := writeCommand(c.w, args...); err != nil {
+		c.Close()
+		return nil, err
+	}
+	reply, err := readReply(c.r)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	select {
+	case s.idle <- c:
+	default:
+		c.Close()
+	}
+	if e, ok := reply.(redisError); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+// writeCommand writes args as an array of bulk strings and flushes w.
+func writeCommand(w *bufio.Writer, args ...string) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return w.Flush()
+}
+
+// readReply reads a value: a string for simple and bulk strings, an int64,
+// nil for null, a redisError, or a []interface{} for arrays.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: malformed line %q", line)
+	}
+	kind, rest := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return redisError(rest), nil
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n > maxRedisBulk {
+			return nil, fmt.Errorf("redis: bad bulk length %q", rest)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n > maxRedisBulk {
+			return nil, fmt.Errorf("redis: bad array length %q", rest)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
+
+// RedisServer is a stand-in for Redis, to run the frontend with the Redis
+// store but without Redis, as in tests. It keeps keys in memory and knows
+// only the commands the store sends: PING, GET, SET with PX or EX, DEL and
+// QUIT.
+type RedisServer struct {
+	mu   sync.Mutex
+	keys map[string]memoryEntry
+}
+
+func NewRedisServer() *RedisServer {
+	return &RedisServer{keys: make(map[string]memoryEntry)}
+}
+
+// Serve serves connections from lis until it is closed.
+func (s *RedisServer) Serve(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *RedisServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	for {
+		v, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		if a, ok := v.([]interface{}); ok {
+			for _, arg := range a {
+				if s, ok := arg.(string); ok {
+					args = append(args, s)
+				}
+			}
+		}
+		if len(args) == 0 {
+			fmt.Fprint(w, "-ERR Protocol error\r\n")
+			w.Flush()
+			return
+		}
+		quit := strings.EqualFold(args[0], "QUIT")
+		s.exec(w, args)
+		if w.Flush() != nil || quit {
+			return
+		}
+	}
+}
+
+// exec runs a command and writes its reply.
+func (s *RedisServer) exec(w io.Writer, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmd := strings.ToUpper(args[0])
+	switch {
+	case cmd == "PING":
+		fmt.Fprint(w, "+PONG\r\n")
+	case cmd == "QUIT":
+		fmt.Fprint(w, "+OK\r\n")
+	case cmd == "GET" && len(args) == 2:
+		e, ok := s.keys[args[1]]
+		if !ok || !time.Now().Before(e.expires) {
+			fmt.Fprint(w, "$-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(e.data), e.data)
+	case cmd == "SET" && (len(args) == 3 || len(args) == 5):
+		// Keys without an expiry are kept for a year.
+		ttl := 365 * 24 * time.Hour
+		if len(args) == 5 {
+			n, err := strconv.ParseInt(args[4], 10, 64)
+			unit := map[string]time.Duration{"PX": time.Millisecond, "EX": time.Second}[strings.ToUpper(args[3])]
+			if err != nil || n <= 0 || unit == 0 {
+				fmt.Fprint(w, "-ERR syntax error\r\n")
+				return
+			}
+			ttl = time.Duration(n) * unit
+		}
+		s.keys[args[1]] = memoryEntry{data: []byte(args[2]), expires: time.Now().Add(ttl)}
+		fmt.Fprint(w, "+OK\r\n")
+	case cmd == "DEL" && len(args) >= 2:
+		n := 0
+		for _, k := range args[1:] {
+			if _, ok := s.keys[k]; ok {
+				delete(s.keys, k)
+				n++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", n)
+	case cmd == "GET" || cmd == "SET" || cmd == "DEL":
+		fmt.Fprintf(w, "-ERR wrong number of arguments for '%s' command\r\n", strings.ToLower(cmd))
+	default:
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", args[0])
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package session keeps the sessions of the frontend's visitors on the
+// server. The session cookie holds only the session ID, sealed with Keys so
+// that visitors can neither read it nor make one up; the session itself is
+// kept in a Store.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a visitor's session.
+type Session struct {
+	// ID identifies the session in the store. It changes when the session is
+	// renewed.
+	ID string `json:"-"`
+	// UserID identifies the visitor to the backend services, for instance as
+	// the owner of a cart. It does not change when the session is renewed.
+	UserID string `json:"user_id"`
+	// Values are what the frontend keeps about the visitor. Save the session
+	// after changing them.
+	Values  map[string]string `json:"values,omitempty"`
+	Created time.Time         `json:"created"`
+	Expires time.Time         `json:"expires"`
+}
+
+// Get returns the value of key, or "".
+func (s *Session) Get(key string) string { return s.Values[key] }
+
+// Set sets the value of key, or removes it if value is "".
+func (s *Session) Set(key, value string) {
+	if value == "" {
+		delete(s.Values, key)
+		return
+	}
+	if s.Values == nil {
+		s.Values = make(map[string]string)
+	}
+	s.Values[key] = value
+}
+
+// Manager loads and saves sessions, and sets their cookies.
+type Manager struct {
+	Store Store
+	Keys  *Keys
+
+	CookieName string
+	CookiePath string
+	// Secure marks the cookie Secure on plain HTTP requests too, as when TLS
+	// ends at a load balancer. It is always Secure on TLS requests.
+	Secure bool
+
+	// IdleTimeout is how long a session lasts without being used. Sessions
+	// used when less than half of it is left are renewed for another
+	// IdleTimeout.
+	IdleTimeout time.Duration
+	// NewUserID returns the user ID of new sessions. By default, it is a
+	// random UUID.
+	NewUserID func() string
+}
+
+// Load returns the session of the request's cookie, or a new session if the
+// cookie is missing, forged or expired. It sets the cookie of new and renewed
+// sessions on w.
+func (m *Manager) Load(w http.ResponseWriter, r *http.Request) (s *Session, created bool, err error) {
+	ctx := r.Context()
+	s, err = m.get(ctx, r)
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	if s == nil {
+		userID := uuid.NewString()
+		if m.NewUserID != nil {
+			userID = m.NewUserID()
+		}
+		s = &Session{ID: newID(), UserID: userID, Created: now}
+		created = true
+	} else if s.Expires.Sub(now) >= m.IdleTimeout/2 {
+		return s, false, nil
+	}
+	s.Expires = now.Add(m.IdleTimeout)
+	if err := m.Save(ctx, s); err != nil {
+		return nil, false, err
+	}
+	m.setCookie(w, r, s)
+	return s, created, nil
+}
+
+// get returns the session of the request's cookie, or nil.
+func (m *Manager) get(ctx context.Context, r *http.Request) (*Session, error) {
+	c, err := r.Cookie(m.CookieName)
+	if err != nil {
+		return nil, nil
+	}
+	id, err := m.Keys.Open(m.CookieName, c.Value)
+	if err != nil {
+		return nil, nil
+	}
+	data, err := m.Store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	s := &Session{ID: id}
+	if err := json.Unmarshal(data, s); err != nil {
+		// Not a session this version can read: start over.
+		return nil, nil
+	}
+	return s, nil
+}
+
+// Save saves the session in the store.
+func (m *Manager) Save(ctx context.Context, s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return m.Store.Set(ctx, s.ID, data, s.Expires)
+}
+
+// Renew moves the session to a new ID and extends it, as when the visitor
+// signs in, so that an ID learned before cannot be used after.
+func (m *Manager) Renew(w http.ResponseWriter, r *http.Request, s *Session) error {
+	old := s.ID
+	s.ID = newID()
+	s.Expires = time.Now().Add(m.IdleTimeout)
+	if err := m.Save(r.Context(), s); err != nil {
+		s.ID = old
+		return err
+	}
+	m.setCookie(w, r, s)
+	return m.Store.Delete(r.Context(), old)
+}
+
+// Destroy deletes the session and its cookie.
+func (m *Manager) Destroy(w http.ResponseWriter, r *http.Request, s *Session) error {
+	http.SetCookie(w, m.cookie(r, "", -1))
+	return m.Store.Delete(r.Context(), s.ID)
+}
+
+func (m *Manager) setCookie(w http.ResponseWriter, r *http.Request, s *Session) {
+	maxAge := int(time.Until(s.Expires) / time.Second)
+	http.SetCookie(w, m.cookie(r, m.Keys.Seal(m.CookieName, s.ID), maxAge))
+}
+
+func (m *Manager) cookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	path := m.CookiePath
+	if path == "" {
+		path = "/"
+	}
+	return &http.Cookie{
+		Name:     m.CookieName,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   m.Secure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// newID returns a random session ID, long enough not to be guessed.
+func newID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
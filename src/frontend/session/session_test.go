@@ -0,0 +1,281 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const cookieName = "shop_session-id"
+
+func newTestManager() *Manager {
+	return &Manager{
+		Store:       NewMemoryStore(),
+		Keys:        RandomKeys(),
+		CookieName:  cookieName,
+		IdleTimeout: time.Hour,
+	}
+}
+
+// load loads the session of a request with cookie c, which may be nil, and
+// returns the cookie set by the response, if any.
+func load(t *testing.T, m *Manager, c *http.Cookie) (*Session, bool, *http.Cookie) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if c != nil {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	s, created, err := m.Load(rr, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == cookieName {
+			set = c
+		}
+	}
+	return s, created, set
+}
+
+func TestKeys(t *testing.T) {
+	old, _ := NewKeys(bytes.Repeat([]byte{1}, 32))
+	sealed := old.Seal("a", "value")
+	if strings.Contains(sealed, "value") {
+		t.Errorf("sealed value %q is readable", sealed)
+	}
+	if v, err := old.Open("a", sealed); err != nil || v != "value" {
+		t.Errorf("Open() = %q, %v", v, err)
+	}
+	if _, err := old.Open("b", sealed); err == nil {
+		t.Error("a value sealed for one cookie opens for another")
+	}
+	if _, err := old.Open("a", sealed[:len(sealed)-2]+"AA"); err == nil {
+		t.Error("a tampered value opens")
+	}
+
+	rotated, err := ParseKeys(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)) + ", " +
+		base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := rotated.Open("a", sealed); err != nil || v != "value" {
+		t.Errorf("Open() with the old key second = %q, %v", v, err)
+	}
+	if _, err := old.Open("a", rotated.Seal("a", "value")); err == nil {
+		t.Error("a value sealed with the new key opens with the old one")
+	}
+
+	for _, s := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := ParseKeys(s); err == nil {
+			t.Errorf("ParseKeys(%q) succeeded", s)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	m := newTestManager()
+	s, created, c := load(t, m, nil)
+	if !created || s.UserID == "" || c == nil {
+		t.Fatalf("first Load() = %+v, created %v, cookie %v", s, created, c)
+	}
+	if !c.HttpOnly || c.SameSite != http.SameSiteLaxMode || c.Path != "/" || c.MaxAge <= 0 {
+		t.Errorf("cookie attributes = %+v", c)
+	}
+	if strings.Contains(c.Value, s.ID) {
+		t.Error("the cookie shows the session ID")
+	}
+
+	s.Set("currency", "EUR")
+	if err := m.Save(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	again, created, set := load(t, m, c)
+	if created || again.UserID != s.UserID || again.Get("currency") != "EUR" {
+		t.Errorf("second Load() = %+v, created %v", again, created)
+	}
+	if set != nil {
+		t.Errorf("a fresh session's cookie was set again: %v", set)
+	}
+
+	for name, c := range map[string]*http.Cookie{
+		"raw ID":       {Name: cookieName, Value: s.ID},
+		"guessed user": {Name: cookieName, Value: s.UserID},
+		"other keys":   {Name: cookieName, Value: RandomKeys().Seal(cookieName, s.ID)},
+	} {
+		if other, created, _ := load(t, m, c); !created || other.UserID == s.UserID {
+			t.Errorf("%s: Load() = %+v, created %v, want a new session", name, other, created)
+		}
+	}
+}
+
+func TestExpiryAndRenewal(t *testing.T) {
+	m := newTestManager()
+	s, _, c := load(t, m, nil)
+
+	// Past half of the idle timeout, the session is extended and its cookie
+	// set again.
+	s.Expires = time.Now().Add(20 * time.Minute)
+	m.Save(context.Background(), s)
+	renewed, created, set := load(t, m, c)
+	if created || renewed.UserID != s.UserID || set == nil || time.Until(renewed.Expires) < 50*time.Minute {
+		t.Errorf("Load() of an old session = %+v, created %v, cookie %v", renewed, created, set)
+	}
+
+	// Once expired, it is gone.
+	s.Expires = time.Now().Add(-time.Second)
+	m.Save(context.Background(), s)
+	if expired, created, _ := load(t, m, c); !created || expired.UserID == s.UserID {
+		t.Errorf("Load() of an expired session = %+v, created %v", expired, created)
+	}
+}
+
+func TestRenewAndDestroy(t *testing.T) {
+	m := newTestManager()
+	m.Secure = true
+	s, _, c := load(t, m, nil)
+	oldID, userID := s.ID, s.UserID
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rr := httptest.NewRecorder()
+	if err := m.Renew(rr, req, s); err != nil {
+		t.Fatal(err)
+	}
+	if s.ID == oldID || s.UserID != userID {
+		t.Errorf("renewed session = %+v", s)
+	}
+	renewed := rr.Result().Cookies()[0]
+	if !renewed.Secure {
+		t.Error("cookie is not Secure")
+	}
+	if old, created, _ := load(t, m, c); !created || old.UserID == userID {
+		t.Error("the cookie from before the renewal still works")
+	}
+	if got, created, _ := load(t, m, renewed); created || got.UserID != userID {
+		t.Errorf("Load() after Renew() = %+v, created %v", got, created)
+	}
+
+	rr = httptest.NewRecorder()
+	if err := m.Destroy(rr, req, s); err != nil {
+		t.Fatal(err)
+	}
+	if cleared := rr.Result().Cookies()[0]; cleared.MaxAge >= 0 {
+		t.Errorf("cookie after Destroy() = %+v", cleared)
+	}
+	if _, created, _ := load(t, m, renewed); !created {
+		t.Error("the session survived Destroy()")
+	}
+}
+
+func TestNewUserID(t *testing.T) {
+	m := newTestManager()
+	m.NewUserID = func() string { return "shared" }
+	a, _, _ := load(t, m, nil)
+	b, _, _ := load(t, m, nil)
+	if a.UserID != "shared" || b.UserID != "shared" || a.ID == b.ID {
+		t.Errorf("sessions = %+v, %+v", a, b)
+	}
+}
+
+func TestStores(t *testing.T) {
+	file, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go NewRedisServer().Serve(lis)
+
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   file,
+		"redis":  NewRedisStore(lis.Addr().String()),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			id := newID()
+			if _, err := store.Get(ctx, id); err != ErrNotFound {
+				t.Errorf("Get() of a missing session: %v, want ErrNotFound", err)
+			}
+			if err := store.Set(ctx, id, []byte(`{"user_id":"u"}`), time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			if data, err := store.Get(ctx, id); err != nil || string(data) != `{"user_id":"u"}` {
+				t.Errorf("Get() = %s, %v", data, err)
+			}
+			if err := store.Delete(ctx, id); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get(ctx, id); err != ErrNotFound {
+				t.Errorf("Get() after Delete(): %v, want ErrNotFound", err)
+			}
+
+			store.Set(ctx, id, []byte("{}"), time.Now().Add(50*time.Millisecond))
+			time.Sleep(100 * time.Millisecond)
+			if _, err := store.Get(ctx, id); err != ErrNotFound {
+				t.Errorf("Get() of an expired session: %v, want ErrNotFound", err)
+			}
+		})
+	}
+
+	if err := file.Set(context.Background(), "../escape", nil, time.Now().Add(time.Hour)); err == nil {
+		t.Error("the file store accepted an ID that is a path")
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	for _, spec := range []string{"", "memory", "file:" + t.TempDir(), "redis:localhost:6379"} {
+		if _, err := OpenStore(spec); err != nil {
+			t.Errorf("OpenStore(%q): %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"file:", "memcache:localhost:11211"} {
+		if _, err := OpenStore(spec); err == nil {
+			t.Errorf("OpenStore(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestRedisServerErrors(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go NewRedisServer().Serve(lis)
+	store := NewRedisStore(lis.Addr().String())
+	ctx := context.Background()
+
+	if _, err := store.do(ctx, "FLUSHALL"); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("FLUSHALL: %v", err)
+	}
+	// The connection is still usable after an error reply.
+	if reply, err := store.do(ctx, "PING"); err != nil || reply != "PONG" {
+		t.Errorf("PING = %v, %v", reply, err)
+	}
+}
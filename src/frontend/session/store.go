@@ -0,0 +1,239 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by stores for sessions that do not exist or have
+// expired.
+var ErrNotFound = errors.New("session: not found")
+
+// sweepInterval is how often the memory and file stores remove expired
+// sessions.
+const sweepInterval = time.Minute
+
+// Store keeps encoded sessions on the server, by session ID. A store must not
+// return a session after it expires.
+type Store interface {
+	Get(ctx context.Context, id string) ([]byte, error)
+	Set(ctx context.Context, id string, data []byte, expires time.Time) error
+	Delete(ctx context.Context, id string) error
+}
+
+// OpenStore opens the store described by spec, as in the SESSION_STORE
+// variable: "memory" (or ""), "file:<directory>" or "redis:<host:port>".
+func OpenStore(spec string) (Store, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "file":
+		return NewFileStore(arg)
+	case "redis":
+		return NewRedisStore(arg), nil
+	}
+	return nil, fmt.Errorf("session: unknown store %q", spec)
+}
+
+type memoryEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// MemoryStore keeps sessions in memory. They are lost on restart and not
+// shared between replicas.
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memoryEntry
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]memoryEntry), lastSweep: time.Now()}
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.sessions[id]
+	if !ok || !time.Now().Before(e.expires) {
+		return nil, ErrNotFound
+	}
+	return e.data, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, id string, data []byte, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		for id, e := range s.sessions {
+			if !now.Before(e.expires) {
+				delete(s.sessions, id)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.sessions[id] = memoryEntry{data: append([]byte(nil), data...), expires: expires}
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+// Len returns the number of sessions held, including expired ones not yet
+// removed.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// fileEntry is the content of a session file.
+type fileEntry struct {
+	Expires time.Time `json:"expires"`
+	Data    []byte    `json:"data"`
+}
+
+// FileStore keeps each session in a file of a directory, which replicas on
+// the same host can share.
+type FileStore struct {
+	dir string
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewFileStore returns a store in dir, which is created if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, errors.New("session: no directory for the file store")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, lastSweep: time.Now()}, nil
+}
+
+// path returns the file of session id. IDs are hex, so they cannot name a
+// file outside the directory.
+func (s *FileStore) path(id string) (string, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return "", fmt.Errorf("session: invalid session ID %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+func (s *FileStore) Get(_ context.Context, id string) ([]byte, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	e, err := readFileEntry(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(e.Expires) {
+		os.Remove(path)
+		return nil, ErrNotFound
+	}
+	return e.Data, nil
+}
+
+func (s *FileStore) Set(_ context.Context, id string, data []byte, expires time.Time) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	s.sweep()
+	b, err := json.Marshal(fileEntry{Expires: expires, Data: data})
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so readers never see a partial session.
+	f, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (s *FileStore) Delete(_ context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// sweep removes the files of expired sessions, at most once a sweepInterval.
+func (s *FileStore) sweep() {
+	s.mu.Lock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) <= sweepInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = now
+	s.mu.Unlock()
+
+	paths, _ := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	for _, path := range paths {
+		if e, err := readFileEntry(path); err == nil && !now.Before(e.Expires) {
+			os.Remove(path)
+		}
+	}
+}
+
+func readFileEntry(path string) (fileEntry, error) {
+	var e fileEntry
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return e, err
+	}
+	if err := json.Unmarshal(b, &e); err != nil {
+		return e, fmt.Errorf("session: corrupt session file %s: %w", path, err)
+	}
+	return e, nil
+}
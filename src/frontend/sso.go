@@ -0,0 +1,131 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/oidc"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/session"
+)
+
+// The session values kept while the visitor signs in with the identity
+// provider, which bind the callback to the session that started it.
+const (
+	sessionKeySSOState    = "sso_state"
+	sessionKeySSONonce    = "sso_nonce"
+	sessionKeySSOVerifier = "sso_verifier"
+	sessionKeySSONext     = "sso_next"
+)
+
+// ssoLoginHandler sends the visitor to sign in with the identity provider,
+// and to come back to the page in the next parameter.
+func (fe *frontendServer) ssoLoginHandler(w http.ResponseWriter, r *http.Request) {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	s, ok := r.Context().Value(ctxKeySession{}).(*session.Session)
+	if !ok {
+		renderHTTPError(log, r, w, errNoSession, http.StatusInternalServerError)
+		return
+	}
+	state, nonce, verifier := oidc.RandomString(), oidc.RandomString(), oidc.RandomString()
+	target, err := fe.sso.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		renderHTTPError(log, r, w, errors.Wrap(err, "identity provider unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+	s.Set(sessionKeySSOState, state)
+	s.Set(sessionKeySSONonce, nonce)
+	s.Set(sessionKeySSOVerifier, verifier)
+	s.Set(sessionKeySSONext, safeRedirectPath(r, r.FormValue("next")))
+	if err := fe.sessions.Save(r.Context(), s); err != nil {
+		renderHTTPError(log, r, w, errors.Wrap(err, "failed to save session"), http.StatusServiceUnavailable)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// ssoCallbackHandler finishes signing in: the identity provider sends the
+// visitor back here with a code, which is exchanged for an ID token naming
+// them. It only accepts the state given out to the same session, once.
+func (fe *frontendServer) ssoCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	log := r.Context().Value(ctxKeyLog{}).(logrus.FieldLogger)
+	s, ok := r.Context().Value(ctxKeySession{}).(*session.Session)
+	if !ok {
+		renderHTTPError(log, r, w, errNoSession, http.StatusInternalServerError)
+		return
+	}
+	state, nonce, verifier, next := s.Get(sessionKeySSOState), s.Get(sessionKeySSONonce),
+		s.Get(sessionKeySSOVerifier), s.Get(sessionKeySSONext)
+	for _, k := range []string{sessionKeySSOState, sessionKeySSONonce, sessionKeySSOVerifier, sessionKeySSONext} {
+		s.Set(k, "")
+	}
+	if err := fe.sessions.Save(r.Context(), s); err != nil {
+		renderHTTPError(log, r, w, errors.Wrap(err, "failed to save session"), http.StatusServiceUnavailable)
+		return
+	}
+
+	if state == "" || subtle.ConstantTimeCompare([]byte(r.FormValue("state")), []byte(state)) != 1 {
+		loginsTotal.WithLabelValues("invalid_credentials").Inc()
+		renderHTTPError(log, r, w, errors.New("sign-in expired or was not started from this browser, please try again"), http.StatusBadRequest)
+		return
+	}
+	if e := r.FormValue("error"); e != "" {
+		loginsTotal.WithLabelValues("invalid_credentials").Inc()
+		renderHTTPError(log, r, w, &oidc.Error{Code: e, Description: r.FormValue("error_description")}, http.StatusUnauthorized)
+		return
+	}
+	token, err := fe.sso.Exchange(r.Context(), r.FormValue("code"), verifier)
+	if err != nil {
+		loginsTotal.WithLabelValues("error").Inc()
+		code := http.StatusBadGateway
+		var oidcErr *oidc.Error
+		if errors.As(err, &oidcErr) {
+			code = http.StatusUnauthorized
+		}
+		renderHTTPError(log, r, w, errors.Wrap(err, "failed to sign in"), code)
+		return
+	}
+	claims, err := fe.sso.Verify(r.Context(), token.IDToken, nonce)
+	if err != nil {
+		loginsTotal.WithLabelValues("invalid_credentials").Inc()
+		renderHTTPError(log, r, w, errors.Wrap(err, "failed to sign in"), http.StatusUnauthorized)
+		return
+	}
+
+	email, name := "", claims.Name
+	if claims.EmailVerified {
+		email = claims.Email
+	}
+	if name == "" {
+		name = claims.Email
+	}
+	a, err := fe.accounts.SignInWith(r.Context(), claims.Issuer, claims.Subject, email, name)
+	if err != nil {
+		loginsTotal.WithLabelValues("error").Inc()
+		renderHTTPError(log, r, w, errors.Wrap(err, "failed to retrieve account"), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+	if err := fe.signIn(w, r, a); err != nil {
+		loginsTotal.WithLabelValues("error").Inc()
+		renderHTTPError(log, r, w, err, http.StatusServiceUnavailable)
+		return
+	}
+	loginsTotal.WithLabelValues("success").Inc()
+	localRedirect(w, r, next)
+}
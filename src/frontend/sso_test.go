@@ -0,0 +1,143 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/backendtest"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/cart"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/account"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/oidc"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/frontend/session"
+)
+
+func TestSSO(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := "http://" + lis.Addr().String()
+	provider := oidc.NewMockProvider(issuer, "storefront", "s3cret")
+	provider.SetUser(&oidc.MockUser{Subject: "staff-1", Email: "staff@example.com", Name: "Staff"})
+	idp := &http.Server{Handler: provider}
+	go idp.Serve(lis)
+	t.Cleanup(func() { idp.Close() })
+
+	srv := backendtest.NewServer(t)
+	fe := newTestFrontend(t)
+	fe.cartSvcConn = srv.Conn()
+	fe.sessions = newTestSessions()
+	store, _ := account.NewEmbeddedStore("")
+	fe.accounts = &account.Service{Store: store, HashCost: bcrypt.MinCost}
+	fe.sso = &oidc.Client{
+		Issuer:       issuer,
+		ClientID:     "storefront",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://example.com/auth/callback",
+	}
+	c := newAccountsClient(t, fe)
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	// signIn starts signing in from the storefront and returns the path of
+	// the callback the provider sends the browser back to.
+	signIn := func() string {
+		t.Helper()
+		rr := c.do(http.MethodGet, "/auth/login?next=/account", nil)
+		if rr.Code != http.StatusFound || !strings.HasPrefix(rr.Header().Get("Location"), issuer+"/authorize?") {
+			t.Fatalf("GET /auth/login returned %d to %q", rr.Code, rr.Header().Get("Location"))
+		}
+		resp, err := noRedirects.Get(rr.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil || callback.Path != "/auth/callback" {
+			t.Fatalf("provider returned %s to %q", resp.Status, resp.Header.Get("Location"))
+		}
+		return callback.RequestURI()
+	}
+
+	c.do(http.MethodGet, "/login", nil)
+	anonymous, anonymousCookie := c.userID, c.cookie
+	srv.Cart.Add(anonymous, cart.Item{ProductID: "mug", Quantity: 1})
+	callback := signIn()
+	rr := c.do(http.MethodGet, callback, nil)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/account" {
+		t.Fatalf("callback returned %d to %q: %s", rr.Code, rr.Header().Get("Location"), rr.Body)
+	}
+	if c.cookie == anonymousCookie {
+		t.Error("signing in kept the session ID")
+	}
+	a, err := fe.accounts.SignInWith(context.Background(), issuer, "staff-1", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Email != "staff@example.com" || a.Name != "Staff" {
+		t.Errorf("account = %+v", a)
+	}
+	if got, want := srv.Cart.Get(a.ID), []cart.Item{{ProductID: "mug", Quantity: 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("account cart = %v, want %v", got, want)
+	}
+	if rr := c.do(http.MethodGet, "/account", nil); rr.Code != http.StatusOK || c.userID != a.ID {
+		t.Errorf("GET /account returned %d as %s", rr.Code, c.userID)
+	}
+
+	// A callback is good once, and only in the session that started it.
+	if rr := c.do(http.MethodGet, callback, nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("replayed callback returned %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	callback = signIn()
+	other := &accountsClient{t: t, handler: c.handler}
+	if rr := other.do(http.MethodGet, callback, nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("callback in another session returned %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	u, _ := url.Parse(callback)
+	q := u.Query()
+	q.Set("code", "forged")
+	if rr := c.do(http.MethodGet, "/auth/callback?"+q.Encode(), nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("callback with a forged code returned %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	// The provider refusing is reported.
+	signIn()
+	q = url.Values{"error": {"access_denied"}, "state": {c.sessionValue(t, fe, sessionKeySSOState)}}
+	if rr := c.do(http.MethodGet, "/auth/callback?"+q.Encode(), nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("callback with an error returned %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+// sessionValue returns a value of the client's session.
+func (c *accountsClient) sessionValue(t *testing.T, fe *frontendServer, key string) string {
+	t.Helper()
+	var value string
+	h := fe.ensureSession(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		value = r.Context().Value(ctxKeySession{}).(*session.Session).Get(key)
+	}))
+	saved := c.handler
+	c.handler = h
+	defer func() { c.handler = saved }()
+	c.do(http.MethodGet, "/", nil)
+	return value
+}
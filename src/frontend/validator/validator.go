@@ -34,26 +34,71 @@ type Payload interface {
 	Validate() error
 }
 
+// The payloads are decoded from HTML forms and, using their JSON tags, from
+// requests to the JSON API.
 type AddToCartPayload struct {
-	Quantity  uint64 `validate:"required,gte=1,lte=10"`
-	ProductID string `validate:"required"`
+	Quantity   uint64 `json:"quantity" validate:"required,gte=1,lte=10"`
+	ProductID  string `json:"productId" validate:"required"`
+	VariantSKU string `json:"variantSku,omitempty" validate:"omitempty,printascii,excludes= ,max=64"`
+}
+
+// UpdateCartItemPayload sets the quantity of an item already in the cart. A
+// quantity of zero removes it.
+type UpdateCartItemPayload struct {
+	ProductID  string `json:"productId" validate:"required"`
+	VariantSKU string `json:"variantSku,omitempty" validate:"omitempty,printascii,excludes= ,max=64"`
+	Quantity   uint64 `json:"quantity" validate:"lte=10"`
+}
+
+type RemoveCartItemPayload struct {
+	ProductID  string `json:"productId" validate:"required"`
+	VariantSKU string `json:"variantSku,omitempty" validate:"omitempty,printascii,excludes= ,max=64"`
 }
 
 type PlaceOrderPayload struct {
-	Email         string `validate:"required,email"`
-	StreetAddress string `validate:"required,max=512"`
-	ZipCode       int64  `validate:"required"`
-	City          string `validate:"required,max=128"`
-	State         string `validate:"required,max=128"`
-	Country       string `validate:"required,max=128"`
-	CcNumber      string `validate:"required,credit_card"`
-	CcMonth       int64  `validate:"required,gte=1,lte=12"`
-	CcYear        int64  `validate:"required"`
-	CcCVV         int64  `validate:"required"`
+	Email         string `json:"email" validate:"required,email"`
+	StreetAddress string `json:"streetAddress" validate:"required,max=512"`
+	ZipCode       int64  `json:"zipCode" validate:"required"`
+	City          string `json:"city" validate:"required,max=128"`
+	State         string `json:"state" validate:"required,max=128"`
+	Country       string `json:"country" validate:"required,max=128"`
+	CcNumber      string `json:"creditCardNumber" validate:"required,credit_card"`
+	CcMonth       int64  `json:"creditCardExpirationMonth" validate:"required,gte=1,lte=12"`
+	CcYear        int64  `json:"creditCardExpirationYear" validate:"required"`
+	CcCVV         int64  `json:"creditCardCvv" validate:"required"`
 }
 
 type SetCurrencyPayload struct {
-	Currency string `validate:"required,iso4217"`
+	Currency string `json:"currency" validate:"required,iso4217"`
+}
+
+// RegisterPayload creates an account. Bcrypt reads no more than 72 bytes of
+// a password.
+type RegisterPayload struct {
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Name     string `json:"name" validate:"required,max=128"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+type LoginPayload struct {
+	Email    string `json:"email" validate:"required,max=254"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+// AddressPayload saves a shipping address to an account.
+type AddressPayload struct {
+	StreetAddress string `json:"streetAddress" validate:"required,max=512"`
+	ZipCode       int64  `json:"zipCode" validate:"required,gte=1,lte=2147483647"`
+	City          string `json:"city" validate:"required,max=128"`
+	State         string `json:"state" validate:"required,max=128"`
+	Country       string `json:"country" validate:"required,max=128"`
+}
+
+// ChatPayload is a message to the shopping assistant, optionally with a
+// picture of the shopper's room as a data URL.
+type ChatPayload struct {
+	Message string `json:"message" validate:"required,max=2000"`
+	Image   string `json:"image,omitempty" validate:"omitempty,startswith=data:image/,datauri"`
 }
 
 // Implementations of the 'Payload' interface.
@@ -61,6 +106,14 @@ func (ad *AddToCartPayload) Validate() error {
 	return validate.Struct(ad)
 }
 
+func (uc *UpdateCartItemPayload) Validate() error {
+	return validate.Struct(uc)
+}
+
+func (rc *RemoveCartItemPayload) Validate() error {
+	return validate.Struct(rc)
+}
+
 func (po *PlaceOrderPayload) Validate() error {
 	return validate.Struct(po)
 }
@@ -69,6 +122,22 @@ func (sc *SetCurrencyPayload) Validate() error {
 	return validate.Struct(sc)
 }
 
+func (rp *RegisterPayload) Validate() error {
+	return validate.Struct(rp)
+}
+
+func (lp *LoginPayload) Validate() error {
+	return validate.Struct(lp)
+}
+
+func (ap *AddressPayload) Validate() error {
+	return validate.Struct(ap)
+}
+
+func (cp *ChatPayload) Validate() error {
+	return validate.Struct(cp)
+}
+
 // Reusable error response function.
 func ValidationErrorResponse(err error) error {
 	validationErrs, ok := err.(validator.ValidationErrors)
@@ -105,16 +105,18 @@ func TestPlaceOrderFailsValidation(t *testing.T) {
 
 func TestAddToCartPassesValidation(t *testing.T) {
 	tests := []struct {
-		name      string
-		quantity  uint64
-		productID string
+		name       string
+		quantity   uint64
+		productID  string
+		variantSKU string
 	}{
-		{"valid min quantity and product id", 1, "OLJCESPC7Z"},
-		{"valid max quantity and product id", 10, "OLJCESPC7Z"},
+		{"valid min quantity and product id", 1, "OLJCESPC7Z", ""},
+		{"valid max quantity and product id", 10, "OLJCESPC7Z", ""},
+		{"valid variant sku", 1, "66VCHSJNUP", "66VCHSJNUP-M"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			payload := AddToCartPayload{Quantity: tt.quantity, ProductID: tt.productID}
+			payload := AddToCartPayload{Quantity: tt.quantity, ProductID: tt.productID, VariantSKU: tt.variantSKU}
 			if err := payload.Validate(); err != nil {
 				t.Errorf("want validation on %v, got %v", payload, err)
 			}
@@ -124,18 +126,21 @@ func TestAddToCartPassesValidation(t *testing.T) {
 
 func TestAddToCartFailsValidation(t *testing.T) {
 	tests := []struct {
-		name      string
-		quantity  uint64
-		productID string
+		name       string
+		quantity   uint64
+		productID  string
+		variantSKU string
 	}{
-		{"invalid min quantity", 0, "OLJCESPC7Z"},
-		{"invalid max quantity", 11, "OLJCESPC7Z"},
-		{"invalid product id", 1, ""},
-		{"invalid quantity and product id", 0, ""},
+		{"invalid min quantity", 0, "OLJCESPC7Z", ""},
+		{"invalid max quantity", 11, "OLJCESPC7Z", ""},
+		{"invalid product id", 1, "", ""},
+		{"invalid quantity and product id", 0, "", ""},
+		{"invalid variant sku (whitespace)", 1, "66VCHSJNUP", "66VCHSJNUP M"},
+		{"invalid variant sku (too long)", 1, "66VCHSJNUP", strings.Repeat("M", 65)},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			payload := AddToCartPayload{Quantity: tt.quantity, ProductID: tt.productID}
+			payload := AddToCartPayload{Quantity: tt.quantity, ProductID: tt.productID, VariantSKU: tt.variantSKU}
 			if err := payload.Validate(); err == nil {
 				t.Errorf("want validation on %v, got %v", payload, err)
 			}
@@ -143,6 +148,70 @@ func TestAddToCartFailsValidation(t *testing.T) {
 	}
 }
 
+func TestUpdateCartItemPassesValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		productID  string
+		variantSKU string
+		quantity   uint64
+	}{
+		{"valid quantity", "OLJCESPC7Z", "", 3},
+		{"valid zero quantity", "OLJCESPC7Z", "", 0},
+		{"valid variant sku", "66VCHSJNUP", "66VCHSJNUP-M", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := UpdateCartItemPayload{ProductID: tt.productID, VariantSKU: tt.variantSKU, Quantity: tt.quantity}
+			if err := payload.Validate(); err != nil {
+				t.Errorf("want validation on %v, got %v", payload, err)
+			}
+		})
+	}
+}
+
+func TestUpdateCartItemFailsValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		productID  string
+		variantSKU string
+		quantity   uint64
+	}{
+		{"invalid max quantity", "OLJCESPC7Z", "", 11},
+		{"invalid product id", "", "", 1},
+		{"invalid variant sku (whitespace)", "66VCHSJNUP", "66VCHSJNUP M", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := UpdateCartItemPayload{ProductID: tt.productID, VariantSKU: tt.variantSKU, Quantity: tt.quantity}
+			if err := payload.Validate(); err == nil {
+				t.Errorf("want validation on %v, got %v", payload, err)
+			}
+		})
+	}
+}
+
+func TestRemoveCartItemValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		productID  string
+		variantSKU string
+		wantErr    bool
+	}{
+		{"valid product id", "OLJCESPC7Z", "", false},
+		{"valid variant sku", "66VCHSJNUP", "66VCHSJNUP-M", false},
+		{"invalid product id", "", "", true},
+		{"invalid variant sku (too long)", "66VCHSJNUP", strings.Repeat("M", 65), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := RemoveCartItemPayload{ProductID: tt.productID, VariantSKU: tt.variantSKU}
+			if err := payload.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() on %v = %v, wantErr %v", payload, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestSetCurrencyPassesValidation(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -183,3 +252,69 @@ func TestSetCurrencyFailsValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestRegisterValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		userName string
+		password string
+		valid    bool
+	}{
+		{"valid", "ada@example.com", "Ada", "correct horse", true},
+		{"invalid email", "ada@example", "Ada", "correct horse", false},
+		{"no name", "ada@example.com", "", "correct horse", false},
+		{"short password", "ada@example.com", "Ada", "horse", false},
+		{"long password", "ada@example.com", "Ada", strings.Repeat("horse", 15), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := RegisterPayload{Email: tt.email, Name: tt.userName, Password: tt.password}
+			if err := payload.Validate(); (err == nil) != tt.valid {
+				t.Errorf("validating %v returned %v", payload, err)
+			}
+		})
+	}
+}
+
+func TestAddressValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload AddressPayload
+		valid   bool
+	}{
+		{"valid", AddressPayload{StreetAddress: "1600 Amphitheatre Parkway", ZipCode: 94043, City: "Mountain View", State: "CA", Country: "United States"}, true},
+		{"no street", AddressPayload{ZipCode: 94043, City: "Mountain View", State: "CA", Country: "United States"}, false},
+		{"zip code too large", AddressPayload{StreetAddress: "1600 Amphitheatre Parkway", ZipCode: 1 << 40, City: "Mountain View", State: "CA", Country: "United States"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.payload.Validate(); (err == nil) != tt.valid {
+				t.Errorf("validating %v returned %v", tt.payload, err)
+			}
+		})
+	}
+}
+
+func TestChatValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload ChatPayload
+		valid   bool
+	}{
+		{"message", ChatPayload{Message: "Which sunglasses suit me?"}, true},
+		{"with image", ChatPayload{Message: "What goes with this room?", Image: "data:image/png;base64,iVBORw0KGgo="}, true},
+		{"no message", ChatPayload{Image: "data:image/png;base64,iVBORw0KGgo="}, false},
+		{"message too long", ChatPayload{Message: strings.Repeat("a", 2001)}, false},
+		{"image URL", ChatPayload{Message: "this", Image: "https://example.com/room.png"}, false},
+		{"not an image", ChatPayload{Message: "this", Image: "data:text/html;base64,PGgxPg=="}, false},
+		{"not base64", ChatPayload{Message: "this", Image: "data:image/png;base64,<script>"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.payload.Validate(); (err == nil) != tt.valid {
+				t.Errorf("validating %v returned %v", tt.payload, err)
+			}
+		})
+	}
+}
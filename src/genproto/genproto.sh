@@ -14,12 +14,9 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
-# [START gke_frontend_genproto]
-
 PATH=$PATH:$(go env GOPATH)/bin
 protodir=../../protos
-outdir=./genproto
+outdir=.
 
-protoc --proto_path=$protodir --go_out=./$outdir --go_opt=paths=source_relative --go-grpc_out=./$outdir --go-grpc_opt=paths=source_relative $protodir/demo.proto
+protoc --proto_path=$protodir --go_out=$outdir --go_opt=paths=source_relative --go-grpc_out=$outdir --go-grpc_opt=paths=source_relative $protodir/demo.proto
 
-# [END gke_frontend_genproto]
\ No newline at end of file
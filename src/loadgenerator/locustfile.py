@@ -15,6 +15,7 @@
 # limitations under the License.
 
 import random
+import re
 from locust import FastHttpUser, TaskSet, between
 from faker import Faker
 import datetime
@@ -31,34 +32,57 @@ products = [
     'LS4PSXUNUM',
     'OLJCESPC7Z']
 
+# Products with variants must be added to the cart with a variant SKU.
+variants = {
+    '66VCHSJNUP': ['66VCHSJNUP-S', '66VCHSJNUP-M', '66VCHSJNUP-L'],
+    'L9ECAV7KIM': ['L9ECAV7KIM-41', 'L9ECAV7KIM-42'],
+}
+
+# Forms carry the session's CSRF token, which the frontend requires on posts.
+csrf_token = re.compile(r'name="csrf_token" value="([^"]*)"')
+
+def get(l, path):
+    response = l.client.get(path)
+    match = csrf_token.search(response.text or '')
+    if match:
+        l.csrf_token = match.group(1)
+
+def post(l, path, form=None):
+    form = dict(form or {})
+    form['csrf_token'] = getattr(l, 'csrf_token', '')
+    l.client.post(path, form)
+
 def index(l):
-    l.client.get("/")
+    get(l, "/")
 
 def setCurrency(l):
     currencies = ['EUR', 'USD', 'JPY', 'CAD', 'GBP', 'TRY']
-    l.client.post("/setCurrency",
+    post(l, "/setCurrency",
         {'currency_code': random.choice(currencies)})
 
 def browseProduct(l):
-    l.client.get("/product/" + random.choice(products))
+    get(l, "/product/" + random.choice(products))
 
 def viewCart(l):
-    l.client.get("/cart")
+    get(l, "/cart")
 
 def addToCart(l):
     product = random.choice(products)
-    l.client.get("/product/" + product)
-    l.client.post("/cart", {
+    get(l, "/product/" + product)
+    form = {
         'product_id': product,
-        'quantity': random.randint(1,10)})
+        'quantity': random.randint(1,10)}
+    if product in variants:
+        form['variant_sku'] = random.choice(variants[product])
+    post(l, "/cart", form)
     
 def empty_cart(l):
-    l.client.post('/cart/empty')
+    post(l, '/cart/empty')
 
 def checkout(l):
     addToCart(l)
     current_year = datetime.datetime.now().year+1
-    l.client.post("/cart/checkout", {
+    post(l, "/cart/checkout", {
         'email': fake.email(),
         'street_address': fake.street_address(),
         'zip_code': fake.zipcode(),
@@ -0,0 +1,177 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package money
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+)
+
+// RoundingMode selects how a result that falls between two representable
+// values is rounded.
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds to the nearest value, and ties to the even one
+	// ("banker's rounding").
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfAwayFromZero rounds to the nearest value, and ties away from
+	// zero. This is how most people round by hand.
+	RoundHalfAwayFromZero
+	// RoundTowardZero truncates.
+	RoundTowardZero
+	// RoundAwayFromZero rounds any remainder away from zero.
+	RoundAwayFromZero
+	// RoundFloor rounds toward negative infinity.
+	RoundFloor
+	// RoundCeiling rounds toward positive infinity.
+	RoundCeiling
+)
+
+func (r RoundingMode) String() string {
+	switch r {
+	case RoundHalfEven:
+		return "RoundHalfEven"
+	case RoundHalfAwayFromZero:
+		return "RoundHalfAwayFromZero"
+	case RoundTowardZero:
+		return "RoundTowardZero"
+	case RoundAwayFromZero:
+		return "RoundAwayFromZero"
+	case RoundFloor:
+		return "RoundFloor"
+	case RoundCeiling:
+		return "RoundCeiling"
+	}
+	return fmt.Sprintf("RoundingMode(%d)", int(r))
+}
+
+// addInt64 returns a+b and whether it did not overflow.
+func addInt64(a, b int64) (int64, bool) {
+	s := a + b
+	return s, (s > a) == (b > 0)
+}
+
+// abs returns |v| as a uint64, which is exact even for math.MinInt64.
+func abs(v int64) uint64 {
+	if v < 0 {
+		return uint64(-v)
+	}
+	return uint64(v)
+}
+
+// mul returns (units, nanos) * n for a valid amount, and whether the result
+// fits. It works on magnitudes with 128-bit intermediate products.
+func mul(units int64, nanos int32, n int64) (int64, int32, bool) {
+	negative := (units < 0 || nanos < 0) != (n < 0)
+	k := abs(n)
+
+	hi, lo := bits.Mul64(abs(int64(nanos)), k)
+	// hi < nanosMod because |nanos| < nanosMod, so the quotient fits.
+	carry, remNanos := bits.Div64(hi, lo, nanosMod)
+
+	uhi, ulo := bits.Mul64(abs(units), k)
+	if uhi != 0 {
+		return 0, 0, false
+	}
+	total, c := bits.Add64(ulo, carry, 0)
+	limit := uint64(math.MaxInt64)
+	if negative {
+		limit++ // math.MinInt64 has no positive counterpart
+	}
+	if c != 0 || total > limit {
+		return 0, 0, false
+	}
+
+	if negative {
+		return int64(-total), -int32(remNanos), true
+	}
+	return int64(total), int32(remNanos), true
+}
+
+var (
+	bigNanosMod = big.NewInt(nanosMod)
+	bigMaxNanos = new(big.Int).Add(new(big.Int).Mul(big.NewInt(math.MaxInt64), bigNanosMod), big.NewInt(nanosMax))
+	bigMinNanos = new(big.Int).Sub(new(big.Int).Mul(big.NewInt(math.MinInt64), bigNanosMod), big.NewInt(nanosMax))
+)
+
+func bigInt(v int64) *big.Int { return big.NewInt(v) }
+
+// toNanos returns a valid amount as a total number of nanos.
+func toNanos(m Money) *big.Int {
+	v := new(big.Int).Mul(big.NewInt(m.GetUnits()), bigNanosMod)
+	return v.Add(v, big.NewInt(int64(m.GetNanos())))
+}
+
+// fromNanos splits a total number of nanos into units and nanos with
+// matching signs, and reports whether the units fit in an int64.
+func fromNanos(v *big.Int) (int64, int32, bool) {
+	if v.Cmp(bigMaxNanos) > 0 || v.Cmp(bigMinNanos) < 0 {
+		return 0, 0, false
+	}
+	units, nanos := new(big.Int).QuoRem(v, bigNanosMod, new(big.Int))
+	return units.Int64(), int32(nanos.Int64()), true
+}
+
+// divRound returns x/d rounded with the given mode. d must not be zero.
+func divRound(x, d *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(x, d, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	// The exact quotient lies strictly between q and q+dir.
+	dir := int64(x.Sign() * d.Sign())
+
+	var away bool
+	switch mode {
+	case RoundTowardZero:
+	case RoundAwayFromZero:
+		away = true
+	case RoundFloor:
+		away = dir < 0
+	case RoundCeiling:
+		away = dir > 0
+	default:
+		twice := new(big.Int).Abs(r)
+		twice.Lsh(twice, 1)
+		switch c := twice.Cmp(new(big.Int).Abs(d)); {
+		case c > 0:
+			away = true
+		case c == 0:
+			away = mode == RoundHalfAwayFromZero || q.Bit(0) == 1
+		}
+	}
+	if away {
+		q.Add(q, big.NewInt(dir))
+	}
+	return q
+}
+
+// allocation describes n parts of a total: count parts are larger, the rest
+// are smaller.
+type allocation struct {
+	count  int
+	larger *big.Int
+}
+
+// allocate splits total into n parts differing by at most one, returning the
+// smaller part and which parts are larger. All parts have the sign of total.
+func allocate(total *big.Int, n int) (*big.Int, allocation) {
+	q, r := new(big.Int).QuoRem(total, big.NewInt(int64(n)), new(big.Int))
+	larger := new(big.Int).Add(q, big.NewInt(int64(total.Sign())))
+	return q, allocation{count: int(new(big.Int).Abs(r).Int64()), larger: larger}
+}
@@ -0,0 +1,229 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package money
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Currency describes how amounts in a currency are written.
+type Currency struct {
+	// Code is the ISO 4217 alphabetic code, e.g. "EUR".
+	Code string
+	// MinorUnits is the ISO 4217 exponent: the number of digits after the
+	// decimal separator (2 for cents, 0 for yen, 3 for fils).
+	MinorUnits int
+	// Symbol is written next to the amount, e.g. "€" or "kr".
+	Symbol string
+	// SymbolAfter places the symbol after the amount ("12,50 €") instead of
+	// before it ("$12.50").
+	SymbolAfter bool
+}
+
+// currencies holds the currencies offered by the currency service, and a few
+// others with unusual minor units.
+var currencies = map[string]Currency{
+	"AUD": {"AUD", 2, "A$", false},
+	"BGN": {"BGN", 2, "лв.", true},
+	"BHD": {"BHD", 3, "BD", false},
+	"BRL": {"BRL", 2, "R$", false},
+	"CAD": {"CAD", 2, "CA$", false},
+	"CHF": {"CHF", 2, "CHF", false},
+	"CLP": {"CLP", 0, "CLP$", false},
+	"CNY": {"CNY", 2, "CN¥", false},
+	"CZK": {"CZK", 2, "Kč", true},
+	"DKK": {"DKK", 2, "kr.", true},
+	"EUR": {"EUR", 2, "€", false},
+	"GBP": {"GBP", 2, "£", false},
+	"HKD": {"HKD", 2, "HK$", false},
+	"HRK": {"HRK", 2, "kn", true},
+	"HUF": {"HUF", 2, "Ft", true},
+	"IDR": {"IDR", 2, "Rp", false},
+	"ILS": {"ILS", 2, "₪", false},
+	"INR": {"INR", 2, "₹", false},
+	"ISK": {"ISK", 0, "kr", true},
+	"JOD": {"JOD", 3, "JD", false},
+	"JPY": {"JPY", 0, "¥", false},
+	"KRW": {"KRW", 0, "₩", false},
+	"KWD": {"KWD", 3, "KD", false},
+	"MXN": {"MXN", 2, "MX$", false},
+	"MYR": {"MYR", 2, "RM", false},
+	"NOK": {"NOK", 2, "kr", true},
+	"NZD": {"NZD", 2, "NZ$", false},
+	"PHP": {"PHP", 2, "₱", false},
+	"PLN": {"PLN", 2, "zł", true},
+	"RON": {"RON", 2, "lei", true},
+	"RUB": {"RUB", 2, "₽", true},
+	"SEK": {"SEK", 2, "kr", true},
+	"SGD": {"SGD", 2, "S$", false},
+	"THB": {"THB", 2, "฿", false},
+	"TND": {"TND", 3, "DT", false},
+	"TRY": {"TRY", 2, "₺", false},
+	"USD": {"USD", 2, "$", false},
+	"VND": {"VND", 0, "₫", true},
+	"ZAR": {"ZAR", 2, "R", false},
+}
+
+// LookupCurrency returns the metadata for an ISO 4217 code. For unknown codes
+// it returns a currency with two minor units that uses the code as its
+// symbol, and false.
+func LookupCurrency(code string) (Currency, bool) {
+	if c, ok := currencies[strings.ToUpper(code)]; ok {
+		return c, true
+	}
+	return Currency{Code: code, MinorUnits: 2, Symbol: code}, false
+}
+
+// Locale describes how numbers are written in a language or region.
+type Locale struct {
+	// Tag is the BCP 47 language tag, e.g. "de-CH".
+	Tag string
+	// Decimal separates the fraction from the whole part.
+	Decimal string
+	// Group separates groups of digits in the whole part.
+	Group string
+	// Grouping lists the sizes of digit groups from the right. The last
+	// size repeats, so {3} gives 1,234,567 and {3, 2} gives 12,34,567.
+	Grouping []int
+}
+
+// DefaultLocale is used when no better locale is known.
+var DefaultLocale = Locale{Tag: "en", Decimal: ".", Group: ",", Grouping: []int{3}}
+
+var locales = map[string]Locale{
+	"en":    DefaultLocale,
+	"en-IN": {"en-IN", ".", ",", []int{3, 2}},
+	"hi":    {"hi", ".", ",", []int{3, 2}},
+	"de":    {"de", ",", ".", []int{3}},
+	"de-CH": {"de-CH", ".", "’", []int{3}},
+	"es":    {"es", ",", ".", []int{3}},
+	"fr":    {"fr", ",", "\u202f", []int{3}},
+	"fr-CH": {"fr-CH", ",", "\u202f", []int{3}},
+	"it":    {"it", ",", ".", []int{3}},
+	"ja":    {"ja", ".", ",", []int{3}},
+	"ko":    {"ko", ".", ",", []int{3}},
+	"nl":    {"nl", ",", ".", []int{3}},
+	"pl":    {"pl", ",", "\u00a0", []int{3}},
+	"pt":    {"pt", ",", ".", []int{3}},
+	"ru":    {"ru", ",", "\u00a0", []int{3}},
+	"sv":    {"sv", ",", "\u00a0", []int{3}},
+	"tr":    {"tr", ",", ".", []int{3}},
+	"zh":    {"zh", ".", ",", []int{3}},
+}
+
+// LookupLocale returns the locale for a BCP 47 tag, falling back from a
+// regional tag to its language ("de-AT" to "de"). If neither is known it
+// returns DefaultLocale and false.
+func LookupLocale(tag string) (Locale, bool) {
+	tag = strings.ReplaceAll(tag, "_", "-")
+	for tag != "" {
+		for k, l := range locales {
+			if strings.EqualFold(k, tag) {
+				return l, true
+			}
+		}
+		i := strings.LastIndex(tag, "-")
+		if i < 0 {
+			break
+		}
+		tag = tag[:i]
+	}
+	return DefaultLocale, false
+}
+
+// RoundToMinorUnit rounds m to the minor unit of its currency, e.g. to whole
+// cents for USD or whole yen for JPY.
+func RoundToMinorUnit[T any, P Ptr[T]](m P, mode RoundingMode) (P, error) {
+	c, _ := LookupCurrency(m.GetCurrencyCode())
+	return Round(m, c.MinorUnits, mode)
+}
+
+// nbsp keeps the symbol on the same line as the amount.
+const nbsp = "\u00a0"
+
+// Format writes m for display in the given locale, rounded half-even to the
+// minor unit of its currency: "$1,234.50", "1 234,50 zł" in Polish, "¥1,235".
+func Format(m Money, loc Locale) (string, error) {
+	if !IsValid(m) {
+		return "", ErrInvalidValue
+	}
+	c, _ := LookupCurrency(m.GetCurrencyCode())
+	v := toNanos(m)
+	step := bigInt(pow10(9 - c.MinorUnits))
+	v = divRound(v, step, RoundHalfEven)
+
+	negative := v.Sign() < 0
+	digits := v.Abs(v).String()
+	if len(digits) <= c.MinorUnits {
+		digits = strings.Repeat("0", c.MinorUnits-len(digits)+1) + digits
+	}
+	whole, frac := digits[:len(digits)-c.MinorUnits], digits[len(digits)-c.MinorUnits:]
+
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	if !c.SymbolAfter {
+		b.WriteString(c.Symbol)
+		if r, _ := utf8.DecodeLastRuneInString(c.Symbol); unicode.IsLetter(r) {
+			b.WriteString(nbsp)
+		}
+	}
+	b.WriteString(group(whole, loc))
+	if frac != "" {
+		b.WriteString(loc.Decimal)
+		b.WriteString(frac)
+	}
+	if c.SymbolAfter {
+		b.WriteString(nbsp)
+		b.WriteString(c.Symbol)
+	}
+	return b.String(), nil
+}
+
+// group inserts the locale's group separator into a string of digits.
+func group(digits string, loc Locale) string {
+	sizes := loc.Grouping
+	if len(sizes) == 0 || loc.Group == "" {
+		return digits
+	}
+	var parts []string
+	for i := 0; len(digits) > 0; i++ {
+		size := sizes[len(sizes)-1]
+		if i < len(sizes) {
+			size = sizes[i]
+		}
+		if size <= 0 || size >= len(digits) {
+			parts = append(parts, digits)
+			break
+		}
+		parts = append(parts, digits[len(digits)-size:])
+		digits = digits[:len(digits)-size]
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, loc.Group)
+}
+
+func pow10(n int) int64 {
+	v := int64(1)
+	for ; n > 0; n-- {
+		v *= 10
+	}
+	return v
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package money
+
+import (
+	"testing"
+
+	pb "google.golang.org/genproto/googleapis/type/money"
+)
+
+func TestFormat(t *testing.T) {
+	en := DefaultLocale
+	de, _ := LookupLocale("de")
+	fr, _ := LookupLocale("fr")
+	in, _ := LookupLocale("en-IN")
+	tests := []struct {
+		name string
+		m    Money
+		loc  Locale
+		want string
+	}{
+		{"USD", mmc(10, 500000000, "USD"), en, "$10.50"},
+		{"EUR", mmc(25, 750000000, "EUR"), en, "€25.75"},
+		{"zero", mmc(0, 0, "USD"), en, "$0.00"},
+		{"cents only", mmc(0, 50000000, "USD"), en, "$0.05"},
+		{"grouping", mmc(1234567, 890000000, "USD"), en, "$1,234,567.89"},
+		{"round half even down", mmc(2, 125000000, "USD"), en, "$2.12"},
+		{"round half even up", mmc(2, 135000000, "USD"), en, "$2.14"},
+		{"round into units", mmc(9, 999000000, "USD"), en, "$10.00"},
+		{"negative", mmc(-1234, -500000000, "USD"), en, "-$1,234.50"},
+		{"JPY has no minor unit", mmc(1234, 500000000, "JPY"), en, "¥1,234"},
+		{"JPY rounds", mmc(1235, 500000000, "JPY"), en, "¥1,236"},
+		{"KWD has three digits", mmc(1, 234500000, "KWD"), en, "KD\u00a01.234"},
+		{"German separators", mmc(1234, 500000000, "EUR"), de, "€1.234,50"},
+		{"symbol after", mmc(1234, 500000000, "SEK"), de, "1.234,50\u00a0kr"},
+		{"French grouping", mmc(1234567, 0, "PLN"), fr, "1\u202f234\u202f567,00\u00a0zł"},
+		{"Indian grouping", mmc(12345678, 0, "INR"), in, "₹1,23,45,678.00"},
+		{"letter symbol", mmc(5, 0, "CHF"), en, "CHF\u00a05.00"},
+		{"unknown currency", mmc(5, 0, "XTS"), en, "XTS\u00a05.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format(tt.m, tt.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Format(%v, %s) = %q, want %q", tt.m, tt.loc.Tag, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Format(mm(1, -1), en); err != ErrInvalidValue {
+		t.Errorf("Format(invalid): expected ErrInvalidValue, got %v", err)
+	}
+}
+
+func TestLookupLocale(t *testing.T) {
+	tests := []struct {
+		tag     string
+		want    string
+		wantOk  bool
+		comment string
+	}{
+		{"en", "en", true, "exact"},
+		{"de-CH", "de-CH", true, "region"},
+		{"de-AT", "de", true, "region falls back to language"},
+		{"fr_FR", "fr", true, "underscore"},
+		{"EN-in", "en-IN", true, "case insensitive"},
+		{"zh-Hant-TW", "zh", true, "script and region"},
+		{"xx", "en", false, "unknown"},
+		{"", "en", false, "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.comment, func(t *testing.T) {
+			got, ok := LookupLocale(tt.tag)
+			if got.Tag != tt.want || ok != tt.wantOk {
+				t.Errorf("LookupLocale(%q) = %s, %v, want %s, %v", tt.tag, got.Tag, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestRoundToMinorUnit(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *pb.Money
+		want *pb.Money
+	}{
+		{"USD", mmc(1, 995000000, "USD"), mmc(2, 0, "USD")},
+		{"USD half even", mmc(1, 985000000, "USD"), mmc(1, 980000000, "USD")},
+		{"JPY", mmc(126, 400000000, "JPY"), mmc(126, 0, "JPY")},
+		{"KWD", mmc(0, 123450000, "KWD"), mmc(0, 123000000, "KWD")},
+		{"negative", mmc(-1, -995000000, "EUR"), mmc(-2, 0, "EUR")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RoundToMinorUnit(tt.in, RoundHalfEven)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !AreEquals(got, tt.want) {
+				t.Errorf("RoundToMinorUnit(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrSyntax is returned when text cannot be parsed as an amount.
+var ErrSyntax = errors.New("invalid money syntax")
+
+var (
+	// decimalPattern matches a decimal number as written in JSON, but also
+	// allowing a leading "+" and omitted digits on either side of the point.
+	decimalPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d{1,4})?$`)
+	currencyCode   = regexp.MustCompile(`^[A-Za-z]{3}$`)
+)
+
+// parseDecimal converts a decimal string to an exact number of nanos.
+func parseDecimal(s string) (*big.Int, error) {
+	if !decimalPattern.MatchString(s) {
+		return nil, ErrSyntax
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, ErrSyntax
+	}
+	r.Mul(r, new(big.Rat).SetInt(bigNanosMod))
+	if !r.IsInt() {
+		return nil, fmt.Errorf("%w: more than 9 fractional digits in %q", ErrSyntax, s)
+	}
+	return r.Num(), nil
+}
+
+// ParseDecimal returns the amount written as a decimal number, such as
+// "12.345" or "-1e3", in the given currency. The conversion is exact: it
+// fails with ErrSyntax if the number has more than nine fractional digits
+// and with ErrOverflow if it does not fit.
+func ParseDecimal[T any, P Ptr[T]](s, currencyCode string) (P, error) {
+	v, err := parseDecimal(s)
+	if err != nil {
+		return nil, err
+	}
+	units, nanos, ok := fromNanos(v)
+	if !ok {
+		return nil, ErrOverflow
+	}
+	return New[T, P](currencyCode, units, nanos), nil
+}
+
+// Parse returns the amount written as a decimal number with an ISO 4217
+// currency code before or after it, such as "12.345 EUR" or "USD -8.99". A
+// bare number has no currency code. Parse(String(m)) returns m for every
+// valid m.
+func Parse[T any, P Ptr[T]](s string) (P, error) {
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+		return ParseDecimal[T, P](fields[0], "")
+	case 2:
+		number, code := fields[0], fields[1]
+		if currencyCode.MatchString(number) {
+			number, code = code, number
+		}
+		if !currencyCode.MatchString(code) {
+			return nil, fmt.Errorf("%w: invalid currency code %q", ErrSyntax, code)
+		}
+		return ParseDecimal[T, P](number, strings.ToUpper(code))
+	}
+	return nil, ErrSyntax
+}
+
+// decimal writes a valid amount as a decimal number without trailing zeros.
+func decimal(m Money) string {
+	units, nanos := m.GetUnits(), m.GetNanos()
+	var b strings.Builder
+	if units < 0 || nanos < 0 {
+		b.WriteByte('-')
+	}
+	b.WriteString(strconv.FormatUint(abs(units), 10))
+	if nanos != 0 {
+		frac := fmt.Sprintf("%09d", abs(int64(nanos)))
+		b.WriteByte('.')
+		b.WriteString(strings.TrimRight(frac, "0"))
+	}
+	return b.String()
+}
+
+// String writes m as a decimal number followed by its currency code, such as
+// "12.345 EUR", using as few fractional digits as needed. Unlike Format, it
+// never rounds.
+func String(m Money) string {
+	if !IsValid(m) {
+		return fmt.Sprintf("invalid money (units=%d, nanos=%d, currency_code=%q)",
+			m.GetUnits(), m.GetNanos(), m.GetCurrencyCode())
+	}
+	if m.GetCurrencyCode() == "" {
+		return decimal(m)
+	}
+	return decimal(m) + " " + m.GetCurrencyCode()
+}
+
+// jsonMoney is the JSON encoding of an amount. The amount is a string so
+// that clients do not lose precision by decoding it as a float.
+type jsonMoney struct {
+	CurrencyCode string          `json:"currencyCode"`
+	Amount       json.RawMessage `json:"amount"`
+}
+
+// MarshalJSON encodes m as {"currencyCode": "EUR", "amount": "12.345"}.
+func MarshalJSON(m Money) ([]byte, error) {
+	if !IsValid(m) {
+		return nil, ErrInvalidValue
+	}
+	amount, _ := json.Marshal(decimal(m))
+	return json.Marshal(jsonMoney{CurrencyCode: m.GetCurrencyCode(), Amount: amount})
+}
+
+// UnmarshalJSON decodes an amount encoded by MarshalJSON. The amount may also
+// be a JSON number, which is read exactly rather than as a float, and the
+// whole value may be a string accepted by Parse.
+func UnmarshalJSON[T any, P Ptr[T]](data []byte) (P, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, err
+		}
+		return Parse[T, P](s)
+	}
+
+	var v jsonMoney
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if v.CurrencyCode != "" && !currencyCode.MatchString(v.CurrencyCode) {
+		return nil, fmt.Errorf("%w: invalid currency code %q", ErrSyntax, v.CurrencyCode)
+	}
+	amount := string(bytes.TrimSpace(v.Amount))
+	if strings.HasPrefix(amount, `"`) {
+		if err := json.Unmarshal(v.Amount, &amount); err != nil {
+			return nil, err
+		}
+	}
+	return ParseDecimal[T, P](amount, strings.ToUpper(v.CurrencyCode))
+}
@@ -0,0 +1,182 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	pb "google.golang.org/genproto/googleapis/type/money"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    *pb.Money
+		wantErr error
+	}{
+		{"12.345 EUR", mmc(12, 345000000, "EUR"), nil},
+		{"EUR 12.345", mmc(12, 345000000, "EUR"), nil},
+		{"  8.99\tusd ", mmc(8, 990000000, "USD"), nil},
+		{"-0.5 USD", mmc(0, -500000000, "USD"), nil},
+		{"+3 JPY", mmc(3, 0, "JPY"), nil},
+		{".5 USD", mmc(0, 500000000, "USD"), nil},
+		{"5. USD", mmc(5, 0, "USD"), nil},
+		{"1.5e3 USD", mmc(1500, 0, "USD"), nil},
+		{"1E-9 USD", mmc(0, 1, "USD"), nil},
+		{"0.000000001", mm(0, 1), nil},
+		{"-0", mm(0, 0), nil},
+		{"9223372036854775807.999999999 USD", mmc(math.MaxInt64, 999999999, "USD"), nil},
+		{"-9223372036854775808.999999999 USD", mmc(math.MinInt64, -999999999, "USD"), nil},
+		{"9223372036854775808 USD", nil, ErrOverflow},
+		{"1e19 USD", nil, ErrOverflow},
+		{"0.0000000001 USD", nil, ErrSyntax},
+		{"1e-10 USD", nil, ErrSyntax},
+		{"", nil, ErrSyntax},
+		{"USD", nil, ErrSyntax},
+		{"12 EURO", nil, ErrSyntax},
+		{"1,234.00 USD", nil, ErrSyntax},
+		{"0x10 USD", nil, ErrSyntax},
+		{"1/3 USD", nil, ErrSyntax},
+		{"Inf USD", nil, ErrSyntax},
+		{"1 2 USD", nil, ErrSyntax},
+		{"1e99999 USD", nil, ErrSyntax},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse[pb.Money](tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse(%q): expected err=%v got=%v", tt.in, tt.wantErr, err)
+			}
+			if (got == nil) != (tt.want == nil) || got != nil && !AreEquals(got, tt.want) {
+				t.Errorf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   *pb.Money
+		want string
+	}{
+		{mmc(12, 345000000, "EUR"), "12.345 EUR"},
+		{mmc(8, 50000000, "USD"), "8.05 USD"},
+		{mmc(0, -1, "USD"), "-0.000000001 USD"},
+		{mmc(-3, 0, "JPY"), "-3 JPY"},
+		{mm(0, 0), "0"},
+		{mmc(math.MinInt64, -999999999, "USD"), "-9223372036854775808.999999999 USD"},
+		{mmc(1, -1, "USD"), `invalid money (units=1, nanos=-1, currency_code="USD")`},
+	}
+	for _, tt := range tests {
+		if got := String(tt.in); got != tt.want {
+			t.Errorf("String(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	b, err := MarshalJSON(mmc(-12, -345000000, "EUR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"currencyCode":"EUR","amount":"-12.345"}`; got != want {
+		t.Errorf("MarshalJSON() = %s, want %s", got, want)
+	}
+	if _, err := MarshalJSON(mm(1, -1)); err != ErrInvalidValue {
+		t.Errorf("MarshalJSON(invalid): expected ErrInvalidValue, got %v", err)
+	}
+
+	tests := []struct {
+		in      string
+		want    *pb.Money
+		wantErr bool
+	}{
+		{`{"currencyCode":"EUR","amount":"-12.345"}`, mmc(-12, -345000000, "EUR"), false},
+		{`{"currencyCode":"usd","amount":8.99}`, mmc(8, 990000000, "USD"), false},
+		{`{"currencyCode":"USD","amount":0.1}`, mmc(0, 100000000, "USD"), false},
+		{`{"currencyCode":"USD","amount":1e2}`, mmc(100, 0, "USD"), false},
+		{`{"currencyCode":"USD","amount":9007199254740993}`, mmc(9007199254740993, 0, "USD"), false},
+		{`"12.345 EUR"`, mmc(12, 345000000, "EUR"), false},
+		{`{"amount":"1"}`, mm(1, 0), false},
+		{`{"currencyCode":"USD"}`, nil, true},
+		{`{"currencyCode":"USD","amount":"1.0000000001"}`, nil, true},
+		{`{"currencyCode":"US","amount":"1"}`, nil, true},
+		{`{"currencyCode":"USD","amount":true}`, nil, true},
+		{`[1]`, nil, true},
+		{`"abc"`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := UnmarshalJSON[pb.Money]([]byte(tt.in))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalJSON(%s): unexpected err=%v", tt.in, err)
+			}
+			if (got == nil) != (tt.want == nil) || got != nil && !AreEquals(got, tt.want) {
+				t.Errorf("UnmarshalJSON(%s) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// FuzzStringRoundTrip checks that every valid value survives String/Parse and
+// MarshalJSON/UnmarshalJSON unchanged.
+func FuzzStringRoundTrip(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, u int64, n int32, _ int64, code int32) {
+		m := mmc(u, n, []string{"", "USD", "JPY", "KWD"}[uint32(code)%4])
+		if !IsValid(m) {
+			return
+		}
+		got, err := Parse[pb.Money](String(m))
+		if err != nil || !AreEquals(got, m) {
+			t.Fatalf("Parse(String(%v)) = %v, %v", m, got, err)
+		}
+		b, err := MarshalJSON(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = UnmarshalJSON[pb.Money](b)
+		if err != nil || !AreEquals(got, m) {
+			t.Fatalf("UnmarshalJSON(%s) = %v, %v, want %v", b, got, err, m)
+		}
+	})
+}
+
+// FuzzParse checks that anything Parse accepts is valid and is written back
+// in a canonical form that parses to the same value.
+func FuzzParse(f *testing.F) {
+	for _, s := range []string{"12.345 EUR", "USD -8.99", "1e3", ".5", "-0.000000001 JPY", "9223372036854775807.999999999"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		m, err := Parse[pb.Money](s)
+		if err != nil {
+			return
+		}
+		if !IsValid(m) {
+			t.Fatalf("Parse(%q) = %v is invalid", s, m)
+		}
+		canonical := String(m)
+		again, err := Parse[pb.Money](canonical)
+		if err != nil || !AreEquals(again, m) {
+			t.Fatalf("Parse(%q) = %v, but Parse(%q) = %v, %v", s, m, canonical, again, err)
+		}
+		if String(again) != canonical {
+			t.Fatalf("String is not canonical: %q then %q", canonical, String(again))
+		}
+	})
+}
@@ -0,0 +1,194 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package money
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	pb "google.golang.org/genproto/googleapis/type/money"
+)
+
+// The fuzz tests check results against exact arithmetic on the total number
+// of nanos, and that every successful result is a valid value.
+
+func addSeeds(f *testing.F) {
+	f.Add(int64(0), int32(0), int64(0), int32(0))
+	f.Add(int64(2), int32(200000000), int64(2), int32(900000000))
+	f.Add(int64(-11), int32(-100000000), int64(2), int32(9000000))
+	f.Add(int64(math.MaxInt64), int32(999999999), int64(1), int32(0))
+	f.Add(int64(math.MinInt64), int32(-999999999), int64(-1), int32(-1))
+	f.Add(int64(1), int32(-1), int64(0), int32(0))
+}
+
+func checkResult(t *testing.T, op string, got *pb.Money, err error, want *big.Int) {
+	t.Helper()
+	_, _, fits := fromNanos(want)
+	if !fits {
+		if err != ErrOverflow {
+			t.Fatalf("%s: expected ErrOverflow for %v, got %v, %v", op, want, got, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("%s: unexpected error %v (want %v)", op, err, want)
+	}
+	if !IsValid(got) {
+		t.Fatalf("%s: invalid result %v", op, got)
+	}
+	if toNanos(got).Cmp(want) != 0 {
+		t.Fatalf("%s = %v, want %v nanos", op, got, want)
+	}
+}
+
+func FuzzSum(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, lu int64, ln int32, ru int64, rn int32) {
+		l, r := mm(lu, ln), mm(ru, rn)
+		got, err := Sum(l, r)
+		if !IsValid(l) || !IsValid(r) {
+			if err != ErrInvalidValue {
+				t.Fatalf("Sum(%v, %v): expected ErrInvalidValue, got %v", l, r, err)
+			}
+			return
+		}
+		checkResult(t, "Sum", got, err, new(big.Int).Add(toNanos(l), toNanos(r)))
+
+		got, err = Subtract(l, r)
+		checkResult(t, "Subtract", got, err, new(big.Int).Sub(toNanos(l), toNanos(r)))
+	})
+}
+
+func FuzzMultiply(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, u int64, n int32, k int64, _ int32) {
+		m := mm(u, n)
+		got, err := Multiply(m, k)
+		if !IsValid(m) {
+			if err != ErrInvalidValue {
+				t.Fatalf("Multiply(%v, %d): expected ErrInvalidValue, got %v", m, k, err)
+			}
+			return
+		}
+		checkResult(t, "Multiply", got, err, new(big.Int).Mul(toNanos(m), big.NewInt(k)))
+	})
+}
+
+func FuzzDivide(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, u int64, n int32, k int64, mode int32) {
+		m := mm(u, n)
+		if !IsValid(m) || k == 0 {
+			return
+		}
+		rm := RoundingMode(uint32(mode) % 6)
+		got, err := Divide(m, k, rm)
+		if err == ErrOverflow {
+			// Only dividing the most negative amount by -1 can overflow.
+			if k != -1 {
+				t.Fatalf("Divide(%v, %d): unexpected overflow", m, k)
+			}
+			return
+		}
+		if err != nil || !IsValid(got) {
+			t.Fatalf("Divide(%v, %d, %v) = %v, %v", m, k, rm, got, err)
+		}
+		// The result must be within one nano of the exact quotient.
+		diff := new(big.Int).Mul(toNanos(got), big.NewInt(k))
+		diff.Sub(diff, toNanos(m)).Abs(diff)
+		if diff.Cmp(new(big.Int).Abs(big.NewInt(k))) >= 0 {
+			t.Fatalf("Divide(%v, %d, %v) = %v is off by more than one nano", m, k, rm, got)
+		}
+	})
+}
+
+func FuzzAllocate(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, u int64, n int32, k int64, _ int32) {
+		m := mm(u, n)
+		parts := int(uint64(k)%100) + 1
+		if !IsValid(m) {
+			return
+		}
+		got, err := Allocate(m, parts)
+		if err != nil || len(got) != parts {
+			t.Fatalf("Allocate(%v, %d) = %v, %v", m, parts, got, err)
+		}
+		sum := new(big.Int)
+		for i, p := range got {
+			if !IsValid(p) {
+				t.Fatalf("Allocate(%v, %d): invalid part %v", m, parts, p)
+			}
+			if IsNegative(p) && IsPositive(m) || IsPositive(p) && IsNegative(m) {
+				t.Fatalf("Allocate(%v, %d): part %v has the wrong sign", m, parts, p)
+			}
+			if i > 0 {
+				d := new(big.Int).Sub(toNanos(got[i-1]), toNanos(p))
+				if d.Abs(d).Cmp(big.NewInt(1)) > 0 {
+					t.Fatalf("Allocate(%v, %d): parts %v and %v differ by more than one nano", m, parts, got[i-1], p)
+				}
+			}
+			sum.Add(sum, toNanos(p))
+		}
+		if sum.Cmp(toNanos(m)) != 0 {
+			t.Fatalf("Allocate(%v, %d): parts add up to %v nanos", m, parts, sum)
+		}
+	})
+}
+
+func FuzzRound(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, u int64, n int32, digits int64, mode int32) {
+		m := mm(u, n)
+		if !IsValid(m) {
+			return
+		}
+		d := int(uint64(digits) % 10)
+		rm := RoundingMode(uint32(mode) % 6)
+		got, err := Round(m, d, rm)
+		if err == ErrOverflow {
+			return
+		}
+		if err != nil || !IsValid(got) {
+			t.Fatalf("Round(%v, %d, %v) = %v, %v", m, d, rm, got, err)
+		}
+		step := int64(math.Pow10(9 - d))
+		if got.GetNanos()%int32(step) != 0 {
+			t.Fatalf("Round(%v, %d, %v) = %v has more than %d digits", m, d, rm, got, d)
+		}
+		diff := new(big.Int).Sub(toNanos(got), toNanos(m))
+		if diff.Abs(diff).Cmp(big.NewInt(step)) >= 0 {
+			t.Fatalf("Round(%v, %d, %v) = %v moved by a whole step or more", m, d, rm, got)
+		}
+	})
+}
+
+func FuzzCompare(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, lu int64, ln int32, ru int64, rn int32) {
+		l, r := mm(lu, ln), mm(ru, rn)
+		if !IsValid(l) || !IsValid(r) {
+			return
+		}
+		got, err := Compare(l, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := toNanos(l).Cmp(toNanos(r)); got != want {
+			t.Fatalf("Compare(%v, %v) = %d, want %d", l, r, got, want)
+		}
+	})
+}
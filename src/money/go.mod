@@ -0,0 +1,10 @@
+module github.com/GoogleCloudPlatform/microservices-demo/src/money
+
+go 1.25.0
+
+toolchain go1.26.5
+
+require (
+	google.golang.org/genproto v0.0.0-20260319201613-d00831a3d3e7
+	google.golang.org/protobuf v1.36.11
+)
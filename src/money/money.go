@@ -0,0 +1,293 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package money implements arithmetic on Money protocol buffer messages.
+//
+// The functions here are generic over any message with the currency_code,
+// units and nanos fields of google.type.Money, such as the hipstershop Money
+// message and google.type.Money itself. Functions returning money build a
+// new message of the caller's type and never modify their arguments.
+//
+// A value is valid if its nanos are within ±999,999,999 and have the same
+// sign as its units (or either is zero). Operations fail with
+// ErrInvalidValue on invalid input and with ErrOverflow if the result does
+// not fit in int64 units; they never produce an invalid value.
+package money
+
+import (
+	"errors"
+	"math"
+	"math/big"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	nanosMin = -999999999
+	nanosMax = +999999999
+	nanosMod = 1000000000
+)
+
+var (
+	ErrInvalidValue        = errors.New("one of the specified money values is invalid")
+	ErrMismatchingCurrency = errors.New("mismatching currency codes")
+	ErrOverflow            = errors.New("money value out of range")
+	ErrDivideByZero        = errors.New("division by zero")
+	ErrInvalidParts        = errors.New("number of parts must be positive")
+)
+
+// Money is implemented by the generated Money message of the genproto package,
+// and by google.type.Money.
+type Money interface {
+	proto.Message
+	GetCurrencyCode() string
+	GetUnits() int64
+	GetNanos() int32
+}
+
+// Ptr constrains a type parameter to a pointer to a generated Money message,
+// so that functions can return values of the caller's type.
+type Ptr[T any] interface {
+	*T
+	Money
+}
+
+// New returns a money value of type P. It does not check validity.
+func New[T any, P Ptr[T]](currencyCode string, units int64, nanos int32) P {
+	p := P(new(T))
+	m := p.ProtoReflect()
+	fields := m.Descriptor().Fields()
+	m.Set(fields.ByName("currency_code"), protoreflect.ValueOfString(currencyCode))
+	m.Set(fields.ByName("units"), protoreflect.ValueOfInt64(units))
+	m.Set(fields.ByName("nanos"), protoreflect.ValueOfInt32(nanos))
+	return p
+}
+
+// IsValid checks if specified value has a valid units/nanos signs and ranges.
+func IsValid(m Money) bool {
+	return signMatches(m) && validNanos(m.GetNanos())
+}
+
+func signMatches(m Money) bool {
+	return m.GetNanos() == 0 || m.GetUnits() == 0 || (m.GetNanos() < 0) == (m.GetUnits() < 0)
+}
+
+func validNanos(nanos int32) bool { return nanosMin <= nanos && nanos <= nanosMax }
+
+// IsZero returns true if the specified money value is equal to zero.
+func IsZero(m Money) bool { return m.GetUnits() == 0 && m.GetNanos() == 0 }
+
+// IsPositive returns true if the specified money value is valid and is
+// positive.
+func IsPositive(m Money) bool {
+	return IsValid(m) && (m.GetUnits() > 0 || (m.GetUnits() == 0 && m.GetNanos() > 0))
+}
+
+// IsNegative returns true if the specified money value is valid and is
+// negative.
+func IsNegative(m Money) bool {
+	return IsValid(m) && (m.GetUnits() < 0 || (m.GetUnits() == 0 && m.GetNanos() < 0))
+}
+
+// AreSameCurrency returns true if values l and r have a currency code and
+// they are the same values.
+func AreSameCurrency(l, r Money) bool {
+	return l.GetCurrencyCode() == r.GetCurrencyCode() && l.GetCurrencyCode() != ""
+}
+
+// AreEquals returns true if values l and r are the equal, including the
+// currency. This does not check validity of the provided values.
+func AreEquals(l, r Money) bool {
+	return l.GetCurrencyCode() == r.GetCurrencyCode() &&
+		l.GetUnits() == r.GetUnits() && l.GetNanos() == r.GetNanos()
+}
+
+// Compare returns -1, 0 or +1 depending on whether l is less than, equal to
+// or greater than r. Both values must be valid and have the same currency
+// code.
+func Compare(l, r Money) (int, error) {
+	if !IsValid(l) || !IsValid(r) {
+		return 0, ErrInvalidValue
+	} else if l.GetCurrencyCode() != r.GetCurrencyCode() {
+		return 0, ErrMismatchingCurrency
+	}
+	// Valid values have matching signs, so comparing units then nanos
+	// orders them correctly.
+	switch {
+	case l.GetUnits() < r.GetUnits():
+		return -1, nil
+	case l.GetUnits() > r.GetUnits():
+		return +1, nil
+	case l.GetNanos() < r.GetNanos():
+		return -1, nil
+	case l.GetNanos() > r.GetNanos():
+		return +1, nil
+	}
+	return 0, nil
+}
+
+// Less reports whether l is less than r. See Compare.
+func Less(l, r Money) (bool, error) {
+	c, err := Compare(l, r)
+	return c < 0, err
+}
+
+// Greater reports whether l is greater than r. See Compare.
+func Greater(l, r Money) (bool, error) {
+	c, err := Compare(l, r)
+	return c > 0, err
+}
+
+// Negate returns the same amount with the sign negated. The result is
+// unspecified for units equal to math.MinInt64; use Subtract to detect that
+// overflow.
+func Negate[T any, P Ptr[T]](m P) P {
+	return New[T, P](m.GetCurrencyCode(), -m.GetUnits(), -m.GetNanos())
+}
+
+// Must panics if the given error is not nil. This can be used with other
+// functions like: "m := Must(Sum(a,b))".
+func Must[T any, P Ptr[T]](v P, err error) P {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Sum adds two values. Returns an error if one of the values are invalid or
+// currency codes are not matching (unless currency code is unspecified for
+// both).
+func Sum[T any, P Ptr[T]](l, r P) (P, error) {
+	if !IsValid(l) || !IsValid(r) {
+		return nil, ErrInvalidValue
+	} else if l.GetCurrencyCode() != r.GetCurrencyCode() {
+		return nil, ErrMismatchingCurrency
+	}
+	units, ok := addInt64(l.GetUnits(), r.GetUnits())
+	if !ok {
+		return nil, ErrOverflow
+	}
+	nanos := l.GetNanos() + r.GetNanos()
+
+	if units == 0 || (units > 0 && nanos >= 0) || (units < 0 && nanos <= 0) {
+		// same sign <units, nanos>
+		if units, ok = addInt64(units, int64(nanos/nanosMod)); !ok {
+			return nil, ErrOverflow
+		}
+		nanos = nanos % nanosMod
+	} else {
+		// different sign. nanos guaranteed to not to go over the limit
+		if units > 0 {
+			units--
+			nanos += nanosMod
+		} else {
+			units++
+			nanos -= nanosMod
+		}
+	}
+
+	return New[T, P](l.GetCurrencyCode(), units, nanos), nil
+}
+
+// Subtract returns l-r. It fails like Sum.
+func Subtract[T any, P Ptr[T]](l, r P) (P, error) {
+	if !IsValid(l) || !IsValid(r) {
+		return nil, ErrInvalidValue
+	} else if r.GetUnits() == math.MinInt64 {
+		return nil, ErrOverflow
+	}
+	return Sum(l, Negate(r))
+}
+
+// Multiply returns m*n, computed exactly in constant time.
+func Multiply[T any, P Ptr[T]](m P, n int64) (P, error) {
+	if !IsValid(m) {
+		return nil, ErrInvalidValue
+	}
+	units, nanos, ok := mul(m.GetUnits(), m.GetNanos(), n)
+	if !ok {
+		return nil, ErrOverflow
+	}
+	return New[T, P](m.GetCurrencyCode(), units, nanos), nil
+}
+
+// Divide returns m/n, rounded to whole nanos with the given rounding mode.
+func Divide[T any, P Ptr[T]](m P, n int64, mode RoundingMode) (P, error) {
+	if !IsValid(m) {
+		return nil, ErrInvalidValue
+	} else if n == 0 {
+		return nil, ErrDivideByZero
+	}
+	units, nanos, ok := fromNanos(divRound(toNanos(m), bigInt(n), mode))
+	if !ok {
+		return nil, ErrOverflow
+	}
+	return New[T, P](m.GetCurrencyCode(), units, nanos), nil
+}
+
+// Allocate splits m into n parts that add up to exactly m. The parts differ
+// by at most one nano; larger parts (by magnitude) come first. For example
+// $10 split three ways is $3.333333334, $3.333333333 and $3.333333333.
+func Allocate[T any, P Ptr[T]](m P, n int) ([]P, error) {
+	if !IsValid(m) {
+		return nil, ErrInvalidValue
+	} else if n < 1 {
+		return nil, ErrInvalidParts
+	}
+	quo, rem := allocate(toNanos(m), n)
+	parts := make([]P, n)
+	for i := range parts {
+		v := quo
+		if i < rem.count {
+			v = rem.larger
+		}
+		units, nanos, _ := fromNanos(v) // |v| <= |m|, so it always fits
+		parts[i] = New[T, P](m.GetCurrencyCode(), units, nanos)
+	}
+	return parts, nil
+}
+
+// Round rounds m to the given number of fractional digits (0 to 9) using the
+// given rounding mode. Round(m, 2, RoundHalfEven) rounds to whole cents.
+func Round[T any, P Ptr[T]](m P, digits int, mode RoundingMode) (P, error) {
+	if !IsValid(m) {
+		return nil, ErrInvalidValue
+	} else if digits < 0 || digits > 9 {
+		return nil, errors.New("digits must be between 0 and 9")
+	}
+	step := bigInt(pow10(9 - digits))
+	rounded := divRound(toNanos(m), step, mode)
+	units, nanos, ok := fromNanos(rounded.Mul(rounded, step))
+	if !ok {
+		return nil, ErrOverflow
+	}
+	return New[T, P](m.GetCurrencyCode(), units, nanos), nil
+}
+
+// Scale returns m*r for an exact rational factor r, such as an exchange
+// rate, rounded to whole nanos with the given rounding mode.
+func Scale[T any, P Ptr[T]](m P, r *big.Rat, mode RoundingMode) (P, error) {
+	if !IsValid(m) {
+		return nil, ErrInvalidValue
+	} else if r == nil {
+		return nil, ErrInvalidValue
+	}
+	x := new(big.Int).Mul(toNanos(m), r.Num())
+	units, nanos, ok := fromNanos(divRound(x, r.Denom(), mode))
+	if !ok {
+		return nil, ErrOverflow
+	}
+	return New[T, P](m.GetCurrencyCode(), units, nanos), nil
+}
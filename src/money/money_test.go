@@ -0,0 +1,478 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package money
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+
+	pb "google.golang.org/genproto/googleapis/type/money"
+)
+
+func mmc(u int64, n int32, c string) *pb.Money { return &pb.Money{Units: u, Nanos: n, CurrencyCode: c} }
+func mm(u int64, n int32) *pb.Money            { return mmc(u, n, "") }
+
+func TestIsValid(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *pb.Money
+		want bool
+	}{
+		{"valid -/-", mm(-981273891273, -999999999), true},
+		{"invalid -/+", mm(-981273891273, +999999999), false},
+		{"valid +/+", mm(981273891273, 999999999), true},
+		{"invalid +/-", mm(981273891273, -999999999), false},
+		{"invalid +/+overflow", mm(3, 1000000000), false},
+		{"invalid +/-overflow", mm(3, -1000000000), false},
+		{"invalid -/+overflow", mm(-3, 1000000000), false},
+		{"invalid -/-overflow", mm(-3, -1000000000), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValid(tt.in); got != tt.want {
+				t.Errorf("IsValid(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsZero(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *pb.Money
+		want bool
+	}{
+		{"zero", mm(0, 0), true},
+		{"not-zero (-/+)", mm(-1, +1), false},
+		{"not-zero (-/-)", mm(-1, -1), false},
+		{"not-zero (+/+)", mm(+1, +1), false},
+		{"not-zero (+/-)", mm(+1, -1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsZero(tt.in); got != tt.want {
+				t.Errorf("IsZero(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPositive(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *pb.Money
+		want bool
+	}{
+		{"zero", mm(0, 0), false},
+		{"positive (+/+)", mm(+1, +1), true},
+		{"invalid (-/+)", mm(-1, +1), false},
+		{"negative (-/-)", mm(-1, -1), false},
+		{"invalid (+/-)", mm(+1, -1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPositive(tt.in); got != tt.want {
+				t.Errorf("IsPositive(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsNegative(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *pb.Money
+		want bool
+	}{
+		{"zero", mm(0, 0), false},
+		{"positive (+/+)", mm(+1, +1), false},
+		{"invalid (-/+)", mm(-1, +1), false},
+		{"negative (-/-)", mm(-1, -1), true},
+		{"invalid (+/-)", mm(+1, -1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsNegative(tt.in); got != tt.want {
+				t.Errorf("IsNegative(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAreSameCurrency(t *testing.T) {
+	type args struct {
+		l *pb.Money
+		r *pb.Money
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{"both empty currency", args{mmc(1, 0, ""), mmc(2, 0, "")}, false},
+		{"left empty currency", args{mmc(1, 0, ""), mmc(2, 0, "USD")}, false},
+		{"right empty currency", args{mmc(1, 0, "USD"), mmc(2, 0, "")}, false},
+		{"mismatching", args{mmc(1, 0, "USD"), mmc(2, 0, "CAD")}, false},
+		{"matching", args{mmc(1, 0, "USD"), mmc(2, 0, "USD")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AreSameCurrency(tt.args.l, tt.args.r); got != tt.want {
+				t.Errorf("AreSameCurrency([%v],[%v]) = %v, want %v", tt.args.l, tt.args.r, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAreEquals(t *testing.T) {
+	type args struct {
+		l *pb.Money
+		r *pb.Money
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{"equals", args{mmc(1, 2, "USD"), mmc(1, 2, "USD")}, true},
+		{"mismatching currency", args{mmc(1, 2, "USD"), mmc(1, 2, "CAD")}, false},
+		{"mismatching units", args{mmc(10, 20, "USD"), mmc(1, 20, "USD")}, false},
+		{"mismatching nanos", args{mmc(1, 2, "USD"), mmc(1, 20, "USD")}, false},
+		{"negated", args{mmc(1, 2, "USD"), mmc(-1, -2, "USD")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AreEquals(tt.args.l, tt.args.r); got != tt.want {
+				t.Errorf("AreEquals([%v],[%v]) = %v, want %v", tt.args.l, tt.args.r, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *pb.Money
+		want *pb.Money
+	}{
+		{"zero", mm(0, 0), mm(0, 0)},
+		{"negative", mm(-1, -200), mm(1, 200)},
+		{"positive", mm(1, 200), mm(-1, -200)},
+		{"carries currency code", mmc(0, 0, "XXX"), mmc(0, 0, "XXX")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Negate(tt.in); !AreEquals(got, tt.want) {
+				t.Errorf("Negate([%v]) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMust_pass(t *testing.T) {
+	v := Must(mm(2, 3), nil)
+	if !AreEquals(v, mm(2, 3)) {
+		t.Errorf("returned the wrong value: %v", v)
+	}
+}
+
+func TestMust_panic(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Logf("panic captured: %v", r)
+		}
+	}()
+	Must(mm(2, 3), fmt.Errorf("some error"))
+	t.Fatal("this should not have executed due to the panic above")
+}
+
+func TestSum(t *testing.T) {
+	type args struct {
+		l *pb.Money
+		r *pb.Money
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *pb.Money
+		wantErr error
+	}{
+		{"0+0=0", args{mm(0, 0), mm(0, 0)}, mm(0, 0), nil},
+		{"Error: currency code on left", args{mmc(0, 0, "XXX"), mm(0, 0)}, nil, ErrMismatchingCurrency},
+		{"Error: currency code on right", args{mm(0, 0), mmc(0, 0, "YYY")}, nil, ErrMismatchingCurrency},
+		{"Error: currency code mismatch", args{mmc(0, 0, "AAA"), mmc(0, 0, "BBB")}, nil, ErrMismatchingCurrency},
+		{"Error: invalid +/-", args{mm(+1, -1), mm(0, 0)}, nil, ErrInvalidValue},
+		{"Error: invalid -/+", args{mm(0, 0), mm(-1, +2)}, nil, ErrInvalidValue},
+		{"Error: invalid nanos", args{mm(0, 1000000000), mm(1, 0)}, nil, ErrInvalidValue},
+		{"both positive (no carry)", args{mm(2, 200000000), mm(2, 200000000)}, mm(4, 400000000), nil},
+		{"both positive (nanos=max)", args{mm(2, 111111111), mm(2, 888888888)}, mm(4, 999999999), nil},
+		{"both positive (carry)", args{mm(2, 200000000), mm(2, 900000000)}, mm(5, 100000000), nil},
+		{"both negative (no carry)", args{mm(-2, -200000000), mm(-2, -200000000)}, mm(-4, -400000000), nil},
+		{"both negative (carry)", args{mm(-2, -200000000), mm(-2, -900000000)}, mm(-5, -100000000), nil},
+		{"mixed (larger positive, just decimals)", args{mm(11, 0), mm(-2, 0)}, mm(9, 0), nil},
+		{"mixed (larger negative, just decimals)", args{mm(-11, 0), mm(2, 0)}, mm(-9, 0), nil},
+		{"mixed (larger positive, no borrow)", args{mm(11, 100000000), mm(-2, -100000000)}, mm(9, 0), nil},
+		{"mixed (larger positive, with borrow)", args{mm(11, 100000000), mm(-2, -9000000 /*.09*/)}, mm(9, 91000000 /*.091*/), nil},
+		{"mixed (larger negative, no borrow)", args{mm(-11, -100000000), mm(2, 100000000)}, mm(-9, 0), nil},
+		{"mixed (larger negative, with borrow)", args{mm(-11, -100000000), mm(2, 9000000 /*.09*/)}, mm(-9, -91000000 /*.091*/), nil},
+		{"mixed (zero units)", args{mm(2, 200000000), mm(-2, -900000000)}, mm(0, -700000000), nil},
+		{"0+negative", args{mm(0, 0), mm(-2, -100000000)}, mm(-2, -100000000), nil},
+		{"negative+0", args{mm(-2, -100000000), mm(0, 0)}, mm(-2, -100000000), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sum(tt.args.l, tt.args.r)
+			if err != tt.wantErr {
+				t.Errorf("Sum([%v],[%v]): expected err=\"%v\" got=\"%v\"", tt.args.l, tt.args.r, tt.wantErr, err)
+			}
+			if (got == nil) != (tt.want == nil) || got != nil && !AreEquals(got, tt.want) {
+				t.Errorf("Sum([%v],[%v]) = %v, want %v", tt.args.l, tt.args.r, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSumOverflow(t *testing.T) {
+	if _, err := Sum(mm(math.MaxInt64, 0), mm(1, 0)); err != ErrOverflow {
+		t.Errorf("Sum(max, 1): expected ErrOverflow, got %v", err)
+	}
+	if _, err := Sum(mm(math.MaxInt64, 600000000), mm(0, 600000000)); err != ErrOverflow {
+		t.Errorf("Sum(max.6, .6): expected ErrOverflow, got %v", err)
+	}
+	if _, err := Sum(mm(math.MinInt64, -1), mm(-1, 0)); err != ErrOverflow {
+		t.Errorf("Sum(min, -1): expected ErrOverflow, got %v", err)
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		l, r    *pb.Money
+		want    *pb.Money
+		wantErr error
+	}{
+		{"positive result", mmc(5, 500000000, "USD"), mmc(2, 750000000, "USD"), mmc(2, 750000000, "USD"), nil},
+		{"negative result", mmc(2, 750000000, "USD"), mmc(5, 500000000, "USD"), mmc(-2, -750000000, "USD"), nil},
+		{"less than one unit", mm(2, 200000000), mm(2, 900000000), mm(0, -700000000), nil},
+		{"zero", mmc(1, 1, "USD"), mmc(1, 1, "USD"), mmc(0, 0, "USD"), nil},
+		{"mismatching currency", mmc(1, 0, "USD"), mmc(1, 0, "EUR"), nil, ErrMismatchingCurrency},
+		{"invalid", mm(1, -1), mm(0, 0), nil, ErrInvalidValue},
+		{"overflow", mm(0, 0), mm(math.MinInt64, 0), nil, ErrOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Subtract(tt.l, tt.r)
+			if err != tt.wantErr {
+				t.Fatalf("Subtract([%v],[%v]): expected err=%v got=%v", tt.l, tt.r, tt.wantErr, err)
+			}
+			if err == nil && !AreEquals(got, tt.want) {
+				t.Errorf("Subtract([%v],[%v]) = %v, want %v", tt.l, tt.r, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiply(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      *pb.Money
+		n       int64
+		want    *pb.Money
+		wantErr error
+	}{
+		{"by zero", mm(3, 500000000), 0, mm(0, 0), nil},
+		{"by one", mmc(3, 500000000, "USD"), 1, mmc(3, 500000000, "USD"), nil},
+		{"carry", mm(3, 500000000), 3, mm(10, 500000000), nil},
+		{"nanos only", mm(0, 999999999), 1000000001, mm(999999999, 999999999), nil},
+		{"negative amount", mm(-1, -250000000), 4, mm(-5, 0), nil},
+		{"negative factor", mm(1, 250000000), -4, mm(-5, 0), nil},
+		{"both negative", mm(-1, -250000000), -4, mm(5, 0), nil},
+		{"max", mm(math.MaxInt64, 0), 1, mm(math.MaxInt64, 0), nil},
+		{"min", mm(math.MinInt64, -999999999), 1, mm(math.MinInt64, -999999999), nil},
+		{"overflow units", mm(math.MaxInt64/2+1, 0), 2, nil, ErrOverflow},
+		{"overflow carry", mm(math.MaxInt64, 500000000), 2, nil, ErrOverflow},
+		{"overflow factor", mm(2, 0), math.MinInt64, nil, ErrOverflow},
+		{"invalid", mm(1, -1), 2, nil, ErrInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Multiply(tt.in, tt.n)
+			if err != tt.wantErr {
+				t.Fatalf("Multiply([%v], %d): expected err=%v got=%v", tt.in, tt.n, tt.wantErr, err)
+			}
+			if err == nil && !AreEquals(got, tt.want) {
+				t.Errorf("Multiply([%v], %d) = %v, want %v", tt.in, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDivide(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      *pb.Money
+		n       int64
+		mode    RoundingMode
+		want    *pb.Money
+		wantErr error
+	}{
+		{"exact", mm(10, 0), 4, RoundHalfEven, mm(2, 500000000), nil},
+		{"thirds, half even", mm(10, 0), 3, RoundHalfEven, mm(3, 333333333), nil},
+		{"thirds, away from zero", mm(10, 0), 3, RoundAwayFromZero, mm(3, 333333334), nil},
+		{"negative thirds, floor", mm(-10, 0), 3, RoundFloor, mm(-3, -333333334), nil},
+		{"negative thirds, ceiling", mm(-10, 0), 3, RoundCeiling, mm(-3, -333333333), nil},
+		{"negative divisor", mm(10, 0), -4, RoundHalfEven, mm(-2, -500000000), nil},
+		{"tie, half even rounds to even", mm(0, 5), 2, RoundHalfEven, mm(0, 2), nil},
+		{"tie, half away from zero", mm(0, 5), 2, RoundHalfAwayFromZero, mm(0, 3), nil},
+		{"by zero", mm(1, 0), 0, RoundHalfEven, nil, ErrDivideByZero},
+		{"overflow", mm(math.MinInt64, 0), -1, RoundHalfEven, nil, ErrOverflow},
+		{"invalid", mm(1, -1), 2, RoundHalfEven, nil, ErrInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Divide(tt.in, tt.n, tt.mode)
+			if err != tt.wantErr {
+				t.Fatalf("Divide([%v], %d, %v): expected err=%v got=%v", tt.in, tt.n, tt.mode, tt.wantErr, err)
+			}
+			if err == nil && !AreEquals(got, tt.want) {
+				t.Errorf("Divide([%v], %d, %v) = %v, want %v", tt.in, tt.n, tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	parts, err := Allocate(mmc(10, 0, "USD"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*pb.Money{mmc(3, 333333334, "USD"), mmc(3, 333333333, "USD"), mmc(3, 333333333, "USD")}
+	for i := range want {
+		if !AreEquals(parts[i], want[i]) {
+			t.Errorf("part %d = %v, want %v", i, parts[i], want[i])
+		}
+	}
+
+	parts, err = Allocate(mm(0, -5), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []*pb.Money{mm(0, -2), mm(0, -2), mm(0, -1)}
+	for i := range want {
+		if !AreEquals(parts[i], want[i]) {
+			t.Errorf("negative part %d = %v, want %v", i, parts[i], want[i])
+		}
+	}
+
+	if _, err := Allocate(mm(1, 0), 0); err != ErrInvalidParts {
+		t.Errorf("Allocate(_, 0): expected ErrInvalidParts, got %v", err)
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     *pb.Money
+		digits int
+		mode   RoundingMode
+		want   *pb.Money
+	}{
+		{"cents, half even down", mm(1, 125000000), 2, RoundHalfEven, mm(1, 120000000)},
+		{"cents, half even up", mm(1, 135000000), 2, RoundHalfEven, mm(1, 140000000)},
+		{"cents, half away", mm(1, 125000000), 2, RoundHalfAwayFromZero, mm(1, 130000000)},
+		{"cents, truncate", mm(1, 129999999), 2, RoundTowardZero, mm(1, 120000000)},
+		{"negative cents, half away", mm(-1, -125000000), 2, RoundHalfAwayFromZero, mm(-1, -130000000)},
+		{"whole units, carry", mm(1, 999999999), 0, RoundHalfEven, mm(2, 0)},
+		{"nanos unchanged", mm(1, 123456789), 9, RoundHalfEven, mm(1, 123456789)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Round(tt.in, tt.digits, tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !AreEquals(got, tt.want) {
+				t.Errorf("Round([%v], %d, %v) = %v, want %v", tt.in, tt.digits, tt.mode, got, tt.want)
+			}
+		})
+	}
+	if _, err := Round(mm(1, 0), 10, RoundHalfEven); err == nil {
+		t.Error("Round with 10 digits: expected an error")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name    string
+		l, r    *pb.Money
+		want    int
+		wantErr error
+	}{
+		{"equal", mm(1, 5), mm(1, 5), 0, nil},
+		{"less by units", mm(1, 5), mm(2, 0), -1, nil},
+		{"less by nanos", mm(1, 5), mm(1, 6), -1, nil},
+		{"negative nanos", mm(-1, -500000000), mm(-1, -200000000), -1, nil},
+		{"greater", mm(0, 1), mm(0, -1), +1, nil},
+		{"mismatching currency", mmc(1, 0, "USD"), mmc(1, 0, "EUR"), 0, ErrMismatchingCurrency},
+		{"invalid", mm(1, -1), mm(1, 0), 0, ErrInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Compare(tt.l, tt.r)
+			if err != tt.wantErr || got != tt.want {
+				t.Errorf("Compare([%v],[%v]) = %d, %v, want %d, %v", tt.l, tt.r, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+	if less, _ := Less(mm(1, 0), mm(2, 0)); !less {
+		t.Error("Less(1, 2) = false")
+	}
+	if greater, _ := Greater(mm(1, 0), mm(2, 0)); greater {
+		t.Error("Greater(1, 2) = true")
+	}
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      *pb.Money
+		r       *big.Rat
+		mode    RoundingMode
+		want    *pb.Money
+		wantErr error
+	}{
+		{"identity", mmc(8, 990000000, "USD"), big.NewRat(1, 1), RoundHalfEven, mmc(8, 990000000, "USD"), nil},
+		{"exchange rate", mmc(10, 0, "EUR"), big.NewRat(11305, 10000), RoundHalfEven, mmc(11, 305000000, "EUR"), nil},
+		{"thirds round", mmc(1, 0, "USD"), big.NewRat(1, 3), RoundHalfEven, mmc(0, 333333333, "USD"), nil},
+		{"thirds ceiling", mmc(1, 0, "USD"), big.NewRat(1, 3), RoundCeiling, mmc(0, 333333334, "USD"), nil},
+		{"negative", mmc(-2, -500000000, "USD"), big.NewRat(2, 5), RoundHalfEven, mmc(-1, 0, "USD"), nil},
+		{"overflow", mm(math.MaxInt64, 0), big.NewRat(2, 1), RoundHalfEven, nil, ErrOverflow},
+		{"nil rate", mm(1, 0), nil, RoundHalfEven, nil, ErrInvalidValue},
+		{"invalid", mm(1, -1), big.NewRat(1, 1), RoundHalfEven, nil, ErrInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Scale(tt.in, tt.r, tt.mode)
+			if err != tt.wantErr {
+				t.Fatalf("Scale(%v, %v): expected err=%v got=%v", tt.in, tt.r, tt.wantErr, err)
+			}
+			if (got == nil) != (tt.want == nil) || got != nil && !AreEquals(got, tt.want) {
+				t.Errorf("Scale(%v, %v) = %v, want %v", tt.in, tt.r, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package productcatalogservice
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// catalogHistorySize is how many changes are kept for clients resuming
+	// a watch. Clients further behind receive a snapshot instead.
+	catalogHistorySize = 64
+
+	// watcherBufferSize is how many changes may queue up for a watcher
+	// before it is disconnected as too slow.
+	watcherBufferSize = 16
+)
+
+// catalogFeed tracks versions of the catalog and fans out the differences
+// between them to watchers. The zero value is ready to use.
+//
+// The first version is the time the feed was created in Unix milliseconds,
+// so versions from before a restart are almost certainly older than any
+// current one and resuming from them yields a snapshot.
+type catalogFeed struct {
+	mu       sync.Mutex
+	version  int64
+	products map[string]*pb.Product
+	history  []*pb.CatalogChange // oldest first
+	watchers map[chan *pb.CatalogChange]struct{}
+}
+
+// diffCatalog returns the change turning old into products, or nil if they
+// are equal. Products are compared by ID and content.
+func diffCatalog(old map[string]*pb.Product, products []*pb.Product) *pb.CatalogChange {
+	change := &pb.CatalogChange{}
+	seen := make(map[string]bool, len(products))
+	for _, p := range products {
+		seen[p.GetId()] = true
+		prev, ok := old[p.GetId()]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, p)
+		case !proto.Equal(prev, p):
+			change.Updated = append(change.Updated, p)
+		}
+	}
+	for id := range old {
+		if !seen[id] {
+			change.RemovedIds = append(change.RemovedIds, id)
+		}
+	}
+	if len(change.Added)+len(change.Updated)+len(change.RemovedIds) == 0 {
+		return nil
+	}
+	sort.Strings(change.RemovedIds)
+	return change
+}
+
+// publish records products as the current catalog. If it differs from the
+// previous one, the version is bumped and the change sent to every watcher.
+// Watchers that have fallen too far behind are disconnected.
+func (f *catalogFeed) publish(products []*pb.Product) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	change := diffCatalog(f.products, products)
+	if change == nil {
+		return
+	}
+	if f.version == 0 {
+		f.version = time.Now().UnixMilli()
+	} else {
+		f.version++
+	}
+	change.Version = f.version
+
+	f.products = make(map[string]*pb.Product, len(products))
+	for _, p := range products {
+		f.products[p.GetId()] = p
+	}
+	f.history = append(f.history, change)
+	if len(f.history) > catalogHistorySize {
+		f.history = f.history[len(f.history)-catalogHistorySize:]
+	}
+
+	for ch := range f.watchers {
+		select {
+		case ch <- change:
+		default:
+			delete(f.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// snapshotLocked returns a change replacing the whole catalog. f.mu must be
+// held.
+func (f *catalogFeed) snapshotLocked() *pb.CatalogChange {
+	change := &pb.CatalogChange{Version: f.version, Snapshot: true}
+	for _, p := range f.products {
+		change.Added = append(change.Added, p)
+	}
+	sort.Slice(change.Added, func(i, j int) bool { return change.Added[i].GetId() < change.Added[j].GetId() })
+	return change
+}
+
+// subscribe registers a watcher that has the catalog at version since. It
+// returns the changes the watcher has missed, a channel delivering future
+// changes, and a function that unregisters the watcher. The channel is
+// closed if the watcher falls behind.
+func (f *catalogFeed) subscribe(since int64) ([]*pb.CatalogChange, <-chan *pb.CatalogChange, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var backlog []*pb.CatalogChange
+	switch {
+	case since == f.version:
+	case since > 0 && since < f.version && len(f.history) > 0 && since >= f.history[0].GetVersion()-1:
+		for _, c := range f.history {
+			if c.GetVersion() > since {
+				backlog = append(backlog, c)
+			}
+		}
+	default:
+		backlog = []*pb.CatalogChange{f.snapshotLocked()}
+	}
+
+	ch := make(chan *pb.CatalogChange, watcherBufferSize)
+	if f.watchers == nil {
+		f.watchers = make(map[chan *pb.CatalogChange]struct{})
+	}
+	f.watchers[ch] = struct{}{}
+	cancel := func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.watchers[ch]; ok {
+			delete(f.watchers, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, cancel
+}
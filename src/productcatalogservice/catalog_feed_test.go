@@ -0,0 +1,185 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package productcatalogservice
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func ids(products []*pb.Product) []string {
+	var out []string
+	for _, p := range products {
+		out = append(out, p.GetId())
+	}
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDiffCatalog(t *testing.T) {
+	old := map[string]*pb.Product{
+		"A": {Id: "A", Name: "Alpha"},
+		"B": {Id: "B", Name: "Beta"},
+		"C": {Id: "C", Name: "Gamma"},
+	}
+	change := diffCatalog(old, []*pb.Product{
+		{Id: "A", Name: "Alpha"},
+		{Id: "B", Name: "Beta, renamed"},
+		{Id: "D", Name: "Delta"},
+	})
+	if change == nil {
+		t.Fatal("expected a change")
+	}
+	if got, want := ids(change.Added), []string{"D"}; !equalStrings(got, want) {
+		t.Errorf("added: got %v, want %v", got, want)
+	}
+	if got, want := ids(change.Updated), []string{"B"}; !equalStrings(got, want) {
+		t.Errorf("updated: got %v, want %v", got, want)
+	}
+	if got, want := change.RemovedIds, []string{"C"}; !equalStrings(got, want) {
+		t.Errorf("removed: got %v, want %v", got, want)
+	}
+
+	if change := diffCatalog(old, []*pb.Product{old["C"], old["B"], old["A"]}); change != nil {
+		t.Errorf("expected no change, got %v", change)
+	}
+}
+
+func TestCatalogFeedSubscribe(t *testing.T) {
+	var f catalogFeed
+	f.publish([]*pb.Product{{Id: "A"}})
+	v1 := f.version
+	f.publish([]*pb.Product{{Id: "A"}, {Id: "B"}})
+	f.publish([]*pb.Product{{Id: "A"}, {Id: "B"}}) // unchanged, no new version
+	f.publish([]*pb.Product{{Id: "B"}})
+	if got, want := f.version, v1+2; got != want {
+		t.Fatalf("version: got %d, want %d", got, want)
+	}
+
+	tests := []struct {
+		name     string
+		since    int64
+		versions []int64
+		snapshot bool
+	}{
+		{"new client", 0, []int64{v1 + 2}, true},
+		{"up to date", v1 + 2, nil, false},
+		{"resume", v1, []int64{v1 + 1, v1 + 2}, false},
+		{"from before restart", v1 - 100, []int64{v1 + 2}, true},
+		{"from the future", v1 + 100, []int64{v1 + 2}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backlog, _, cancel := f.subscribe(tt.since)
+			defer cancel()
+			var versions []int64
+			for _, c := range backlog {
+				versions = append(versions, c.GetVersion())
+			}
+			if len(versions) != len(tt.versions) {
+				t.Fatalf("got versions %v, want %v", versions, tt.versions)
+			}
+			for i := range versions {
+				if versions[i] != tt.versions[i] {
+					t.Fatalf("got versions %v, want %v", versions, tt.versions)
+				}
+			}
+			if len(backlog) > 0 && backlog[0].GetSnapshot() != tt.snapshot {
+				t.Errorf("snapshot: got %v, want %v", backlog[0].GetSnapshot(), tt.snapshot)
+			}
+		})
+	}
+}
+
+func TestCatalogFeedDropsSlowWatchers(t *testing.T) {
+	var f catalogFeed
+	f.publish([]*pb.Product{{Id: "P"}})
+	_, changes, cancel := f.subscribe(f.version)
+	defer cancel()
+
+	for i := 0; i <= watcherBufferSize; i++ {
+		f.publish([]*pb.Product{{Id: "P", Name: string(rune('a' + i))}})
+	}
+	n := 0
+	for range changes {
+		n++
+	}
+	if n != watcherBufferSize {
+		t.Errorf("got %d buffered changes before disconnect, want %d", n, watcherBufferSize)
+	}
+}
+
+func TestWatchCatalog(t *testing.T) {
+	svc := &productCatalog{}
+	svc.feed.publish([]*pb.Product{{Id: "A", Name: "Alpha"}})
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterProductCatalogServiceServer(srv, svc)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := pb.NewProductCatalogServiceClient(conn).WatchCatalog(ctx, &pb.WatchCatalogRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !snapshot.GetSnapshot() || !equalStrings(ids(snapshot.GetAdded()), []string{"A"}) {
+		t.Fatalf("unexpected first message: %v", snapshot)
+	}
+
+	svc.feed.publish([]*pb.Product{{Id: "B", Name: "Beta"}})
+	change, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := change.GetVersion(), snapshot.GetVersion()+1; got != want {
+		t.Errorf("version: got %d, want %d", got, want)
+	}
+	if change.GetSnapshot() || !equalStrings(ids(change.GetAdded()), []string{"B"}) ||
+		!equalStrings(change.GetRemovedIds(), []string{"A"}) {
+		t.Errorf("unexpected change: %v", change)
+	}
+}
@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package productcatalogservice
 
 import (
 	"bytes"
@@ -20,45 +20,76 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"strings"
 
 	"cloud.google.com/go/alloydbconn"
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
-	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
 )
 
-func loadCatalog(catalog *pb.ListProductsResponse) error {
-	catalogMutex.Lock()
-	defer catalogMutex.Unlock()
-
+// loadCatalog loads the catalog from AlloyDB if it is configured, and from
+// products.json, or the file named by CATALOG_FILE, otherwise.
+func loadCatalog() ([]*pb.Product, error) {
+	var loaded pb.ListProductsResponse
+	var err error
 	if os.Getenv("ALLOYDB_CLUSTER_NAME") != "" {
-		return loadCatalogFromAlloyDB(catalog)
+		err = loadCatalogFromAlloyDB(&loaded)
+	} else {
+		err = loadCatalogFromLocalFile(&loaded)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse to serve a catalog that breaks invariants other services rely
+	// on; the previously loaded catalog (if any) stays in place.
+	if problems := validateCatalog(loaded.GetProducts()); len(problems) > 0 {
+		for _, p := range problems {
+			log.Warnf("invalid product catalog: %s", p)
+		}
+		return nil, errors.Errorf("product catalog has %d problem(s)", len(problems))
 	}
 
-	return loadCatalogFromLocalFile(catalog)
+	return loaded.GetProducts(), nil
 }
 
 func loadCatalogFromLocalFile(catalog *pb.ListProductsResponse) error {
-	log.Info("loading catalog from local products.json file...")
+	file := "products.json"
+	if f := os.Getenv("CATALOG_FILE"); f != "" {
+		file = f
+	}
+	log.Infof("loading catalog from local %s file...", file)
+
+	if err := readCatalogFile(file, catalog); err != nil {
+		return err
+	}
+
+	log.Info("successfully parsed product catalog json")
+	return nil
+}
 
-	catalogJSON, err := os.ReadFile("products.json")
+// readCatalogFile parses a products.json formatted file into catalog.
+func readCatalogFile(path string, catalog *pb.ListProductsResponse) error {
+	catalogJSON, err := os.ReadFile(path)
 	if err != nil {
 		log.Warnf("failed to open product catalog json file: %v", err)
 		return err
 	}
 
-	if err := jsonpb.Unmarshal(bytes.NewReader(catalogJSON), catalog); err != nil {
+	if err := jsonUnmarshalCatalog(catalogJSON, catalog); err != nil {
 		log.Warnf("failed to parse the catalog JSON: %v", err)
 		return err
 	}
-
-	log.Info("successfully parsed product catalog json")
 	return nil
 }
 
+func jsonUnmarshalCatalog(data []byte, catalog *pb.ListProductsResponse) error {
+	return jsonpb.Unmarshal(bytes.NewReader(data), catalog)
+}
+
 func getSecretPayload(project, secret, version string) (string, error) {
 	ctx := context.Background()
 	client, err := secretmanager.NewClient(ctx)
@@ -82,29 +113,27 @@ func getSecretPayload(project, secret, version string) (string, error) {
 	return string(result.Payload.Data), nil
 }
 
-func loadCatalogFromAlloyDB(catalog *pb.ListProductsResponse) error {
-	log.Info("loading catalog from AlloyDB...")
-
+// connectAlloyDB opens a connection pool to the AlloyDB instance configured
+// through the environment. The returned cleanup function closes the pool and
+// the underlying dialer.
+func connectAlloyDB(ctx context.Context) (*pgxpool.Pool, func(), error) {
 	projectID := os.Getenv("PROJECT_ID")
 	region := os.Getenv("REGION")
 	pgClusterName := os.Getenv("ALLOYDB_CLUSTER_NAME")
 	pgInstanceName := os.Getenv("ALLOYDB_INSTANCE_NAME")
 	pgDatabaseName := os.Getenv("ALLOYDB_DATABASE_NAME")
-	pgTableName := os.Getenv("ALLOYDB_TABLE_NAME")
 	pgSecretName := os.Getenv("ALLOYDB_SECRET_NAME")
 
 	pgPassword, err := getSecretPayload(projectID, pgSecretName, "latest")
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	dialer, err := alloydbconn.NewDialer(context.Background())
+	dialer, err := alloydbconn.NewDialer(ctx)
 	if err != nil {
 		log.Warnf("failed to set-up dialer connection: %v", err)
-		return err
+		return nil, nil, err
 	}
-	cleanup := func() error { return dialer.Close() }
-	defer cleanup()
 
 	dsn := fmt.Sprintf(
 		"user=%s password=%s dbname=%s sslmode=disable",
@@ -114,7 +143,8 @@ func loadCatalogFromAlloyDB(catalog *pb.ListProductsResponse) error {
 	config, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		log.Warnf("failed to parse DSN config: %v", err)
-		return err
+		dialer.Close()
+		return nil, nil, err
 	}
 
 	pgInstanceURI := fmt.Sprintf("projects/%s/locations/%s/clusters/%s/instances/%s", projectID, region, pgClusterName, pgInstanceName)
@@ -122,39 +152,56 @@ func loadCatalogFromAlloyDB(catalog *pb.ListProductsResponse) error {
 		return dialer.Dial(ctx, pgInstanceURI)
 	}
 
-	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		log.Warnf("failed to set-up pgx pool: %v", err)
-		return err
+		dialer.Close()
+		return nil, nil, err
 	}
-	defer pool.Close()
 
-	query := "SELECT id, name, description, picture, price_usd_currency_code, price_usd_units, price_usd_nanos, categories FROM " + pgTableName
-	rows, err := pool.Query(context.Background(), query)
+	cleanup := func() {
+		pool.Close()
+		dialer.Close()
+	}
+	return pool, cleanup, nil
+}
+
+// newAlloyDBRepository connects to AlloyDB and returns a repository for the
+// table named by ALLOYDB_TABLE_NAME.
+func newAlloyDBRepository(ctx context.Context) (*catalogRepository, func(), error) {
+	// Validate the table name before doing any network round trips.
+	if _, err := parseTableName(os.Getenv("ALLOYDB_TABLE_NAME")); err != nil {
+		return nil, nil, errors.Wrap(err, "ALLOYDB_TABLE_NAME")
+	}
+	pool, cleanup, err := connectAlloyDB(ctx)
 	if err != nil {
-		log.Warnf("failed to query database: %v", err)
-		return err
+		return nil, nil, err
+	}
+	repo, err := newCatalogRepository(pool, os.Getenv("ALLOYDB_TABLE_NAME"))
+	if err != nil {
+		cleanup()
+		return nil, nil, err
 	}
-	defer rows.Close()
+	return repo, cleanup, nil
+}
 
-	catalog.Products = catalog.Products[:0]
-	for rows.Next() {
-		product := &pb.Product{}
-		product.PriceUsd = &pb.Money{}
+func loadCatalogFromAlloyDB(catalog *pb.ListProductsResponse) error {
+	log.Info("loading catalog from AlloyDB...")
 
-		var categories string
-		err = rows.Scan(&product.Id, &product.Name, &product.Description,
-			&product.Picture, &product.PriceUsd.CurrencyCode, &product.PriceUsd.Units,
-			&product.PriceUsd.Nanos, &categories)
-		if err != nil {
-			log.Warnf("failed to scan query result row: %v", err)
-			return err
-		}
-		categories = strings.ToLower(categories)
-		product.Categories = strings.Split(categories, ",")
+	ctx := context.Background()
+	repo, cleanup, err := newAlloyDBRepository(ctx)
+	if err != nil {
+		log.Warnf("failed to connect to AlloyDB: %v", err)
+		return err
+	}
+	defer cleanup()
 
-		catalog.Products = append(catalog.Products, product)
+	products, err := repo.listProducts(ctx)
+	if err != nil {
+		log.Warnf("failed to load products: %v", err)
+		return err
 	}
+	catalog.Products = products
 
 	log.Info("successfully parsed product catalog from AlloyDB")
 	return nil
@@ -0,0 +1,519 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package productcatalogservice
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+)
+
+// catalogSchemaVersion is the newest catalog table schema this service knows
+// how to read. It must match the highest numbered file in migrations/.
+const catalogSchemaVersion = 3
+
+const (
+	// categoriesArraySchemaVersion is the schema version from which the
+	// categories column is stored as TEXT[] rather than a comma-separated
+	// string.
+	categoriesArraySchemaVersion = 2
+
+	// variantsSchemaVersion is the schema version that added product images
+	// and the variants table.
+	variantsSchemaVersion = 3
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// identifierPart matches a single unquoted Postgres identifier. Anything else
+// (quotes, whitespace, semicolons, ...) is rejected rather than escaped so that
+// ALLOYDB_TABLE_NAME cannot be used to smuggle SQL into a query.
+var identifierPart = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+// Suffixes of the names of the tables and indexes next to the catalog table.
+const (
+	migrationsSuffix    = "_schema_migrations"
+	variantsSuffix      = "_variants"
+	variantsIndexSuffix = "_variants_product_idx"
+)
+
+// maxTableNameLen is the longest catalog table name whose derived names
+// still fit in the 63 bytes Postgres keeps of an identifier. Longer names
+// would be truncated silently, and could collide with each other.
+const maxTableNameLen = 63 - len(variantsIndexSuffix)
+
+// parseTableName validates a table name of the form "table" or
+// "schema.table" and returns it as a pgx.Identifier. Names are folded to
+// lower case, which matches how Postgres resolves unquoted identifiers.
+func parseTableName(name string) (pgx.Identifier, error) {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return nil, errors.Errorf("invalid table name %q: expected [schema.]table", name)
+	}
+	ident := make(pgx.Identifier, len(parts))
+	for i, p := range parts {
+		if !identifierPart.MatchString(p) {
+			return nil, errors.Errorf("invalid table name %q: %q is not a valid identifier", name, p)
+		}
+		ident[i] = strings.ToLower(p)
+	}
+	if table := ident[len(ident)-1]; len(table) > maxTableNameLen {
+		return nil, errors.Errorf("invalid table name %q: %q is longer than %d characters", name, table, maxTableNameLen)
+	}
+	return ident, nil
+}
+
+// splitCategories parses the legacy comma-separated categories column.
+func splitCategories(s string) []string {
+	var out []string
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.ToLower(strings.TrimSpace(c)); c != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// normalizeCategories lower-cases and trims categories read from a TEXT[]
+// column, dropping empty entries.
+func normalizeCategories(in []string) []string {
+	var out []string
+	for _, c := range in {
+		if c = strings.ToLower(strings.TrimSpace(c)); c != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// pgxQuerier is the subset of *pgxpool.Pool used by catalogRepository.
+type pgxQuerier interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// catalogRepository reads and writes the product catalog stored in a
+// Postgres-compatible database such as AlloyDB.
+type catalogRepository struct {
+	db    pgxQuerier
+	table pgx.Identifier
+}
+
+func newCatalogRepository(db pgxQuerier, tableName string) (*catalogRepository, error) {
+	table, err := parseTableName(tableName)
+	if err != nil {
+		return nil, err
+	}
+	return &catalogRepository{db: db, table: table}, nil
+}
+
+// suffixed returns an identifier for a table next to table, named after it
+// with the given suffix.
+func suffixed(table pgx.Identifier, suffix string) pgx.Identifier {
+	ident := append(pgx.Identifier{}, table...)
+	ident[len(ident)-1] += suffix
+	return ident
+}
+
+// migrationsTable returns the table recording which migrations have been
+// applied to r.table. It lives next to the catalog table.
+func (r *catalogRepository) migrationsTable() pgx.Identifier {
+	return suffixed(r.table, migrationsSuffix)
+}
+
+// variantsTable returns the table holding the variants of each product.
+func (r *catalogRepository) variantsTable() pgx.Identifier {
+	return suffixed(r.table, variantsSuffix)
+}
+
+// schemaVersion returns the highest migration applied to the catalog table,
+// or 0 if the table predates migrations.
+func (r *catalogRepository) schemaVersion(ctx context.Context) (int, error) {
+	return r.schemaVersionIn(ctx, r.db)
+}
+
+// rowQuerier is implemented by *pgxpool.Pool and pgx.Tx.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// schemaVersionIn is schemaVersion, querying q.
+func (r *catalogRepository) schemaVersionIn(ctx context.Context, q rowQuerier) (int, error) {
+	var exists bool
+	if err := q.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL",
+		r.migrationsTable().Sanitize()).Scan(&exists); err != nil {
+		return 0, errors.Wrap(err, "failed to look up schema migrations table")
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version int
+	err := q.QueryRow(ctx,
+		"SELECT COALESCE(MAX(version), 0) FROM "+r.migrationsTable().Sanitize()).Scan(&version)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read schema version")
+	}
+	return version, nil
+}
+
+// listProducts returns every product in the catalog table.
+func (r *catalogRepository) listProducts(ctx context.Context) ([]*pb.Product, error) {
+	version, err := r.schemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version > catalogSchemaVersion {
+		return nil, errors.Errorf("catalog schema version %d is newer than the supported version %d", version, catalogSchemaVersion)
+	}
+
+	columns := "id, name, description, picture, price_usd_currency_code, price_usd_units, price_usd_nanos, categories"
+	if version >= variantsSchemaVersion {
+		columns += ", images"
+	}
+	rows, err := r.db.Query(ctx, "SELECT "+columns+" FROM "+r.table.Sanitize()+" ORDER BY id")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query database")
+	}
+	defer rows.Close()
+
+	var products []*pb.Product
+	for rows.Next() {
+		product := &pb.Product{PriceUsd: &pb.Money{}}
+		var (
+			description, picture *string
+			categories           any
+		)
+		dest := []any{&product.Id, &product.Name, &description, &picture,
+			&product.PriceUsd.CurrencyCode, &product.PriceUsd.Units, &product.PriceUsd.Nanos,
+			&categories}
+		if version >= variantsSchemaVersion {
+			dest = append(dest, &product.Images)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, errors.Wrap(err, "failed to scan query result row")
+		}
+		if description != nil {
+			product.Description = *description
+		}
+		if picture != nil {
+			product.Picture = *picture
+		}
+		product.Categories, err = scanCategories(categories, version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "product %q", product.Id)
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read query results")
+	}
+
+	if version >= variantsSchemaVersion {
+		if err := r.attachVariants(ctx, products); err != nil {
+			return nil, err
+		}
+	}
+	return products, nil
+}
+
+// attachVariants loads the variants table and adds each variant to its
+// product, in position order.
+func (r *catalogRepository) attachVariants(ctx context.Context, products []*pb.Product) error {
+	byID := make(map[string]*pb.Product, len(products))
+	for _, p := range products {
+		byID[p.Id] = p
+	}
+
+	rows, err := r.db.Query(ctx, "SELECT product_id, sku, name, price_override_usd_currency_code, "+
+		"price_override_usd_units, price_override_usd_nanos, attributes, images FROM "+
+		r.variantsTable().Sanitize()+" ORDER BY product_id, position, sku")
+	if err != nil {
+		return errors.Wrap(err, "failed to query product variants")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			productID    string
+			variant      = &pb.ProductVariant{}
+			currencyCode *string
+			units        *int64
+			nanos        *int32
+		)
+		if err := rows.Scan(&productID, &variant.Sku, &variant.Name, &currencyCode, &units, &nanos,
+			&variant.Attributes, &variant.Images); err != nil {
+			return errors.Wrap(err, "failed to scan product variant row")
+		}
+		if currencyCode != nil {
+			variant.PriceOverrideUsd = &pb.Money{CurrencyCode: *currencyCode}
+			if units != nil {
+				variant.PriceOverrideUsd.Units = *units
+			}
+			if nanos != nil {
+				variant.PriceOverrideUsd.Nanos = *nanos
+			}
+		}
+		if p, ok := byID[productID]; ok {
+			p.Variants = append(p.Variants, variant)
+		}
+	}
+	return errors.Wrap(rows.Err(), "failed to read product variants")
+}
+
+// scanCategories converts the categories column for the given schema version.
+func scanCategories(v any, version int) ([]string, error) {
+	switch c := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if version >= categoriesArraySchemaVersion {
+			return nil, errors.Errorf("categories column is text at schema version %d", version)
+		}
+		return splitCategories(c), nil
+	case []any:
+		out := make([]string, 0, len(c))
+		for _, e := range c {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return normalizeCategories(out), nil
+	default:
+		return nil, errors.Errorf("unexpected categories column type %T", v)
+	}
+}
+
+// migration is a numbered schema change read from migrations/.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// loadMigrations returns the embedded migrations in version order, rendered
+// for the given catalog table.
+func loadMigrations(table pgx.Identifier) ([]migration, error) {
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	data := struct{ Table, VariantsTable, VariantsIndex string }{
+		Table:         table.Sanitize(),
+		VariantsTable: suffixed(table, variantsSuffix).Sanitize(),
+		// Index names cannot be schema-qualified; the index is created in
+		// the schema of its table.
+		VariantsIndex: pgx.Identifier{table[len(table)-1] + variantsIndexSuffix}.Sanitize(),
+	}
+
+	var out []migration
+	for _, name := range names {
+		base := path.Base(name)
+		prefix, _, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, errors.Errorf("migration %s: expected NNNN_description.sql", base)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, errors.Wrapf(err, "migration %s: invalid version", base)
+		}
+		raw, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := template.New(base).Parse(string(raw))
+		if err != nil {
+			return nil, errors.Wrapf(err, "migration %s", base)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, errors.Wrapf(err, "migration %s", base)
+		}
+		out = append(out, migration{version: version, name: base, sql: buf.String()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].version < out[j].version })
+	for i, m := range out {
+		if m.version != i+1 {
+			return nil, errors.Errorf("migration %s: expected version %d", m.name, i+1)
+		}
+	}
+	return out, nil
+}
+
+// migrate applies all pending migrations, each in its own transaction, and
+// returns the resulting schema version.
+func (r *catalogRepository) migrate(ctx context.Context) (int, error) {
+	migrations, err := loadMigrations(r.table)
+	if err != nil {
+		return 0, err
+	}
+	current := 0
+	for _, m := range migrations {
+		if current, err = r.applyMigration(ctx, m); err != nil {
+			return current, err
+		}
+	}
+	return current, nil
+}
+
+// migrationLockKey returns the key of the advisory lock migrations of the
+// catalog table hold.
+func (r *catalogRepository) migrationLockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte("catalog migrations " + r.table.Sanitize()))
+	return int64(h.Sum64())
+}
+
+// applyMigration applies m unless it has been already, and returns the
+// resulting schema version. Its transaction holds an advisory lock, so that
+// replicas starting together wait for each other rather than both applying
+// it.
+func (r *catalogRepository) applyMigration(ctx context.Context, m migration) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", r.migrationLockKey()); err != nil {
+		return 0, errors.Wrap(err, "failed to lock the catalog for migration")
+	}
+	if _, err := tx.Exec(ctx, "CREATE TABLE IF NOT EXISTS "+r.migrationsTable().Sanitize()+
+		" (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())"); err != nil {
+		return 0, errors.Wrap(err, "failed to create schema migrations table")
+	}
+	current, err := r.schemaVersionIn(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	if current > catalogSchemaVersion {
+		return current, errors.Errorf("catalog schema version %d is newer than the supported version %d", current, catalogSchemaVersion)
+	}
+	if m.version <= current {
+		return current, tx.Commit(ctx)
+	}
+
+	log.Infof("applying catalog migration %s", m.name)
+	if _, err := tx.Exec(ctx, m.sql); err != nil {
+		return current, errors.Wrapf(err, "migration %s failed", m.name)
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO "+r.migrationsTable().Sanitize()+" (version, name) VALUES ($1, $2)",
+		m.version, m.name); err != nil {
+		return current, errors.Wrapf(err, "failed to record migration %s", m.name)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return current, errors.Wrapf(err, "failed to commit migration %s", m.name)
+	}
+	return m.version, nil
+}
+
+// upsertProductSQL returns the statement used by seed to insert or update a
+// single product.
+func (r *catalogRepository) upsertProductSQL() string {
+	return fmt.Sprintf(`INSERT INTO %s (id, name, description, picture, price_usd_currency_code, price_usd_units, price_usd_nanos, categories, images)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ON CONFLICT (id) DO UPDATE SET
+    name = EXCLUDED.name,
+    description = EXCLUDED.description,
+    picture = EXCLUDED.picture,
+    price_usd_currency_code = EXCLUDED.price_usd_currency_code,
+    price_usd_units = EXCLUDED.price_usd_units,
+    price_usd_nanos = EXCLUDED.price_usd_nanos,
+    categories = EXCLUDED.categories,
+    images = EXCLUDED.images`, r.table.Sanitize())
+}
+
+// insertVariantSQL returns the statement used by seed to insert a variant.
+func (r *catalogRepository) insertVariantSQL() string {
+	return fmt.Sprintf(`INSERT INTO %s (sku, product_id, position, name, price_override_usd_currency_code, price_override_usd_units, price_override_usd_nanos, attributes, images)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`, r.variantsTable().Sanitize())
+}
+
+// nonNil returns s, or an empty slice if s is nil, for NOT NULL array columns.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// seed upserts the given products into the catalog table in a single
+// transaction. The schema must already be at catalogSchemaVersion.
+func (r *catalogRepository) seed(ctx context.Context, products []*pb.Product) error {
+	version, err := r.schemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version != catalogSchemaVersion {
+		return errors.Errorf("catalog schema version is %d, want %d; run migrations first", version, catalogSchemaVersion)
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	upsertProduct := r.upsertProductSQL()
+	deleteVariants := "DELETE FROM " + r.variantsTable().Sanitize() + " WHERE product_id = $1"
+	insertVariant := r.insertVariantSQL()
+	for _, p := range products {
+		price := p.GetPriceUsd()
+		if _, err := tx.Exec(ctx, upsertProduct, p.GetId(), p.GetName(), p.GetDescription(), p.GetPicture(),
+			price.GetCurrencyCode(), price.GetUnits(), price.GetNanos(),
+			nonNil(normalizeCategories(p.GetCategories())), nonNil(p.GetImages())); err != nil {
+			return errors.Wrapf(err, "failed to upsert product %q", p.GetId())
+		}
+
+		if _, err := tx.Exec(ctx, deleteVariants, p.GetId()); err != nil {
+			return errors.Wrapf(err, "failed to replace variants of product %q", p.GetId())
+		}
+		for i, v := range p.GetVariants() {
+			var (
+				currencyCode *string
+				units        *int64
+				nanos        *int32
+			)
+			if o := v.GetPriceOverrideUsd(); o != nil {
+				currencyCode, units, nanos = &o.CurrencyCode, &o.Units, &o.Nanos
+			}
+			attributes := v.GetAttributes()
+			if attributes == nil {
+				attributes = map[string]string{}
+			}
+			if _, err := tx.Exec(ctx, insertVariant, v.GetSku(), p.GetId(), i, v.GetName(),
+				currencyCode, units, nanos, attributes, nonNil(v.GetImages())); err != nil {
+				return errors.Wrapf(err, "failed to insert variant %q of product %q", v.GetSku(), p.GetId())
+			}
+		}
+	}
+	return tx.Commit(ctx)
+}
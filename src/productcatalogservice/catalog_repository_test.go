@@ -0,0 +1,153 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package productcatalogservice
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestParseTableName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "catalog_items", want: `"catalog_items"`},
+		{name: "Catalog_Items", want: `"catalog_items"`},
+		{name: "public.catalog_items", want: `"public"."catalog_items"`},
+		{name: "", wantErr: true},
+		{name: "a.b.c", wantErr: true},
+		{name: "1products", wantErr: true},
+		{name: "products; DROP TABLE products", wantErr: true},
+		{name: `products"`, wantErr: true},
+		{name: "products --", wantErr: true},
+		{name: strings.Repeat("a", 64), wantErr: true},
+		{name: strings.Repeat("a", maxTableNameLen), want: `"` + strings.Repeat("a", maxTableNameLen) + `"`},
+		{name: strings.Repeat("a", maxTableNameLen+1), wantErr: true},
+		{name: strings.Repeat("s", 63) + ".products", want: `"` + strings.Repeat("s", 63) + `"."products"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ident, err := parseTableName(tt.name)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTableName(%q) = %v, want error", tt.name, ident)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ident.Sanitize(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitCategories(t *testing.T) {
+	got := splitCategories(" Clothing, tops ,,KITCHEN,")
+	want := []string{"clothing", "tops", "kitchen"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestScanCategories(t *testing.T) {
+	got, err := scanCategories([]any{" Tops", "clothing", ""}, catalogSchemaVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"tops", "clothing"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got, err = scanCategories("tops, clothing", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"tops", "clothing"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := scanCategories("tops", categoriesArraySchemaVersion); err == nil {
+		t.Error("expected error for text categories at array schema version")
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	table := pgx.Identifier{"public", "catalog_items"}
+	migrations, err := loadMigrations(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(migrations), catalogSchemaVersion; got != want {
+		t.Fatalf("got %d migrations, want %d", got, want)
+	}
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", m.name, m.version, i+1)
+		}
+		if !strings.Contains(m.sql, `"public"."catalog_items"`) {
+			t.Errorf("migration %s does not reference the quoted table name:\n%s", m.name, m.sql)
+		}
+		if strings.Contains(m.sql, "{{") {
+			t.Errorf("migration %s was not fully rendered:\n%s", m.name, m.sql)
+		}
+	}
+}
+
+func TestDerivedIdentifiersFit(t *testing.T) {
+	table, err := parseTableName(strings.Repeat("t", maxTableNameLen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &catalogRepository{table: table}
+	names := map[string]bool{table[0]: true}
+	for _, ident := range []pgx.Identifier{repo.migrationsTable(), repo.variantsTable(), {table[0] + variantsIndexSuffix}} {
+		name := ident[len(ident)-1]
+		if len(name) > 63 {
+			t.Errorf("%s is %d bytes long, more than Postgres keeps", name, len(name))
+		}
+		if names[name] {
+			t.Errorf("%s is used twice", name)
+		}
+		names[name] = true
+	}
+}
+
+func TestRepositoryQuotesIdentifiers(t *testing.T) {
+	repo, err := newCatalogRepository(nil, "shop.Products")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := repo.migrationsTable().Sanitize(), `"shop"."products_schema_migrations"`; got != want {
+		t.Errorf("migrations table: got %s, want %s", got, want)
+	}
+	if got, want := repo.variantsTable().Sanitize(), `"shop"."products_variants"`; got != want {
+		t.Errorf("variants table: got %s, want %s", got, want)
+	}
+	if sql := repo.upsertProductSQL(); !strings.HasPrefix(sql, `INSERT INTO "shop"."products" (`) {
+		t.Errorf("unexpected upsert statement:\n%s", sql)
+	}
+
+	if _, err := newCatalogRepository(nil, "products WHERE 1=1"); err == nil {
+		t.Error("expected invalid table name to be rejected")
+	}
+}
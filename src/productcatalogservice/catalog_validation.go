@@ -0,0 +1,275 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package productcatalogservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
+)
+
+// catalogProblem describes a single invalid entry in the product catalog.
+type catalogProblem struct {
+	index   int    // position of the product in the catalog
+	id      string // product ID, may be empty
+	field   string // proto field name, empty if the problem is the whole product
+	message string
+	line    int // 1-based line in the source file, 0 if unknown
+}
+
+func (p catalogProblem) String() string {
+	var b strings.Builder
+	if p.id != "" {
+		fmt.Fprintf(&b, "product %q", p.id)
+	} else {
+		fmt.Fprintf(&b, "product #%d", p.index)
+	}
+	if p.field != "" {
+		fmt.Fprintf(&b, ": %s", p.field)
+	}
+	fmt.Fprintf(&b, ": %s", p.message)
+	return b.String()
+}
+
+// validateCatalog checks the invariants the rest of the system relies on:
+// unique non-empty IDs and SKUs, valid non-negative USD prices, and pictures
+// and categories for every product. It returns every problem found.
+func validateCatalog(products []*pb.Product) []catalogProblem {
+	var problems []catalogProblem
+	seen := make(map[string]int)
+	seenSKUs := make(map[string]string)
+	for i, p := range products {
+		report := func(field, format string, args ...interface{}) {
+			problems = append(problems, catalogProblem{
+				index:   i,
+				id:      p.GetId(),
+				field:   field,
+				message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		switch id := p.GetId(); {
+		case id == "":
+			report("id", "missing")
+		case strings.TrimSpace(id) != id:
+			report("id", "has leading or trailing whitespace")
+		default:
+			if first, ok := seen[id]; ok {
+				report("id", "duplicate of product #%d", first)
+			} else {
+				seen[id] = i
+			}
+		}
+
+		if strings.TrimSpace(p.GetName()) == "" {
+			report("name", "missing")
+		}
+		if strings.TrimSpace(p.GetPicture()) == "" {
+			report("picture", "missing")
+		}
+
+		if p.GetPriceUsd() == nil {
+			report("price_usd", "missing")
+		} else {
+			price := p.GetPriceUsd()
+			if price.GetCurrencyCode() != "USD" {
+				report("price_usd", "currency code is %q, want \"USD\"", price.GetCurrencyCode())
+			}
+			if !money.IsValid(price) {
+				report("price_usd", "invalid money value (units=%d, nanos=%d)", price.GetUnits(), price.GetNanos())
+			} else if money.IsNegative(price) {
+				report("price_usd", "negative price")
+			}
+		}
+
+		if len(p.GetCategories()) == 0 {
+			report("categories", "empty")
+		}
+		for _, c := range p.GetCategories() {
+			if strings.TrimSpace(c) == "" {
+				report("categories", "contains an empty category")
+			} else if c != strings.ToLower(strings.TrimSpace(c)) {
+				report("categories", "category %q must be lower case without surrounding whitespace", c)
+			}
+		}
+
+		for j, v := range p.GetVariants() {
+			switch sku := v.GetSku(); {
+			case strings.TrimSpace(sku) == "":
+				report("variants", "variant #%d: missing sku", j)
+			case strings.TrimSpace(sku) != sku:
+				report("variants", "variant %q: sku has leading or trailing whitespace", sku)
+			default:
+				if owner, ok := seenSKUs[sku]; ok {
+					report("variants", "variant %q: sku already used by product %q", sku, owner)
+				} else {
+					seenSKUs[sku] = p.GetId()
+				}
+			}
+			if strings.TrimSpace(v.GetName()) == "" {
+				report("variants", "variant %q: missing name", v.GetSku())
+			}
+			if price := v.GetPriceOverrideUsd(); price != nil {
+				if price.GetCurrencyCode() != "USD" {
+					report("variants", "variant %q: price override currency code is %q, want \"USD\"", v.GetSku(), price.GetCurrencyCode())
+				}
+				if !money.IsValid(price) {
+					report("variants", "variant %q: invalid price override (units=%d, nanos=%d)", v.GetSku(), price.GetUnits(), price.GetNanos())
+				} else if money.IsNegative(price) {
+					report("variants", "variant %q: negative price override", v.GetSku())
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// productLines records where a product and its fields start in a JSON
+// catalog file.
+type productLines struct {
+	line   int
+	fields map[string]int // keyed by proto field name
+}
+
+// locateProducts returns the line of each element of the top-level
+// "products" array in a products.json formatted document. Field names are
+// normalized to proto names so that "priceUsd" and "price_usd" both map to
+// "price_usd".
+func locateProducts(data []byte) ([]productLines, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	lineAt := func(offset int64) int {
+		return bytes.Count(data[:offset], []byte("\n")) + 1
+	}
+	// nextOffset returns the offset of the next token, which is where the
+	// decoder will start reading the value.
+	nextOffset := func() int64 {
+		off := dec.InputOffset()
+		for off < int64(len(data)) && strings.ContainsRune(" \t\r\n:,", rune(data[off])) {
+			off++
+		}
+		return off
+	}
+
+	if t, err := dec.Token(); err != nil {
+		return nil, err
+	} else if t != json.Delim('{') {
+		return nil, fmt.Errorf("line %d: expected a JSON object", lineAt(dec.InputOffset()))
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key != "products" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if t, err := dec.Token(); err != nil {
+			return nil, err
+		} else if t != json.Delim('[') {
+			return nil, fmt.Errorf("line %d: \"products\" must be an array", lineAt(dec.InputOffset()))
+		}
+
+		var out []productLines
+		for dec.More() {
+			pl := productLines{line: lineAt(nextOffset()), fields: map[string]int{}}
+			if t, err := dec.Token(); err != nil {
+				return nil, err
+			} else if t != json.Delim('{') {
+				return nil, fmt.Errorf("line %d: product must be an object", pl.line)
+			}
+			for dec.More() {
+				keyOffset := nextOffset()
+				k, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				if name, ok := k.(string); ok {
+					pl.fields[protoFieldName(name)] = lineAt(keyOffset)
+				}
+				var skip json.RawMessage
+				if err := dec.Decode(&skip); err != nil {
+					return nil, err
+				}
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			out = append(out, pl)
+		}
+		return out, nil
+	}
+	return nil, nil
+}
+
+// protoFieldName converts a lowerCamelCase JSON name to its snake_case proto
+// field name. Names that are already snake_case are returned unchanged.
+func protoFieldName(jsonName string) string {
+	var b strings.Builder
+	for _, r := range jsonName {
+		if 'A' <= r && r <= 'Z' {
+			b.WriteByte('_')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// lintCatalog parses a products.json formatted document and returns all
+// problems with line numbers filled in where they can be determined.
+func lintCatalog(r io.Reader) ([]catalogProblem, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var syntax interface{}
+	if err := json.Unmarshal(data, &syntax); err != nil {
+		if se, ok := err.(*json.SyntaxError); ok {
+			return nil, fmt.Errorf("line %d: %v", bytes.Count(data[:se.Offset], []byte("\n"))+1, err)
+		}
+		return nil, err
+	}
+
+	var catalog pb.ListProductsResponse
+	if err := jsonUnmarshalCatalog(data, &catalog); err != nil {
+		return nil, err
+	}
+	lines, err := locateProducts(data)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := validateCatalog(catalog.GetProducts())
+	for i := range problems {
+		if problems[i].index >= len(lines) {
+			continue
+		}
+		pl := lines[problems[i].index]
+		problems[i].line = pl.line
+		if l, ok := pl.fields[problems[i].field]; ok {
+			problems[i].line = l
+		}
+	}
+	return problems, nil
+}
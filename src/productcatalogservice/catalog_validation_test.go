@@ -0,0 +1,142 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package productcatalogservice
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+)
+
+const badCatalog = `{
+    "products": [
+        {
+            "id": "A1",
+            "name": "Good",
+            "picture": "/static/img/products/a.jpg",
+            "priceUsd": {"currencyCode": "USD", "units": 1, "nanos": 500000000},
+            "categories": ["kitchen"]
+        },
+        {
+            "id": "A1",
+            "name": "Duplicate",
+            "picture": "/static/img/products/b.jpg",
+            "priceUsd": {"currencyCode": "USD", "units": 1, "nanos": -5},
+            "categories": []
+        },
+        {
+            "id": "C3",
+            "name": "Negative",
+            "price_usd": {"currencyCode": "USD", "units": -2, "nanos": 0},
+            "categories": ["Clothing"]
+        }
+    ]
+}`
+
+func TestLintCatalog(t *testing.T) {
+	problems, err := lintCatalog(strings.NewReader(badCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		line  int
+		field string
+	}{
+		{11, "id"},
+		{14, "price_usd"},
+		{15, "categories"},
+		{17, "picture"},
+		{20, "price_usd"},
+		{21, "categories"},
+	}
+	if len(problems) != len(want) {
+		for _, p := range problems {
+			t.Logf("line %d: %s", p.line, p)
+		}
+		t.Fatalf("got %d problems, want %d", len(problems), len(want))
+	}
+	for i, w := range want {
+		if problems[i].line != w.line || problems[i].field != w.field {
+			t.Errorf("problem %d: got line %d field %q (%s), want line %d field %q",
+				i, problems[i].line, problems[i].field, problems[i], w.line, w.field)
+		}
+	}
+}
+
+func TestValidateCatalogVariants(t *testing.T) {
+	product := func(id string, variants ...*pb.ProductVariant) *pb.Product {
+		return &pb.Product{
+			Id:         id,
+			Name:       id,
+			Picture:    "/static/img/products/" + id + ".jpg",
+			PriceUsd:   &pb.Money{CurrencyCode: "USD", Units: 1},
+			Categories: []string{"kitchen"},
+			Variants:   variants,
+		}
+	}
+	products := []*pb.Product{
+		product("A", &pb.ProductVariant{Sku: "A-1", Name: "One"},
+			&pb.ProductVariant{Sku: "", Name: "No SKU"},
+			&pb.ProductVariant{Sku: "A-2", PriceOverrideUsd: &pb.Money{CurrencyCode: "EUR", Units: 2}}),
+		product("B", &pb.ProductVariant{Sku: "A-1", Name: "Taken",
+			PriceOverrideUsd: &pb.Money{CurrencyCode: "USD", Units: -1}}),
+	}
+
+	want := []string{
+		`product "A": variants: variant #1: missing sku`,
+		`product "A": variants: variant "A-2": missing name`,
+		`product "A": variants: variant "A-2": price override currency code is "EUR", want "USD"`,
+		`product "B": variants: variant "A-1": sku already used by product "A"`,
+		`product "B": variants: variant "A-1": negative price override`,
+	}
+	problems := validateCatalog(products)
+	if len(problems) != len(want) {
+		for _, p := range problems {
+			t.Log(p)
+		}
+		t.Fatalf("got %d problems, want %d", len(problems), len(want))
+	}
+	for i, w := range want {
+		if got := problems[i].String(); got != w {
+			t.Errorf("problem %d: got %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestLintCatalogSyntaxError(t *testing.T) {
+	_, err := lintCatalog(strings.NewReader("{\n  \"products\": [\n    {,}\n  ]\n}"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("got %v, want a syntax error on line 3", err)
+	}
+}
+
+func TestShippedCatalogIsValid(t *testing.T) {
+	f, err := os.Open("products.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	problems, err := lintCatalog(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Errorf("products.json:%d: %s", p.line, p)
+	}
+}
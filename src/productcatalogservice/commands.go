@@ -0,0 +1,150 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package productcatalogservice
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+)
+
+// command is a one-off administrative task run instead of the gRPC server,
+// e.g. "productcatalogservice migrate".
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"catalog-lint": {
+		usage: "catalog-lint [file ...]\n\tValidate JSON catalog files (default products.json) and report every problem.",
+		run:   catalogLintCommand,
+	},
+	"migrate": {
+		usage: "migrate\n\tApply pending schema migrations to the AlloyDB catalog table.",
+		run:   migrateCommand,
+	},
+	"seed": {
+		usage: "seed [-file products.json]\n\tMigrate the AlloyDB catalog table and upsert products from a JSON catalog.",
+		run:   seedCommand,
+	},
+}
+
+// runCommand runs the command named by args[0] and returns the process exit
+// code.
+func runCommand(ctx context.Context, args []string) int {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q; available commands:\n", args[0])
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+		}
+		return 2
+	}
+	if err := cmd.run(ctx, args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func migrateCommand(ctx context.Context, args []string) error {
+	repo, cleanup, err := newAlloyDBRepository(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	version, err := repo.migrate(ctx)
+	if err != nil {
+		return err
+	}
+	log.Infof("catalog schema is at version %d", version)
+	return nil
+}
+
+func seedCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := fs.String("file", "products.json", "catalog JSON file to load")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var catalog pb.ListProductsResponse
+	if err := readCatalogFile(*file, &catalog); err != nil {
+		return err
+	}
+
+	if problems := validateCatalog(catalog.GetProducts()); len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *file, p)
+		}
+		return fmt.Errorf("refusing to seed a catalog with %d problem(s)", len(problems))
+	}
+
+	repo, cleanup, err := newAlloyDBRepository(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if _, err := repo.migrate(ctx); err != nil {
+		return err
+	}
+	if err := repo.seed(ctx, catalog.GetProducts()); err != nil {
+		return err
+	}
+	log.Infof("seeded %d products from %s", len(catalog.GetProducts()), *file)
+	return nil
+}
+
+func catalogLintCommand(ctx context.Context, args []string) error {
+	files := args
+	if len(files) == 0 {
+		files = []string{"products.json"}
+	}
+
+	total := 0
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		problems, err := lintCatalog(f)
+		f.Close()
+		if err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			total++
+			continue
+		}
+		for _, p := range problems {
+			fmt.Printf("%s:%d: %s\n", name, p.line, p)
+		}
+		total += len(problems)
+	}
+	if total > 0 {
+		return fmt.Errorf("found %d problem(s)", total)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package productcatalogservice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultReservationTTL = 5 * time.Minute
+	maxReservationTTL     = 30 * time.Minute
+)
+
+// reservation is stock held for a checkout in progress.
+type reservation struct {
+	items   map[string]int32 // keyed by SKU
+	expires time.Time
+}
+
+// inventory implements InventoryService with in-memory stock levels.
+// Reservations expire lazily: every call first drops reservations whose TTL
+// has passed and returns their stock.
+type inventory struct {
+	pb.UnimplementedInventoryServiceServer
+
+	mu           sync.Mutex
+	levels       map[string]int32 // configured stock levels, restored by restock
+	onHand       map[string]int32 // tracked SKUs only
+	reserved     map[string]int32
+	reservations map[string]*reservation
+
+	now func() time.Time
+}
+
+func newInventory(stock map[string]int32) *inventory {
+	levels := make(map[string]int32, len(stock))
+	for sku, n := range stock {
+		levels[sku] = n
+	}
+	i := &inventory{
+		levels:       levels,
+		reserved:     make(map[string]int32),
+		reservations: make(map[string]*reservation),
+		now:          time.Now,
+	}
+	i.restock()
+	return i
+}
+
+// restock resets the stock on hand to the configured levels. Open
+// reservations are kept and still count against the new levels.
+func (i *inventory) restock() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.onHand = make(map[string]int32, len(i.levels))
+	for sku, n := range i.levels {
+		i.onHand[sku] = n
+	}
+}
+
+// restockEvery calls restock every d until ctx is done.
+func (i *inventory) restockEvery(ctx context.Context, d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			i.restock()
+			log.Info("restocked inventory")
+		}
+	}
+}
+
+// loadInventory reads stock levels from a JSON file of the form
+// {"stock": {"<sku>": <units>, ...}}. A missing file leaves every SKU
+// untracked.
+func loadInventory(path string) (*inventory, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Warnf("inventory file %s not found, stock is not tracked", path)
+		return newInventory(nil), nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read inventory file")
+	}
+	var file struct {
+		Stock map[string]int32 `json:"stock"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse inventory file %s", path)
+	}
+	for sku, n := range file.Stock {
+		if n < 0 {
+			return nil, errors.Errorf("inventory file %s: negative stock for %s", path, sku)
+		}
+	}
+	log.Infof("loaded stock levels for %d SKUs from %s", len(file.Stock), path)
+	return newInventory(file.Stock), nil
+}
+
+// stockKey returns the SKU stock is tracked under for a cart item.
+func stockKey(item *pb.CartItem) string {
+	if item.GetVariantSku() != "" {
+		return item.GetVariantSku()
+	}
+	return item.GetProductId()
+}
+
+// expireLocked drops reservations that have expired. i.mu must be held.
+func (i *inventory) expireLocked() {
+	now := i.now()
+	for id, r := range i.reservations {
+		if now.Before(r.expires) {
+			continue
+		}
+		i.releaseLocked(r)
+		delete(i.reservations, id)
+	}
+}
+
+// releaseLocked returns the stock held by r. i.mu must be held.
+func (i *inventory) releaseLocked(r *reservation) {
+	for sku, n := range r.items {
+		if i.reserved[sku] -= n; i.reserved[sku] <= 0 {
+			delete(i.reserved, sku)
+		}
+	}
+}
+
+// availableLocked returns the unreserved stock of a tracked SKU. i.mu must be
+// held.
+func (i *inventory) availableLocked(sku string) (n int32, tracked bool) {
+	onHand, tracked := i.onHand[sku]
+	if !tracked {
+		return 0, false
+	}
+	return onHand - i.reserved[sku], true
+}
+
+func (i *inventory) GetStock(ctx context.Context, req *pb.GetStockRequest) (*pb.GetStockResponse, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.expireLocked()
+
+	resp := &pb.GetStockResponse{Levels: make([]*pb.StockLevel, len(req.GetSkus()))}
+	for j, sku := range req.GetSkus() {
+		n, tracked := i.availableLocked(sku)
+		resp.Levels[j] = &pb.StockLevel{Sku: sku, Available: n, Tracked: tracked}
+	}
+	return resp, nil
+}
+
+func (i *inventory) ReserveStock(ctx context.Context, req *pb.ReserveStockRequest) (*pb.ReserveStockResponse, error) {
+	ttl := defaultReservationTTL
+	switch s := req.GetTtlSeconds(); {
+	case s < 0:
+		return nil, status.Errorf(codes.InvalidArgument, "ttl_seconds must not be negative, got %d", s)
+	case s > 0:
+		ttl = time.Duration(s) * time.Second
+		if ttl > maxReservationTTL {
+			return nil, status.Errorf(codes.InvalidArgument, "ttl_seconds must be at most %d", int(maxReservationTTL.Seconds()))
+		}
+	}
+	if len(req.GetItems()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no items to reserve")
+	}
+
+	wanted := make(map[string]int32)
+	for _, item := range req.GetItems() {
+		if item.GetQuantity() <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid quantity %d for %s", item.GetQuantity(), stockKey(item))
+		}
+		wanted[stockKey(item)] += item.GetQuantity()
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.expireLocked()
+
+	var short []string
+	items := make(map[string]int32, len(wanted))
+	for sku, n := range wanted {
+		available, tracked := i.availableLocked(sku)
+		if !tracked {
+			continue
+		}
+		if available < n {
+			short = append(short, sku)
+		}
+		items[sku] = n
+	}
+	if len(short) > 0 {
+		sort.Strings(short)
+		return nil, status.Errorf(codes.FailedPrecondition, "insufficient stock for %s", strings.Join(short, ", "))
+	}
+
+	id, err := newReservationID()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate reservation ID: %v", err)
+	}
+	r := &reservation{items: items, expires: i.now().Add(ttl)}
+	for sku, n := range items {
+		i.reserved[sku] += n
+	}
+	i.reservations[id] = r
+	return &pb.ReserveStockResponse{ReservationId: id, ExpiresAtUnixSeconds: r.expires.Unix()}, nil
+}
+
+func (i *inventory) CommitReservation(ctx context.Context, req *pb.CommitReservationRequest) (*pb.Empty, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.expireLocked()
+
+	r, ok := i.reservations[req.GetReservationId()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no reservation with ID %s, it may have expired", req.GetReservationId())
+	}
+	i.releaseLocked(r)
+	for sku, n := range r.items {
+		i.onHand[sku] -= n
+	}
+	delete(i.reservations, req.GetReservationId())
+	return &pb.Empty{}, nil
+}
+
+// ReleaseReservation is idempotent: releasing an unknown or expired
+// reservation succeeds, since its stock has already been returned.
+func (i *inventory) ReleaseReservation(ctx context.Context, req *pb.ReleaseReservationRequest) (*pb.Empty, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.expireLocked()
+
+	if r, ok := i.reservations[req.GetReservationId()]; ok {
+		i.releaseLocked(r)
+		delete(i.reservations, req.GetReservationId())
+	}
+	return &pb.Empty{}, nil
+}
+
+func newReservationID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package productcatalogservice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testInventory returns an inventory with a controllable clock.
+func testInventory(stock map[string]int32) (*inventory, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	inv := newInventory(stock)
+	inv.now = func() time.Time { return now }
+	return inv, &now
+}
+
+func available(t *testing.T, inv *inventory, sku string) int32 {
+	t.Helper()
+	resp, err := inv.GetStock(context.Background(), &pb.GetStockRequest{Skus: []string{sku}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Levels[0].Available
+}
+
+func TestReserveAndCommit(t *testing.T) {
+	ctx := context.Background()
+	inv, _ := testInventory(map[string]int32{"A": 5, "B-M": 2})
+
+	res, err := inv.ReserveStock(ctx, &pb.ReserveStockRequest{Items: []*pb.CartItem{
+		{ProductId: "A", Quantity: 3},
+		{ProductId: "B", VariantSku: "B-M", Quantity: 2},
+		{ProductId: "untracked", Quantity: 100},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := available(t, inv, "A"), int32(2); got != want {
+		t.Errorf("available A after reserve: got %d, want %d", got, want)
+	}
+
+	_, err = inv.ReserveStock(ctx, &pb.ReserveStockRequest{Items: []*pb.CartItem{{ProductId: "A", Quantity: 3}}})
+	if got, want := status.Code(err), codes.FailedPrecondition; got != want {
+		t.Errorf("over-reserving: got %s, want %s", got, want)
+	}
+
+	if _, err := inv.CommitReservation(ctx, &pb.CommitReservationRequest{ReservationId: res.ReservationId}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := available(t, inv, "A"), int32(2); got != want {
+		t.Errorf("available A after commit: got %d, want %d", got, want)
+	}
+	if got, want := available(t, inv, "B-M"), int32(0); got != want {
+		t.Errorf("available B-M after commit: got %d, want %d", got, want)
+	}
+
+	_, err = inv.CommitReservation(ctx, &pb.CommitReservationRequest{ReservationId: res.ReservationId})
+	if got, want := status.Code(err), codes.NotFound; got != want {
+		t.Errorf("committing twice: got %s, want %s", got, want)
+	}
+}
+
+func TestReleaseReservation(t *testing.T) {
+	ctx := context.Background()
+	inv, _ := testInventory(map[string]int32{"A": 5})
+
+	res, err := inv.ReserveStock(ctx, &pb.ReserveStockRequest{Items: []*pb.CartItem{{ProductId: "A", Quantity: 5}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := inv.ReleaseReservation(ctx, &pb.ReleaseReservationRequest{ReservationId: res.ReservationId}); err != nil {
+			t.Fatalf("release #%d: %v", i+1, err)
+		}
+	}
+	if got, want := available(t, inv, "A"), int32(5); got != want {
+		t.Errorf("available after release: got %d, want %d", got, want)
+	}
+}
+
+func TestReservationExpires(t *testing.T) {
+	ctx := context.Background()
+	inv, now := testInventory(map[string]int32{"A": 5})
+
+	res, err := inv.ReserveStock(ctx, &pb.ReserveStockRequest{
+		Items:      []*pb.CartItem{{ProductId: "A", Quantity: 4}},
+		TtlSeconds: 60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.ExpiresAtUnixSeconds, now.Add(time.Minute).Unix(); got != want {
+		t.Errorf("expiry: got %d, want %d", got, want)
+	}
+
+	*now = now.Add(time.Minute)
+	if got, want := available(t, inv, "A"), int32(5); got != want {
+		t.Errorf("available after expiry: got %d, want %d", got, want)
+	}
+	_, err = inv.CommitReservation(ctx, &pb.CommitReservationRequest{ReservationId: res.ReservationId})
+	if got, want := status.Code(err), codes.NotFound; got != want {
+		t.Errorf("committing expired reservation: got %s, want %s", got, want)
+	}
+}
+
+func TestReserveStockInvalidArgument(t *testing.T) {
+	inv, _ := testInventory(nil)
+	tests := []struct {
+		name string
+		req  *pb.ReserveStockRequest
+	}{
+		{"no items", &pb.ReserveStockRequest{}},
+		{"zero quantity", &pb.ReserveStockRequest{Items: []*pb.CartItem{{ProductId: "A"}}}},
+		{"negative ttl", &pb.ReserveStockRequest{Items: []*pb.CartItem{{ProductId: "A", Quantity: 1}}, TtlSeconds: -1}},
+		{"ttl too long", &pb.ReserveStockRequest{Items: []*pb.CartItem{{ProductId: "A", Quantity: 1}}, TtlSeconds: 3600}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := inv.ReserveStock(context.Background(), tt.req)
+			if got, want := status.Code(err), codes.InvalidArgument; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestRestock(t *testing.T) {
+	ctx := context.Background()
+	inv, _ := testInventory(map[string]int32{"A": 5})
+
+	res, err := inv.ReserveStock(ctx, &pb.ReserveStockRequest{Items: []*pb.CartItem{{ProductId: "A", Quantity: 5}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inv.CommitReservation(ctx, &pb.CommitReservationRequest{ReservationId: res.ReservationId}); err != nil {
+		t.Fatal(err)
+	}
+	inv.restock()
+	if got, want := available(t, inv, "A"), int32(5); got != want {
+		t.Errorf("available after restock: got %d, want %d", got, want)
+	}
+}
+
+func TestShippedInventoryCoversCatalog(t *testing.T) {
+	inv, err := loadInventory("inventory.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var catalog pb.ListProductsResponse
+	if err := readCatalogFile("products.json", &catalog); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range catalog.GetProducts() {
+		skus := []string{p.GetId()}
+		if len(p.GetVariants()) > 0 {
+			skus = nil
+			for _, v := range p.GetVariants() {
+				skus = append(skus, v.GetSku())
+			}
+		}
+		for _, sku := range skus {
+			if _, ok := inv.levels[sku]; !ok {
+				t.Errorf("inventory.json has no stock level for %s", sku)
+			}
+		}
+	}
+}
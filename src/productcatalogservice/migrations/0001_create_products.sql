@@ -0,0 +1,13 @@
+-- Creates the product catalog table. The shape matches the table created by
+-- kustomize/components/shopping-assistant/scripts, so on existing databases
+-- this migration only records the baseline version.
+CREATE TABLE IF NOT EXISTS {{.Table}} (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT,
+    picture TEXT,
+    price_usd_currency_code TEXT NOT NULL,
+    price_usd_units BIGINT NOT NULL,
+    price_usd_nanos INTEGER NOT NULL,
+    categories TEXT
+);
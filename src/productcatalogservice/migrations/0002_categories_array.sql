@@ -0,0 +1,7 @@
+-- Stores categories as a TEXT[] instead of a comma-separated string. Existing
+-- values are split on commas, trimmed and lower-cased.
+ALTER TABLE {{.Table}}
+    ALTER COLUMN categories TYPE TEXT[]
+        USING array_remove(regexp_split_to_array(lower(btrim(COALESCE(categories, ''))), '\s*,\s*'), ''),
+    ALTER COLUMN categories SET DEFAULT '{}',
+    ALTER COLUMN categories SET NOT NULL;
@@ -0,0 +1,18 @@
+-- Adds additional product images and a table of purchasable variants (sizes,
+-- colours, ...) with optional per-variant prices.
+ALTER TABLE {{.Table}}
+    ADD COLUMN IF NOT EXISTS images TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS {{.VariantsTable}} (
+    sku TEXT PRIMARY KEY,
+    product_id TEXT NOT NULL REFERENCES {{.Table}} (id) ON DELETE CASCADE,
+    position INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    price_override_usd_currency_code TEXT,
+    price_override_usd_units BIGINT,
+    price_override_usd_nanos INTEGER,
+    attributes JSONB NOT NULL DEFAULT '{}',
+    images TEXT[] NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS {{.VariantsIndex}} ON {{.VariantsTable}} (product_id, position);
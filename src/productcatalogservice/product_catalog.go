@@ -12,14 +12,15 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package productcatalogservice
 
 import (
 	"context"
 	"strings"
+	"sync"
 	"time"
 
-	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
 	"google.golang.org/grpc/codes"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
@@ -27,7 +28,13 @@ import (
 
 type productCatalog struct {
 	pb.UnimplementedProductCatalogServiceServer
-	catalog pb.ListProductsResponse
+
+	// mu guards products, which reloads replace but never modify. Reloads
+	// hold it to publish their changes too, so watchers see the versions in
+	// the order the catalogs were installed.
+	mu       sync.RWMutex
+	products []*pb.Product
+	feed     catalogFeed
 }
 
 func (p *productCatalog) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
@@ -71,13 +78,90 @@ func (p *productCatalog) SearchProducts(ctx context.Context, req *pb.SearchProdu
 	return &pb.SearchProductsResponse{Results: ps}, nil
 }
 
+func (p *productCatalog) GetProductVariants(ctx context.Context, req *pb.GetProductVariantsRequest) (*pb.GetProductVariantsResponse, error) {
+	time.Sleep(extraLatency)
+
+	for _, product := range p.parseCatalog() {
+		if req.ProductId == product.Id {
+			return &pb.GetProductVariantsResponse{Variants: product.Variants}, nil
+		}
+	}
+
+	return nil, status.Errorf(codes.NotFound, "no product with ID %s", req.ProductId)
+}
+
+func (p *productCatalog) WatchCatalog(req *pb.WatchCatalogRequest, stream pb.ProductCatalogService_WatchCatalogServer) error {
+	backlog, changes, cancel := p.feed.subscribe(req.GetSinceVersion())
+	defer cancel()
+
+	for _, change := range backlog {
+		if err := stream.Send(change); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case change, ok := <-changes:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watcher fell behind, resume from the last version received")
+			}
+			if err := stream.Send(change); err != nil {
+				return err
+			}
+		}
+	}
+}
+
 func (p *productCatalog) parseCatalog() []*pb.Product {
-	if reloadCatalog || len(p.catalog.Products) == 0 {
-		err := loadCatalog(&p.catalog)
-		if err != nil {
-			return []*pb.Product{}
+	if reloadCatalog.Load() || len(p.current()) == 0 {
+		if err := p.reload(); err != nil {
+			log.Warnf("failed to reload catalog, serving the one loaded before: %v", err)
 		}
 	}
 
-	return p.catalog.Products
+	return p.current()
+}
+
+// current returns the installed catalog. It must not be modified.
+func (p *productCatalog) current() []*pb.Product {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.products
+}
+
+// reload loads the catalog again and notifies watchers of any changes. If
+// the catalog fails to load, the one installed before stays. Reloads run one
+// at a time, so a slow load can't replace a newer catalog.
+func (p *productCatalog) reload() error {
+	catalogMutex.Lock()
+	defer catalogMutex.Unlock()
+
+	products, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.products = products
+	p.feed.publish(products)
+	return nil
+}
+
+// reloadEvery reloads the catalog every d, so that watchers see changes made
+// to its source even when no requests arrive.
+func (p *productCatalog) reloadEvery(ctx context.Context, d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := p.reload(); err != nil {
+				log.Warnf("failed to reload catalog: %v", err)
+			}
+		}
+	}
 }
@@ -12,14 +12,15 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package productcatalogservice
 
 import (
 	"context"
 	"os"
+	"sync"
 	"testing"
 
-	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -30,26 +31,28 @@ var (
 
 func TestMain(m *testing.M) {
 	mockProductCatalog = &productCatalog{
-		catalog: pb.ListProductsResponse{
-			Products: []*pb.Product{},
-		},
+		products: []*pb.Product{},
 	}
 
-	mockProductCatalog.catalog.Products = append(mockProductCatalog.catalog.Products, &pb.Product{
+	mockProductCatalog.products = append(mockProductCatalog.products, &pb.Product{
 		Id:   "abc001",
 		Name: "Product Alpha One",
 	})
-	mockProductCatalog.catalog.Products = append(mockProductCatalog.catalog.Products, &pb.Product{
+	mockProductCatalog.products = append(mockProductCatalog.products, &pb.Product{
 		Id:   "abc002",
 		Name: "Product Delta",
 	})
-	mockProductCatalog.catalog.Products = append(mockProductCatalog.catalog.Products, &pb.Product{
+	mockProductCatalog.products = append(mockProductCatalog.products, &pb.Product{
 		Id:   "abc003",
 		Name: "Product Alpha Two",
 	})
-	mockProductCatalog.catalog.Products = append(mockProductCatalog.catalog.Products, &pb.Product{
+	mockProductCatalog.products = append(mockProductCatalog.products, &pb.Product{
 		Id:   "abc004",
 		Name: "Product Gamma",
+		Variants: []*pb.ProductVariant{
+			{Sku: "abc004-S", Name: "Small"},
+			{Sku: "abc004-L", Name: "Large"},
+		},
 	})
 
 	os.Exit(m.Run())
@@ -99,3 +102,87 @@ func TestSearchProducts(t *testing.T) {
 		t.Errorf("got %d, want %d", got, want)
 	}
 }
+
+func TestGetProductVariants(t *testing.T) {
+	resp, err := mockProductCatalog.GetProductVariants(context.Background(),
+		&pb.GetProductVariantsRequest{ProductId: "abc004"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(resp.Variants), 2; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+	if got, want := resp.Variants[1].Sku, "abc004-L"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	_, err = mockProductCatalog.GetProductVariants(context.Background(),
+		&pb.GetProductVariantsRequest{ProductId: "abc005"},
+	)
+	if got, want := status.Code(err), codes.NotFound; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestReloadWhileServing(t *testing.T) {
+	svc := &productCatalog{}
+	if err := svc.reload(); err != nil {
+		t.Fatal(err)
+	}
+	want := len(svc.current())
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := svc.reload(); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			resp, err := svc.ListProducts(context.Background(), &pb.Empty{})
+			if err != nil || len(resp.GetProducts()) != want {
+				t.Errorf("ListProducts during a reload returned %d products, %v; want %d", len(resp.GetProducts()), err, want)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestReloadInvalidCatalog(t *testing.T) {
+	valid, err := os.ReadFile("products.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("products.json", valid, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	svc := &productCatalog{}
+	if err := svc.reload(); err != nil {
+		t.Fatal(err)
+	}
+	want := len(svc.current())
+
+	if err := os.WriteFile("products.json", []byte(`{"products": [{"id": "", "name": "Nameless"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reloadCatalog.Store(true)
+	defer reloadCatalog.Store(false)
+	if err := svc.reload(); err == nil {
+		t.Fatal("reloading an invalid catalog succeeded")
+	}
+	resp, err := svc.ListProducts(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(resp.GetProducts()); got != want || want == 0 {
+		t.Errorf("after an invalid reload, ListProducts returned %d products, want the %d loaded before", got, want)
+	}
+	if _, err := svc.GetProduct(context.Background(), &pb.GetProductRequest{Id: svc.current()[0].GetId()}); err != nil {
+		t.Errorf("after an invalid reload, GetProduct failed: %v", err)
+	}
+}
@@ -12,20 +12,22 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package productcatalogservice
 
 import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
@@ -48,7 +50,7 @@ var (
 
 	port = "3550"
 
-	reloadCatalog bool
+	reloadCatalog atomic.Bool
 )
 
 func init() {
@@ -65,7 +67,28 @@ func init() {
 	catalogMutex = &sync.Mutex{}
 }
 
-func main() {
+// Main runs the command named by the arguments, or serves the product catalog
+// on PORT until it fails.
+func Main() {
+	flag.Parse()
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(context.Background(), flag.Args()))
+	}
+
+	if os.Getenv("PORT") != "" {
+		port = os.Getenv("PORT")
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("starting grpc server at :%s", port)
+	log.Fatal(Serve(context.Background(), listener))
+}
+
+// Serve serves the product catalog and inventory on lis until ctx is done. It
+// is configured by the same environment variables as Main, apart from PORT.
+func Serve(ctx context.Context, lis net.Listener) error {
 	if os.Getenv("ENABLE_TRACING") == "1" {
 		err := initTracing()
 		if err != nil {
@@ -82,13 +105,11 @@ func main() {
 		log.Info("Profiling disabled.")
 	}
 
-	flag.Parse()
-
 	// set injected latency
 	if s := os.Getenv("EXTRA_LATENCY"); s != "" {
 		v, err := time.ParseDuration(s)
 		if err != nil {
-			log.Fatalf("failed to parse EXTRA_LATENCY (%s) as time.Duration: %+v", v, err)
+			return errors.Wrapf(err, "failed to parse EXTRA_LATENCY (%s) as time.Duration", s)
 		}
 		extraLatency = v
 		log.Infof("extra latency enabled (duration: %v)", extraLatency)
@@ -98,34 +119,26 @@ func main() {
 
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(sigs)
 	go func() {
 		for {
-			sig := <-sigs
+			var sig os.Signal
+			select {
+			case sig = <-sigs:
+			case <-ctx.Done():
+				return
+			}
 			log.Printf("Received signal: %s", sig)
 			if sig == syscall.SIGUSR1 {
-				reloadCatalog = true
+				reloadCatalog.Store(true)
 				log.Infof("Enable catalog reloading")
 			} else {
-				reloadCatalog = false
+				reloadCatalog.Store(false)
 				log.Infof("Disable catalog reloading")
 			}
 		}
 	}()
 
-	if os.Getenv("PORT") != "" {
-		port = os.Getenv("PORT")
-	}
-	log.Infof("starting grpc server at :%s", port)
-	run(port)
-	select {}
-}
-
-func run(port string) string {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
-	if err != nil {
-		log.Fatal(err)
-	}
-
 	// Propagate trace context
 	otel.SetTextMapPropagator(
 		propagation.NewCompositeTextMapPropagator(
@@ -135,17 +148,49 @@ func run(port string) string {
 		grpc.StatsHandler(otelgrpc.NewServerHandler()))
 
 	svc := &productCatalog{}
-	err = loadCatalog(&svc.catalog)
+	if err := svc.reload(); err != nil {
+		return errors.Wrap(err, "could not parse product catalog")
+	}
+	if s := os.Getenv("CATALOG_RELOAD_INTERVAL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse CATALOG_RELOAD_INTERVAL (%s) as time.Duration", s)
+		}
+		if d > 0 {
+			go svc.reloadEvery(ctx, d)
+		}
+	}
+
+	inventoryFile := "inventory.json"
+	if f := os.Getenv("INVENTORY_FILE"); f != "" {
+		inventoryFile = f
+	}
+	inv, err := loadInventory(inventoryFile)
 	if err != nil {
-		log.Fatalf("could not parse product catalog: %v", err)
+		return errors.Wrap(err, "could not load inventory")
+	}
+	restockInterval := time.Hour
+	if s := os.Getenv("INVENTORY_RESTOCK_INTERVAL"); s != "" {
+		restockInterval, err = time.ParseDuration(s)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse INVENTORY_RESTOCK_INTERVAL (%s) as time.Duration", s)
+		}
+	}
+	if restockInterval > 0 {
+		go inv.restockEvery(ctx, restockInterval)
 	}
 
 	pb.RegisterProductCatalogServiceServer(srv, svc)
+	pb.RegisterInventoryServiceServer(srv, inv)
 	healthcheck := health.NewServer()
 	healthpb.RegisterHealthServer(srv, healthcheck)
-	go srv.Serve(listener)
+	defer context.AfterFunc(ctx, srv.Stop)()
+	return srv.Serve(lis)
+}
 
-	return listener.Addr().String()
+// SetLogOutput sends the service's logs to w instead of standard output.
+func SetLogOutput(w io.Writer) {
+	log.SetOutput(w)
 }
 
 func initStats() {
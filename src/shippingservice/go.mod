@@ -6,10 +6,11 @@ toolchain go1.26.5
 
 require (
 	cloud.google.com/go/profiler v0.6.0
+	github.com/GoogleCloudPlatform/microservices-demo/src/genproto v0.0.0
+	github.com/GoogleCloudPlatform/microservices-demo/src/money v0.0.0
 	github.com/sirupsen/logrus v1.9.4
 	golang.org/x/net v0.57.0
 	google.golang.org/grpc v1.83.0
-	google.golang.org/protobuf v1.36.11
 )
 
 require (
@@ -41,4 +42,9 @@ require (
 	google.golang.org/genproto v0.0.0-20260319201613-d00831a3d3e7 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20260526163538-3dc84a4a5aaa // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20260526163538-3dc84a4a5aaa // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
 )
+
+replace github.com/GoogleCloudPlatform/microservices-demo/src/genproto => ../genproto
+
+replace github.com/GoogleCloudPlatform/microservices-demo/src/money => ../money
@@ -12,24 +12,25 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package shippingservice
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"time"
 
 	"cloud.google.com/go/profiler"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
-	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
@@ -53,7 +54,27 @@ func init() {
 	log.Out = os.Stdout
 }
 
-func main() {
+// Main runs the shipping service on PORT until it fails.
+func Main() {
+	port := defaultPort
+	if value, ok := os.LookupEnv("PORT"); ok {
+		port = value
+	}
+	port = fmt.Sprintf(":%s", port)
+
+	lis, err := net.Listen("tcp", port)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	log.Infof("Shipping Service listening on port %s", port)
+	if err := Serve(context.Background(), lis); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// Serve serves the shipping service on lis until ctx is done. It is configured
+// by the same environment variables as Main, apart from PORT.
+func Serve(ctx context.Context, lis net.Listener) error {
 	if os.Getenv("DISABLE_TRACING") == "" {
 		log.Info("Tracing enabled, but temporarily unavailable")
 		log.Info("See https://github.com/GoogleCloudPlatform/microservices-demo/issues/422 for more info.")
@@ -69,17 +90,6 @@ func main() {
 		log.Info("Profiling disabled.")
 	}
 
-	port := defaultPort
-	if value, ok := os.LookupEnv("PORT"); ok {
-		port = value
-	}
-	port = fmt.Sprintf(":%s", port)
-
-	lis, err := net.Listen("tcp", port)
-	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
-	}
-
 	var srv *grpc.Server
 	if os.Getenv("DISABLE_STATS") == "" {
 		log.Info("Stats enabled, but temporarily unavailable")
@@ -92,13 +102,16 @@ func main() {
 	pb.RegisterShippingServiceServer(srv, svc)
 	healthcheck := health.NewServer()
 	healthpb.RegisterHealthServer(srv, healthcheck)
-	log.Infof("Shipping Service listening on port %s", port)
 
 	// Register reflection service on gRPC server.
 	reflection.Register(srv)
-	if err := srv.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
-	}
+	defer context.AfterFunc(ctx, srv.Stop)()
+	return srv.Serve(lis)
+}
+
+// SetLogOutput sends the service's logs to w instead of standard output.
+func SetLogOutput(w io.Writer) {
+	log.SetOutput(w)
 }
 
 // server controls RPC service responses.
@@ -129,10 +142,7 @@ func (s *server) GetQuote(ctx context.Context, in *pb.GetQuoteRequest) (*pb.GetQ
 
 	// 2. Generate a response.
 	return &pb.GetQuoteResponse{
-		CostUsd: &pb.Money{
-			CurrencyCode: "USD",
-			Units:        int64(quote.Dollars),
-			Nanos:        int32(quote.Cents * 10000000)},
+		CostUsd: quote,
 	}, nil
 
 }
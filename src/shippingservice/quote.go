@@ -12,37 +12,26 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package shippingservice
 
 import (
-	"fmt"
-	"math"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
 )
 
-// Quote represents a currency value.
-type Quote struct {
-	Dollars uint32
-	Cents   uint32
-}
-
-// String representation of the Quote.
-func (q Quote) String() string {
-	return fmt.Sprintf("$%d.%d", q.Dollars, q.Cents)
-}
+// flatRate is the cost of shipping any non-empty order.
+const flatRate = "8.99"
 
 // CreateQuoteFromCount takes a number of items and returns a shipping quote.
-func CreateQuoteFromCount(count int) Quote {
+func CreateQuoteFromCount(count int) *pb.Money {
 	if count == 0 {
-		return CreateQuoteFromFloat(0)
+		return money.Must(CreateQuote("0"))
 	}
-	return CreateQuoteFromFloat(8.99)
+	return money.Must(CreateQuote(flatRate))
 }
 
-// CreateQuoteFromFloat takes a price represented as a float and creates a Price struct.
-func CreateQuoteFromFloat(value float64) Quote {
-	units, fraction := math.Modf(value)
-	return Quote{
-		uint32(units),
-		uint32(math.Trunc(fraction * 100)),
-	}
-}
\ No newline at end of file
+// CreateQuote takes a price in USD written as a decimal number and creates a
+// quote, without the rounding errors of going through a float.
+func CreateQuote(usd string) (*pb.Money, error) {
+	return money.ParseDecimal[pb.Money](usd, "USD")
+}
@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package shippingservice
 
 import (
 	"regexp"
@@ -20,7 +20,8 @@ import (
 
 	"golang.org/x/net/context"
 
-	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/money"
 )
 
 // TestGetQuote is a basic check on the GetQuote RPC service.
@@ -136,42 +137,51 @@ func TestTrackingIdUniqueness(t *testing.T) {
 	}
 }
 
-// TestCreateQuoteFromFloat verifies quote creation from float values.
-func TestCreateQuoteFromFloat(t *testing.T) {
+// TestCreateQuote verifies quote creation from decimal prices.
+func TestCreateQuote(t *testing.T) {
 	tests := []struct {
-		name    string
-		value   float64
-		dollars uint32
-		cents   uint32
+		name  string
+		value string
+		units int64
+		nanos int32
 	}{
-		{"zero", 0.0, 0, 0},
-		{"whole dollars", 10.0, 10, 0},
-		{"with cents", 8.99, 8, 99},
-		{"small value", 0.50, 0, 50},
-		{"large value", 100.01, 100, 1},
+		{"zero", "0", 0, 0},
+		{"whole dollars", "10", 10, 0},
+		{"with cents", "8.99", 8, 990000000},
+		{"small value", "0.50", 0, 500000000},
+		{"large value", "100.01", 100, 10000000},
+		{"leading zero cents", "8.05", 8, 50000000},
+		{"sub-cent", "0.125", 0, 125000000},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			q := CreateQuoteFromFloat(tc.value)
-			if q.Dollars != tc.dollars || q.Cents != tc.cents {
-				t.Errorf("CreateQuoteFromFloat(%v) = $%d.%d, want $%d.%d",
-					tc.value, q.Dollars, q.Cents, tc.dollars, tc.cents)
+			q, err := CreateQuote(tc.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.GetCurrencyCode() != "USD" || q.GetUnits() != tc.units || q.GetNanos() != tc.nanos {
+				t.Errorf("CreateQuote(%q) = %s, want %d.%09d USD",
+					tc.value, money.String(q), tc.units, tc.nanos)
 			}
 		})
 	}
+
+	if _, err := CreateQuote("8,99"); err == nil {
+		t.Error("CreateQuote(\"8,99\") succeeded, expected an error")
+	}
 }
 
 // TestCreateQuoteFromCount verifies count-based quote generation.
 func TestCreateQuoteFromCount(t *testing.T) {
 	zeroQuote := CreateQuoteFromCount(0)
-	if zeroQuote.Dollars != 0 || zeroQuote.Cents != 0 {
-		t.Errorf("CreateQuoteFromCount(0) = %s, want $0.0", zeroQuote)
+	if !money.IsZero(zeroQuote) {
+		t.Errorf("CreateQuoteFromCount(0) = %s, want 0 USD", money.String(zeroQuote))
 	}
 
 	nonZeroQuote := CreateQuoteFromCount(5)
-	if nonZeroQuote.Dollars == 0 && nonZeroQuote.Cents == 0 {
-		t.Error("CreateQuoteFromCount(5) returned zero, expected a non-zero quote")
+	if got, want := money.String(nonZeroQuote), "8.99 USD"; got != want {
+		t.Errorf("CreateQuoteFromCount(5) = %s, want %s", got, want)
 	}
 }
 
@@ -195,12 +205,3 @@ func TestGetRandomNumber(t *testing.T) {
 		}
 	}
 }
-
-// TestQuoteString verifies the string representation of a Quote.
-func TestQuoteString(t *testing.T) {
-	q := Quote{Dollars: 8, Cents: 99}
-	expected := "$8.99"
-	if q.String() != expected {
-		t.Errorf("Quote.String() = '%s', want '%s'", q.String(), expected)
-	}
-}